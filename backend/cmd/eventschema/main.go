@@ -0,0 +1,22 @@
+// Command eventschema writes the real-time event catalog as a JSON Schema
+// document, the same one served at /api/realtime/schema, for client builds
+// that generate types without a running API.
+//
+//	go run ./cmd/eventschema > realtime-events.schema.json
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/kaori/backend/internal/events"
+)
+
+func main() {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(events.Schema()); err != nil {
+		log.Fatalf("Failed to write schema: %v", err)
+	}
+}
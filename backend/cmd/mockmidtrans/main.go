@@ -0,0 +1,485 @@
+// Command mockmidtrans is a local stand-in for the Midtrans Snap and Core APIs.
+// It takes charges, status checks and refunds the way Midtrans does, and sends
+// signed payment notifications to Kaori's callback when told a customer paid, so
+// the whole payment flow can be exercised without a sandbox account.
+//
+//	go run ./cmd/mockmidtrans -port 9091 -server-key SB-Mid-server-mock
+//
+// Point Kaori at it with MIDTRANS_BASE_URL=http://localhost:9091 and the same
+// MIDTRANS_SERVER_KEY, then settle a payment with
+//
+//	curl -X POST localhost:9091/_pay/<payment id> -d '{"status":"settlement"}'
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/kaori/backend/internal/payment"
+)
+
+// Transaction is a charge the mock holds, as Midtrans would report it
+type Transaction struct {
+	OrderID           string           `json:"order_id"`
+	TransactionID     string           `json:"transaction_id"`
+	GrossAmount       int              `json:"gross_amount"`
+	PaymentType       string           `json:"payment_type"`       // empty until a Snap customer picks a method
+	TransactionStatus string           `json:"transaction_status"` // pending, settlement, capture, deny, cancel, expire, (partial_)refund
+	FraudStatus       string           `json:"fraud_status,omitempty"`
+	SnapToken         string           `json:"snap_token,omitempty"`
+	EnabledPayments   []string         `json:"enabled_payments,omitempty"`
+	Refunds           []Refund         `json:"refunds"`
+	Request           json.RawMessage  `json:"request"`
+	Notifications     []NotificationAt `json:"notifications"`
+	CreatedAt         time.Time        `json:"created_at"`
+	UpdatedAt         time.Time        `json:"updated_at"`
+}
+
+// Refund is money returned from a transaction
+type Refund struct {
+	ChargebackID int64     `json:"refund_chargeback_id"`
+	RefundKey    string    `json:"refund_key"`
+	Amount       int       `json:"amount"`
+	Reason       string    `json:"reason"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NotificationAt is a notification the mock sent and how Kaori answered
+type NotificationAt struct {
+	Status       string    `json:"status"`
+	ResponseCode int       `json:"response_code"`
+	Error        string    `json:"error,omitempty"`
+	SentAt       time.Time `json:"sent_at"`
+}
+
+type mockServer struct {
+	mu           sync.Mutex
+	transactions map[string]*Transaction
+	serverKey    string
+	baseURL      string
+	callbackURL  string
+}
+
+func main() {
+	port := flag.Int("port", 9091, "port to listen on")
+	serverKey := flag.String("server-key", "SB-Mid-server-mock", "server key Kaori must authenticate with and notifications are signed with")
+	kaoriURL := flag.String("kaori", "http://localhost:8080", "Kaori API base URL for payment notifications")
+	flag.Parse()
+
+	s := &mockServer{
+		transactions: make(map[string]*Transaction),
+		serverKey:    *serverKey,
+		baseURL:      fmt.Sprintf("http://localhost:%d", *port),
+		callbackURL:  *kaoriURL + "/api/payments/midtrans/callback",
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := s.routes()
+
+	log.Printf("🧪 Mock Midtrans on :%d, notifying %s", *port, s.callbackURL)
+	log.Printf("   Transactions: GET /_transactions   Pay: POST /_pay/{order_id} {\"status\": \"settlement|capture|deny|cancel|expire\"}")
+	log.Printf("   Resend the last notification: POST /_notify/{order_id}")
+	if err := r.Run(fmt.Sprintf(":%d", *port)); err != nil {
+		log.Fatalf("Failed to start mock Midtrans: %v", err)
+	}
+}
+
+// routes serves the Midtrans APIs, the customer's pages and the mock's controls
+func (s *mockServer) routes() *gin.Engine {
+	r := gin.Default()
+
+	// Midtrans APIs, authenticated with the server key
+	authed := r.Group("/", s.authenticate)
+	authed.POST("/snap/v1/transactions", s.createSnap)
+	authed.POST("/v2/charge", s.charge)
+	authed.GET("/v2/:order_id/status", s.status)
+	authed.POST("/v2/:order_id/refund", s.refund)
+
+	// Pages the customer would be sent to
+	r.GET("/snap/v2/vtweb/:token", s.page)
+	r.GET("/v2/qris/:order_id/qr-code", s.page)
+	r.GET("/v2/deeplink/:order_id", s.page)
+	r.GET("/v2/3ds/:order_id", s.page)
+
+	// Mock controls
+	r.GET("/_transactions", s.listTransactions)
+	r.POST("/_pay/:order_id", s.pay)
+	r.POST("/_notify/:order_id", s.renotify)
+	return r
+}
+
+// authenticate checks the Basic auth server key, answering like Midtrans does
+func (s *mockServer) authenticate(c *gin.Context) {
+	if user, _, ok := c.Request.BasicAuth(); !ok || user != s.serverKey {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"status_code":    "401",
+			"status_message": "Unknown Merchant server_key/id",
+			"error_messages": []string{"Access denied due to unauthorized transaction, please check client or server key"},
+		})
+		return
+	}
+	c.Next()
+}
+
+type chargeBody struct {
+	PaymentType        string `json:"payment_type"`
+	TransactionDetails struct {
+		OrderID     string `json:"order_id"`
+		GrossAmount int    `json:"gross_amount"`
+	} `json:"transaction_details"`
+	ItemDetails []struct {
+		Price    int `json:"price"`
+		Quantity int `json:"quantity"`
+	} `json:"item_details"`
+	EnabledPayments []string `json:"enabled_payments"`
+	CreditCard      struct {
+		TokenID        string `json:"token_id"`
+		Authentication bool   `json:"authentication"`
+	} `json:"credit_card"`
+}
+
+// validate checks a charge the way Midtrans rejects them
+func (s *mockServer) validate(body []byte) (*chargeBody, []string) {
+	var req chargeBody
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, []string{"Invalid JSON"}
+	}
+	var errs []string
+	if req.TransactionDetails.OrderID == "" {
+		errs = append(errs, "transaction_details.order_id is required")
+	}
+	if req.TransactionDetails.GrossAmount < 1 {
+		errs = append(errs, "transaction_details.gross_amount must be greater than or equal to 1")
+	}
+	if len(req.ItemDetails) > 0 {
+		sum := 0
+		for _, it := range req.ItemDetails {
+			sum += it.Price * it.Quantity
+		}
+		if sum != req.TransactionDetails.GrossAmount {
+			errs = append(errs, "transaction_details.gross_amount is not equal to the sum of item_details")
+		}
+	}
+	if _, taken := s.transactions[req.TransactionDetails.OrderID]; taken {
+		errs = append(errs, "transaction_details.order_id has already been taken")
+	}
+	return &req, errs
+}
+
+func (s *mockServer) createSnap(c *gin.Context) {
+	body, _ := io.ReadAll(c.Request.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, errs := s.validate(body)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error_messages": errs})
+		return
+	}
+
+	token := uuid.New().String()
+	now := time.Now()
+	s.transactions[req.TransactionDetails.OrderID] = &Transaction{
+		OrderID:         req.TransactionDetails.OrderID,
+		TransactionID:   uuid.New().String(),
+		GrossAmount:     req.TransactionDetails.GrossAmount,
+		SnapToken:       token,
+		EnabledPayments: req.EnabledPayments,
+		Request:         body,
+		Refunds:         []Refund{},
+		Notifications:   []NotificationAt{},
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	c.JSON(http.StatusCreated, gin.H{"token": token, "redirect_url": s.baseURL + "/snap/v2/vtweb/" + token})
+}
+
+// charge answers with HTTP 200 even for declines, with the real code in
+// status_code, as the Core API does
+func (s *mockServer) charge(c *gin.Context) {
+	body, _ := io.ReadAll(c.Request.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	req, errs := s.validate(body)
+	if len(errs) > 0 {
+		code := "400"
+		if req != nil && len(errs) == 1 && errs[0] == "transaction_details.order_id has already been taken" {
+			code = "406"
+		}
+		c.JSON(http.StatusOK, gin.H{"status_code": code, "status_message": errs[0], "validation_messages": errs})
+		return
+	}
+
+	now := time.Now()
+	txn := &Transaction{
+		OrderID:           req.TransactionDetails.OrderID,
+		TransactionID:     uuid.New().String(),
+		GrossAmount:       req.TransactionDetails.GrossAmount,
+		PaymentType:       req.PaymentType,
+		TransactionStatus: "pending",
+		Request:           body,
+		Refunds:           []Refund{},
+		Notifications:     []NotificationAt{},
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	resp := gin.H{}
+	id := txn.OrderID
+	switch req.PaymentType {
+	case "qris":
+		resp["qr_string"] = "00020101021226620014COM.GO-JEK.WWW011893600914" + id
+		resp["actions"] = []gin.H{{"name": "generate-qr-code", "method": "GET", "url": s.baseURL + "/v2/qris/" + id + "/qr-code"}}
+	case "gopay", "shopeepay":
+		actions := []gin.H{{"name": "deeplink-redirect", "method": "GET", "url": s.baseURL + "/v2/deeplink/" + id}}
+		if req.PaymentType == "gopay" {
+			actions = append(actions, gin.H{"name": "generate-qr-code", "method": "GET", "url": s.baseURL + "/v2/qris/" + id + "/qr-code"})
+		}
+		resp["actions"] = actions
+	case "credit_card":
+		// Test tokens: "decline" is denied, anything else needs 3-D Secure if asked for, or is captured
+		switch {
+		case req.CreditCard.TokenID == "decline":
+			txn.TransactionStatus, txn.FraudStatus = "deny", "accept"
+		case req.CreditCard.Authentication:
+			resp["redirect_url"] = s.baseURL + "/v2/3ds/" + id
+		default:
+			txn.TransactionStatus, txn.FraudStatus = "capture", "accept"
+		}
+	default:
+		c.JSON(http.StatusOK, gin.H{"status_code": "400", "status_message": "payment_type is not supported: " + req.PaymentType})
+		return
+	}
+	s.transactions[id] = txn
+
+	for k, v := range s.report(txn) {
+		resp[k] = v
+	}
+	if txn.TransactionStatus == "pending" {
+		resp["expiry_time"] = txn.CreatedAt.Add(15 * time.Minute).In(wib).Format(midtransTime)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func (s *mockServer) status(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn := s.transactions[c.Param("order_id")]
+	if txn == nil || txn.PaymentType == "" {
+		// Snap transactions don't exist for the Core API until the customer picks a method
+		c.JSON(http.StatusNotFound, gin.H{"status_code": "404", "status_message": "Transaction doesn't exist."})
+		return
+	}
+	c.JSON(http.StatusOK, s.report(txn))
+}
+
+// refund returns some or all of a paid transaction. A refund key already used
+// gets the same answer again, as with Midtrans.
+func (s *mockServer) refund(c *gin.Context) {
+	var req struct {
+		RefundKey string `json:"refund_key"`
+		Amount    int    `json:"amount"`
+		Reason    string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusOK, gin.H{"status_code": "400", "status_message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn := s.transactions[c.Param("order_id")]
+	if txn == nil || txn.PaymentType == "" {
+		c.JSON(http.StatusOK, gin.H{"status_code": "404", "status_message": "Transaction doesn't exist."})
+		return
+	}
+	refunded := 0
+	for _, r := range txn.Refunds {
+		if req.RefundKey != "" && r.RefundKey == req.RefundKey {
+			c.JSON(http.StatusOK, s.refundReport(txn, r))
+			return
+		}
+		refunded += r.Amount
+	}
+	switch txn.TransactionStatus {
+	case "settlement", "capture", "partial_refund":
+	default:
+		c.JSON(http.StatusOK, gin.H{"status_code": "412", "status_message": "Merchant cannot modify the status of the transaction"})
+		return
+	}
+	if req.Amount == 0 {
+		req.Amount = txn.GrossAmount - refunded
+	}
+	if req.Amount < 1 || refunded+req.Amount > txn.GrossAmount {
+		c.JSON(http.StatusOK, gin.H{"status_code": "412", "status_message": "Refund amount is greater than the remaining amount"})
+		return
+	}
+
+	r := Refund{ChargebackID: time.Now().UnixNano() % 1e9, RefundKey: req.RefundKey, Amount: req.Amount, Reason: req.Reason, CreatedAt: time.Now()}
+	txn.Refunds = append(txn.Refunds, r)
+	txn.TransactionStatus = "partial_refund"
+	if refunded+req.Amount == txn.GrossAmount {
+		txn.TransactionStatus = "refund"
+	}
+	txn.UpdatedAt = time.Now()
+	c.JSON(http.StatusOK, s.refundReport(txn, r))
+}
+
+// refundReport is the answer to a refund. Callers hold s.mu.
+func (s *mockServer) refundReport(txn *Transaction, r Refund) gin.H {
+	report := s.report(txn)
+	report["status_code"] = "200"
+	report["status_message"] = "Success, refund request is approved"
+	report["refund_chargeback_id"] = r.ChargebackID
+	report["refund_amount"] = payment.FormatAmount(r.Amount)
+	report["refund_key"] = r.RefundKey
+	delete(report, "signature_key")
+	return report
+}
+
+func (s *mockServer) page(c *gin.Context) {
+	c.String(http.StatusOK, "Mock Midtrans payment page. Pay with POST /_pay/{order_id}.")
+}
+
+func (s *mockServer) listTransactions(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]*Transaction, 0, len(s.transactions))
+	for _, txn := range s.transactions {
+		result = append(result, txn)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.Before(result[j].CreatedAt) })
+	c.JSON(http.StatusOK, result)
+}
+
+// pay moves a transaction to a new status, as if the customer paid (or didn't),
+// and notifies Kaori. Snap transactions get a payment type on the way.
+func (s *mockServer) pay(c *gin.Context) {
+	var req struct {
+		Status      string `json:"status" binding:"required,oneof=pending settlement capture deny cancel expire"`
+		PaymentType string `json:"payment_type"`
+		FraudStatus string `json:"fraud_status" binding:"omitempty,oneof=accept challenge deny"`
+		Notify      *bool  `json:"notify"` // default true; false to simulate a lost notification
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	txn := s.transactions[c.Param("order_id")]
+	if txn == nil {
+		s.mu.Unlock()
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such transaction"})
+		return
+	}
+	if txn.PaymentType == "" {
+		txn.PaymentType = req.PaymentType
+		if txn.PaymentType == "" && len(txn.EnabledPayments) > 0 {
+			txn.PaymentType = txn.EnabledPayments[0]
+		}
+		if txn.PaymentType == "other_qris" || txn.PaymentType == "" {
+			txn.PaymentType = "qris"
+		}
+	}
+	txn.TransactionStatus = req.Status
+	txn.FraudStatus = req.FraudStatus
+	if req.Status == "capture" && txn.FraudStatus == "" {
+		txn.FraudStatus = "accept"
+	}
+	txn.UpdatedAt = time.Now()
+	s.mu.Unlock()
+
+	if req.Notify != nil && !*req.Notify {
+		c.JSON(http.StatusOK, gin.H{"notified": false})
+		return
+	}
+	s.notify(c, txn.OrderID)
+}
+
+// renotify sends the current status again, as Midtrans does until it gets a 200
+func (s *mockServer) renotify(c *gin.Context) {
+	s.mu.Lock()
+	txn := s.transactions[c.Param("order_id")]
+	s.mu.Unlock()
+	if txn == nil || txn.PaymentType == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no such transaction, or not paid yet"})
+		return
+	}
+	s.notify(c, txn.OrderID)
+}
+
+// notify posts a signed notification to Kaori and relays its answer
+func (s *mockServer) notify(c *gin.Context, orderID string) {
+	s.mu.Lock()
+	txn := s.transactions[orderID]
+	report := s.report(txn)
+	s.mu.Unlock()
+
+	body, _ := json.Marshal(report)
+	resp, err := http.Post(s.callbackURL, "application/json", bytes.NewReader(body))
+	sent := NotificationAt{Status: txn.TransactionStatus, SentAt: time.Now()}
+	if err != nil {
+		sent.Error = err.Error()
+	} else {
+		sent.ResponseCode = resp.StatusCode
+	}
+	s.mu.Lock()
+	txn.Notifications = append(txn.Notifications, sent)
+	s.mu.Unlock()
+
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", respBody)
+}
+
+// report is the transaction as the status API and notifications show it.
+// Callers hold s.mu.
+func (s *mockServer) report(txn *Transaction) gin.H {
+	statusCode := map[string]string{
+		"pending": "201", "settlement": "200", "capture": "200", "deny": "202", "cancel": "200", "expire": "407",
+		"refund": "200", "partial_refund": "200",
+	}[txn.TransactionStatus]
+	grossAmount := payment.FormatAmount(txn.GrossAmount)
+
+	report := gin.H{
+		"status_code":        statusCode,
+		"status_message":     "Success, transaction is found",
+		"transaction_id":     txn.TransactionID,
+		"order_id":           txn.OrderID,
+		"merchant_id":        "M-MOCK",
+		"gross_amount":       grossAmount,
+		"currency":           "IDR",
+		"payment_type":       txn.PaymentType,
+		"transaction_time":   txn.CreatedAt.In(wib).Format(midtransTime),
+		"transaction_status": txn.TransactionStatus,
+		"signature_key":      payment.MidtransSignature(txn.OrderID, statusCode, grossAmount, s.serverKey),
+	}
+	if txn.FraudStatus != "" {
+		report["fraud_status"] = txn.FraudStatus
+	}
+	if txn.TransactionStatus == "settlement" {
+		report["settlement_time"] = txn.UpdatedAt.In(wib).Format(midtransTime)
+	}
+	return report
+}
+
+// Midtrans reports times in Jakarta time without a zone
+const midtransTime = "2006-01-02 15:04:05"
+
+var wib = time.FixedZone("WIB", 7*60*60)
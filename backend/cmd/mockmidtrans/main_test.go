@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/kaori/backend/internal/payment"
+)
+
+const testServerKey = "SB-Mid-server-test"
+
+// newTestMock starts the mock and a client of it
+func newTestMock(t *testing.T) (*httptest.Server, *payment.Midtrans) {
+	t.Helper()
+	s := &mockServer{transactions: make(map[string]*Transaction), serverKey: testServerKey}
+	mock := httptest.NewServer(s.routes())
+	t.Cleanup(mock.Close)
+	s.baseURL = mock.URL
+	return mock, payment.NewMidtrans(testServerKey, false, mock.URL)
+}
+
+func TestVerifySignature(t *testing.T) {
+	mock, midtrans := newTestMock(t)
+	ref := uuid.New().String()
+	_, err := payment.NewMidtransProvider(midtrans).Create(context.Background(), payment.ChargeRequest{Ref: ref, Amount: 25000, Method: "qris", Channel: payment.ChannelCore})
+	if err != nil {
+		t.Fatalf("charge: %v", err)
+	}
+	body, _ := json.Marshal(map[string]interface{}{"status": "settlement", "notify": false})
+	resp, err := http.Post(mock.URL+"/_pay/"+ref, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	resp.Body.Close()
+
+	n, err := midtrans.GetStatus(context.Background(), ref)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if !midtrans.VerifySignature(n) {
+		t.Fatalf("signature from the mock was refused: %+v", n)
+	}
+
+	tampered := *n
+	tampered.SignatureKey = n.SignatureKey[:len(n.SignatureKey)-1] + "0"
+	if tampered.SignatureKey == n.SignatureKey {
+		tampered.SignatureKey = n.SignatureKey[:len(n.SignatureKey)-1] + "1"
+	}
+	if midtrans.VerifySignature(&tampered) {
+		t.Error("tampered signature_key was accepted")
+	}
+
+	tampered = *n
+	tampered.GrossAmount = "1.00"
+	if midtrans.VerifySignature(&tampered) {
+		t.Error("signature_key was accepted for a different gross_amount")
+	}
+
+	other := payment.NewMidtrans("SB-Mid-server-other", false, mock.URL)
+	if other.VerifySignature(n) {
+		t.Error("signature_key was accepted with another server key")
+	}
+}
@@ -0,0 +1,294 @@
+// Command mockplatform is a local stand-in for the GrabFood, GoFood and ShopeeFood
+// merchant APIs. It records the order updates, menu changes and store pauses Kaori
+// pushes, can fail a share of them to exercise the retry queues, and can send
+// sample orders, driver updates and cancellations to Kaori's webhooks.
+//
+//	go run ./cmd/mockplatform -port 9090 -fail-rate 0.3
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// ReceivedUpdate is a status update the mock received from Kaori
+type ReceivedUpdate struct {
+	Platform   string          `json:"platform"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Body       json.RawMessage `json:"body"`
+	Failed     bool            `json:"failed"`
+	ReceivedAt time.Time       `json:"received_at"`
+}
+
+type mockServer struct {
+	mu       sync.Mutex
+	received []ReceivedUpdate
+	failRate float64
+	kaoriURL string
+}
+
+func main() {
+	port := flag.Int("port", 9090, "port to listen on")
+	failRate := flag.Float64("fail-rate", 0, "share of updates to answer with 503 (0-1)")
+	kaoriURL := flag.String("kaori", "http://localhost:8080", "Kaori API base URL for sample orders")
+	flag.Parse()
+
+	s := &mockServer{failRate: *failRate, kaoriURL: *kaoriURL}
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.Default()
+
+	// GrabFood partner API
+	r.POST("/grabfood/partner/v1/order/prepare", s.record("grabfood"))
+	r.POST("/grabfood/partner/v1/orders/mark", s.record("grabfood"))
+	r.PUT("/grabfood/partner/v1/order/cancel", s.record("grabfood"))
+	r.PUT("/grabfood/partner/v1/batch/menu", s.record("grabfood"))
+	r.PUT("/grabfood/partner/v1/merchant/pause", s.record("grabfood"))
+
+	// GoFood (GoBiz) API
+	r.PUT("/gofood/v1/orders/:id/:action", s.record("gofood"))
+	r.PATCH("/gofood/v1/outlets/:id/catalog/items", s.record("gofood"))
+	r.PUT("/gofood/v1/outlets/:id/status", s.record("gofood"))
+
+	// ShopeeFood partner API
+	r.POST("/shopee/api/v1/order/update_status", s.record("shopee_food"))
+	r.POST("/shopee/api/v1/menu/item/update", s.record("shopee_food"))
+	r.POST("/shopee/api/v1/store/update_status", s.record("shopee_food"))
+
+	// Mock controls
+	r.GET("/_received", s.listReceived)
+	r.DELETE("/_received", s.clearReceived)
+	r.PUT("/_config", s.updateConfig)
+	r.POST("/_send/:platform", s.sendSampleOrder)
+	r.POST("/_send/:platform/driver", s.sendDriverEvent)
+	r.POST("/_send/:platform/cancel", s.sendCancellation)
+
+	log.Printf("🧪 Mock delivery platforms on :%d (fail rate %.0f%%)", *port, *failRate*100)
+	log.Printf("   Received updates: GET /_received   Sample order: POST /_send/{grabfood,gofood,shopee}")
+	log.Printf("   Driver update: POST /_send/{platform}/driver {\"order_id\": \"...\", \"status\": \"...\"}")
+	if err := r.Run(fmt.Sprintf(":%d", *port)); err != nil {
+		log.Fatalf("Failed to start mock platform: %v", err)
+	}
+}
+
+func (s *mockServer) record(platform string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		if !json.Valid(body) {
+			body = []byte("null")
+		}
+
+		s.mu.Lock()
+		failed := rand.Float64() < s.failRate
+		s.received = append(s.received, ReceivedUpdate{
+			Platform:   platform,
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			Body:       body,
+			Failed:     failed,
+			ReceivedAt: time.Now(),
+		})
+		s.mu.Unlock()
+
+		if failed {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "simulated outage"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	}
+}
+
+func (s *mockServer) listReceived(c *gin.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.JSON(http.StatusOK, s.received)
+}
+
+func (s *mockServer) clearReceived(c *gin.Context) {
+	s.mu.Lock()
+	s.received = nil
+	s.mu.Unlock()
+	c.Status(http.StatusNoContent)
+}
+
+func (s *mockServer) updateConfig(c *gin.Context) {
+	var req struct {
+		FailRate float64 `json:"fail_rate"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	s.mu.Lock()
+	s.failRate = req.FailRate
+	s.mu.Unlock()
+	c.JSON(http.StatusOK, gin.H{"fail_rate": req.FailRate})
+}
+
+// sendSampleOrder posts a platform-shaped order to Kaori's webhook
+func (s *mockServer) sendSampleOrder(c *gin.Context) {
+	platform := c.Param("platform")
+	id := uuid.New().String()[:8]
+
+	var payload interface{}
+	switch platform {
+	case "grabfood":
+		payload = gin.H{
+			"orderId": "GF-" + id, "customerName": "Budi", "customerPhone": "081200000001",
+			"address": "Jl. Sudirman No. 1",
+			"items": []gin.H{
+				{"itemId": "grab-latte", "name": "Iced Latte", "quantity": 2, "price": 31000},
+				{"itemId": "grab-croissant", "name": "Croissant", "quantity": 1, "price": 25000},
+			},
+			"driverName": "Agus", "total": 87000,
+		}
+	case "gofood":
+		payload = gin.H{
+			"transaction_id":   "GJ-" + id,
+			"customer":         gin.H{"name": "Sari", "phone": "081200000002"},
+			"delivery_address": "Jl. Thamrin No. 2",
+			"items": []gin.H{
+				{"sku": "gojek-cappuccino", "product_name": "Cappuccino", "variant": "Large", "qty": 1, "price": 36000},
+			},
+			"driver":       gin.H{"name": "Dedi"},
+			"total_amount": 36000,
+		}
+	case "shopee":
+		payload = gin.H{
+			"order_no": "SF-" + id, "buyer_name": "Rina", "buyer_phone": "081200000003",
+			"address": gin.H{"full": "Jl. Gatot Subroto No. 3"},
+			"order_items": []gin.H{
+				{"item_id": "shp-brownies", "item_name": "Brownies", "quantity": 2, "price": 28000},
+			},
+			"shipper_name": "Joko", "total_price": 56000,
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "platform must be grabfood, gofood or shopee"})
+		return
+	}
+
+	body, _ := json.Marshal(payload)
+	resp, err := http.Post(s.kaoriURL+"/api/webhooks/"+platform, "application/json", bytes.NewReader(body))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", respBody)
+}
+
+// sendDriverEvent posts a platform-shaped driver update for one of the platform's
+// order IDs. Status is in the platform's own vocabulary, e.g. DRIVER_ARRIVED for
+// GrabFood, driver_arrived for GoFood or ARRIVED_AT_SHOP for ShopeeFood.
+func (s *mockServer) sendDriverEvent(c *gin.Context) {
+	var req struct {
+		OrderID string `json:"order_id" binding:"required"`
+		Status  string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order_id and status are required"})
+		return
+	}
+
+	platform := c.Param("platform")
+	now := time.Now()
+	var payload interface{}
+	switch platform {
+	case "grabfood":
+		payload = gin.H{
+			"orderId": req.OrderID, "state": req.Status, "updatedAt": now.Format(time.RFC3339Nano),
+			"driver": gin.H{"name": "Agus", "phone": "081300000001", "licensePlate": "B 1234 GRB"},
+		}
+	case "gofood":
+		payload = gin.H{
+			"transaction_id": req.OrderID, "event": req.Status, "event_time": now.Format(time.RFC3339Nano),
+			"driver": gin.H{"name": "Dedi", "phone": "081300000002", "vehicle_number": "B 5678 GJK"},
+		}
+	case "shopee":
+		payload = gin.H{
+			"order_no": req.OrderID, "shipper_status": req.Status, "update_time": now.Unix(),
+			"shipper": gin.H{"name": "Joko", "phone": "081300000003", "plate_number": "B 9012 SPF"},
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "platform must be grabfood, gofood or shopee"})
+		return
+	}
+
+	body, _ := json.Marshal(payload)
+	resp, err := http.Post(s.kaoriURL+"/api/webhooks/"+platform+"/driver", "application/json", bytes.NewReader(body))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", respBody)
+}
+
+// sendCancellation posts a platform-shaped cancellation for one of the platform's
+// order IDs, cancelled by the customer unless "by" names someone else in the
+// platform's vocabulary (e.g. DRIVER, MERCHANT)
+func (s *mockServer) sendCancellation(c *gin.Context) {
+	var req struct {
+		OrderID string `json:"order_id" binding:"required"`
+		By      string `json:"by"`
+		Reason  string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order_id is required"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "Customer changed their mind"
+	}
+
+	platform := c.Param("platform")
+	now := time.Now()
+	var payload interface{}
+	switch platform {
+	case "grabfood":
+		if req.By == "" {
+			req.By = "CUSTOMER"
+		}
+		payload = gin.H{"orderId": req.OrderID, "cancelledBy": req.By, "reason": req.Reason, "cancelledAt": now.Format(time.RFC3339)}
+	case "gofood":
+		if req.By == "" {
+			req.By = "customer"
+		}
+		payload = gin.H{"transaction_id": req.OrderID, "cancelled_by": req.By, "reason": req.Reason, "cancelled_at": now.Format(time.RFC3339)}
+	case "shopee":
+		if req.By == "" {
+			req.By = "BUYER"
+		}
+		payload = gin.H{"order_no": req.OrderID, "cancel_by": req.By, "cancel_reason": req.Reason, "update_time": now.Unix()}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "platform must be grabfood, gofood or shopee"})
+		return
+	}
+
+	body, _ := json.Marshal(payload)
+	resp, err := http.Post(s.kaoriURL+"/api/webhooks/"+platform+"/cancel", "application/json", bytes.NewReader(body))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	c.Data(resp.StatusCode, "application/json", respBody)
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 
 	"github.com/kaori/backend/internal/config"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/eventbus"
 	"github.com/kaori/backend/internal/handler"
 	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/payment"
+	"github.com/kaori/backend/internal/webhooks"
 	"github.com/kaori/backend/internal/websocket"
 )
 
@@ -30,13 +38,65 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
-	// Initialize WebSocket hub
-	hub := websocket.NewHub()
+	// Initialize WebSocket hub, on a bus shared with other instances if configured
+	bus, err := newEventBus(cfg)
+	if err != nil {
+		log.Fatalf("Failed to start event bus: %v", err)
+	}
+	defer bus.Close()
+	hub := websocket.NewHub(bus, websocket.HubOptions{
+		QueueSize:        cfg.WSClientQueueSize,
+		SlowClientPolicy: cfg.WSSlowClientPolicy,
+	})
 	go hub.Run()
 
+	// Outbound order status updates to delivery platforms
+	outbox, err := delivery.NewOutbox(cfg.DeliveryOutboxFile, delivery.AdaptersFromConfig(cfg)...)
+	if err != nil {
+		log.Fatalf("Failed to load delivery outbox: %v", err)
+	}
+	go outbox.Run(context.Background())
+
+	// Menu availability, prices and store pauses pushed to delivery platforms
+	menuSync := delivery.NewMenuSync(delivery.AdaptersFromConfig(cfg)...)
+	go menuSync.Run(context.Background())
+
+	// Events sent on to merchant systems that subscribed to them
+	dispatcher, err := webhooks.NewDispatcher(cfg.WebhookDeliveryFile)
+	if err != nil {
+		log.Fatalf("Failed to load webhook deliveries: %v", err)
+	}
+	dispatcher.AllowPrivate = cfg.AppEnv == "development"
+	hub.OnPublish(dispatcher.Publish)
+	go dispatcher.Run(context.Background())
+
+	// Countdown and timeout for delivery orders waiting to be accepted
+	go delivery.NewAcceptanceWatcher(hub, outbox).Run(context.Background())
+
+	// Alert cashiers when an open store has no kitchen display online
+	go websocket.NewPresenceWatcher(hub, dummy.StoreIDs, func(storeID string, now time.Time) bool {
+		hours := dummy.GetOpeningHours(storeID)
+		return delivery.WithinHours(hours.OpensAt, hours.ClosesAt, now)
+	}).Run(context.Background())
+
+	// Pending digital payments whose callback never came
+	reconciler := payment.NewReconciler(hub, payment.ProvidersFromConfig(cfg),
+		time.Duration(cfg.PaymentCheckMinutes)*time.Minute, time.Duration(cfg.PaymentExpiryMinutes)*time.Minute)
+	go reconciler.Run(context.Background())
+
 	// Initialize handlers (using dummy data)
-	handlers := handler.NewHandlers(nil, hub)
-	deliveryHandler := handler.NewDeliveryHandler(hub)
+	handlers := handler.NewHandlers(nil, hub, outbox)
+	deliveryHandler := handler.NewDeliveryHandler(hub, outbox)
+	menuMappingHandler := handler.NewMenuMappingHandler()
+	payoutHandler := handler.NewPayoutHandler()
+	menuSyncHandler := handler.NewMenuSyncHandler(menuSync)
+	integrationHandler := handler.NewIntegrationHandler()
+	merchantWebhookHandler := handler.NewMerchantWebhookHandler(dispatcher, cfg.AppEnv == "development")
+	reconciliationHandler := handler.NewReconciliationHandler(reconciler)
+	shiftHandler := handler.NewShiftHandler()
+	realtimeHandler := handler.NewRealtimeHandler(hub, websocket.NewAuthenticator(cfg.JWTSecret, cfg.CORSAllowedOrigins, dummy.DefaultStoreID))
+	hub.HandleCommands(handlers.Order.HandleCommand)
+	webhookArchive := handler.NewWebhookArchiveHandler(time.Duration(cfg.WebhookRetentionDays) * 24 * time.Hour)
 
 	// Setup Gin router
 	if cfg.GinMode == "release" {
@@ -88,9 +148,19 @@ func main() {
 		// Delivery platform webhooks (public - they have their own auth)
 		webhooks := api.Group("/webhooks")
 		{
-			webhooks.POST("/grabfood", deliveryHandler.HandleGrabFood)
-			webhooks.POST("/gofood", deliveryHandler.HandleGoFood)
-			webhooks.POST("/shopee", deliveryHandler.HandleShopeeFood)
+			webhooks.POST("/grabfood", webhookArchive.Archive(dummy.SourceGrabFood, dummy.WebhookKindOrder, deliveryHandler.HandleGrabFood))
+			webhooks.POST("/gofood", webhookArchive.Archive(dummy.SourceGoFood, dummy.WebhookKindOrder, deliveryHandler.HandleGoFood))
+			webhooks.POST("/shopee", webhookArchive.Archive(dummy.SourceShopeeFood, dummy.WebhookKindOrder, deliveryHandler.HandleShopeeFood))
+			webhooks.POST("/grabfood/driver", webhookArchive.Archive(dummy.SourceGrabFood, dummy.WebhookKindDriver, deliveryHandler.HandleGrabFoodDriver))
+			webhooks.POST("/gofood/driver", webhookArchive.Archive(dummy.SourceGoFood, dummy.WebhookKindDriver, deliveryHandler.HandleGoFoodDriver))
+			webhooks.POST("/shopee/driver", webhookArchive.Archive(dummy.SourceShopeeFood, dummy.WebhookKindDriver, deliveryHandler.HandleShopeeFoodDriver))
+			webhooks.POST("/grabfood/cancel", webhookArchive.Archive(dummy.SourceGrabFood, dummy.WebhookKindCancel, deliveryHandler.HandleCancellation(dummy.SourceGrabFood)))
+			webhooks.POST("/grabfood/modify", webhookArchive.Archive(dummy.SourceGrabFood, dummy.WebhookKindModify, deliveryHandler.HandleModification(dummy.SourceGrabFood)))
+			webhooks.POST("/gofood/cancel", webhookArchive.Archive(dummy.SourceGoFood, dummy.WebhookKindCancel, deliveryHandler.HandleCancellation(dummy.SourceGoFood)))
+			webhooks.POST("/gofood/modify", webhookArchive.Archive(dummy.SourceGoFood, dummy.WebhookKindModify, deliveryHandler.HandleModification(dummy.SourceGoFood)))
+			webhooks.POST("/shopee/cancel", webhookArchive.Archive(dummy.SourceShopeeFood, dummy.WebhookKindCancel, deliveryHandler.HandleCancellation(dummy.SourceShopeeFood)))
+			webhooks.POST("/shopee/modify", webhookArchive.Archive(dummy.SourceShopeeFood, dummy.WebhookKindModify, deliveryHandler.HandleModification(dummy.SourceShopeeFood)))
+			webhooks.POST("/integrations/:slug", webhookArchive.ArchiveIntegration(deliveryHandler.HandleIntegration))
 		}
 
 		// Simulate order endpoint (for testing)
@@ -104,6 +174,9 @@ func main() {
 			protected.GET("/auth/me", handlers.Auth.Me)
 			protected.POST("/auth/logout", handlers.Auth.Logout)
 
+			// Single-use ticket for opening the WebSocket
+			protected.POST("/ws/ticket", realtimeHandler.IssueTicket)
+
 			// Stores
 			stores := protected.Group("/stores")
 			{
@@ -112,6 +185,9 @@ func main() {
 				stores.POST("", middleware.RequireRole("super_admin"), handlers.Store.Create)
 				stores.PUT("/:id", middleware.RequireRole("super_admin"), handlers.Store.Update)
 				stores.GET("/:id/stats", handlers.Store.GetStats)
+				stores.GET("/:id/devices/online", realtimeHandler.OnlineDevices)
+				stores.GET("/:id/delivery-pause", menuSyncHandler.GetPause)
+				stores.PUT("/:id/delivery-pause", middleware.RequireRole("cashier", "kitchen", "store_admin", "super_admin"), menuSyncHandler.SetPause)
 			}
 
 			// Tables
@@ -155,16 +231,35 @@ func main() {
 				orders.POST("", handlers.Order.Create)
 				orders.PATCH("/:id/confirm", middleware.RequireRole("cashier", "store_admin", "super_admin"), handlers.Order.Confirm)
 				orders.PATCH("/:id/status", handlers.Order.UpdateStatus)
+				orders.PATCH("/:id/acknowledge", handlers.Order.Acknowledge)
+				orders.PATCH("/:id/items/:itemId/ready", handlers.Order.MarkItemReady)
 				orders.POST("/:id/cancel", handlers.Order.Cancel)
+				orders.GET("/:id/payments", handlers.Payment.ListForOrder)
 				orders.POST("/sync", handlers.Order.SyncOffline)
 			}
 
+			// Cashier shifts
+			shifts := protected.Group("/shifts")
+			shifts.Use(middleware.RequireRole("cashier", "store_admin", "super_admin"))
+			{
+				shifts.POST("", shiftHandler.Open)
+				shifts.GET("", middleware.RequireRole("store_admin", "super_admin"), shiftHandler.List)
+				shifts.GET("/current", shiftHandler.Current)
+				shifts.GET("/:id", shiftHandler.Get)
+				shifts.POST("/:id/cash-movements", shiftHandler.AddCashMovement)
+				shifts.POST("/:id/close", shiftHandler.Close)
+				shifts.GET("/:id/report", shiftHandler.Report)
+			}
+
 			// Payments
 			payments := protected.Group("/payments")
 			{
+				payments.POST("", handlers.Payment.Create)
 				payments.POST("/cash", handlers.Payment.ProcessCash)
 				payments.POST("/midtrans", handlers.Payment.CreateMidtrans)
 				payments.GET("/:id/status", handlers.Payment.GetStatus)
+				payments.GET("/:id/refunds", handlers.Payment.ListRefunds)
+				payments.POST("/:id/refunds", middleware.RequireRole("store_admin", "super_admin"), handlers.Payment.Refund)
 			}
 
 			// Members
@@ -192,6 +287,8 @@ func main() {
 				reports.GET("/products", handlers.Report.GetProductSales)
 				reports.GET("/cashiers", handlers.Report.GetCashierSales)
 				reports.GET("/hourly", handlers.Report.GetHourly)
+				reports.GET("/delivery-payouts", payoutHandler.GetDeliveryPayouts)
+				reports.GET("/driver-wait", deliveryHandler.GetDriverWait)
 			}
 
 			// Users
@@ -203,20 +300,102 @@ func main() {
 				users.PUT("/:id", handlers.User.Update)
 				users.DELETE("/:id", handlers.User.Delete)
 			}
+
+			// Admin
+			admin := protected.Group("/admin")
+			admin.Use(middleware.RequireRole("store_admin", "super_admin"))
+			{
+				// Delivery platform menu mappings
+				mappings := admin.Group("/menu-mappings")
+				{
+					mappings.GET("", menuMappingHandler.List)
+					mappings.POST("", menuMappingHandler.Create)
+					mappings.GET("/suggestions", menuMappingHandler.Suggest)
+					mappings.GET("/unmapped", menuMappingHandler.ListUnmapped)
+					mappings.POST("/unmapped/:id/resolve", menuMappingHandler.ResolveUnmapped)
+					mappings.POST("/unmapped/:id/ignore", menuMappingHandler.IgnoreUnmapped)
+					mappings.PUT("/:id", menuMappingHandler.Update)
+					mappings.DELETE("/:id", menuMappingHandler.Delete)
+				}
+
+				// Outbound delivery platform updates (dead-letter list and retries)
+				admin.GET("/delivery/outbox", deliveryHandler.ListOutbox)
+				admin.POST("/delivery/outbox/:id/retry", deliveryHandler.RetryOutboxJob)
+
+				// Delivery order acceptance rules (per store, per platform)
+				admin.GET("/delivery/rules", deliveryHandler.ListRules)
+				admin.PUT("/delivery/rules/:platform", deliveryHandler.UpdateRule)
+
+				// Delivery commissions and settlement reconciliation
+				admin.GET("/delivery/commissions", payoutHandler.ListCommissions)
+				admin.POST("/delivery/commissions", payoutHandler.CreateCommission)
+				admin.DELETE("/delivery/commissions/:id", payoutHandler.DeleteCommission)
+				admin.GET("/delivery/settlements", payoutHandler.ListSettlements)
+				admin.POST("/delivery/settlements/import", payoutHandler.ImportSettlement)
+				admin.GET("/delivery/settlements/:id", payoutHandler.GetSettlement)
+
+				// Menu sync to delivery platforms (status, pending diff, forced sync)
+				admin.GET("/delivery/menu-sync", menuSyncHandler.ListStatus)
+				admin.GET("/delivery/menu-sync/:platform", menuSyncHandler.GetDiff)
+				admin.POST("/delivery/menu-sync/:platform/sync", menuSyncHandler.Sync)
+
+				// Archived inbound webhook payloads
+				admin.GET("/webhooks", webhookArchive.List)
+				admin.GET("/webhooks/:id", webhookArchive.Get)
+				admin.POST("/webhooks/:id/replay", webhookArchive.Replay)
+
+				// Aggregators onboarded through a declarative field mapping
+				admin.GET("/integrations", integrationHandler.List)
+				admin.POST("/integrations", integrationHandler.Create)
+				admin.POST("/integrations/test", integrationHandler.TestMapping)
+				admin.PUT("/integrations/:id", integrationHandler.Update)
+				admin.DELETE("/integrations/:id", integrationHandler.Delete)
+				admin.POST("/integrations/:id/test", integrationHandler.TestMapping)
+
+				// Events pushed to merchant systems (accounting, loyalty dashboards)
+				admin.GET("/webhook-subscriptions", merchantWebhookHandler.ListSubscriptions)
+				admin.POST("/webhook-subscriptions", merchantWebhookHandler.CreateSubscription)
+				admin.PUT("/webhook-subscriptions/:id", merchantWebhookHandler.UpdateSubscription)
+				admin.DELETE("/webhook-subscriptions/:id", merchantWebhookHandler.DeleteSubscription)
+				admin.GET("/webhook-deliveries", merchantWebhookHandler.ListDeliveries)
+				admin.GET("/webhook-deliveries/:id", merchantWebhookHandler.GetDelivery)
+				admin.POST("/webhook-deliveries/:id/replay", merchantWebhookHandler.ReplayDelivery)
+
+				// Real-time connections and how well they keep up
+				admin.GET("/realtime/stats", realtimeHandler.Stats)
+
+				// Payment providers and which one each store uses per method
+				admin.GET("/payment-providers", handlers.Payment.ListProviders)
+				admin.GET("/payment-routes", handlers.Payment.ListRoutes)
+				admin.PUT("/payment-routes/:method", handlers.Payment.UpdateRoute)
+				admin.GET("/payments/reconcile", reconciliationHandler.GetStatus)
+				admin.POST("/payments/reconcile", reconciliationHandler.Reconcile)
+				admin.GET("/payment-discrepancies", reconciliationHandler.ListDiscrepancies)
+				admin.POST("/payment-discrepancies/:id/review", reconciliationHandler.ReviewDiscrepancy)
+			}
 		}
 
-		// WebSocket for real-time updates
-		api.GET("/ws", func(c *gin.Context) {
-			websocket.ServeWS(hub, c.Writer, c.Request)
-		})
+		// WebSocket for real-time updates, authenticated with a ticket or a first auth message
+		api.GET("/ws", realtimeHandler.ServeWS)
+
+		// Server-Sent Events fallback for clients that can't open a WebSocket
+		api.GET("/events", realtimeHandler.ServeSSE)
+
+		// JSON Schema of every real-time event, for generating client types
+		api.GET("/realtime/schema", realtimeHandler.Schema)
 	}
 
-	// Midtrans webhook (public)
-	r.POST("/api/payments/midtrans/callback", handlers.Payment.MidtransCallback)
+	// Midtrans payment notifications (public - signed with our server key)
+	r.POST("/api/payments/midtrans/callback", webhookArchive.Archive("midtrans", dummy.WebhookKindPayment, handlers.Payment.MidtransCallback))
 
 	// Public table info for QR ordering
 	r.GET("/api/public/tables/:id", handlers.Table.GetPublicInfo)
 
+	// Customer order tracking page: a socket that only follows one order
+	r.POST("/api/public/orders/:id/ws-ticket", realtimeHandler.IssueOrderTicket)
+
+	webhookArchive.SetRouter(r)
+
 	// Start server
 	port := cfg.Port
 	if port == "" {
@@ -231,3 +410,14 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// newEventBus picks the real-time event bus from the config
+func newEventBus(cfg *config.Config) (eventbus.Bus, error) {
+	switch cfg.EventBus {
+	case "", "local":
+		return eventbus.NewLocal(), nil
+	case "postgres":
+		return eventbus.NewPostgres(cfg.EventBusURL)
+	}
+	return nil, fmt.Errorf("unknown EVENT_BUS %q, use local or postgres", cfg.EventBus)
+}
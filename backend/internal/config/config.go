@@ -22,6 +22,37 @@ type Config struct {
 	MidtransServerKey    string
 	MidtransClientKey    string
 	MidtransIsProduction bool
+	MidtransBaseURL      string // overrides the Midtrans hosts, e.g. for cmd/mockmidtrans
+
+	// Pending payments are checked with their provider after PaymentCheckMinutes,
+	// and expired after PaymentExpiryMinutes if still unpaid
+	PaymentCheckMinutes  int
+	PaymentExpiryMinutes int
+
+	// Delivery platforms (outbound status updates)
+	GrabFoodAPIURL     string
+	GrabFoodAPIKey     string
+	GoFoodAPIURL       string
+	GoFoodAPIKey       string
+	ShopeeFoodAPIURL   string
+	ShopeeFoodAPIKey   string
+	DeliveryOutboxFile string
+
+	// Outbound merchant webhooks waiting to be sent, and recently sent ones
+	WebhookDeliveryFile string
+
+	// Inbound webhook payload archive
+	WebhookRetentionDays int
+
+	// Real-time event bus: "local" for one instance, "postgres" to share events
+	// between instances through DATABASE_URL (or EVENT_BUS_URL)
+	EventBus    string
+	EventBusURL string
+
+	// Messages waiting per real-time client, and what happens to clients that
+	// fill their queue: "drop_oldest" or "disconnect"
+	WSClientQueueSize  int
+	WSSlowClientPolicy string
 
 	// CORS
 	CORSAllowedOrigins []string
@@ -41,6 +72,22 @@ func Load() *Config {
 		MidtransServerKey:    getEnv("MIDTRANS_SERVER_KEY", ""),
 		MidtransClientKey:    getEnv("MIDTRANS_CLIENT_KEY", ""),
 		MidtransIsProduction: getEnvBool("MIDTRANS_IS_PRODUCTION", false),
+		MidtransBaseURL:      getEnv("MIDTRANS_BASE_URL", ""),
+		PaymentCheckMinutes:  getEnvInt("PAYMENT_CHECK_MINUTES", 5),
+		PaymentExpiryMinutes: getEnvInt("PAYMENT_EXPIRY_MINUTES", 60),
+		GrabFoodAPIURL:       getEnv("GRABFOOD_API_URL", ""),
+		GrabFoodAPIKey:       getEnv("GRABFOOD_API_KEY", ""),
+		GoFoodAPIURL:         getEnv("GOFOOD_API_URL", ""),
+		GoFoodAPIKey:         getEnv("GOFOOD_API_KEY", ""),
+		ShopeeFoodAPIURL:     getEnv("SHOPEEFOOD_API_URL", ""),
+		ShopeeFoodAPIKey:     getEnv("SHOPEEFOOD_API_KEY", ""),
+		DeliveryOutboxFile:   getEnv("DELIVERY_OUTBOX_FILE", "data/delivery_outbox.json"),
+		WebhookDeliveryFile:  getEnv("WEBHOOK_DELIVERY_FILE", "data/webhook_deliveries.json"),
+		WebhookRetentionDays: getEnvInt("WEBHOOK_RETENTION_DAYS", 90),
+		EventBus:             getEnv("EVENT_BUS", "local"),
+		EventBusURL:          getEnv("EVENT_BUS_URL", getEnv("DATABASE_URL", "")),
+		WSClientQueueSize:    getEnvInt("WS_CLIENT_QUEUE_SIZE", 256),
+		WSSlowClientPolicy:   getEnv("WS_SLOW_CLIENT_POLICY", "drop_oldest"),
 		CORSAllowedOrigins:   getEnvSlice("CORS_ALLOWED_ORIGINS", []string{"http://localhost:3000"}),
 		AppName:              getEnv("APP_NAME", "Kaori POS"),
 		AppEnv:               getEnv("APP_ENV", "development"),
@@ -0,0 +1,204 @@
+package delivery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+// Acceptance decisions for new delivery orders
+const (
+	DecisionHold   = "hold" // wait for a cashier to confirm
+	DecisionAccept = "accept"
+	DecisionReject = "reject"
+)
+
+// Countdown alert levels, escalating as the platform's accept deadline approaches
+const (
+	AlertNormal   = "normal"
+	AlertWarning  = "warning"
+	AlertCritical = "critical"
+)
+
+const (
+	// warningShare and criticalShare are the fractions of the accept window left
+	// when the cashier alert escalates
+	warningShare  = 0.5
+	criticalShare = 0.2
+
+	countdownInterval = 5 * time.Second
+)
+
+// Decision is what the store's rule says to do with a new delivery order
+type Decision struct {
+	Action string
+	Reason string
+}
+
+// Decide applies a store's delivery rule to a new order. Out-of-stock rejections
+// win over auto-accept, so we never accept something the kitchen can't make.
+func Decide(rule dummy.DeliveryRule, order *dummy.Order, now time.Time) Decision {
+	if rule.AutoRejectOutOfStock {
+		for _, item := range order.Items {
+			if item.ProductID == "" {
+				continue
+			}
+			if p := dummy.FindProduct(item.ProductID); p != nil && !p.IsAvailable {
+				return Decision{Action: DecisionReject, Reason: "Out of stock: " + p.Name}
+			}
+		}
+	}
+
+	if rule.AutoAcceptDuringHours && WithinHours(rule.OpensAt, rule.ClosesAt, now) {
+		return Decision{Action: DecisionAccept, Reason: "Auto-accepted during opening hours"}
+	}
+	if rule.AutoAcceptMaxTotal > 0 && order.Total <= rule.AutoAcceptMaxTotal {
+		return Decision{Action: DecisionAccept, Reason: fmt.Sprintf("Auto-accepted: total at or below %d", rule.AutoAcceptMaxTotal)}
+	}
+	return Decision{Action: DecisionHold}
+}
+
+// WithinHours reports whether now falls between opensAt and closesAt ("HH:MM").
+// Windows that close after midnight (e.g. 18:00-02:00) are supported.
+func WithinHours(opensAt, closesAt string, now time.Time) bool {
+	opens, err1 := ParseClock(opensAt)
+	closes, err2 := ParseClock(closesAt)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if opens <= closes {
+		return minute >= opens && minute < closes
+	}
+	return minute >= opens || minute < closes
+}
+
+// ParseClock parses "HH:MM" into minutes after midnight
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// AlertLevel returns how urgent a pending order is given its accept window
+func AlertLevel(createdAt, deadline, now time.Time) string {
+	window := deadline.Sub(createdAt)
+	remaining := deadline.Sub(now)
+	switch {
+	case window <= 0 || remaining <= time.Duration(float64(window)*criticalShare):
+		return AlertCritical
+	case remaining <= time.Duration(float64(window)*warningShare):
+		return AlertWarning
+	}
+	return AlertNormal
+}
+
+// AcceptanceWatcher broadcasts accept countdowns for pending delivery orders to
+// cashier screens, escalates alerts as time runs out and rejects orders whose
+// deadline has passed (the platform will have cancelled them by then).
+type AcceptanceWatcher struct {
+	hub    *websocket.Hub
+	outbox *Outbox
+
+	levels   map[string]string
+	lastSent map[string]time.Time
+}
+
+// NewAcceptanceWatcher creates a new acceptance watcher
+func NewAcceptanceWatcher(hub *websocket.Hub, outbox *Outbox) *AcceptanceWatcher {
+	return &AcceptanceWatcher{
+		hub:      hub,
+		outbox:   outbox,
+		levels:   make(map[string]string),
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Run checks pending orders every second until ctx is cancelled
+func (w *AcceptanceWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			w.check(now)
+		}
+	}
+}
+
+func (w *AcceptanceWatcher) check(now time.Time) {
+	pending := make(map[string]bool)
+
+	for _, order := range dummy.GetOrdersByStatus("pending") {
+		if order.AcceptDeadline == nil {
+			continue
+		}
+		pending[order.ID] = true
+
+		if !now.Before(*order.AcceptDeadline) {
+			w.expire(order)
+			continue
+		}
+
+		level := AlertLevel(order.CreatedAt, *order.AcceptDeadline, now)
+		timer := events.AcceptTimer{
+			OrderID:     order.ID,
+			OrderNumber: order.OrderNumber,
+			OrderSource: order.OrderSource,
+			Deadline:    *order.AcceptDeadline,
+			SecondsLeft: int(order.AcceptDeadline.Sub(now).Seconds()),
+			AlertLevel:  level,
+		}
+
+		if level != w.levels[order.ID] {
+			w.levels[order.ID] = level
+			w.lastSent[order.ID] = now
+			w.hub.Publish(websocket.ToStore(order.StoreID), events.OrderAcceptAlert{AcceptTimer: timer})
+		} else if now.Sub(w.lastSent[order.ID]) >= countdownInterval {
+			w.lastSent[order.ID] = now
+			w.hub.Publish(websocket.ToStore(order.StoreID), events.OrderAcceptCountdown{AcceptTimer: timer})
+		}
+	}
+
+	// Forget orders that were accepted, rejected or expired
+	for id := range w.levels {
+		if !pending[id] {
+			delete(w.levels, id)
+			delete(w.lastSent, id)
+		}
+	}
+}
+
+func (w *AcceptanceWatcher) expire(order dummy.Order) {
+	const reason = "Not accepted before the platform deadline"
+	expired := false
+	dummy.UpdateOrder(order.ID, func(o *dummy.Order) {
+		// A cashier may have confirmed it since we listed pending orders
+		if o.Status == "pending" {
+			o.Status = "cancelled"
+			o.StatusReason = reason
+			expired = true
+		}
+	})
+	if !expired {
+		return
+	}
+
+	log.Printf("Delivery order %s expired without being accepted", order.OrderNumber)
+	w.outbox.EnqueueOrderEvent(&order, EventRejected, reason)
+	w.hub.Publish(websocket.ToOrder(order.StoreID, order.ID), events.OrderAcceptExpired{
+		OrderID:     order.ID,
+		OrderNumber: order.OrderNumber,
+		Status:      "cancelled",
+		Reason:      reason,
+	})
+}
@@ -0,0 +1,300 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/config"
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Order events pushed to delivery platforms
+const (
+	EventAccepted  = "accepted"
+	EventRejected  = "rejected"
+	EventReady     = "ready"
+	EventCancelled = "cancelled"
+)
+
+// StatusUpdate is an order state change we report back to a platform
+type StatusUpdate struct {
+	ExternalOrderID string    `json:"external_order_id"`
+	OrderNumber     string    `json:"order_number"`
+	Event           string    `json:"event"`
+	Reason          string    `json:"reason,omitempty"`
+	OccurredAt      time.Time `json:"occurred_at"`
+}
+
+// Adapter talks to one delivery platform's merchant API
+type Adapter interface {
+	Platform() string
+	PushStatus(ctx context.Context, update StatusUpdate) error
+
+	// PushMenu sends menu item changes (price, name, availability, removals)
+	PushMenu(ctx context.Context, storeID string, changes []MenuChange) error
+
+	// SetPaused stops or resumes new orders for a store on the platform
+	SetPaused(ctx context.Context, storeID string, paused bool, reason string) error
+
+	// ParseCancellation and ParseModification read the platform's webhooks for
+	// orders cancelled or changed on its side
+	ParseCancellation(body []byte) (*Cancellation, error)
+	ParseModification(body []byte) (*Modification, error)
+}
+
+// ErrUnsupportedEvent is returned by adapters for status events their platform
+// has no API for. Sending it again won't help, so the outbox dead-letters it.
+var ErrUnsupportedEvent = errors.New("unsupported event")
+
+// PushError is returned when a platform rejects or fails a request
+type PushError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *PushError) Error() string {
+	return fmt.Sprintf("platform responded %d: %s", e.StatusCode, e.Body)
+}
+
+// Retryable reports whether sending the same request again could succeed.
+// Client errors other than timeouts and rate limits will fail the same way every time.
+func (e *PushError) Retryable() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests
+}
+
+// AdaptersFromConfig builds an adapter for every platform that has an API URL configured
+func AdaptersFromConfig(cfg *config.Config) []Adapter {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var adapters []Adapter
+	if cfg.GrabFoodAPIURL != "" {
+		adapters = append(adapters, &GrabFoodAdapter{api: newAPIClient(client, cfg.GrabFoodAPIURL, cfg.GrabFoodAPIKey)})
+	}
+	if cfg.GoFoodAPIURL != "" {
+		adapters = append(adapters, &GoFoodAdapter{api: newAPIClient(client, cfg.GoFoodAPIURL, cfg.GoFoodAPIKey)})
+	}
+	if cfg.ShopeeFoodAPIURL != "" {
+		adapters = append(adapters, &ShopeeFoodAdapter{api: newAPIClient(client, cfg.ShopeeFoodAPIURL, cfg.ShopeeFoodAPIKey)})
+	}
+	return adapters
+}
+
+// apiClient sends authenticated JSON requests to a platform
+type apiClient struct {
+	http    *http.Client
+	baseURL string
+	apiKey  string
+}
+
+func newAPIClient(client *http.Client, baseURL, apiKey string) *apiClient {
+	return &apiClient{http: client, baseURL: strings.TrimRight(baseURL, "/"), apiKey: apiKey}
+}
+
+func (c *apiClient) send(ctx context.Context, method, path string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return &PushError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	return nil
+}
+
+// --- GrabFood ---
+
+// GrabFoodAdapter pushes order states to the GrabFood partner API
+type GrabFoodAdapter struct {
+	api *apiClient
+}
+
+func (a *GrabFoodAdapter) Platform() string { return dummy.SourceGrabFood }
+
+func (a *GrabFoodAdapter) PushStatus(ctx context.Context, update StatusUpdate) error {
+	switch update.Event {
+	case EventAccepted, EventRejected:
+		toState := "Accepted"
+		if update.Event == EventRejected {
+			toState = "Rejected"
+		}
+		return a.api.send(ctx, http.MethodPost, "/partner/v1/order/prepare", map[string]string{
+			"orderID": update.ExternalOrderID,
+			"toState": toState,
+		})
+	case EventReady:
+		return a.api.send(ctx, http.MethodPost, "/partner/v1/orders/mark", map[string]interface{}{
+			"orderID":    update.ExternalOrderID,
+			"markStatus": 1,
+		})
+	case EventCancelled:
+		return a.api.send(ctx, http.MethodPut, "/partner/v1/order/cancel", map[string]string{
+			"orderID": update.ExternalOrderID,
+			"reason":  update.Reason,
+		})
+	}
+	return fmt.Errorf("grabfood: %w %q", ErrUnsupportedEvent, update.Event)
+}
+
+func (a *GrabFoodAdapter) PushMenu(ctx context.Context, storeID string, changes []MenuChange) error {
+	entities := make([]map[string]interface{}, len(changes))
+	for i, ch := range changes {
+		status := "AVAILABLE"
+		switch {
+		case ch.Change == MenuRemoved:
+			status = "HIDE"
+		case !ch.Item.Available:
+			status = "UNAVAILABLE"
+		}
+		entities[i] = map[string]interface{}{
+			"id":              ch.Item.ExternalID,
+			"name":            ch.Item.Name,
+			"price":           ch.Item.Price,
+			"availableStatus": status,
+		}
+	}
+	return a.api.send(ctx, http.MethodPut, "/partner/v1/batch/menu", map[string]interface{}{
+		"merchantID":   storeID,
+		"field":        "ITEM",
+		"menuEntities": entities,
+	})
+}
+
+func (a *GrabFoodAdapter) SetPaused(ctx context.Context, storeID string, paused bool, reason string) error {
+	return a.api.send(ctx, http.MethodPut, "/partner/v1/merchant/pause", map[string]interface{}{
+		"merchantID": storeID,
+		"isPause":    paused,
+		"reason":     reason,
+	})
+}
+
+// --- GoFood ---
+
+// GoFoodAdapter pushes order states to the GoBiz (GoFood) integration API
+type GoFoodAdapter struct {
+	api *apiClient
+}
+
+func (a *GoFoodAdapter) Platform() string { return dummy.SourceGoFood }
+
+func (a *GoFoodAdapter) PushStatus(ctx context.Context, update StatusUpdate) error {
+	action := map[string]string{
+		EventAccepted:  "accepted",
+		EventRejected:  "rejected",
+		EventReady:     "food-prepared",
+		EventCancelled: "cancelled",
+	}[update.Event]
+	if action == "" {
+		return fmt.Errorf("gofood: %w %q", ErrUnsupportedEvent, update.Event)
+	}
+	return a.api.send(ctx, http.MethodPut, "/v1/orders/"+update.ExternalOrderID+"/"+action, map[string]string{
+		"reason": update.Reason,
+	})
+}
+
+func (a *GoFoodAdapter) PushMenu(ctx context.Context, storeID string, changes []MenuChange) error {
+	items := make([]map[string]interface{}, len(changes))
+	for i, ch := range changes {
+		items[i] = map[string]interface{}{
+			"external_id": ch.Item.ExternalID,
+			"name":        ch.Item.Name,
+			"price":       ch.Item.Price,
+			"in_stock":    ch.Item.Available,
+			"active":      ch.Change != MenuRemoved,
+		}
+	}
+	return a.api.send(ctx, http.MethodPatch, "/v1/outlets/"+storeID+"/catalog/items", map[string]interface{}{
+		"items": items,
+	})
+}
+
+func (a *GoFoodAdapter) SetPaused(ctx context.Context, storeID string, paused bool, reason string) error {
+	status := "open"
+	if paused {
+		status = "closed"
+	}
+	return a.api.send(ctx, http.MethodPut, "/v1/outlets/"+storeID+"/status", map[string]string{
+		"status": status,
+		"reason": reason,
+	})
+}
+
+// --- ShopeeFood ---
+
+// ShopeeFoodAdapter pushes order states to the ShopeeFood partner API
+type ShopeeFoodAdapter struct {
+	api *apiClient
+}
+
+func (a *ShopeeFoodAdapter) Platform() string { return dummy.SourceShopeeFood }
+
+func (a *ShopeeFoodAdapter) PushStatus(ctx context.Context, update StatusUpdate) error {
+	status := map[string]string{
+		EventAccepted:  "ACCEPTED",
+		EventRejected:  "REJECTED",
+		EventReady:     "READY_FOR_PICKUP",
+		EventCancelled: "CANCELLED",
+	}[update.Event]
+	if status == "" {
+		return fmt.Errorf("shopee_food: %w %q", ErrUnsupportedEvent, update.Event)
+	}
+	return a.api.send(ctx, http.MethodPost, "/api/v1/order/update_status", map[string]interface{}{
+		"order_no":    update.ExternalOrderID,
+		"status":      status,
+		"reason":      update.Reason,
+		"update_time": update.OccurredAt.Unix(),
+	})
+}
+
+func (a *ShopeeFoodAdapter) PushMenu(ctx context.Context, storeID string, changes []MenuChange) error {
+	items := make([]map[string]interface{}, len(changes))
+	for i, ch := range changes {
+		stock := "IN_STOCK"
+		if !ch.Item.Available {
+			stock = "OUT_OF_STOCK"
+		}
+		items[i] = map[string]interface{}{
+			"item_id":      ch.Item.ExternalID,
+			"item_name":    ch.Item.Name,
+			"price":        ch.Item.Price,
+			"stock_status": stock,
+			"is_deleted":   ch.Change == MenuRemoved,
+		}
+	}
+	return a.api.send(ctx, http.MethodPost, "/api/v1/menu/item/update", map[string]interface{}{
+		"store_id": storeID,
+		"items":    items,
+	})
+}
+
+func (a *ShopeeFoodAdapter) SetPaused(ctx context.Context, storeID string, paused bool, reason string) error {
+	status := "OPEN"
+	if paused {
+		status = "PAUSED"
+	}
+	return a.api.send(ctx, http.MethodPost, "/api/v1/store/update_status", map[string]string{
+		"store_id": storeID,
+		"status":   status,
+		"reason":   reason,
+	})
+}
@@ -0,0 +1,282 @@
+package delivery
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// MenuLine is one order item as described by a delivery platform
+type MenuLine struct {
+	ExternalID string
+	Name       string
+	Variant    string
+	Modifiers  []string
+}
+
+// Miss is a part of a MenuLine that could not be matched to our catalog
+type Miss struct {
+	Kind       string
+	ExternalID string
+	Name       string
+	ProductID  string
+}
+
+// ResolvedLine is a MenuLine matched against our catalog
+type ResolvedLine struct {
+	ProductID   string
+	ProductName string
+	VariantID   string
+	VariantName string
+	ModifierIDs []string
+	Misses      []Miss
+}
+
+// Suggestion is a catalog entry that looks like a platform menu name
+type Suggestion struct {
+	ProductID    string  `json:"product_id"`
+	ProductName  string  `json:"product_name"`
+	VariantID    string  `json:"variant_id,omitempty"`
+	VariantName  string  `json:"variant_name,omitempty"`
+	ModifierID   string  `json:"modifier_id,omitempty"`
+	ModifierName string  `json:"modifier_name,omitempty"`
+	Score        float64 `json:"score"`
+}
+
+// minSuggestionScore filters out suggestions that are mostly noise
+const minSuggestionScore = 0.45
+
+// Resolve matches a platform item against admin mappings first, then exact catalog names.
+// Anything left over is reported in Misses so the caller can queue it for an admin.
+func Resolve(platform string, line MenuLine) ResolvedLine {
+	result := ResolvedLine{ProductName: line.Name, VariantName: line.Variant}
+
+	product, variant := resolveProduct(platform, line)
+	if product == nil {
+		result.Misses = append(result.Misses, Miss{Kind: dummy.MappingKindItem, ExternalID: line.ExternalID, Name: line.Name})
+		return result
+	}
+	result.ProductID = product.ID
+	result.ProductName = product.Name
+
+	if variant == nil && line.Variant != "" {
+		variant = resolveVariant(platform, product, line.Variant)
+		if variant == nil {
+			result.Misses = append(result.Misses, Miss{Kind: dummy.MappingKindVariant, Name: line.Variant, ProductID: product.ID})
+		}
+	}
+	if variant != nil {
+		result.VariantID = variant.ID
+		result.VariantName = variant.Name
+	}
+
+	for _, name := range line.Modifiers {
+		modifier := resolveModifier(platform, product, name)
+		if modifier == nil {
+			result.Misses = append(result.Misses, Miss{Kind: dummy.MappingKindModifier, Name: name, ProductID: product.ID})
+			continue
+		}
+		result.ModifierIDs = append(result.ModifierIDs, modifier.ID)
+	}
+
+	return result
+}
+
+func resolveProduct(platform string, line MenuLine) (*dummy.Product, *dummy.Variant) {
+	if m := dummy.FindMenuMapping(platform, dummy.MappingKindItem, line.ExternalID, line.Name, ""); m != nil {
+		product := dummy.FindProduct(m.ProductID)
+		if product != nil {
+			return product, findVariant(product, m.VariantID)
+		}
+	}
+
+	// Fall back to exact catalog names, including "Iced Latte" style variant prefixes
+	name := dummy.NormalizeMenuName(line.Name)
+	products := dummy.ListProducts()
+	for i := range products {
+		p := &products[i]
+		productName := dummy.NormalizeMenuName(p.Name)
+		if productName == name {
+			return p, nil
+		}
+		for j := range p.Variants {
+			v := &p.Variants[j]
+			variantName := dummy.NormalizeMenuName(v.Name)
+			if name == variantName+" "+productName || name == productName+" "+variantName {
+				return p, v
+			}
+		}
+	}
+	return nil, nil
+}
+
+func resolveVariant(platform string, product *dummy.Product, name string) *dummy.Variant {
+	if m := dummy.FindMenuMapping(platform, dummy.MappingKindVariant, "", name, product.ID); m != nil {
+		if v := findVariant(product, m.VariantID); v != nil {
+			return v
+		}
+	}
+	normalized := dummy.NormalizeMenuName(name)
+	for i := range product.Variants {
+		if dummy.NormalizeMenuName(product.Variants[i].Name) == normalized {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+func resolveModifier(platform string, product *dummy.Product, name string) *dummy.Modifier {
+	if m := dummy.FindMenuMapping(platform, dummy.MappingKindModifier, "", name, product.ID); m != nil {
+		if mod := findModifier(product, m.ModifierID); mod != nil {
+			return mod
+		}
+	}
+	normalized := dummy.NormalizeMenuName(name)
+	for i := range product.Modifiers {
+		if dummy.NormalizeMenuName(product.Modifiers[i].Name) == normalized {
+			return &product.Modifiers[i]
+		}
+	}
+	return nil
+}
+
+func findVariant(product *dummy.Product, variantID string) *dummy.Variant {
+	for i := range product.Variants {
+		if product.Variants[i].ID == variantID {
+			return &product.Variants[i]
+		}
+	}
+	return nil
+}
+
+func findModifier(product *dummy.Product, modifierID string) *dummy.Modifier {
+	for i := range product.Modifiers {
+		if product.Modifiers[i].ID == modifierID {
+			return &product.Modifiers[i]
+		}
+	}
+	return nil
+}
+
+// Suggest returns the catalog entries most similar to a platform name.
+// For variant and modifier kinds the search is limited to productID's options when set.
+func Suggest(kind, name, productID string, limit int) []Suggestion {
+	var candidates []Suggestion
+	var labels []string
+
+	for _, p := range dummy.ListProducts() {
+		if productID != "" && kind != dummy.MappingKindItem && p.ID != productID {
+			continue
+		}
+		switch kind {
+		case dummy.MappingKindVariant:
+			for _, v := range p.Variants {
+				candidates = append(candidates, Suggestion{ProductID: p.ID, ProductName: p.Name, VariantID: v.ID, VariantName: v.Name})
+				labels = append(labels, v.Name)
+			}
+		case dummy.MappingKindModifier:
+			for _, m := range p.Modifiers {
+				candidates = append(candidates, Suggestion{ProductID: p.ID, ProductName: p.Name, ModifierID: m.ID, ModifierName: m.Name})
+				labels = append(labels, m.Name)
+			}
+		default:
+			candidates = append(candidates, Suggestion{ProductID: p.ID, ProductName: p.Name})
+			labels = append(labels, p.Name)
+			for _, v := range p.Variants {
+				candidates = append(candidates, Suggestion{ProductID: p.ID, ProductName: p.Name, VariantID: v.ID, VariantName: v.Name})
+				labels = append(labels, v.Name+" "+p.Name)
+			}
+		}
+	}
+
+	suggestions := []Suggestion{}
+	for i, candidate := range candidates {
+		candidate.Score = similarity(name, labels[i])
+		if candidate.Score >= minSuggestionScore {
+			suggestions = append(suggestions, candidate)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Score > suggestions[j].Score
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// similarity scores two menu names between 0 and 1 using the better of
+// edit distance and word overlap, so both typos and reordered words match
+func similarity(a, b string) float64 {
+	a, b = simplify(a), simplify(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+
+	longest := len([]rune(a))
+	if n := len([]rune(b)); n > longest {
+		longest = n
+	}
+	editScore := 1 - float64(levenshtein(a, b))/float64(longest)
+
+	wordsA, wordsB := strings.Fields(a), strings.Fields(b)
+	shared := 0
+	for _, wa := range wordsA {
+		for _, wb := range wordsB {
+			if wa == wb || (len(wa) > 3 && len(wb) > 3 && levenshtein(wa, wb) <= 1) {
+				shared++
+				break
+			}
+		}
+	}
+	wordScore := 2 * float64(shared) / float64(len(wordsA)+len(wordsB))
+
+	if wordScore > editScore {
+		return round2(wordScore)
+	}
+	return round2(editScore)
+}
+
+// simplify lowercases and strips punctuation so "Latte (Iced)" matches "iced latte"
+func simplify(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func round2(f float64) float64 {
+	return float64(int(f*100+0.5)) / 100
+}
@@ -0,0 +1,78 @@
+package delivery
+
+import (
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Each platform's names for the driver stages
+var driverStages = map[string]map[string]string{
+	dummy.SourceGrabFood: {
+		"DRIVER_ALLOCATED": dummy.DriverAssigned,
+		"DRIVER_ARRIVING":  dummy.DriverArriving,
+		"DRIVER_ARRIVED":   dummy.DriverArrived,
+		"COLLECTED":        dummy.DriverPickedUp,
+		"DELIVERED":        dummy.DriverDelivered,
+	},
+	dummy.SourceGoFood: {
+		"driver_found":      dummy.DriverAssigned,
+		"driver_otw_pickup": dummy.DriverArriving,
+		"driver_arrived":    dummy.DriverArrived,
+		"picked_up":         dummy.DriverPickedUp,
+		"completed":         dummy.DriverDelivered,
+	},
+	dummy.SourceShopeeFood: {
+		"ASSIGNED":        dummy.DriverAssigned,
+		"HEADING_TO_SHOP": dummy.DriverArriving,
+		"ARRIVED_AT_SHOP": dummy.DriverArrived,
+		"PICKED_UP":       dummy.DriverPickedUp,
+		"DELIVERED":       dummy.DriverDelivered,
+	},
+}
+
+// DriverStage translates a platform's driver status into our stage. Our own stage
+// names are accepted too, so mapped integrations can send them directly.
+func DriverStage(platform, status string) (string, bool) {
+	if stage, ok := driverStages[platform][status]; ok {
+		return stage, true
+	}
+	stage := strings.ToLower(strings.TrimSpace(status))
+	return stage, dummy.IsDriverStage(stage)
+}
+
+// DriverWait compares when the driver arrived with when the food was ready.
+// Exactly one of DriverWaited and FoodWaited is non-zero: either the driver
+// stood at the counter waiting for the kitchen, or the food sat on the shelf.
+type DriverWait struct {
+	ArrivedAt    time.Time
+	ReadyAt      time.Time
+	PickedUpAt   *time.Time
+	DriverWaited time.Duration
+	FoodWaited   time.Duration
+}
+
+// WaitFor works out the driver wait for an order, or returns false until both
+// the driver's arrival and the food-ready time are known. A driver who picked
+// up without an arrival event is taken to have arrived at pickup.
+func WaitFor(order *dummy.Order) (DriverWait, bool) {
+	if order.Driver == nil || order.ReadyAt == nil {
+		return DriverWait{}, false
+	}
+	arrived := order.Driver.ArrivedAt
+	if arrived == nil {
+		arrived = order.Driver.PickedUpAt
+	}
+	if arrived == nil {
+		return DriverWait{}, false
+	}
+
+	w := DriverWait{ArrivedAt: *arrived, ReadyAt: *order.ReadyAt, PickedUpAt: order.Driver.PickedUpAt}
+	if w.ReadyAt.After(w.ArrivedAt) {
+		w.DriverWaited = w.ReadyAt.Sub(w.ArrivedAt)
+	} else {
+		w.FoodWaited = w.ArrivedAt.Sub(w.ReadyAt)
+	}
+	return w, true
+}
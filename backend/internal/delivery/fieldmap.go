@@ -0,0 +1,331 @@
+package delivery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FieldMapping describes where an aggregator's webhook payload keeps each order
+// field, as JSONPath-style expressions. Item fields are relative to each item
+// matched by Items.Path and may start with either $ or @.
+//
+//	order_id: $.order.id
+//	customer_name: $.order.customer.name
+//	total: $.order.grand_total
+//	items:
+//	  path: $.order.lines[*]
+//	  external_id: "@.sku"
+//	  name: "@.title"
+//	  modifiers: "@.extras[*].name"
+//	  quantity: "@.qty"
+//	  price: "@.unit_price"
+type FieldMapping struct {
+	OrderID       string           `json:"order_id" yaml:"order_id"`
+	CustomerName  string           `json:"customer_name,omitempty" yaml:"customer_name"`
+	CustomerPhone string           `json:"customer_phone,omitempty" yaml:"customer_phone"`
+	Address       string           `json:"address,omitempty" yaml:"address"`
+	DriverName    string           `json:"driver_name,omitempty" yaml:"driver_name"`
+	Notes         string           `json:"notes,omitempty" yaml:"notes"`
+	Total         string           `json:"total,omitempty" yaml:"total"`
+	MerchantPromo string           `json:"merchant_promo,omitempty" yaml:"merchant_promo"`
+	PlatformPromo string           `json:"platform_promo,omitempty" yaml:"platform_promo"`
+	Items         ItemFieldMapping `json:"items" yaml:"items"`
+}
+
+// ItemFieldMapping locates the order lines and their fields
+type ItemFieldMapping struct {
+	Path       string `json:"path" yaml:"path"`
+	ExternalID string `json:"external_id,omitempty" yaml:"external_id"`
+	Name       string `json:"name" yaml:"name"`
+	Variant    string `json:"variant,omitempty" yaml:"variant"`
+	Modifiers  string `json:"modifiers,omitempty" yaml:"modifiers"`
+	Quantity   string `json:"quantity,omitempty" yaml:"quantity"` // defaults to 1
+	Price      string `json:"price" yaml:"price"`
+	Notes      string `json:"notes,omitempty" yaml:"notes"`
+}
+
+// MappedOrder is a payload translated through a field mapping
+type MappedOrder struct {
+	ExternalOrderID string       `json:"external_order_id"`
+	CustomerName    string       `json:"customer_name"`
+	CustomerPhone   string       `json:"customer_phone"`
+	Address         string       `json:"address"`
+	DriverName      string       `json:"driver_name"`
+	Notes           string       `json:"notes,omitempty"`
+	Total           int          `json:"total"`
+	MerchantPromo   int          `json:"merchant_promo"`
+	PlatformPromo   int          `json:"platform_promo"`
+	Items           []MappedItem `json:"items"`
+}
+
+// MappedItem is one order line read from a payload
+type MappedItem struct {
+	ExternalID string   `json:"external_id,omitempty"`
+	Name       string   `json:"name"`
+	Variant    string   `json:"variant,omitempty"`
+	Modifiers  []string `json:"modifiers,omitempty"`
+	Quantity   int      `json:"quantity"`
+	Price      int      `json:"price"`
+	Notes      string   `json:"notes,omitempty"`
+}
+
+// ParseFieldMapping reads a mapping in "yaml" or "json" and checks every expression
+func ParseFieldMapping(format, text string) (*FieldMapping, error) {
+	var m FieldMapping
+	switch format {
+	case "yaml", "yml", "":
+		dec := yaml.NewDecoder(strings.NewReader(text))
+		dec.KnownFields(true)
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("invalid YAML mapping: %w", err)
+		}
+	case "json":
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&m); err != nil {
+			return nil, fmt.Errorf("invalid JSON mapping: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown mapping format %q, use yaml or json", format)
+	}
+
+	required := map[string]string{"order_id": m.OrderID, "items.path": m.Items.Path, "items.name": m.Items.Name, "items.price": m.Items.Price}
+	for field, expr := range required {
+		if expr == "" {
+			return nil, fmt.Errorf("%s is required", field)
+		}
+	}
+
+	exprs := map[string]string{
+		"order_id": m.OrderID, "customer_name": m.CustomerName, "customer_phone": m.CustomerPhone,
+		"address": m.Address, "driver_name": m.DriverName, "notes": m.Notes, "total": m.Total,
+		"merchant_promo": m.MerchantPromo, "platform_promo": m.PlatformPromo,
+		"items.path": m.Items.Path, "items.external_id": m.Items.ExternalID, "items.name": m.Items.Name,
+		"items.variant": m.Items.Variant, "items.modifiers": m.Items.Modifiers, "items.quantity": m.Items.Quantity,
+		"items.price": m.Items.Price, "items.notes": m.Items.Notes,
+	}
+	for field, expr := range exprs {
+		if expr == "" {
+			continue
+		}
+		if _, err := compilePath(expr); err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+	}
+	return &m, nil
+}
+
+// Apply translates a JSON webhook payload into an order
+func (m *FieldMapping) Apply(payload []byte) (*MappedOrder, error) {
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	var doc interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+
+	order := &MappedOrder{
+		ExternalOrderID: lookupString(doc, m.OrderID),
+		CustomerName:    lookupString(doc, m.CustomerName),
+		CustomerPhone:   lookupString(doc, m.CustomerPhone),
+		Address:         lookupString(doc, m.Address),
+		DriverName:      lookupString(doc, m.DriverName),
+		Notes:           lookupString(doc, m.Notes),
+	}
+	if order.ExternalOrderID == "" {
+		return nil, fmt.Errorf("order_id (%s) not found in payload", m.OrderID)
+	}
+
+	amounts := []struct {
+		field, expr string
+		dest        *int
+	}{
+		{"total", m.Total, &order.Total},
+		{"merchant_promo", m.MerchantPromo, &order.MerchantPromo},
+		{"platform_promo", m.PlatformPromo, &order.PlatformPromo},
+	}
+	for _, a := range amounts {
+		n, err := lookupAmount(doc, a.expr)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", a.field, err)
+		}
+		*a.dest = n
+	}
+
+	lines := lookup(doc, m.Items.Path)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("no items found at %s", m.Items.Path)
+	}
+	for i, line := range lines {
+		item := MappedItem{
+			ExternalID: lookupString(line, m.Items.ExternalID),
+			Name:       lookupString(line, m.Items.Name),
+			Variant:    lookupString(line, m.Items.Variant),
+			Notes:      lookupString(line, m.Items.Notes),
+			Quantity:   1,
+		}
+		if item.Name == "" {
+			return nil, fmt.Errorf("item %d: name (%s) not found", i+1, m.Items.Name)
+		}
+		if m.Items.Modifiers != "" {
+			for _, v := range lookup(line, m.Items.Modifiers) {
+				if s := scalarString(v); s != "" {
+					item.Modifiers = append(item.Modifiers, s)
+				}
+			}
+		}
+		price, err := lookupAmount(line, m.Items.Price)
+		if err != nil {
+			return nil, fmt.Errorf("item %d price: %w", i+1, err)
+		}
+		item.Price = price
+		if m.Items.Quantity != "" {
+			qty, err := lookupAmount(line, m.Items.Quantity)
+			if err != nil {
+				return nil, fmt.Errorf("item %d quantity: %w", i+1, err)
+			}
+			if qty > 0 {
+				item.Quantity = qty
+			}
+		}
+		order.Items = append(order.Items, item)
+	}
+	return order, nil
+}
+
+// --- JSONPath subset: $ or @, .field, ['field'], [n], [*] and .* ---
+
+type pathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func compilePath(expr string) ([]pathStep, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" || (expr[0] != '$' && expr[0] != '@') {
+		return nil, fmt.Errorf("path %q must start with $ or @", expr)
+	}
+
+	var steps []pathStep
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, fmt.Errorf("path %q: recursive descent is not supported", expr)
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			if key == "" {
+				return nil, fmt.Errorf("path %q: empty field name", expr)
+			}
+			steps = append(steps, pathStep{key: key, wildcard: key == "*"})
+			rest = rest[end:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: unclosed [", expr)
+			}
+			inner := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, pathStep{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, pathStep{key: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: invalid index [%s]", expr, inner)
+				}
+				steps = append(steps, pathStep{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", expr, rest[:1])
+		}
+	}
+	return steps, nil
+}
+
+// lookup returns every value expr matches in node; invalid or empty expressions match nothing
+func lookup(node interface{}, expr string) []interface{} {
+	if expr == "" {
+		return nil
+	}
+	steps, err := compilePath(expr)
+	if err != nil {
+		return nil
+	}
+
+	current := []interface{}{node}
+	for _, step := range steps {
+		var next []interface{}
+		for _, n := range current {
+			switch v := n.(type) {
+			case map[string]interface{}:
+				if step.wildcard {
+					for _, child := range v {
+						next = append(next, child)
+					}
+				} else if child, ok := v[step.key]; ok && !step.isIndex {
+					next = append(next, child)
+				}
+			case []interface{}:
+				switch {
+				case step.wildcard:
+					next = append(next, v...)
+				case step.isIndex:
+					i := step.index
+					if i < 0 {
+						i += len(v)
+					}
+					if i >= 0 && i < len(v) {
+						next = append(next, v[i])
+					}
+				}
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+func lookupString(node interface{}, expr string) string {
+	values := lookup(node, expr)
+	if len(values) == 0 {
+		return ""
+	}
+	return scalarString(values[0])
+}
+
+func lookupAmount(node interface{}, expr string) (int, error) {
+	s := lookupString(node, expr)
+	if s == "" {
+		return 0, nil
+	}
+	return ParseAmount(s)
+}
+
+func scalarString(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case json.Number:
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	case nil:
+		return ""
+	}
+	return ""
+}
@@ -0,0 +1,279 @@
+package delivery
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Who cancelled a delivery order
+const (
+	CancelledByCustomer = "customer"
+	CancelledByPlatform = "platform"
+	CancelledByDriver   = "driver"
+	CancelledByMerchant = "merchant"
+)
+
+// Who bears the cost of food already made for a cancelled order
+const (
+	CostBearerNone     = "none" // nothing was made yet
+	CostBearerPlatform = "platform"
+	CostBearerMerchant = "merchant"
+)
+
+// Cancellation is a platform telling us an order was cancelled on their side
+type Cancellation struct {
+	ExternalOrderID string
+	CancelledBy     string // customer, platform, driver, merchant
+	Reason          string
+	Compensation    int // what the platform says it will pay us, if it says
+	OccurredAt      time.Time
+}
+
+// Modification is a platform telling us an order's items changed
+type Modification struct {
+	ExternalOrderID string
+	Items           []InboundItem
+	Total           int
+	Reason          string
+	OccurredAt      time.Time
+}
+
+// InboundItem is an order line as a platform sends it
+type InboundItem struct {
+	ExternalID string
+	Name       string
+	Variant    string
+	Modifiers  []string
+	Quantity   int
+	Price      int
+	Notes      string
+}
+
+// InboundAdapter returns the adapter for reading a platform's webhooks. Reading
+// needs no API credentials, so it works for platforms we don't push to.
+func InboundAdapter(platform string) Adapter {
+	switch platform {
+	case dummy.SourceGrabFood:
+		return &GrabFoodAdapter{}
+	case dummy.SourceGoFood:
+		return &GoFoodAdapter{}
+	case dummy.SourceShopeeFood:
+		return &ShopeeFoodAdapter{}
+	}
+	return nil
+}
+
+// CostBearer decides who pays for food already made when a platform cancels an
+// order. Nothing is owed if the kitchen hadn't started; otherwise the merchant
+// pays for its own cancellations and the platform for everyone else's.
+func CostBearer(order *dummy.Order, cancelledBy string) (foodMade bool, bearer string) {
+	foodMade = order.ReadyAt != nil || order.Status == "cooking" || order.Status == "ready" || order.Status == "completed"
+	switch {
+	case !foodMade:
+		return false, CostBearerNone
+	case cancelledBy == CancelledByMerchant:
+		return true, CostBearerMerchant
+	default:
+		return true, CostBearerPlatform
+	}
+}
+
+var errMissingOrderID = errors.New("order ID is required")
+
+func decodeInbound(body []byte, v interface{}, platform, kind string) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid %s %s format: %w", platform, kind, err)
+	}
+	return nil
+}
+
+// cancelledBy normalizes a platform's cancelling party
+func cancelledBy(value string, aliases map[string]string) string {
+	v := strings.ToUpper(strings.TrimSpace(value))
+	if by, ok := aliases[v]; ok {
+		return by
+	}
+	return CancelledByPlatform
+}
+
+// --- GrabFood ---
+
+func (a *GrabFoodAdapter) ParseCancellation(body []byte) (*Cancellation, error) {
+	var req struct {
+		OrderID              string    `json:"orderId"`
+		CancelledBy          string    `json:"cancelledBy"` // CUSTOMER, GRAB, DRIVER, MERCHANT
+		Reason               string    `json:"reason"`
+		MerchantCompensation int       `json:"merchantCompensation"`
+		CancelledAt          time.Time `json:"cancelledAt"`
+	}
+	if err := decodeInbound(body, &req, "GrabFood", "cancellation"); err != nil {
+		return nil, err
+	}
+	if req.OrderID == "" {
+		return nil, errMissingOrderID
+	}
+	return &Cancellation{
+		ExternalOrderID: req.OrderID,
+		CancelledBy: cancelledBy(req.CancelledBy, map[string]string{
+			"CUSTOMER": CancelledByCustomer, "EATER": CancelledByCustomer, "GRAB": CancelledByPlatform,
+			"DRIVER": CancelledByDriver, "MERCHANT": CancelledByMerchant,
+		}),
+		Reason:       req.Reason,
+		Compensation: req.MerchantCompensation,
+		OccurredAt:   req.CancelledAt,
+	}, nil
+}
+
+func (a *GrabFoodAdapter) ParseModification(body []byte) (*Modification, error) {
+	var req struct {
+		OrderID string `json:"orderId"`
+		Items   []struct {
+			ItemID    string   `json:"itemId"`
+			Name      string   `json:"name"`
+			Variant   string   `json:"variant"`
+			Modifiers []string `json:"modifiers"`
+			Quantity  int      `json:"quantity"`
+			Price     int      `json:"price"`
+			Notes     string   `json:"notes"`
+		} `json:"items"`
+		Total     int       `json:"total"`
+		Reason    string    `json:"reason"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+	if err := decodeInbound(body, &req, "GrabFood", "order edit"); err != nil {
+		return nil, err
+	}
+	if req.OrderID == "" {
+		return nil, errMissingOrderID
+	}
+	m := &Modification{ExternalOrderID: req.OrderID, Total: req.Total, Reason: req.Reason, OccurredAt: req.UpdatedAt}
+	for _, item := range req.Items {
+		m.Items = append(m.Items, InboundItem{ExternalID: item.ItemID, Name: item.Name, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Quantity, Price: item.Price, Notes: item.Notes})
+	}
+	return m, nil
+}
+
+// --- GoFood ---
+
+func (a *GoFoodAdapter) ParseCancellation(body []byte) (*Cancellation, error) {
+	var req struct {
+		TransactionID        string    `json:"transaction_id"`
+		CancelledBy          string    `json:"cancelled_by"` // customer, gofood, driver, merchant
+		Reason               string    `json:"reason"`
+		MerchantCompensation int       `json:"merchant_compensation"`
+		CancelledAt          time.Time `json:"cancelled_at"`
+	}
+	if err := decodeInbound(body, &req, "GoFood", "cancellation"); err != nil {
+		return nil, err
+	}
+	if req.TransactionID == "" {
+		return nil, errMissingOrderID
+	}
+	return &Cancellation{
+		ExternalOrderID: req.TransactionID,
+		CancelledBy: cancelledBy(req.CancelledBy, map[string]string{
+			"CUSTOMER": CancelledByCustomer, "GOFOOD": CancelledByPlatform, "DRIVER": CancelledByDriver,
+			"MERCHANT": CancelledByMerchant,
+		}),
+		Reason:       req.Reason,
+		Compensation: req.MerchantCompensation,
+		OccurredAt:   req.CancelledAt,
+	}, nil
+}
+
+func (a *GoFoodAdapter) ParseModification(body []byte) (*Modification, error) {
+	var req struct {
+		TransactionID string `json:"transaction_id"`
+		Items         []struct {
+			SKU         string   `json:"sku"`
+			ProductName string   `json:"product_name"`
+			Variant     string   `json:"variant"`
+			Modifiers   []string `json:"modifiers"`
+			Qty         int      `json:"qty"`
+			Price       int      `json:"price"`
+			Note        string   `json:"note"`
+		} `json:"items"`
+		TotalAmount int       `json:"total_amount"`
+		Reason      string    `json:"reason"`
+		ModifiedAt  time.Time `json:"modified_at"`
+	}
+	if err := decodeInbound(body, &req, "GoFood", "modification"); err != nil {
+		return nil, err
+	}
+	if req.TransactionID == "" {
+		return nil, errMissingOrderID
+	}
+	m := &Modification{ExternalOrderID: req.TransactionID, Total: req.TotalAmount, Reason: req.Reason, OccurredAt: req.ModifiedAt}
+	for _, item := range req.Items {
+		m.Items = append(m.Items, InboundItem{ExternalID: item.SKU, Name: item.ProductName, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Qty, Price: item.Price, Notes: item.Note})
+	}
+	return m, nil
+}
+
+// --- ShopeeFood ---
+
+func (a *ShopeeFoodAdapter) ParseCancellation(body []byte) (*Cancellation, error) {
+	var req struct {
+		OrderNo              string `json:"order_no"`
+		CancelBy             string `json:"cancel_by"` // BUYER, SHOPEE, SHIPPER, MERCHANT
+		CancelReason         string `json:"cancel_reason"`
+		MerchantCompensation int    `json:"merchant_compensation"`
+		UpdateTime           int64  `json:"update_time"` // unix seconds
+	}
+	if err := decodeInbound(body, &req, "Shopee Food", "cancellation"); err != nil {
+		return nil, err
+	}
+	if req.OrderNo == "" {
+		return nil, errMissingOrderID
+	}
+	c := &Cancellation{
+		ExternalOrderID: req.OrderNo,
+		CancelledBy: cancelledBy(req.CancelBy, map[string]string{
+			"BUYER": CancelledByCustomer, "SHOPEE": CancelledByPlatform, "SHIPPER": CancelledByDriver,
+			"MERCHANT": CancelledByMerchant, "SELLER": CancelledByMerchant,
+		}),
+		Reason:       req.CancelReason,
+		Compensation: req.MerchantCompensation,
+	}
+	if req.UpdateTime > 0 {
+		c.OccurredAt = time.Unix(req.UpdateTime, 0)
+	}
+	return c, nil
+}
+
+func (a *ShopeeFoodAdapter) ParseModification(body []byte) (*Modification, error) {
+	var req struct {
+		OrderNo    string `json:"order_no"`
+		OrderItems []struct {
+			ItemID    string   `json:"item_id"`
+			ItemName  string   `json:"item_name"`
+			ModelName string   `json:"model_name"`
+			AddOns    []string `json:"add_ons"`
+			Quantity  int      `json:"quantity"`
+			Price     int      `json:"price"`
+			Remark    string   `json:"remark"`
+		} `json:"order_items"`
+		TotalPrice int    `json:"total_price"`
+		Reason     string `json:"reason"`
+		UpdateTime int64  `json:"update_time"`
+	}
+	if err := decodeInbound(body, &req, "Shopee Food", "modification"); err != nil {
+		return nil, err
+	}
+	if req.OrderNo == "" {
+		return nil, errMissingOrderID
+	}
+	m := &Modification{ExternalOrderID: req.OrderNo, Total: req.TotalPrice, Reason: req.Reason}
+	if req.UpdateTime > 0 {
+		m.OccurredAt = time.Unix(req.UpdateTime, 0)
+	}
+	for _, item := range req.OrderItems {
+		m.Items = append(m.Items, InboundItem{ExternalID: item.ItemID, Name: item.ItemName, Variant: item.ModelName, Modifiers: item.AddOns, Quantity: item.Quantity, Price: item.Price, Notes: item.Remark})
+	}
+	return m, nil
+}
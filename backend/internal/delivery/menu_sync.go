@@ -0,0 +1,391 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Menu sync statuses
+const (
+	SyncInSync        = "in_sync"
+	SyncPending       = "pending"  // changes waiting for the next push
+	SyncRetrying      = "retrying" // last push failed and will be retried
+	SyncFailed        = "failed"   // platform rejected the changes; fix them or force a sync
+	SyncNotConfigured = "not_configured"
+)
+
+// Kinds of menu change
+const (
+	MenuAdded   = "added"
+	MenuUpdated = "updated"
+	MenuRemoved = "removed"
+)
+
+const menuSyncInterval = 2 * time.Second
+
+// MenuItem is one of our products as listed on a platform
+type MenuItem struct {
+	ExternalID string `json:"external_id"`
+	ProductID  string `json:"product_id"`
+	Name       string `json:"name"`
+	Price      int    `json:"price"`
+	Available  bool   `json:"available"`
+}
+
+// MenuChange is a difference between our catalog and what a platform last received
+type MenuChange struct {
+	Change   string    `json:"change"`             // added, updated, removed
+	Item     MenuItem  `json:"item"`               // state to push; last pushed state for removals
+	Previous *MenuItem `json:"previous,omitempty"` // what the platform has now
+	Fields   []string  `json:"fields,omitempty"`   // changed fields of an update
+}
+
+// PauseChange is a store pause state the platform hasn't received yet
+type PauseChange struct {
+	StoreID string `json:"store_id"`
+	Paused  bool   `json:"paused"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SyncStatus is a platform's menu sync state
+type SyncStatus struct {
+	Platform       string        `json:"platform"`
+	Status         string        `json:"status"`
+	PendingChanges int           `json:"pending_changes"`
+	PendingPauses  []PauseChange `json:"pending_pauses"`
+	PausedStores   []string      `json:"paused_stores"` // stores the platform has been told are paused
+	Attempts       int           `json:"attempts,omitempty"`
+	LastError      string        `json:"last_error,omitempty"`
+	LastSyncedAt   *time.Time    `json:"last_synced_at,omitempty"`
+	NextAttemptAt  *time.Time    `json:"next_attempt_at,omitempty"`
+}
+
+type platformMenu struct {
+	adapter Adapter
+
+	pushed map[string]MenuItem // by external ID; nil until the first full push
+	paused map[string]bool     // pause state pushed, by store
+
+	attempts      int
+	lastError     string
+	failedKey     string // changes the platform rejected; not retried until they change
+	lastSyncedAt  time.Time
+	nextAttemptAt time.Time
+}
+
+// MenuSync keeps every linked platform's menu in line with our catalog. Rather
+// than queueing each edit, it diffs the catalog (products linked to a platform
+// through item menu mappings) against what the platform last accepted and
+// pushes only the difference, so rapid toggles coalesce and nothing is lost if
+// a push fails. After a restart the whole menu is pushed once.
+type MenuSync struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+
+	mu        sync.Mutex
+	platforms map[string]*platformMenu
+	wake      chan struct{}
+}
+
+// NewMenuSync creates a menu sync for the platforms that have an adapter
+func NewMenuSync(adapters ...Adapter) *MenuSync {
+	m := &MenuSync{
+		BaseDelay: defaultBaseDelay,
+		MaxDelay:  defaultMaxDelay,
+		platforms: make(map[string]*platformMenu),
+		wake:      make(chan struct{}, 1),
+	}
+	for _, a := range adapters {
+		m.platforms[a.Platform()] = &platformMenu{adapter: a, paused: make(map[string]bool)}
+	}
+	return m
+}
+
+// DesiredMenu is what a platform's menu should look like according to our catalog
+func DesiredMenu(platform string) map[string]MenuItem {
+	products := make(map[string]dummy.Product)
+	for _, p := range dummy.ListProducts() {
+		products[p.ID] = p
+	}
+
+	menu := make(map[string]MenuItem)
+	for _, mapping := range dummy.ListMenuMappings(platform) {
+		if mapping.Kind != dummy.MappingKindItem || mapping.ExternalID == "" {
+			continue
+		}
+		p, ok := products[mapping.ProductID]
+		if !ok {
+			continue
+		}
+		menu[mapping.ExternalID] = MenuItem{
+			ExternalID: mapping.ExternalID,
+			ProductID:  p.ID,
+			Name:       p.Name,
+			Price:      p.BasePrice,
+			Available:  p.IsAvailable,
+		}
+	}
+	return menu
+}
+
+// Diff returns the menu changes waiting to be pushed to a platform
+func (m *MenuSync) Diff(platform string) []MenuChange {
+	desired := DesiredMenu(platform)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var pushed map[string]MenuItem
+	if pm, ok := m.platforms[platform]; ok {
+		pushed = pm.pushed
+	}
+	return diffMenu(pushed, desired)
+}
+
+func diffMenu(pushed, desired map[string]MenuItem) []MenuChange {
+	changes := []MenuChange{}
+	for id, want := range desired {
+		have, ok := pushed[id]
+		if !ok {
+			changes = append(changes, MenuChange{Change: MenuAdded, Item: want})
+			continue
+		}
+		var fields []string
+		if have.Name != want.Name {
+			fields = append(fields, "name")
+		}
+		if have.Price != want.Price {
+			fields = append(fields, "price")
+		}
+		if have.Available != want.Available {
+			fields = append(fields, "available")
+		}
+		if len(fields) > 0 {
+			previous := have
+			changes = append(changes, MenuChange{Change: MenuUpdated, Item: want, Previous: &previous, Fields: fields})
+		}
+	}
+	for id, have := range pushed {
+		if _, ok := desired[id]; !ok {
+			previous := have
+			changes = append(changes, MenuChange{Change: MenuRemoved, Item: have, Previous: &previous})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Item.ExternalID < changes[j].Item.ExternalID })
+	return changes
+}
+
+// pauseChangesLocked lists store pause states the platform hasn't received. Callers hold m.mu.
+func pauseChangesLocked(pm *platformMenu) []PauseChange {
+	changes := []PauseChange{}
+	for _, p := range dummy.ListDeliveryPauses() {
+		if p.Paused != pm.paused[p.StoreID] {
+			changes = append(changes, PauseChange{StoreID: p.StoreID, Paused: p.Paused, Reason: p.Reason})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].StoreID < changes[j].StoreID })
+	return changes
+}
+
+// Status returns the sync state of every delivery platform
+func (m *MenuSync) Status() []SyncStatus {
+	platforms := []string{dummy.SourceGrabFood, dummy.SourceGoFood, dummy.SourceShopeeFood}
+	statuses := make([]SyncStatus, len(platforms))
+	for i, p := range platforms {
+		statuses[i] = m.PlatformStatus(p)
+	}
+	return statuses
+}
+
+// PlatformStatus returns one platform's sync state
+func (m *MenuSync) PlatformStatus(platform string) SyncStatus {
+	desired := DesiredMenu(platform)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := SyncStatus{Platform: platform, PendingPauses: []PauseChange{}, PausedStores: []string{}}
+	pm, ok := m.platforms[platform]
+	if !ok {
+		status.Status = SyncNotConfigured
+		status.PendingChanges = len(desired)
+		return status
+	}
+
+	status.PendingChanges = len(diffMenu(pm.pushed, desired))
+	status.PendingPauses = pauseChangesLocked(pm)
+	for storeID, paused := range pm.paused {
+		if paused {
+			status.PausedStores = append(status.PausedStores, storeID)
+		}
+	}
+	sort.Strings(status.PausedStores)
+	status.Attempts = pm.attempts
+	status.LastError = pm.lastError
+	if !pm.lastSyncedAt.IsZero() {
+		t := pm.lastSyncedAt
+		status.LastSyncedAt = &t
+	}
+
+	switch {
+	case pm.failedKey != "":
+		status.Status = SyncFailed
+	case pm.attempts > 0:
+		status.Status = SyncRetrying
+		t := pm.nextAttemptAt
+		status.NextAttemptAt = &t
+	case status.PendingChanges > 0 || len(status.PendingPauses) > 0:
+		status.Status = SyncPending
+	default:
+		status.Status = SyncInSync
+	}
+	return status
+}
+
+// Resync pushes a platform's pending changes now, even if they failed before.
+// With full set, the whole menu is sent again as if the platform had nothing.
+func (m *MenuSync) Resync(platform string, full bool) error {
+	m.mu.Lock()
+	pm, ok := m.platforms[platform]
+	if !ok {
+		m.mu.Unlock()
+		return errors.New("no adapter configured for " + platform)
+	}
+	pm.failedKey = ""
+	pm.attempts = 0
+	pm.nextAttemptAt = time.Time{}
+	if full {
+		pm.pushed = nil
+	}
+	m.mu.Unlock()
+	m.Notify()
+	return nil
+}
+
+// Notify wakes the sync loop after a change that should go out straight away
+func (m *MenuSync) Notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run pushes pending changes until ctx is cancelled
+func (m *MenuSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(menuSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		for platform := range m.platforms {
+			m.syncPlatform(ctx, platform)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+func (m *MenuSync) syncPlatform(ctx context.Context, platform string) {
+	desired := DesiredMenu(platform)
+
+	m.mu.Lock()
+	pm := m.platforms[platform]
+	if time.Now().Before(pm.nextAttemptAt) {
+		m.mu.Unlock()
+		return
+	}
+	pauses := pauseChangesLocked(pm)
+	changes := diffMenu(pm.pushed, desired)
+	if len(pauses) == 0 && len(changes) == 0 {
+		pm.attempts = 0
+		pm.lastError = ""
+		pm.failedKey = ""
+		if pm.pushed == nil {
+			pm.pushed = desired
+		}
+		m.mu.Unlock()
+		return
+	}
+	key := changeKey(pauses, changes)
+	if key == pm.failedKey {
+		m.mu.Unlock()
+		return
+	}
+	m.mu.Unlock()
+
+	// Pauses go first: an overloaded kitchen matters more than a price change
+	for _, p := range pauses {
+		pushCtx, cancel := context.WithTimeout(ctx, pushTimeout)
+		err := pm.adapter.SetPaused(pushCtx, p.StoreID, p.Paused, p.Reason)
+		cancel()
+		if err != nil {
+			m.pushFailed(pm, platform, key, err)
+			return
+		}
+		m.mu.Lock()
+		pm.paused[p.StoreID] = p.Paused
+		m.mu.Unlock()
+		log.Printf("Set %s paused=%t on %s", p.StoreID, p.Paused, platform)
+	}
+
+	if len(changes) > 0 {
+		pushCtx, cancel := context.WithTimeout(ctx, pushTimeout)
+		// The dummy catalog is shared by every store, so menus are pushed for the default store
+		err := pm.adapter.PushMenu(pushCtx, dummy.DefaultStoreID, changes)
+		cancel()
+		if err != nil {
+			m.pushFailed(pm, platform, key, err)
+			return
+		}
+	}
+
+	m.mu.Lock()
+	if pm.pushed == nil {
+		pm.pushed = make(map[string]MenuItem)
+	}
+	for _, ch := range changes {
+		if ch.Change == MenuRemoved {
+			delete(pm.pushed, ch.Item.ExternalID)
+		} else {
+			pm.pushed[ch.Item.ExternalID] = ch.Item
+		}
+	}
+	pm.attempts = 0
+	pm.lastError = ""
+	pm.failedKey = ""
+	pm.lastSyncedAt = time.Now()
+	m.mu.Unlock()
+	if len(changes) > 0 {
+		log.Printf("Pushed %d menu changes to %s", len(changes), platform)
+	}
+}
+
+func (m *MenuSync) pushFailed(pm *platformMenu, platform, key string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pm.attempts++
+	pm.lastError = err.Error()
+	var pushErr *PushError
+	if errors.As(err, &pushErr) && !pushErr.Retryable() {
+		pm.failedKey = key
+		log.Printf("%s rejected menu sync: %v", platform, err)
+		return
+	}
+	pm.nextAttemptAt = time.Now().Add(backoffDelay(m.BaseDelay, m.MaxDelay, pm.attempts))
+	log.Printf("Menu sync to %s failed (attempt %d): %v", platform, pm.attempts, err)
+}
+
+func changeKey(pauses []PauseChange, changes []MenuChange) string {
+	data, _ := json.Marshal(struct {
+		Pauses  []PauseChange
+		Changes []MenuChange
+	}{pauses, changes})
+	return string(data)
+}
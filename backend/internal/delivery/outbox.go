@@ -0,0 +1,326 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Outbox job statuses
+const (
+	JobPending   = "pending"
+	JobDelivered = "delivered"
+	JobDead      = "dead"
+)
+
+const (
+	defaultMaxAttempts = 8
+	defaultBaseDelay   = 2 * time.Second
+	defaultMaxDelay    = 10 * time.Minute
+	pollInterval       = time.Second
+	pushTimeout        = 15 * time.Second
+
+	// deliveredRetention is how long delivered jobs stay in the file for inspection
+	deliveredRetention = 24 * time.Hour
+)
+
+// Job is one queued push to a delivery platform
+type Job struct {
+	ID            string       `json:"id"`
+	Platform      string       `json:"platform"`
+	OrderID       string       `json:"order_id"`
+	Update        StatusUpdate `json:"update"`
+	Status        string       `json:"status"`
+	Attempts      int          `json:"attempts"`
+	LastError     string       `json:"last_error,omitempty"`
+	NextAttemptAt time.Time    `json:"next_attempt_at"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+// Outbox is a file-backed queue of platform pushes. Failed pushes are retried with
+// exponential backoff and moved to the dead-letter list after MaxAttempts.
+type Outbox struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	mu       sync.Mutex
+	path     string
+	jobs     []*Job
+	adapters map[string]Adapter
+	wake     chan struct{}
+}
+
+// NewOutbox loads any jobs left in path and registers the platform adapters
+func NewOutbox(path string, adapters ...Adapter) (*Outbox, error) {
+	o := &Outbox{
+		MaxAttempts: defaultMaxAttempts,
+		BaseDelay:   defaultBaseDelay,
+		MaxDelay:    defaultMaxDelay,
+		path:        path,
+		adapters:    make(map[string]Adapter),
+		wake:        make(chan struct{}, 1),
+	}
+	for _, a := range adapters {
+		o.adapters[a.Platform()] = a
+	}
+
+	if path == "" {
+		return o, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &o.jobs); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// HasAdapter reports whether pushes to platform can be delivered
+func (o *Outbox) HasAdapter(platform string) bool {
+	_, ok := o.adapters[platform]
+	return ok
+}
+
+// Enqueue queues a status update for a platform. Updates for platforms without
+// a configured adapter are dropped, since they could never be delivered.
+func (o *Outbox) Enqueue(platform, orderID string, update StatusUpdate) (*Job, bool) {
+	if !o.HasAdapter(platform) {
+		log.Printf("No %s adapter configured, not sending %s for order %s", platform, update.Event, orderID)
+		return nil, false
+	}
+	if update.OccurredAt.IsZero() {
+		update.OccurredAt = time.Now()
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:            uuid.New().String(),
+		Platform:      platform,
+		OrderID:       orderID,
+		Update:        update,
+		Status:        JobPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	o.mu.Lock()
+	o.jobs = append(o.jobs, job)
+	o.saveLocked()
+	o.mu.Unlock()
+
+	o.notify()
+	result := *job
+	return &result, true
+}
+
+// EventForTransition returns the platform event for an order status change, or ""
+// if the platform doesn't need to hear about it. Cancelling an order that was
+// never accepted is reported as a rejection.
+func EventForTransition(previous, status string) string {
+	switch status {
+	case "confirmed":
+		if previous == "pending" {
+			return EventAccepted
+		}
+	case "ready":
+		return EventReady
+	case "cancelled":
+		if previous == "pending" {
+			return EventRejected
+		}
+		return EventCancelled
+	}
+	return ""
+}
+
+// EnqueueOrderEvent queues an event for an order if it came from a delivery platform
+func (o *Outbox) EnqueueOrderEvent(order *dummy.Order, event, reason string) {
+	if o == nil || event == "" || !dummy.IsDeliverySource(order.OrderSource) || order.ExternalOrderID == "" {
+		return
+	}
+	o.Enqueue(order.OrderSource, order.ID, StatusUpdate{
+		ExternalOrderID: order.ExternalOrderID,
+		OrderNumber:     order.OrderNumber,
+		Event:           event,
+		Reason:          reason,
+	})
+}
+
+// List returns jobs with the given status ("" for all), oldest first
+func (o *Outbox) List(status string) []Job {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	result := []Job{}
+	for _, j := range o.jobs {
+		if status == "" || j.Status == status {
+			result = append(result, *j)
+		}
+	}
+	return result
+}
+
+// Retry moves a dead-lettered job back to the queue with a fresh attempt budget
+func (o *Outbox) Retry(id string) (*Job, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, j := range o.jobs {
+		if j.ID != id {
+			continue
+		}
+		if j.Status != JobDead {
+			return nil, errors.New("only dead-lettered jobs can be retried")
+		}
+		j.Status = JobPending
+		j.Attempts = 0
+		j.NextAttemptAt = time.Now()
+		j.UpdatedAt = time.Now()
+		o.saveLocked()
+		o.notify()
+		result := *j
+		return &result, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Run delivers due jobs until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		o.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *Outbox) deliverDue(ctx context.Context) {
+	now := time.Now()
+	o.mu.Lock()
+	pending := []*Job{}
+	due := make(map[*Job]bool)
+	for _, j := range o.jobs {
+		if j.Status == JobPending {
+			pending = append(pending, j)
+			due[j] = !j.NextAttemptAt.After(now)
+		}
+	}
+	o.mu.Unlock()
+
+	// Keep each order's events in the order they happened: a job waits while an
+	// earlier job for the same order is still backing off or has just failed
+	sort.SliceStable(pending, func(a, b int) bool { return pending[a].CreatedAt.Before(pending[b].CreatedAt) })
+	blocked := make(map[string]bool)
+
+	for _, j := range pending {
+		if blocked[j.OrderID] {
+			continue
+		}
+		if !due[j] {
+			blocked[j.OrderID] = true
+			continue
+		}
+
+		pushCtx, cancel := context.WithTimeout(ctx, pushTimeout)
+		err := o.adapters[j.Platform].PushStatus(pushCtx, j.Update)
+		cancel()
+
+		o.mu.Lock()
+		j.Attempts++
+		j.UpdatedAt = time.Now()
+		if err == nil {
+			j.Status = JobDelivered
+			j.LastError = ""
+			log.Printf("Pushed %s to %s for order %s", j.Update.Event, j.Platform, j.OrderID)
+		} else {
+			j.LastError = err.Error()
+			blocked[j.OrderID] = true
+			var pushErr *PushError
+			permanent := errors.Is(err, ErrUnsupportedEvent) || (errors.As(err, &pushErr) && !pushErr.Retryable())
+			if j.Attempts >= o.MaxAttempts || permanent {
+				j.Status = JobDead
+				log.Printf("Dead-lettered %s push to %s for order %s: %v", j.Update.Event, j.Platform, j.OrderID, err)
+			} else {
+				j.NextAttemptAt = time.Now().Add(o.backoff(j.Attempts))
+			}
+		}
+		o.saveLocked()
+		o.mu.Unlock()
+	}
+}
+
+func (o *Outbox) backoff(attempts int) time.Duration {
+	return backoffDelay(o.BaseDelay, o.MaxDelay, attempts)
+}
+
+// backoffDelay doubles the delay per attempt, capped at max, with up to 20% jitter
+func backoffDelay(base, max time.Duration, attempts int) time.Duration {
+	delay := base << uint(attempts-1)
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// saveLocked prunes old delivered jobs and writes the queue to disk. Callers hold o.mu.
+func (o *Outbox) saveLocked() {
+	cutoff := time.Now().Add(-deliveredRetention)
+	kept := o.jobs[:0]
+	for _, j := range o.jobs {
+		if j.Status == JobDelivered && j.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		kept = append(kept, j)
+	}
+	o.jobs = kept
+
+	if o.path == "" {
+		return
+	}
+	data, err := json.MarshalIndent(o.jobs, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding delivery outbox: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(o.path), 0o755); err != nil {
+		log.Printf("Error creating delivery outbox directory: %v", err)
+		return
+	}
+	tmp := o.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Error writing delivery outbox: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, o.path); err != nil {
+		log.Printf("Error saving delivery outbox: %v", err)
+	}
+}
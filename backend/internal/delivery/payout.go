@@ -0,0 +1,268 @@
+package delivery
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// reconcileTolerance absorbs rounding differences between our commission maths and the platform's
+const reconcileTolerance = 1
+
+// Settlement row statuses
+const (
+	SettlementMatched             = "matched"
+	SettlementMismatch            = "mismatch"
+	SettlementMissingOrder        = "missing_order"
+	SettlementMissingInSettlement = "missing_in_settlement"
+)
+
+// Promo is the discount on a delivery order, split by who pays for it
+type Promo struct {
+	Merchant int
+	Platform int
+}
+
+// CalculatePayout splits a platform order total into commission, merchant-funded
+// promo and net using the commission setting in effect when the order was placed.
+// Commission is charged on the total after merchant-funded discounts.
+func CalculatePayout(platform string, gross int, promo Promo, at time.Time) *dummy.DeliveryPayout {
+	payout := &dummy.DeliveryPayout{
+		Gross:         gross,
+		MerchantPromo: promo.Merchant,
+		PlatformPromo: promo.Platform,
+	}
+	if setting := dummy.CommissionFor(platform, at); setting != nil {
+		base := gross - promo.Merchant
+		if base < 0 {
+			base = 0
+		}
+		payout.CommissionSettingID = setting.ID
+		payout.CommissionRate = setting.RatePercent
+		payout.CommissionFixedFee = setting.FixedFee
+		payout.Commission = int(math.Round(float64(base)*setting.RatePercent/100)) + setting.FixedFee
+	}
+	payout.Net = gross - promo.Merchant - payout.Commission
+	return payout
+}
+
+// Column names platforms use in settlement exports, normalized to lowercase with underscores
+var settlementColumns = map[string][]string{
+	"order_id":   {"order_id", "external_order_id", "transaction_id", "order_no", "order_number", "booking_id"},
+	"gross":      {"gross", "gross_amount", "order_total", "total", "gross_sales", "total_amount"},
+	"commission": {"commission", "commission_amount", "commission_fee", "platform_fee"},
+	"promo":      {"promo", "merchant_promo", "merchant_discount", "merchant_voucher", "merchant_funded_promo"},
+	"net":        {"net", "net_amount", "net_sales", "payout", "settlement_amount", "amount_settled"},
+}
+
+// ParseSettlementCSV reads a platform settlement export. Only the order ID and
+// net columns are required; column names are matched against known aliases.
+func ParseSettlementCSV(r io.Reader) ([]dummy.SettlementRow, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	index := make(map[string]int)
+	for i, name := range header {
+		key := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		key = strings.TrimPrefix(key, "\ufeff") // Excel's byte order mark
+		for column, aliases := range settlementColumns {
+			for _, alias := range aliases {
+				if _, seen := index[column]; !seen && key == alias {
+					index[column] = i
+				}
+			}
+		}
+	}
+	if _, ok := index["order_id"]; !ok {
+		return nil, errors.New("settlement file has no order ID column")
+	}
+	if _, ok := index["net"]; !ok {
+		return nil, errors.New("settlement file has no net amount column")
+	}
+
+	var rows []dummy.SettlementRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		field := func(column string) string {
+			i, ok := index[column]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+
+		row := dummy.SettlementRow{ExternalOrderID: field("order_id")}
+		if row.ExternalOrderID == "" {
+			continue // subtotal and blank lines
+		}
+		amounts := []struct {
+			column string
+			dest   *int
+		}{{"gross", &row.Gross}, {"commission", &row.Commission}, {"promo", &row.Promo}, {"net", &row.Net}}
+		for _, a := range amounts {
+			if v := field(a.column); v != "" {
+				n, err := ParseAmount(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d, %s: %w", line, a.column, err)
+				}
+				*a.dest = n
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+var thousandsSeparated = regexp.MustCompile(`^-?\d{1,3}([.,]\d{3})+$`)
+
+// ParseAmount reads a rupiah amount such as "87000", "87.000", "87,000.00" or "Rp 87.000".
+// Platforms show commissions as deductions ("-26100", "(26.100)"), so the sign is dropped.
+func ParseAmount(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "Rp"), "IDR")
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	s = strings.Trim(s, "()")
+
+	if thousandsSeparated.MatchString(s) {
+		s = strings.NewReplacer(".", "", ",", "").Replace(s)
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return int(math.Round(math.Abs(f))), nil
+}
+
+// Reconcile matches settlement rows against our orders for a platform. Orders we
+// recorded in the settlement period that the platform didn't pay are listed too.
+func Reconcile(platform string, rows []dummy.SettlementRow, periodFrom, periodTo time.Time) ([]dummy.SettlementRow, dummy.SettlementSummary) {
+	orders := make(map[string]dummy.Order)
+	for _, o := range dummy.GetOrdersBySource(platform) {
+		if o.ExternalOrderID != "" {
+			orders[o.ExternalOrderID] = o
+		}
+	}
+
+	var summary dummy.SettlementSummary
+	settled := make(map[string]bool)
+	result := make([]dummy.SettlementRow, 0, len(rows))
+
+	for _, row := range rows {
+		settled[row.ExternalOrderID] = true
+		summary.SettledNet += row.Net
+
+		order, ok := orders[row.ExternalOrderID]
+		if !ok {
+			row.Status = SettlementMissingOrder
+			row.Note = "No order with this platform ID"
+			row.Difference = row.Net
+			summary.MissingOrders++
+			result = append(result, row)
+			continue
+		}
+
+		row.OrderID = order.ID
+		row.OrderNumber = order.OrderNumber
+		row.ExpectedNet = expectedNet(order)
+		row.Difference = row.Net - row.ExpectedNet
+		summary.ExpectedNet += row.ExpectedNet
+
+		if abs(row.Difference) <= reconcileTolerance {
+			row.Status = SettlementMatched
+			summary.Matched++
+		} else {
+			row.Status = SettlementMismatch
+			row.Note = mismatchNote(order, row)
+			summary.Mismatched++
+		}
+		result = append(result, row)
+	}
+
+	var unpaid []string
+	for externalID := range orders {
+		unpaid = append(unpaid, externalID)
+	}
+	sort.Strings(unpaid)
+	for _, externalID := range unpaid {
+		order := orders[externalID]
+		if settled[externalID] || order.Status == "cancelled" || order.CreatedAt.Before(periodFrom) || !order.CreatedAt.Before(periodTo) {
+			continue
+		}
+		expected := expectedNet(order)
+		summary.ExpectedNet += expected
+		summary.MissingInSettlement++
+		result = append(result, dummy.SettlementRow{
+			ExternalOrderID: externalID,
+			OrderID:         order.ID,
+			OrderNumber:     order.OrderNumber,
+			ExpectedNet:     expected,
+			Difference:      -expected,
+			Status:          SettlementMissingInSettlement,
+			Note:            "Order not paid out in this settlement",
+		})
+	}
+
+	summary.Rows = len(rows)
+	summary.Difference = summary.SettledNet - summary.ExpectedNet
+	return result, summary
+}
+
+func expectedNet(order dummy.Order) int {
+	if order.Payout != nil {
+		return order.Payout.Net
+	}
+	return order.Total
+}
+
+func mismatchNote(order dummy.Order, row dummy.SettlementRow) string {
+	if order.Payout == nil {
+		return "Order has no payout breakdown"
+	}
+	var notes []string
+	if row.Gross != 0 && row.Gross != order.Payout.Gross {
+		notes = append(notes, fmt.Sprintf("gross %d vs our %d", row.Gross, order.Payout.Gross))
+	}
+	if row.Commission != 0 && abs(row.Commission-order.Payout.Commission) > reconcileTolerance {
+		notes = append(notes, fmt.Sprintf("commission %d vs our %d", row.Commission, order.Payout.Commission))
+	}
+	if row.Promo != 0 && row.Promo != order.Payout.MerchantPromo {
+		notes = append(notes, fmt.Sprintf("merchant promo %d vs our %d", row.Promo, order.Payout.MerchantPromo))
+	}
+	if order.Status == "cancelled" {
+		notes = append(notes, "order is cancelled on our side")
+	}
+	if len(notes) == 0 {
+		return "Net amount differs"
+	}
+	return strings.Join(notes, "; ")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -2,6 +2,7 @@ package dummy
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 )
@@ -21,10 +22,10 @@ var (
 
 	// Categories
 	Categories = []Category{
-		{ID: "cat-1", Name: "Coffee", Description: "Hot and cold coffee drinks", SortOrder: 1},
-		{ID: "cat-2", Name: "Non-Coffee", Description: "Tea, chocolate, and more", SortOrder: 2},
-		{ID: "cat-3", Name: "Food", Description: "Snacks and meals", SortOrder: 3},
-		{ID: "cat-4", Name: "Dessert", Description: "Sweet treats", SortOrder: 4},
+		{ID: "cat-1", Name: "Coffee", Description: "Hot and cold coffee drinks", SortOrder: 1, Station: "bar"},
+		{ID: "cat-2", Name: "Non-Coffee", Description: "Tea, chocolate, and more", SortOrder: 2, Station: "bar"},
+		{ID: "cat-3", Name: "Food", Description: "Snacks and meals", SortOrder: 3, Station: "kitchen"},
+		{ID: "cat-4", Name: "Dessert", Description: "Sweet treats", SortOrder: 4, Station: "pastry"},
 	}
 
 	// Products with variants and modifiers
@@ -153,6 +154,7 @@ type Category struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	SortOrder   int    `json:"sort_order"`
+	Station     string `json:"station,omitempty"` // kitchen station that prepares it, e.g. bar
 }
 
 type Variant struct {
@@ -197,41 +199,88 @@ type User struct {
 }
 
 type OrderItem struct {
-	ID          string   `json:"id"`
-	ProductID   string   `json:"product_id"`
-	ProductName string   `json:"product_name"`
-	VariantID   string   `json:"variant_id,omitempty"`
-	VariantName string   `json:"variant_name,omitempty"`
-	Modifiers   []string `json:"modifiers,omitempty"`
-	Quantity    int      `json:"quantity"`
-	UnitPrice   int      `json:"unit_price"`
-	Subtotal    int      `json:"subtotal"`
-	Notes       string   `json:"notes,omitempty"`
+	ID             string   `json:"id"`
+	ProductID      string   `json:"product_id"`
+	ProductName    string   `json:"product_name"`
+	ExternalItemID string   `json:"external_item_id,omitempty"` // delivery platform item ID or SKU
+	VariantID      string   `json:"variant_id,omitempty"`
+	VariantName    string   `json:"variant_name,omitempty"`
+	Modifiers      []string `json:"modifiers,omitempty"`
+	ModifierNames  []string `json:"modifier_names,omitempty"` // modifiers as named by the delivery platform
+	Quantity       int      `json:"quantity"`
+	UnitPrice      int      `json:"unit_price"`
+	Subtotal       int      `json:"subtotal"`
+	Notes          string   `json:"notes,omitempty"`
+
+	ReadyAt          *time.Time `json:"ready_at,omitempty"`          // when the station marked this line ready
+	RefundedQuantity int        `json:"refunded_quantity,omitempty"` // units refunded to the customer
 }
 
 type Order struct {
-	ID              string      `json:"id"`
-	OrderNumber     string      `json:"order_number"`
-	ExternalOrderID string      `json:"external_order_id,omitempty"` // GrabFood/GoFood/Shopee order ID
-	TableID         string      `json:"table_id,omitempty"`
-	TableNumber     int         `json:"table_number,omitempty"`
-	OrderType       string      `json:"order_type"`   // dine_in, takeaway, delivery
-	OrderSource     string      `json:"order_source"` // cashier, table_qr, grabfood, gofood, shopee_food
-	Status          string      `json:"status"`       // pending, confirmed, cooking, ready, completed, cancelled
-	PaymentStatus   string      `json:"payment_status"`
-	Items           []OrderItem `json:"items"`
-	Subtotal        int         `json:"subtotal"`
-	Tax             int         `json:"tax"`
-	Total           int         `json:"total"`
-	Notes           string      `json:"notes,omitempty"`
-	CustomerName    string      `json:"customer_name,omitempty"`
-	CustomerPhone   string      `json:"customer_phone,omitempty"`
-	DeliveryAddress string      `json:"delivery_address,omitempty"`
-	DriverName      string      `json:"driver_name,omitempty"`
-	CreatedAt       time.Time   `json:"created_at"`
-	UpdatedAt       time.Time   `json:"updated_at"`
-	CashierID       string      `json:"cashier_id,omitempty"`
-	CashierName     string      `json:"cashier_name,omitempty"`
+	ID              string              `json:"id"`
+	OrderNumber     string              `json:"order_number"`
+	StoreID         string              `json:"store_id"`
+	ExternalOrderID string              `json:"external_order_id,omitempty"` // GrabFood/GoFood/Shopee order ID
+	TableID         string              `json:"table_id,omitempty"`
+	TableNumber     int                 `json:"table_number,omitempty"`
+	OrderType       string              `json:"order_type"`              // dine_in, takeaway, delivery
+	OrderSource     string              `json:"order_source"`            // cashier, table_qr, grabfood, gofood, shopee_food
+	Status          string              `json:"status"`                  // pending, confirmed, cooking, ready, completed, cancelled
+	StatusReason    string              `json:"status_reason,omitempty"` // why the order was auto-accepted, rejected or cancelled
+	PaymentStatus   string              `json:"payment_status"`          // unpaid, paid, partially_refunded, refunded
+	Items           []OrderItem         `json:"items"`
+	Subtotal        int                 `json:"subtotal"`
+	Tax             int                 `json:"tax"`
+	Total           int                 `json:"total"`
+	Notes           string              `json:"notes,omitempty"`
+	CustomerName    string              `json:"customer_name,omitempty"`
+	CustomerPhone   string              `json:"customer_phone,omitempty"`
+	DeliveryAddress string              `json:"delivery_address,omitempty"`
+	DriverName      string              `json:"driver_name,omitempty"`
+	Driver          *Driver             `json:"driver,omitempty"`          // courier details and progress for delivery orders
+	DriverEvents    []DriverEvent       `json:"driver_events,omitempty"`   // as reported by the platform
+	ReadyAt         *time.Time          `json:"ready_at,omitempty"`        // when the kitchen marked the food ready
+	AcknowledgedAt  *time.Time          `json:"acknowledged_at,omitempty"` // when the kitchen first saw the order
+	AcknowledgedBy  string              `json:"acknowledged_by,omitempty"`
+	AcceptDeadline  *time.Time          `json:"accept_deadline,omitempty"` // when the platform cancels a pending order
+	Payout          *DeliveryPayout     `json:"payout,omitempty"`          // commission and net for delivery orders
+	Cancellation    *OrderCancellation  `json:"cancellation,omitempty"`    // set when a platform cancelled the order
+	Modifications   []OrderModification `json:"modifications,omitempty"`   // item changes made on the platform
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
+	CashierID       string              `json:"cashier_id,omitempty"`
+	CashierName     string              `json:"cashier_name,omitempty"`
+	Refunded        int                 `json:"refunded,omitempty"` // given back by successful refunds
+}
+
+// OrderCancellation records a delivery platform cancelling an order and who
+// pays for any food already made
+type OrderCancellation struct {
+	CancelledBy    string    `json:"cancelled_by"` // customer, platform, driver, merchant
+	Reason         string    `json:"reason,omitempty"`
+	StatusAtCancel string    `json:"status_at_cancel"`
+	FoodMade       bool      `json:"food_made"`
+	CostBearer     string    `json:"cost_bearer"` // none, platform, merchant
+	FoodValue      int       `json:"food_value"`  // menu value of what was made
+	Compensation   int       `json:"compensation,omitempty"`
+	CancelledAt    time.Time `json:"cancelled_at"`
+}
+
+// OrderModification records a delivery platform changing an order's items
+type OrderModification struct {
+	Reason        string       `json:"reason,omitempty"`
+	Changes       []ItemChange `json:"changes"`
+	PreviousTotal int          `json:"previous_total"`
+	Total         int          `json:"total"`
+	ModifiedAt    time.Time    `json:"modified_at"`
+}
+
+// ItemChange is one line of an order modification; a zero quantity means the
+// item was added (Before) or removed (After)
+type ItemChange struct {
+	Name   string `json:"name"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
 }
 
 // Helper functions
@@ -243,9 +292,6 @@ func GetNextOrderNumber() string {
 }
 
 func GetNextDeliveryOrderNumber(source string) string {
-	mu.Lock()
-	defer mu.Unlock()
-	orderSeq++
 	prefix := "DEL"
 	switch source {
 	case SourceGrabFood:
@@ -254,7 +300,15 @@ func GetNextDeliveryOrderNumber(source string) string {
 		prefix = "GOFOOD"
 	case SourceShopeeFood:
 		prefix = "SHOPEE"
+	default:
+		if isIntegrationSource(source) {
+			prefix = strings.ToUpper(source)
+		}
 	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	orderSeq++
 	return fmt.Sprintf("%s-%04d", prefix, orderSeq)
 }
 
@@ -267,12 +321,9 @@ func AddOrder(order Order) {
 func UpdateOrderStatus(orderID, status string) bool {
 	mu.Lock()
 	defer mu.Unlock()
-	for i := range Orders {
-		if Orders[i].ID == orderID {
-			Orders[i].Status = status
-			Orders[i].UpdatedAt = time.Now()
-			return true
-		}
+	if o := findOrder(orderID); o != nil {
+		setStatus(o, status, time.Now())
+		return true
 	}
 	return false
 }
@@ -321,7 +372,105 @@ func GetOrderByID(orderID string) *Order {
 	return nil
 }
 
-// IsDeliverySource checks if the source is from a delivery platform
+// OrderItems returns a copy of an order's items, safe to read without the lock
+func OrderItems(orderID string) ([]OrderItem, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range Orders {
+		if Orders[i].ID == orderID {
+			items := make([]OrderItem, len(Orders[i].Items))
+			for j, item := range Orders[i].Items {
+				item.Modifiers = append([]string(nil), item.Modifiers...)
+				item.ModifierNames = append([]string(nil), item.ModifierNames...)
+				items[j] = item
+			}
+			return items, true
+		}
+	}
+	return nil, false
+}
+
+// OrderStations lists the kitchen stations preparing an order's items
+func OrderStations(order *Order) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var stations []string
+	seen := make(map[string]bool)
+	for _, item := range order.Items {
+		for _, p := range Products {
+			if p.ID != item.ProductID {
+				continue
+			}
+			for _, cat := range Categories {
+				if cat.ID == p.CategoryID && cat.Station != "" && !seen[cat.Station] {
+					seen[cat.Station] = true
+					stations = append(stations, cat.Station)
+				}
+			}
+		}
+	}
+	return stations
+}
+
+// FindOrderByExternalID returns a platform's order by the platform's own ID
+func FindOrderByExternalID(source, externalID string) *Order {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range Orders {
+		if Orders[i].OrderSource == source && Orders[i].ExternalOrderID == externalID {
+			found := Orders[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// SetProductAvailability marks a product as available or sold out
+func SetProductAvailability(productID string, available bool) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range Products {
+		if Products[i].ID == productID {
+			Products[i].IsAvailable = available
+			return true
+		}
+	}
+	return false
+}
+
+// ListProducts returns a copy of the catalog
+func ListProducts() []Product {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := make([]Product, len(Products))
+	for i := range Products {
+		result[i] = copyProduct(&Products[i])
+	}
+	return result
+}
+
+// copyProduct copies a product with its variants and modifiers. Callers hold mu.
+func copyProduct(p *Product) Product {
+	c := *p
+	c.Variants = append([]Variant(nil), p.Variants...)
+	c.Modifiers = append([]Modifier(nil), p.Modifiers...)
+	return c
+}
+
+// UpdateProduct applies fn to a product while holding the data lock
+func UpdateProduct(productID string, fn func(p *Product)) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range Products {
+		if Products[i].ID == productID {
+			fn(&Products[i])
+			return true
+		}
+	}
+	return false
+}
+
+// IsDeliverySource checks if the source is from a delivery platform, built in or mapped
 func IsDeliverySource(source string) bool {
-	return source == SourceGrabFood || source == SourceGoFood || source == SourceShopeeFood
+	return source == SourceGrabFood || source == SourceGoFood || source == SourceShopeeFood || isIntegrationSource(source)
 }
@@ -0,0 +1,144 @@
+package dummy
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultStoreID is the store used for dummy data and for webhooks that don't name one
+const DefaultStoreID = "store-1"
+
+// Default seconds a platform gives us to accept an order before it cancels it
+var defaultAcceptTimeouts = map[string]int{
+	SourceGrabFood:   300,
+	SourceGoFood:     180,
+	SourceShopeeFood: 300,
+}
+
+var (
+	rulesMu sync.RWMutex
+
+	// DeliveryRules holds per-store, per-platform acceptance rules
+	DeliveryRules = []DeliveryRule{}
+)
+
+// DeliveryRule decides what happens to a new delivery order before a cashier sees it
+type DeliveryRule struct {
+	StoreID  string `json:"store_id"`
+	Platform string `json:"platform"`
+
+	// Auto-accept every order that arrives between OpensAt and ClosesAt ("HH:MM", store local time)
+	AutoAcceptDuringHours bool   `json:"auto_accept_during_hours"`
+	OpensAt               string `json:"opens_at"`
+	ClosesAt              string `json:"closes_at"`
+
+	// Auto-accept orders whose total is at or below this amount (0 disables)
+	AutoAcceptMaxTotal int `json:"auto_accept_max_total"`
+
+	// Reject orders containing an item we have marked unavailable
+	AutoRejectOutOfStock bool `json:"auto_reject_out_of_stock"`
+
+	// Seconds before the platform cancels an order we haven't accepted
+	AcceptTimeoutSeconds int `json:"accept_timeout_seconds"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DefaultDeliveryRule is used for store/platform pairs nobody has configured:
+// everything waits for a cashier, within the platform's usual timeout
+func DefaultDeliveryRule(storeID, platform string) DeliveryRule {
+	timeout := defaultAcceptTimeouts[platform]
+	if timeout == 0 {
+		timeout = 300
+	}
+	return DeliveryRule{
+		StoreID:              storeID,
+		Platform:             platform,
+		OpensAt:              "08:00",
+		ClosesAt:             "22:00",
+		AcceptTimeoutSeconds: timeout,
+	}
+}
+
+// GetDeliveryRule returns the configured rule or the default one
+func GetDeliveryRule(storeID, platform string) DeliveryRule {
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	for _, r := range DeliveryRules {
+		if r.StoreID == storeID && r.Platform == platform {
+			return r
+		}
+	}
+	return DefaultDeliveryRule(storeID, platform)
+}
+
+// ListDeliveryRules returns the effective rule for every platform of a store
+func ListDeliveryRules(storeID string) []DeliveryRule {
+	platforms := []string{SourceGrabFood, SourceGoFood, SourceShopeeFood}
+	rules := make([]DeliveryRule, len(platforms))
+	for i, p := range platforms {
+		rules[i] = GetDeliveryRule(storeID, p)
+	}
+	return rules
+}
+
+// SaveDeliveryRule creates or replaces the rule for a store/platform pair
+func SaveDeliveryRule(rule DeliveryRule) DeliveryRule {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	rule.UpdatedAt = time.Now()
+	for i := range DeliveryRules {
+		if DeliveryRules[i].StoreID == rule.StoreID && DeliveryRules[i].Platform == rule.Platform {
+			DeliveryRules[i] = rule
+			return rule
+		}
+	}
+	DeliveryRules = append(DeliveryRules, rule)
+	return rule
+}
+
+var (
+	pauseMu sync.RWMutex
+
+	// DeliveryPauses holds stores that have stopped taking delivery orders
+	DeliveryPauses = map[string]DeliveryPause{}
+)
+
+// DeliveryPause takes a store offline on every delivery platform, e.g. when the kitchen is overloaded
+type DeliveryPause struct {
+	StoreID   string    `json:"store_id"`
+	Paused    bool      `json:"paused"`
+	Reason    string    `json:"reason,omitempty"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetDeliveryPause returns a store's pause state (not paused if never set)
+func GetDeliveryPause(storeID string) DeliveryPause {
+	pauseMu.RLock()
+	defer pauseMu.RUnlock()
+	if p, ok := DeliveryPauses[storeID]; ok {
+		return p
+	}
+	return DeliveryPause{StoreID: storeID}
+}
+
+// ListDeliveryPauses returns every store whose pause state has been set
+func ListDeliveryPauses() []DeliveryPause {
+	pauseMu.RLock()
+	defer pauseMu.RUnlock()
+	result := make([]DeliveryPause, 0, len(DeliveryPauses))
+	for _, p := range DeliveryPauses {
+		result = append(result, p)
+	}
+	return result
+}
+
+// SetDeliveryPause pauses or resumes a store on all delivery platforms
+func SetDeliveryPause(p DeliveryPause) DeliveryPause {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	p.UpdatedAt = time.Now()
+	DeliveryPauses[p.StoreID] = p
+	return p
+}
@@ -0,0 +1,120 @@
+package dummy
+
+import (
+	"errors"
+	"time"
+)
+
+// Driver stages, in the order they happen
+const (
+	DriverAssigned  = "assigned"
+	DriverArriving  = "arriving"
+	DriverArrived   = "arrived"
+	DriverPickedUp  = "picked_up"
+	DriverDelivered = "delivered"
+)
+
+var driverStageRank = map[string]int{
+	DriverAssigned:  1,
+	DriverArriving:  2,
+	DriverArrived:   3,
+	DriverPickedUp:  4,
+	DriverDelivered: 5,
+}
+
+// ErrOrderNotFound is returned when an update names an order we don't have
+var ErrOrderNotFound = errors.New("order not found")
+
+// IsDriverStage reports whether stage is a known driver stage
+func IsDriverStage(stage string) bool {
+	return driverStageRank[stage] > 0
+}
+
+// Driver is the courier collecting a delivery order and how far along they are
+type Driver struct {
+	Name        string     `json:"name,omitempty"`
+	Phone       string     `json:"phone,omitempty"`
+	Plate       string     `json:"plate,omitempty"`
+	Stage       string     `json:"stage"` // furthest stage reported so far
+	AssignedAt  *time.Time `json:"assigned_at,omitempty"`
+	ArrivingAt  *time.Time `json:"arriving_at,omitempty"`
+	ArrivedAt   *time.Time `json:"arrived_at,omitempty"`
+	PickedUpAt  *time.Time `json:"picked_up_at,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// DriverEvent is one driver update as the platform reported it
+type DriverEvent struct {
+	Stage      string    `json:"stage"`
+	Name       string    `json:"name,omitempty"`
+	Phone      string    `json:"phone,omitempty"`
+	Plate      string    `json:"plate,omitempty"`
+	At         time.Time `json:"at"` // when it happened, per the platform
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// RecordDriverEvent applies a driver update to an order. Platforms resend and
+// reorder events, so an event already recorded is ignored (duplicate is true)
+// and a late event never moves the driver back to an earlier stage. A new
+// driver being assigned replaces the previous one.
+func RecordDriverEvent(orderID string, event DriverEvent) (order Order, duplicate bool, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var o *Order
+	for i := range Orders {
+		if Orders[i].ID == orderID {
+			o = &Orders[i]
+			break
+		}
+	}
+	if o == nil {
+		return Order{}, false, ErrOrderNotFound
+	}
+
+	for _, e := range o.DriverEvents {
+		if e.Stage == event.Stage && e.At.Equal(event.At) {
+			return *o, true, nil
+		}
+	}
+
+	o.DriverEvents = append(o.DriverEvents, event)
+	if o.Driver == nil || (event.Stage == DriverAssigned && event.Name != "" && event.Name != o.Driver.Name) {
+		o.Driver = &Driver{}
+	}
+	d := o.Driver
+	if event.Name != "" {
+		d.Name = event.Name
+		o.DriverName = event.Name
+	}
+	if event.Phone != "" {
+		d.Phone = event.Phone
+	}
+	if event.Plate != "" {
+		d.Plate = event.Plate
+	}
+
+	at := event.At
+	switch event.Stage {
+	case DriverAssigned:
+		d.AssignedAt = &at
+	case DriverArriving:
+		d.ArrivingAt = &at
+	case DriverArrived:
+		d.ArrivedAt = &at
+	case DriverPickedUp:
+		d.PickedUpAt = &at
+	case DriverDelivered:
+		d.DeliveredAt = &at
+	}
+	if driverStageRank[event.Stage] > driverStageRank[d.Stage] {
+		d.Stage = event.Stage
+	}
+	o.UpdatedAt = time.Now()
+
+	found := *o
+	found.DriverEvents = append([]DriverEvent{}, o.DriverEvents...)
+	driver := *d
+	found.Driver = &driver
+	return found, false, nil
+}
@@ -0,0 +1,109 @@
+package dummy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	integrationMu sync.RWMutex
+
+	// Integrations are delivery aggregators onboarded through a field mapping
+	// instead of a hand-written webhook handler
+	Integrations = []Integration{}
+)
+
+// Integration maps one aggregator's webhook payload onto our orders. Orders
+// from it use Slug as their order source.
+type Integration struct {
+	ID        string    `json:"id"`
+	Slug      string    `json:"slug"`     // webhook URL segment and order source
+	StoreID   string    `json:"store_id"` // the store its orders go to
+	Name      string    `json:"name"`
+	Format    string    `json:"format"` // yaml or json
+	Mapping   string    `json:"mapping"`
+	Secret    string    `json:"-"` // expected X-Webhook-Token; required while active
+	HasSecret bool      `json:"has_secret"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ListIntegrations returns a store's integrations, or every store's if storeID is empty
+func ListIntegrations(storeID string) []Integration {
+	integrationMu.RLock()
+	defer integrationMu.RUnlock()
+	result := []Integration{}
+	for _, in := range Integrations {
+		if storeID == "" || in.StoreID == storeID {
+			result = append(result, in)
+		}
+	}
+	return result
+}
+
+// GetIntegration returns an integration by ID
+func GetIntegration(id string) *Integration {
+	integrationMu.RLock()
+	defer integrationMu.RUnlock()
+	for i := range Integrations {
+		if Integrations[i].ID == id {
+			found := Integrations[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// FindIntegration returns an integration by slug
+func FindIntegration(slug string) *Integration {
+	integrationMu.RLock()
+	defer integrationMu.RUnlock()
+	for i := range Integrations {
+		if Integrations[i].Slug == slug {
+			found := Integrations[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// SaveIntegration creates an integration, or replaces the one with the same ID
+func SaveIntegration(in Integration) Integration {
+	integrationMu.Lock()
+	defer integrationMu.Unlock()
+	in.HasSecret = in.Secret != ""
+	in.UpdatedAt = time.Now()
+	for i := range Integrations {
+		if Integrations[i].ID == in.ID {
+			in.CreatedAt = Integrations[i].CreatedAt
+			Integrations[i] = in
+			return in
+		}
+	}
+	in.ID = uuid.New().String()
+	in.CreatedAt = in.UpdatedAt
+	Integrations = append(Integrations, in)
+	return in
+}
+
+// DeleteIntegration removes an integration by ID
+func DeleteIntegration(id string) bool {
+	integrationMu.Lock()
+	defer integrationMu.Unlock()
+	for i := range Integrations {
+		if Integrations[i].ID == id {
+			Integrations = append(Integrations[:i], Integrations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// isIntegrationSource reports whether source is an active mapped integration
+func isIntegrationSource(source string) bool {
+	in := FindIntegration(source)
+	return in != nil && in.IsActive
+}
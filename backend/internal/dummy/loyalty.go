@@ -0,0 +1,168 @@
+package dummy
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Point entry types, as in member_points
+const (
+	PointsEarn    = "earn"
+	PointsRedeem  = "redeem"
+	PointsBonus   = "bonus"
+	PointsExpired = "expired"
+	PointsRefund  = "refund" // taken back or given back by a refund
+)
+
+var (
+	// MemberPoints is the members' points history, oldest first. Guarded by mu
+	// along with Orders and Refunds, so a refund and its reversal are recorded
+	// together.
+	MemberPoints = []PointEntry{}
+
+	// VoucherUses are the vouchers redeemed on orders. Guarded by mu.
+	VoucherUses = []VoucherUse{}
+)
+
+// PointEntry is points a member earned or spent
+type PointEntry struct {
+	ID          string    `json:"id"`
+	MemberID    string    `json:"member_id"`
+	OrderID     string    `json:"order_id,omitempty"`
+	Points      int       `json:"points"` // negative when taken away or spent
+	Type        string    `json:"type"`   // earn, redeem, bonus, expired, refund
+	Description string    `json:"description,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// VoucherUse is a voucher redeemed on an order
+type VoucherUse struct {
+	ID              string     `json:"id"`
+	VoucherCode     string     `json:"voucher_code"`
+	OrderID         string     `json:"order_id"`
+	MemberID        string     `json:"member_id,omitempty"`
+	DiscountApplied int        `json:"discount_applied"`
+	UsedAt          time.Time  `json:"used_at"`
+	ReversedAt      *time.Time `json:"reversed_at,omitempty"` // the order was refunded; the use no longer counts
+}
+
+// AddPointEntry records points earned, redeemed or adjusted
+func AddPointEntry(e PointEntry) PointEntry {
+	mu.Lock()
+	defer mu.Unlock()
+	return addPointEntry(e)
+}
+
+// MemberPointHistory lists a member's points entries, oldest first
+func MemberPointHistory(memberID string) []PointEntry {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []PointEntry{}
+	for _, e := range MemberPoints {
+		if e.MemberID == memberID {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// MemberPointBalance sums a member's points
+func MemberPointBalance(memberID string) int {
+	total := 0
+	for _, e := range MemberPointHistory(memberID) {
+		total += e.Points
+	}
+	return total
+}
+
+// AddVoucherUse records a voucher redeemed on an order
+func AddVoucherUse(u VoucherUse) VoucherUse {
+	mu.Lock()
+	defer mu.Unlock()
+	u.ID = uuid.New().String()
+	if u.UsedAt.IsZero() {
+		u.UsedAt = time.Now()
+	}
+	VoucherUses = append(VoucherUses, u)
+	return u
+}
+
+// VoucherUseCount counts a voucher's uses that haven't been reversed
+func VoucherUseCount(code string) int {
+	mu.RLock()
+	defer mu.RUnlock()
+	n := 0
+	for _, u := range VoucherUses {
+		if u.VoucherCode == code && u.ReversedAt == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// reverseLoyalty takes back the points an order earned on a refund's part of
+// what was paid. Once the whole order is refunded, the rest of the earned
+// points go too, points spent on it are given back and its vouchers can be
+// used again. Callers hold mu.
+func reverseLoyalty(o *Order, r *Refund, paid int, full bool, now time.Time) {
+	type points struct{ earned, taken, spent int }
+	byMember := map[string]*points{}
+	members := []string{}
+	for _, e := range MemberPoints {
+		if e.OrderID != o.ID {
+			continue
+		}
+		m := byMember[e.MemberID]
+		if m == nil {
+			m = &points{}
+			byMember[e.MemberID] = m
+			members = append(members, e.MemberID)
+		}
+		switch {
+		case e.Type == PointsEarn:
+			m.earned += e.Points
+		case e.Type == PointsRedeem:
+			m.spent -= e.Points
+		case e.Type == PointsRefund && e.Points < 0:
+			m.taken -= e.Points
+		}
+	}
+
+	for _, member := range members {
+		m := byMember[member]
+		// Whatever rounding left goes with the last refund
+		back := m.earned - m.taken
+		if !full && paid > 0 {
+			back = min(m.earned*r.Amount/paid, back)
+		}
+		if back > 0 {
+			addPointEntry(PointEntry{MemberID: member, OrderID: o.ID, Points: -back, Type: PointsRefund, Description: "Refund on order " + o.OrderNumber})
+			r.PointsReversed += back
+		}
+		if full && m.spent > 0 {
+			addPointEntry(PointEntry{MemberID: member, OrderID: o.ID, Points: m.spent, Type: PointsRefund, Description: "Points spent on refunded order " + o.OrderNumber})
+			r.PointsReturned += m.spent
+		}
+	}
+
+	if !full {
+		return
+	}
+	for i := range VoucherUses {
+		if u := &VoucherUses[i]; u.OrderID == o.ID && u.ReversedAt == nil {
+			u.ReversedAt = &now
+			r.VouchersReleased = append(r.VouchersReleased, u.VoucherCode)
+		}
+	}
+}
+
+// addPointEntry records a points entry. Callers hold mu.
+func addPointEntry(e PointEntry) PointEntry {
+	e.ID = uuid.New().String()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	MemberPoints = append(MemberPoints, e)
+	return e
+}
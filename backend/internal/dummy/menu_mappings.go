@@ -0,0 +1,294 @@
+package dummy
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Menu mapping kinds
+const (
+	MappingKindItem     = "item"
+	MappingKindVariant  = "variant"
+	MappingKindModifier = "modifier"
+)
+
+// Unmapped item statuses
+const (
+	UnmappedStatusOpen     = "open"
+	UnmappedStatusResolved = "resolved"
+	UnmappedStatusIgnored  = "ignored"
+)
+
+var (
+	mappingMu sync.RWMutex
+
+	// MenuMappings links delivery platform menu entries to our catalog
+	MenuMappings = []MenuMapping{}
+
+	// UnmappedItems is the queue of platform entries we could not resolve
+	UnmappedItems = []UnmappedItem{}
+)
+
+// MenuMapping links a delivery platform menu entry to a product, variant or modifier.
+// Item mappings may also pin a variant (e.g. GrabFood "Iced Latte" -> Latte / Iced).
+// Variant and modifier mappings are scoped to ProductID when it is set.
+type MenuMapping struct {
+	ID           string    `json:"id"`
+	Platform     string    `json:"platform"`
+	Kind         string    `json:"kind"`                  // item, variant, modifier
+	ExternalID   string    `json:"external_id,omitempty"` // platform item ID or SKU
+	ExternalName string    `json:"external_name"`
+	ProductID    string    `json:"product_id,omitempty"`
+	VariantID    string    `json:"variant_id,omitempty"`
+	ModifierID   string    `json:"modifier_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// UnmappedItem is a platform menu entry seen on an order that matched nothing in our catalog
+type UnmappedItem struct {
+	ID           string    `json:"id"`
+	Platform     string    `json:"platform"`
+	Kind         string    `json:"kind"`
+	ExternalID   string    `json:"external_id,omitempty"`
+	ExternalName string    `json:"external_name"`
+	ProductID    string    `json:"product_id,omitempty"` // parent product for variant/modifier entries
+	Occurrences  int       `json:"occurrences"`
+	OrderIDs     []string  `json:"order_ids"`
+	Status       string    `json:"status"`
+	MappingID    string    `json:"mapping_id,omitempty"`
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+}
+
+// NormalizeMenuName lowercases and collapses whitespace for name comparisons
+func NormalizeMenuName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// FindMenuMapping looks up a mapping by external ID first, then by name.
+// productID scopes variant and modifier lookups; mappings without a product apply to all.
+func FindMenuMapping(platform, kind, externalID, name, productID string) *MenuMapping {
+	mappingMu.RLock()
+	defer mappingMu.RUnlock()
+
+	if externalID != "" {
+		for i := range MenuMappings {
+			m := &MenuMappings[i]
+			if m.Platform == platform && m.Kind == kind && m.ExternalID == externalID && mappingInScope(m, productID) {
+				found := *m
+				return &found
+			}
+		}
+	}
+
+	normalized := NormalizeMenuName(name)
+	if normalized == "" {
+		return nil
+	}
+	for i := range MenuMappings {
+		m := &MenuMappings[i]
+		if m.Platform == platform && m.Kind == kind && NormalizeMenuName(m.ExternalName) == normalized && mappingInScope(m, productID) {
+			found := *m
+			return &found
+		}
+	}
+	return nil
+}
+
+func mappingInScope(m *MenuMapping, productID string) bool {
+	if m.Kind == MappingKindItem {
+		return true
+	}
+	return m.ProductID == "" || m.ProductID == productID
+}
+
+// ListMenuMappings returns mappings, optionally filtered by platform
+func ListMenuMappings(platform string) []MenuMapping {
+	mappingMu.RLock()
+	defer mappingMu.RUnlock()
+	result := []MenuMapping{}
+	for _, m := range MenuMappings {
+		if platform == "" || m.Platform == platform {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// GetMenuMapping returns a mapping by ID
+func GetMenuMapping(id string) *MenuMapping {
+	mappingMu.RLock()
+	defer mappingMu.RUnlock()
+	for i := range MenuMappings {
+		if MenuMappings[i].ID == id {
+			found := MenuMappings[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// SaveMenuMapping creates a mapping, or replaces the existing one for the same platform entry
+func SaveMenuMapping(m MenuMapping) MenuMapping {
+	mappingMu.Lock()
+	defer mappingMu.Unlock()
+
+	now := time.Now()
+	for i := range MenuMappings {
+		existing := &MenuMappings[i]
+		if existing.ID == m.ID || sameMappingKey(existing, &m) {
+			m.ID = existing.ID
+			m.CreatedAt = existing.CreatedAt
+			m.UpdatedAt = now
+			MenuMappings[i] = m
+			return m
+		}
+	}
+
+	if m.ID == "" {
+		m.ID = uuid.New().String()
+	}
+	m.CreatedAt = now
+	m.UpdatedAt = now
+	MenuMappings = append(MenuMappings, m)
+	return m
+}
+
+func sameMappingKey(a, b *MenuMapping) bool {
+	if a.Platform != b.Platform || a.Kind != b.Kind {
+		return false
+	}
+	if a.Kind != MappingKindItem && a.ProductID != b.ProductID {
+		return false
+	}
+	if a.ExternalID != "" || b.ExternalID != "" {
+		return a.ExternalID == b.ExternalID
+	}
+	return NormalizeMenuName(a.ExternalName) == NormalizeMenuName(b.ExternalName)
+}
+
+// DeleteMenuMapping removes a mapping by ID
+func DeleteMenuMapping(id string) bool {
+	mappingMu.Lock()
+	defer mappingMu.Unlock()
+	for i := range MenuMappings {
+		if MenuMappings[i].ID == id {
+			MenuMappings = append(MenuMappings[:i], MenuMappings[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RecordUnmappedItem adds a platform entry to the unmapped queue, or bumps its count if already queued
+func RecordUnmappedItem(platform, kind, externalID, name, productID, orderID string) UnmappedItem {
+	mappingMu.Lock()
+	defer mappingMu.Unlock()
+
+	now := time.Now()
+	normalized := NormalizeMenuName(name)
+	for i := range UnmappedItems {
+		u := &UnmappedItems[i]
+		if u.Status != UnmappedStatusOpen || u.Platform != platform || u.Kind != kind || u.ProductID != productID {
+			continue
+		}
+		if (externalID != "" && u.ExternalID == externalID) || (externalID == "" && NormalizeMenuName(u.ExternalName) == normalized) {
+			u.Occurrences++
+			u.LastSeenAt = now
+			if orderID != "" {
+				u.OrderIDs = append(u.OrderIDs, orderID)
+			}
+			return *u
+		}
+	}
+
+	u := UnmappedItem{
+		ID:           uuid.New().String(),
+		Platform:     platform,
+		Kind:         kind,
+		ExternalID:   externalID,
+		ExternalName: name,
+		ProductID:    productID,
+		Occurrences:  1,
+		OrderIDs:     []string{},
+		Status:       UnmappedStatusOpen,
+		FirstSeenAt:  now,
+		LastSeenAt:   now,
+	}
+	if orderID != "" {
+		u.OrderIDs = append(u.OrderIDs, orderID)
+	}
+	UnmappedItems = append(UnmappedItems, u)
+	return u
+}
+
+// ListUnmappedItems returns queue entries with the given status ("" for all)
+func ListUnmappedItems(platform, status string) []UnmappedItem {
+	mappingMu.RLock()
+	defer mappingMu.RUnlock()
+	result := []UnmappedItem{}
+	for _, u := range UnmappedItems {
+		if (platform == "" || u.Platform == platform) && (status == "" || u.Status == status) {
+			result = append(result, u)
+		}
+	}
+	return result
+}
+
+// GetUnmappedItem returns a queue entry by ID
+func GetUnmappedItem(id string) *UnmappedItem {
+	mappingMu.RLock()
+	defer mappingMu.RUnlock()
+	for i := range UnmappedItems {
+		if UnmappedItems[i].ID == id {
+			found := UnmappedItems[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// CloseUnmappedItem marks a queue entry resolved (with the mapping that fixed it) or ignored
+func CloseUnmappedItem(id, status, mappingID string) bool {
+	mappingMu.Lock()
+	defer mappingMu.Unlock()
+	for i := range UnmappedItems {
+		if UnmappedItems[i].ID == id {
+			UnmappedItems[i].Status = status
+			UnmappedItems[i].MappingID = mappingID
+			return true
+		}
+	}
+	return false
+}
+
+// FindProduct returns a copy of a catalog product by ID
+func FindProduct(productID string) *Product {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range Products {
+		if Products[i].ID == productID {
+			p := copyProduct(&Products[i])
+			return &p
+		}
+	}
+	return nil
+}
+
+// UpdateOrder applies fn to an order under the store lock
+func UpdateOrder(orderID string, fn func(o *Order)) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range Orders {
+		if Orders[i].ID == orderID {
+			fn(&Orders[i])
+			Orders[i].UpdatedAt = time.Now()
+			return true
+		}
+	}
+	return false
+}
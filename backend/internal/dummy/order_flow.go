@@ -0,0 +1,166 @@
+package dummy
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrInvalidTransition is returned for a status change the order flow doesn't allow
+	ErrInvalidTransition = errors.New("invalid status change")
+
+	// ErrItemNotFound is returned when an update names an item the order doesn't have
+	ErrItemNotFound = errors.New("order item not found")
+)
+
+// orderTransitions lists the statuses an order may move to from each status.
+// Going back from ready or completed is the kitchen recalling an order.
+var orderTransitions = map[string][]string{
+	"pending":   {"confirmed", "cancelled"},
+	"confirmed": {"cooking", "ready", "cancelled"},
+	"cooking":   {"ready", "cancelled"},
+	"ready":     {"completed", "cooking", "cancelled"},
+	"completed": {"ready"},
+}
+
+// kitchenFlow is the order a kitchen display bumps through
+var kitchenFlow = []string{"confirmed", "cooking", "ready", "completed"}
+
+// CanTransition reports whether an order may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// BumpStatus is the status a kitchen bump moves an order to
+func BumpStatus(status string) (string, bool) {
+	for i := 0; i < len(kitchenFlow)-1; i++ {
+		if kitchenFlow[i] == status {
+			return kitchenFlow[i+1], true
+		}
+	}
+	return "", false
+}
+
+// RecallStatus is the status a recalled order goes back to
+func RecallStatus(status string) (string, bool) {
+	for i := 2; i < len(kitchenFlow); i++ {
+		if kitchenFlow[i] == status {
+			return kitchenFlow[i-1], true
+		}
+	}
+	return "", false
+}
+
+// TransitionOrder moves an order to status if the order flow allows it and
+// returns the order before and after. Setting the status it already has is a
+// no-op, so retried requests succeed.
+func TransitionOrder(orderID, status string) (before, after Order, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	o := findOrder(orderID)
+	if o == nil {
+		return Order{}, Order{}, ErrOrderNotFound
+	}
+	before = *o
+	if o.Status != status {
+		if !CanTransition(o.Status, status) {
+			return before, before, fmt.Errorf("%w: %s to %s", ErrInvalidTransition, o.Status, status)
+		}
+		setStatus(o, status, time.Now())
+	}
+	return before, *o, nil
+}
+
+// AcknowledgeOrder records that the kitchen has seen an order. Acknowledging it
+// again changes nothing and reports a duplicate.
+func AcknowledgeOrder(orderID, userID string) (order Order, duplicate bool, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	o := findOrder(orderID)
+	if o == nil {
+		return Order{}, false, ErrOrderNotFound
+	}
+	if o.Status == "cancelled" || o.Status == "completed" {
+		return *o, false, fmt.Errorf("%w: order is already %s", ErrInvalidTransition, o.Status)
+	}
+	if o.AcknowledgedAt != nil {
+		return *o, true, nil
+	}
+	now := time.Now()
+	o.AcknowledgedAt = &now
+	o.AcknowledgedBy = userID
+	o.UpdatedAt = now
+	return *o, false, nil
+}
+
+// MarkItemReady marks one line of an order ready. Starting on an item puts a
+// confirmed order into cooking, and the order is ready once every line is.
+func MarkItemReady(orderID, itemID string) (before, after Order, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+	o := findOrder(orderID)
+	if o == nil {
+		return Order{}, Order{}, ErrOrderNotFound
+	}
+	before = *o
+	if o.Status != "confirmed" && o.Status != "cooking" {
+		return before, before, fmt.Errorf("%w: items of a %s order can't be marked ready", ErrInvalidTransition, o.Status)
+	}
+	idx := -1
+	for i := range o.Items {
+		if o.Items[i].ID == itemID {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return before, before, ErrItemNotFound
+	}
+
+	now := time.Now()
+	items := append([]OrderItem{}, o.Items...) // before keeps the old lines
+	if items[idx].ReadyAt == nil {
+		items[idx].ReadyAt = &now
+	}
+	o.Items = items
+	o.UpdatedAt = now
+	if o.Status == "confirmed" {
+		setStatus(o, "cooking", now)
+	}
+	allReady := true
+	for _, item := range o.Items {
+		allReady = allReady && item.ReadyAt != nil
+	}
+	if allReady {
+		setStatus(o, "ready", now)
+	}
+	return before, *o, nil
+}
+
+// findOrder returns the order with the ID. Callers hold mu.
+func findOrder(orderID string) *Order {
+	for i := range Orders {
+		if Orders[i].ID == orderID {
+			return &Orders[i]
+		}
+	}
+	return nil
+}
+
+// setStatus changes an order's status. A recalled order is no longer ready, so
+// the next time it is ready counts for driver wait. Callers hold mu.
+func setStatus(o *Order, status string, now time.Time) {
+	if o.Status == "ready" && status == "cooking" {
+		o.ReadyAt = nil
+	}
+	o.Status = status
+	o.UpdatedAt = now
+	if status == "ready" && o.ReadyAt == nil {
+		o.ReadyAt = &now
+	}
+}
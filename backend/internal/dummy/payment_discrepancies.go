@@ -0,0 +1,119 @@
+package dummy
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment discrepancy kinds
+const (
+	DiscrepancyAmountMismatch    = "amount_mismatch"    // the provider charged a different amount
+	DiscrepancyPaidAfterExpiry   = "paid_after_expiry"  // money arrived for a payment we had given up on
+	DiscrepancyPaidCancelled     = "paid_cancelled"     // a cancelled order was paid
+	DiscrepancyOverpaid          = "overpaid"           // other payments had already covered the order
+	DiscrepancyStatusUnavailable = "status_unavailable" // the provider couldn't tell us about a stale payment
+	DiscrepancyUnknownProvider   = "unknown_provider"   // nothing is configured to ask
+)
+
+// ErrDiscrepancyNotFound is returned for unknown discrepancies
+var ErrDiscrepancyNotFound = errors.New("payment discrepancy not found")
+
+var (
+	discrepanciesMu sync.RWMutex
+
+	// PaymentDiscrepancies are what reconciliation found that needs a person,
+	// oldest first
+	PaymentDiscrepancies = []PaymentDiscrepancy{}
+)
+
+// PaymentDiscrepancy is a payment whose state we and the provider disagree on,
+// for an admin to review
+type PaymentDiscrepancy struct {
+	ID        string    `json:"id"`
+	PaymentID string    `json:"payment_id"`
+	OrderID   string    `json:"order_id"`
+	StoreID   string    `json:"store_id"`
+	Provider  string    `json:"provider"`
+	Kind      string    `json:"kind"`
+	Detail    string    `json:"detail"`
+	Ours      int       `json:"ours,omitempty"`   // our amount, for amount mismatches
+	Theirs    int       `json:"theirs,omitempty"` // the provider's
+	FoundAt   time.Time `json:"found_at"`
+
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+}
+
+// AddPaymentDiscrepancy records a discrepancy once: the same kind on the same
+// payment isn't reported again, whether or not the first was reviewed. It
+// returns false for repeats.
+func AddPaymentDiscrepancy(d PaymentDiscrepancy) (PaymentDiscrepancy, bool) {
+	discrepanciesMu.Lock()
+	defer discrepanciesMu.Unlock()
+	for _, existing := range PaymentDiscrepancies {
+		if existing.PaymentID == d.PaymentID && existing.Kind == d.Kind {
+			return existing, false
+		}
+	}
+	d.ID = uuid.New().String()
+	if d.FoundAt.IsZero() {
+		d.FoundAt = time.Now()
+	}
+	PaymentDiscrepancies = append(PaymentDiscrepancies, d)
+	return d, true
+}
+
+// ListPaymentDiscrepancies filters by store, by the day they were found
+// ("2006-01-02", local time) and by whether they were reviewed. Empty filters
+// match everything.
+func ListPaymentDiscrepancies(storeID, date string, reviewed *bool) []PaymentDiscrepancy {
+	discrepanciesMu.RLock()
+	defer discrepanciesMu.RUnlock()
+	result := []PaymentDiscrepancy{}
+	for _, d := range PaymentDiscrepancies {
+		if storeID != "" && d.StoreID != storeID {
+			continue
+		}
+		if date != "" && d.FoundAt.Format("2006-01-02") != date {
+			continue
+		}
+		if reviewed != nil && (d.ReviewedAt != nil) != *reviewed {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
+
+// GetPaymentDiscrepancy returns a discrepancy by ID
+func GetPaymentDiscrepancy(id string) *PaymentDiscrepancy {
+	discrepanciesMu.RLock()
+	defer discrepanciesMu.RUnlock()
+	for i := range PaymentDiscrepancies {
+		if PaymentDiscrepancies[i].ID == id {
+			found := PaymentDiscrepancies[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// ReviewPaymentDiscrepancy records who looked at a discrepancy and what they did
+func ReviewPaymentDiscrepancy(id, userID, resolution string) (PaymentDiscrepancy, error) {
+	discrepanciesMu.Lock()
+	defer discrepanciesMu.Unlock()
+	for i := range PaymentDiscrepancies {
+		if PaymentDiscrepancies[i].ID == id {
+			now := time.Now()
+			PaymentDiscrepancies[i].ReviewedBy = userID
+			PaymentDiscrepancies[i].ReviewedAt = &now
+			PaymentDiscrepancies[i].Resolution = resolution
+			return PaymentDiscrepancies[i], nil
+		}
+	}
+	return PaymentDiscrepancy{}, ErrDiscrepancyNotFound
+}
@@ -0,0 +1,66 @@
+package dummy
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPaymentProvider takes non-cash payments for stores nobody has configured
+const DefaultPaymentProvider = "midtrans"
+
+// ProviderPaymentMethods are the methods that go through a payment provider.
+// Cash is counted by the cashier.
+var ProviderPaymentMethods = []string{"qris", "card", "ewallet"}
+
+var (
+	paymentRoutesMu sync.RWMutex
+
+	// PaymentRoutes picks the provider per store and payment method
+	PaymentRoutes = []PaymentRoute{}
+)
+
+// PaymentRoute sends a store's payments of one method to a provider, e.g. cards
+// to the bank's EDC terminal and QRIS to Midtrans
+type PaymentRoute struct {
+	StoreID   string    `json:"store_id"`
+	Method    string    `json:"method"`
+	Provider  string    `json:"provider"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// GetPaymentRoute returns the configured route or the default one
+func GetPaymentRoute(storeID, method string) PaymentRoute {
+	paymentRoutesMu.RLock()
+	defer paymentRoutesMu.RUnlock()
+	for _, r := range PaymentRoutes {
+		if r.StoreID == storeID && r.Method == method {
+			return r
+		}
+	}
+	return PaymentRoute{StoreID: storeID, Method: method, Provider: DefaultPaymentProvider}
+}
+
+// ListPaymentRoutes returns the effective route for every method of a store
+func ListPaymentRoutes(storeID string) []PaymentRoute {
+	routes := make([]PaymentRoute, len(ProviderPaymentMethods))
+	for i, m := range ProviderPaymentMethods {
+		routes[i] = GetPaymentRoute(storeID, m)
+	}
+	return routes
+}
+
+// SavePaymentRoute creates or replaces the route for a store/method pair
+func SavePaymentRoute(route PaymentRoute) PaymentRoute {
+	paymentRoutesMu.Lock()
+	defer paymentRoutesMu.Unlock()
+	route.UpdatedAt = time.Now()
+	for i := range PaymentRoutes {
+		if PaymentRoutes[i].StoreID == route.StoreID && PaymentRoutes[i].Method == route.Method {
+			PaymentRoutes[i] = route
+			return route
+		}
+	}
+	PaymentRoutes = append(PaymentRoutes, route)
+	return route
+}
@@ -0,0 +1,319 @@
+package dummy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Payment statuses
+const (
+	PaymentPending  = "pending"
+	PaymentSuccess  = "success"
+	PaymentFailed   = "failed"   // denied or cancelled
+	PaymentExpired  = "expired"  // the customer never paid
+	PaymentRefunded = "refunded" // all of it given back; partly refunded payments stay successful
+)
+
+var (
+	// ErrPaymentNotFound is returned for unknown payments
+	ErrPaymentNotFound = errors.New("payment not found")
+
+	// ErrOverpayment is returned for a payment larger than what is left to pay
+	ErrOverpayment = errors.New("amount is more than the order's balance")
+
+	// ErrOrderPaid is returned for a payment towards an order already paid,
+	// e.g. a delivery order the platform collected for
+	ErrOrderPaid = errors.New("order is already paid")
+
+	// ErrOverpaid is returned for a successful payment the order's other
+	// payments have already covered
+	ErrOverpaid = errors.New("order is already paid by other payments")
+)
+
+// Payments are the payment transactions for orders, oldest first. Guarded by mu
+// along with Orders, since a payment settling changes its order.
+var Payments = []Payment{}
+
+// Payment is one payment towards an order
+type Payment struct {
+	ID      string `json:"id"`
+	OrderID string `json:"order_id"`
+	StoreID string `json:"store_id"`
+	Method  string `json:"method"` // cash, qris, card, ewallet
+	Amount  int    `json:"amount"` // the part of the order's total this payment covers
+	Status  string `json:"status"` // pending, success, failed, expired, refunded
+
+	// Cash handed over and given back; Amount is what stays in the drawer
+	Tendered int `json:"tendered,omitempty"`
+	Change   int `json:"change,omitempty"`
+
+	Refunded int `json:"refunded,omitempty"` // given back by successful refunds
+
+	ShiftID string `json:"shift_id,omitempty"` // the cashier's shift it was taken on; cash goes in that drawer
+
+	// Provider is who processes the payment (cash, midtrans, edc, sandbox). ProviderRef is the
+	// ID we gave it (Midtrans order_id), TransactionID the ID it gave us.
+	Provider       string `json:"provider"`
+	ProviderRef    string `json:"provider_ref,omitempty"`
+	TransactionID  string `json:"transaction_id,omitempty"`
+	ProviderStatus string `json:"provider_status,omitempty"` // as the provider last reported it
+	Channel        string `json:"channel,omitempty"`         // snap, or the Core API payment type (qris, gopay, credit_card...)
+
+	// What the customer needs to pay: a Snap page, a QR code or an e-wallet deeplink
+	SnapToken   string `json:"snap_token,omitempty"`
+	RedirectURL string `json:"redirect_url,omitempty"`
+	QRString    string `json:"qr_string,omitempty"`
+	QRCodeURL   string `json:"qr_code_url,omitempty"`
+	DeeplinkURL string `json:"deeplink_url,omitempty"`
+
+	PaidAt    *time.Time `json:"paid_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// PaymentUpdate is a provider's report on a payment
+type PaymentUpdate struct {
+	Status         string
+	ProviderStatus string
+	TransactionID  string
+	Amount         int // what the provider says was charged, 0 if it didn't say
+	At             time.Time
+}
+
+// PaymentBalance sums up an order's payments
+type PaymentBalance struct {
+	OrderID       string `json:"order_id"`
+	Total         int    `json:"total"`
+	Paid          int    `json:"paid"`      // successful payments, including any later refunded
+	Pending       int    `json:"pending"`   // payments waiting for the customer or provider
+	Remaining     int    `json:"remaining"` // total less what has been paid
+	Change        int    `json:"change"`    // cash given back across the order's cash payments
+	Refunded      int    `json:"refunded"`  // given back to the customer since
+	PaymentStatus string `json:"payment_status"`
+}
+
+// AddPayment records a new payment towards an order. An order can be paid with
+// several payments of different methods, but never for more than its total:
+// the amount must fit in what successful payments have left to pay.
+func AddPayment(p Payment) (Payment, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	o := findOrder(p.OrderID)
+	if o == nil {
+		return Payment{}, ErrOrderNotFound
+	}
+	left := leftToPay(o)
+	if left == 0 {
+		return Payment{}, ErrOrderPaid
+	}
+	if p.Amount < 1 || p.Amount > left {
+		return Payment{}, ErrOverpayment
+	}
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.Status == "" {
+		p.Status = PaymentPending
+	}
+	p.CreatedAt = time.Now()
+	p.UpdatedAt = p.CreatedAt
+	Payments = append(Payments, p)
+	return p, nil
+}
+
+// GetPayment returns a payment by ID
+func GetPayment(id string) *Payment {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range Payments {
+		if Payments[i].ID == id {
+			found := Payments[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// FindPaymentByProviderRef returns the payment a provider knows by ref
+func FindPaymentByProviderRef(provider, ref string) *Payment {
+	mu.RLock()
+	defer mu.RUnlock()
+	for i := range Payments {
+		if Payments[i].Provider == provider && Payments[i].ProviderRef == ref {
+			found := Payments[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// UpdatePayment changes a payment's details (not its status; see ApplyPaymentUpdate)
+func UpdatePayment(id string, fn func(p *Payment)) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	for i := range Payments {
+		if Payments[i].ID == id {
+			fn(&Payments[i])
+			Payments[i].UpdatedAt = time.Now()
+			return true
+		}
+	}
+	return false
+}
+
+// OrderPayments lists an order's payments, oldest first
+func OrderPayments(orderID string) []Payment {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []Payment{}
+	for _, p := range Payments {
+		if p.OrderID == orderID {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// PendingPayments lists payments still pending that were started before the
+// given time, oldest first
+func PendingPayments(before time.Time) []Payment {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []Payment{}
+	for _, p := range Payments {
+		if p.Status == PaymentPending && p.CreatedAt.Before(before) {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// ShiftPayments lists the payments taken on a shift, oldest first
+func ShiftPayments(shiftID string) []Payment {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []Payment{}
+	for _, p := range Payments {
+		if p.ShiftID == shiftID {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// OrderBalance returns what has been paid towards an order and what is left
+func OrderBalance(orderID string) (PaymentBalance, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	o := findOrder(orderID)
+	if o == nil {
+		return PaymentBalance{}, ErrOrderNotFound
+	}
+	b := PaymentBalance{OrderID: o.ID, Total: o.Total, PaymentStatus: o.PaymentStatus}
+	for _, p := range Payments {
+		if p.OrderID != o.ID {
+			continue
+		}
+		switch p.Status {
+		case PaymentSuccess, PaymentRefunded:
+			b.Paid += p.Amount
+			b.Change += p.Change
+			b.Refunded += p.Refunded
+		case PaymentPending:
+			b.Pending += p.Amount
+		}
+	}
+	b.Remaining = leftToPay(o)
+	return b, nil
+}
+
+// ApplyPaymentUpdate records a provider's report and marks the order paid once
+// its successful payments cover the total. It is safe to apply the same report
+// twice or reports out of order: changed is false when nothing moved, and a
+// successful payment never goes back to pending, failed or expired. Pending
+// payments don't hold the balance, so two of them can each be for all of it: a
+// success that would take the order past its total is refused with ErrOverpaid.
+func ApplyPaymentUpdate(id string, u PaymentUpdate) (payment Payment, order Order, changed bool, err error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var p *Payment
+	for i := range Payments {
+		if Payments[i].ID == id {
+			p = &Payments[i]
+		}
+	}
+	if p == nil {
+		return Payment{}, Order{}, false, ErrPaymentNotFound
+	}
+	o := findOrder(p.OrderID)
+	if o == nil {
+		return *p, Order{}, false, ErrOrderNotFound
+	}
+
+	if u.ProviderStatus != "" {
+		p.ProviderStatus = u.ProviderStatus
+	}
+	if u.TransactionID != "" {
+		p.TransactionID = u.TransactionID
+	}
+	if u.Status != p.Status && paymentCanMove(p.Status, u.Status) {
+		if u.Status == PaymentSuccess && p.Amount > leftToPay(o) {
+			return *p, *o, false, ErrOverpaid
+		}
+		at := u.At
+		if at.IsZero() {
+			at = time.Now()
+		}
+		p.Status = u.Status
+		if u.Status == PaymentSuccess {
+			p.PaidAt = &at
+		}
+		p.UpdatedAt = time.Now()
+		changed = true
+
+		if paid := paidAmount(o.ID); paid >= o.Total && o.PaymentStatus != "paid" {
+			o.PaymentStatus = "paid"
+			o.UpdatedAt = time.Now()
+		}
+	}
+	return *p, *o, changed, nil
+}
+
+// paymentCanMove reports whether a payment may go from one status to another.
+// Money can still arrive after a payment was reported failed or expired, but
+// once it succeeded only a refund changes it (see FinishRefund).
+func paymentCanMove(from, to string) bool {
+	switch from {
+	case PaymentPending:
+		return to == PaymentSuccess || to == PaymentFailed || to == PaymentExpired
+	case PaymentFailed, PaymentExpired:
+		return to == PaymentSuccess
+	}
+	return false
+}
+
+// paidAmount sums an order's successful payments. Refunds don't reopen the
+// bill, so refunded payments still count. Callers hold mu.
+// leftToPay is what an order still needs. Orders paid outside Kaori, like
+// delivery orders the platform collected for, have no payments here but
+// nothing left to pay either. Callers hold mu.
+func leftToPay(o *Order) int {
+	if o.PaymentStatus != "" && o.PaymentStatus != "unpaid" {
+		return 0
+	}
+	return max(o.Total-paidAmount(o.ID), 0)
+}
+
+func paidAmount(orderID string) int {
+	total := 0
+	for _, p := range Payments {
+		if p.OrderID == orderID && (p.Status == PaymentSuccess || p.Status == PaymentRefunded) {
+			total += p.Amount
+		}
+	}
+	return total
+}
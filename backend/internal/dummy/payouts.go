@@ -0,0 +1,191 @@
+package dummy
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	payoutMu sync.RWMutex
+
+	// CommissionSettings are the platforms' commission terms over time
+	CommissionSettings = []CommissionSetting{
+		{ID: "comm-1", Platform: SourceGrabFood, RatePercent: 30, FixedFee: 0, EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{ID: "comm-2", Platform: SourceGoFood, RatePercent: 20, FixedFee: 1000, EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{ID: "comm-3", Platform: SourceShopeeFood, RatePercent: 25, FixedFee: 0, EffectiveFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	// SettlementImports are platform payout CSVs matched against our orders
+	SettlementImports = []SettlementImport{}
+)
+
+// CommissionSetting is a platform's commission (percentage plus fixed fee per
+// order) from EffectiveFrom until EffectiveTo, or open-ended if EffectiveTo is nil
+type CommissionSetting struct {
+	ID            string     `json:"id"`
+	Platform      string     `json:"platform"`
+	RatePercent   float64    `json:"rate_percent"`
+	FixedFee      int        `json:"fixed_fee"`
+	EffectiveFrom time.Time  `json:"effective_from"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// DeliveryPayout is what a delivery order is really worth to us
+type DeliveryPayout struct {
+	Gross               int     `json:"gross"`          // platform-reported order total
+	MerchantPromo       int     `json:"merchant_promo"` // discounts we fund
+	PlatformPromo       int     `json:"platform_promo"` // discounts the platform funds (informational)
+	CommissionRate      float64 `json:"commission_rate"`
+	CommissionFixedFee  int     `json:"commission_fixed_fee"`
+	Commission          int     `json:"commission"`
+	Net                 int     `json:"net"` // gross - merchant promo - commission
+	CommissionSettingID string  `json:"commission_setting_id,omitempty"`
+}
+
+// SettlementRow is one order line of a platform settlement, with the match result
+type SettlementRow struct {
+	ExternalOrderID string `json:"external_order_id"`
+	OrderID         string `json:"order_id,omitempty"`
+	OrderNumber     string `json:"order_number,omitempty"`
+	Gross           int    `json:"gross"`
+	Commission      int    `json:"commission"`
+	Promo           int    `json:"promo"`
+	Net             int    `json:"net"`
+	ExpectedNet     int    `json:"expected_net"`
+	Difference      int    `json:"difference"` // settled net - expected net
+	Status          string `json:"status"`     // matched, mismatch, missing_order, missing_in_settlement
+	Note            string `json:"note,omitempty"`
+}
+
+// SettlementSummary totals a settlement import
+type SettlementSummary struct {
+	Rows                int `json:"rows"`
+	Matched             int `json:"matched"`
+	Mismatched          int `json:"mismatched"`
+	MissingOrders       int `json:"missing_orders"`
+	MissingInSettlement int `json:"missing_in_settlement"`
+	SettledNet          int `json:"settled_net"`
+	ExpectedNet         int `json:"expected_net"`
+	Difference          int `json:"difference"`
+}
+
+// SettlementImport is a reconciled platform settlement file
+type SettlementImport struct {
+	ID         string            `json:"id"`
+	Platform   string            `json:"platform"`
+	FileName   string            `json:"file_name"`
+	PeriodFrom time.Time         `json:"period_from"`
+	PeriodTo   time.Time         `json:"period_to"`
+	Summary    SettlementSummary `json:"summary"`
+	Rows       []SettlementRow   `json:"rows,omitempty"`
+	ImportedBy string            `json:"imported_by"`
+	ImportedAt time.Time         `json:"imported_at"`
+}
+
+// CommissionFor returns the setting in effect for a platform at a point in time
+func CommissionFor(platform string, at time.Time) *CommissionSetting {
+	payoutMu.RLock()
+	defer payoutMu.RUnlock()
+	var best *CommissionSetting
+	for i := range CommissionSettings {
+		s := &CommissionSettings[i]
+		if s.Platform != platform || s.EffectiveFrom.After(at) || (s.EffectiveTo != nil && !s.EffectiveTo.After(at)) {
+			continue
+		}
+		if best == nil || s.EffectiveFrom.After(best.EffectiveFrom) {
+			best = s
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	found := *best
+	return &found
+}
+
+// ListCommissionSettings returns settings, newest first, optionally for one platform
+func ListCommissionSettings(platform string) []CommissionSetting {
+	payoutMu.RLock()
+	defer payoutMu.RUnlock()
+	result := []CommissionSetting{}
+	for _, s := range CommissionSettings {
+		if platform == "" || s.Platform == platform {
+			result = append(result, s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].EffectiveFrom.After(result[j].EffectiveFrom) })
+	return result
+}
+
+// AddCommissionSetting starts new commission terms. The platform's previous
+// open-ended setting is closed off where the new one takes effect.
+func AddCommissionSetting(s CommissionSetting) CommissionSetting {
+	payoutMu.Lock()
+	defer payoutMu.Unlock()
+	for i := range CommissionSettings {
+		prev := &CommissionSettings[i]
+		if prev.Platform == s.Platform && prev.EffectiveTo == nil && prev.EffectiveFrom.Before(s.EffectiveFrom) {
+			end := s.EffectiveFrom
+			prev.EffectiveTo = &end
+		}
+	}
+	s.ID = uuid.New().String()
+	s.CreatedAt = time.Now()
+	CommissionSettings = append(CommissionSettings, s)
+	return s
+}
+
+// DeleteCommissionSetting removes a setting by ID
+func DeleteCommissionSetting(id string) bool {
+	payoutMu.Lock()
+	defer payoutMu.Unlock()
+	for i := range CommissionSettings {
+		if CommissionSettings[i].ID == id {
+			CommissionSettings = append(CommissionSettings[:i], CommissionSettings[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// AddSettlementImport stores a reconciled settlement
+func AddSettlementImport(imp SettlementImport) SettlementImport {
+	payoutMu.Lock()
+	defer payoutMu.Unlock()
+	imp.ID = uuid.New().String()
+	imp.ImportedAt = time.Now()
+	SettlementImports = append(SettlementImports, imp)
+	return imp
+}
+
+// ListSettlementImports returns imports without their rows, newest first
+func ListSettlementImports(platform string) []SettlementImport {
+	payoutMu.RLock()
+	defer payoutMu.RUnlock()
+	result := []SettlementImport{}
+	for i := len(SettlementImports) - 1; i >= 0; i-- {
+		imp := SettlementImports[i]
+		if platform == "" || imp.Platform == platform {
+			imp.Rows = nil
+			result = append(result, imp)
+		}
+	}
+	return result
+}
+
+// GetSettlementImport returns an import with its rows
+func GetSettlementImport(id string) *SettlementImport {
+	payoutMu.RLock()
+	defer payoutMu.RUnlock()
+	for i := range SettlementImports {
+		if SettlementImports[i].ID == id {
+			found := SettlementImports[i]
+			return &found
+		}
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package dummy
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrRefundNotFound is returned for unknown refunds
+	ErrRefundNotFound = errors.New("refund not found")
+
+	// ErrNotRefundable is returned for payments that never succeeded
+	ErrNotRefundable = errors.New("only successful payments can be refunded")
+
+	// ErrRefundTooLarge is returned for a refund larger than what is left to
+	// refund on the payment
+	ErrRefundTooLarge = errors.New("amount is more than what is left to refund on the payment")
+
+	// ErrRefundItem is returned for refund lines that aren't on the order or
+	// were already refunded
+	ErrRefundItem = errors.New("item is not on the order or already refunded")
+
+	// ErrRefundedWhole is returned for item refunds on an order that already
+	// has a refund of a whole payment, which can't be told apart by line
+	ErrRefundedWhole = errors.New("order has a refund of a whole payment; refund the rest by payment")
+)
+
+// Refunds are the refunds on payments, oldest first. Guarded by mu along with
+// Payments and Orders.
+var Refunds = []Refund{}
+
+// Refund gives back some or all of a successful payment, through the provider
+// that took it or, for cash, out of the drawer
+type Refund struct {
+	ID        string       `json:"id"`
+	PaymentID string       `json:"payment_id"`
+	OrderID   string       `json:"order_id"`
+	StoreID   string       `json:"store_id"`
+	Method    string       `json:"method"`
+	Provider  string       `json:"provider"`
+	Amount    int          `json:"amount"`
+	Items     []RefundItem `json:"items,omitempty"` // empty for a refund of the whole payment
+	Reason    string       `json:"reason"`
+	Status    string       `json:"status"` // pending, success, failed
+
+	TransactionID string `json:"transaction_id,omitempty"` // the provider's reference for the refund
+	Manual        bool   `json:"manual,omitempty"`         // returned by hand: cash from the drawer, a void on the EDC
+	Message       string `json:"message,omitempty"`
+
+	// Loyalty given back with the money (see reverseLoyalty)
+	PointsReversed   int      `json:"points_reversed,omitempty"`   // earned on the order and taken back
+	PointsReturned   int      `json:"points_returned,omitempty"`   // spent on the order and given back
+	VouchersReleased []string `json:"vouchers_released,omitempty"` // usable again once the order is fully refunded
+
+	ShiftID     string     `json:"shift_id,omitempty"` // for cash, the drawer it was paid out of
+	RequestedBy string     `json:"requested_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// RefundItem is one order line given back
+type RefundItem struct {
+	OrderItemID string `json:"order_item_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Amount      int    `json:"amount"` // with its share of tax and adjustments
+}
+
+// RefundOutcome is the provider's answer to a refund
+type RefundOutcome struct {
+	Status        string
+	TransactionID string
+	Manual        bool
+	Message       string
+}
+
+// StartRefund records a pending refund on a payment, holding its amount so
+// two refunds at once can't give back more than was paid. Without items the
+// rest of the payment is refunded; with items the amount is their price plus
+// their share of the order's tax and adjustments. Once a whole payment has been
+// refunded, nobody can say which lines it covered, so the rest of the order is
+// refunded by payment too.
+func StartRefund(r Refund) (Refund, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	p := findPayment(r.PaymentID)
+	if p == nil {
+		return Refund{}, ErrPaymentNotFound
+	}
+	if p.Status != PaymentSuccess {
+		return Refund{}, ErrNotRefundable
+	}
+	o := findOrder(p.OrderID)
+	if o == nil {
+		return Refund{}, ErrOrderNotFound
+	}
+
+	left := p.Amount - refundingAmount(p.ID)
+	if len(r.Items) == 0 {
+		r.Amount = left
+	} else {
+		if refundedWhole(o.ID) {
+			return Refund{}, ErrRefundedWhole
+		}
+		r.Amount = 0
+		taking := map[string]int{} // units of each line earlier in this refund
+		for i, line := range r.Items {
+			it := findOrderItem(o, line.OrderItemID)
+			if it == nil {
+				return Refund{}, ErrRefundItem
+			}
+			from := refundingQuantity(o.ID, it.ID) + taking[it.ID]
+			if line.Quantity < 1 || line.Quantity > it.Quantity-from {
+				return Refund{}, ErrRefundItem
+			}
+			taking[it.ID] += line.Quantity
+			r.Items[i].ProductName = it.ProductName
+			r.Items[i].Amount = itemRefundAmount(o, it, from, line.Quantity)
+			r.Amount += r.Items[i].Amount
+		}
+	}
+	if r.Amount < 1 || r.Amount > left {
+		return Refund{}, ErrRefundTooLarge
+	}
+
+	r.ID = uuid.New().String()
+	r.OrderID = p.OrderID
+	r.StoreID = p.StoreID
+	r.Method = p.Method
+	r.Provider = p.Provider
+	r.Status = PaymentPending
+	r.CreatedAt = time.Now()
+	Refunds = append(Refunds, r)
+	return r, nil
+}
+
+// FinishRefund records the provider's answer. A successful refund adds to the
+// payment's and order's refunded amounts, marks refunded items and reverses
+// the order's points and voucher uses (see reverseLoyalty). A failed refund
+// frees its amount.
+func FinishRefund(id string, out RefundOutcome) (Refund, Order, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var r *Refund
+	for i := range Refunds {
+		if Refunds[i].ID == id {
+			r = &Refunds[i]
+		}
+	}
+	if r == nil {
+		return Refund{}, Order{}, ErrRefundNotFound
+	}
+	p := findPayment(r.PaymentID)
+	o := findOrder(r.OrderID)
+	if p == nil || o == nil {
+		return *r, Order{}, ErrPaymentNotFound
+	}
+	if r.Status != PaymentPending {
+		return *r, *o, nil
+	}
+
+	now := time.Now()
+	r.Status = out.Status
+	r.TransactionID = out.TransactionID
+	r.Manual = out.Manual
+	r.Message = out.Message
+	if r.Status != PaymentSuccess {
+		if r.Status != PaymentPending {
+			r.CompletedAt = &now
+		}
+		return *r, *o, nil
+	}
+	r.CompletedAt = &now
+
+	p.Refunded += r.Amount
+	if p.Refunded >= p.Amount {
+		p.Status = PaymentRefunded
+	}
+	p.UpdatedAt = now
+
+	paid := paidAmount(o.ID)
+	o.Refunded += r.Amount
+	for _, line := range r.Items {
+		if it := findOrderItem(o, line.OrderItemID); it != nil {
+			it.RefundedQuantity += line.Quantity
+		}
+	}
+	if o.Refunded >= paid {
+		o.PaymentStatus = "refunded"
+		for i := range o.Items {
+			o.Items[i].RefundedQuantity = o.Items[i].Quantity
+		}
+	} else {
+		o.PaymentStatus = "partially_refunded"
+	}
+	reverseLoyalty(o, r, paid, o.Refunded >= paid, now)
+	o.UpdatedAt = now
+	return *r, *o, nil
+}
+
+// PaymentRefunds lists a payment's refunds, oldest first
+func PaymentRefunds(paymentID string) []Refund {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []Refund{}
+	for _, r := range Refunds {
+		if r.PaymentID == paymentID {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// ListRefunds returns every refund, oldest first
+func ListRefunds() []Refund {
+	mu.RLock()
+	defer mu.RUnlock()
+	return append([]Refund(nil), Refunds...)
+}
+
+// PendingRefunds lists refunds still waiting for their provider that were
+// started before the given time, oldest first
+func PendingRefunds(before time.Time) []Refund {
+	mu.RLock()
+	defer mu.RUnlock()
+	result := []Refund{}
+	for _, r := range Refunds {
+		if r.Status == PaymentPending && r.CreatedAt.Before(before) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// findPayment returns a payment by ID. Callers hold mu.
+func findPayment(id string) *Payment {
+	for i := range Payments {
+		if Payments[i].ID == id {
+			return &Payments[i]
+		}
+	}
+	return nil
+}
+
+func findOrderItem(o *Order, id string) *OrderItem {
+	for i := range o.Items {
+		if o.Items[i].ID == id {
+			return &o.Items[i]
+		}
+	}
+	return nil
+}
+
+// itemRefundAmount prices units from to from+quantity of an order line with
+// their share of the order's tax and adjustments. Shares are cut from the
+// order's running total, so rounding goes to the last unit and refunding every
+// unit gives back exactly the total.
+func itemRefundAmount(o *Order, it *OrderItem, from, quantity int) int {
+	base, before := 0, 0
+	for i := range o.Items {
+		if o.Items[i].ID == it.ID {
+			before = base
+		}
+		base += o.Items[i].UnitPrice * o.Items[i].Quantity
+	}
+	if base == 0 {
+		return it.UnitPrice * quantity
+	}
+	share := func(units int) int { return o.Total * (before + it.UnitPrice*units) / base }
+	return share(from+quantity) - share(from)
+}
+
+// refundingAmount sums a payment's refunds that haven't failed. Callers hold mu.
+func refundingAmount(paymentID string) int {
+	total := 0
+	for _, r := range Refunds {
+		if r.PaymentID == paymentID && (r.Status == PaymentPending || r.Status == PaymentSuccess) {
+			total += r.Amount
+		}
+	}
+	return total
+}
+
+// refundedWhole reports whether an order has a refund of a whole payment that
+// hasn't failed. Callers hold mu.
+func refundedWhole(orderID string) bool {
+	for _, r := range Refunds {
+		if r.OrderID == orderID && len(r.Items) == 0 && (r.Status == PaymentPending || r.Status == PaymentSuccess) {
+			return true
+		}
+	}
+	return false
+}
+
+// refundingQuantity sums the units of an order line in refunds that haven't
+// failed, across all of the order's payments. Callers hold mu.
+func refundingQuantity(orderID, itemID string) int {
+	total := 0
+	for _, r := range Refunds {
+		if r.OrderID != orderID || (r.Status != PaymentPending && r.Status != PaymentSuccess) {
+			continue
+		}
+		for _, line := range r.Items {
+			if line.OrderItemID == itemID {
+				total += line.Quantity
+			}
+		}
+	}
+	return total
+}
@@ -0,0 +1,111 @@
+package dummy
+
+import "testing"
+
+// paidOrder adds an order paid in full by one payment
+func paidOrder(t *testing.T, id string, items []OrderItem, total int) Payment {
+	t.Helper()
+	subtotal := 0
+	for i := range items {
+		items[i].Subtotal = items[i].UnitPrice * items[i].Quantity
+		subtotal += items[i].Subtotal
+	}
+	AddOrder(Order{ID: id, StoreID: DefaultStoreID, OrderNumber: id, Status: "completed", PaymentStatus: "unpaid", Items: items, Subtotal: subtotal, Total: total})
+	p, err := AddPayment(Payment{OrderID: id, StoreID: DefaultStoreID, Method: "cash", Amount: total, Provider: "cash"})
+	if err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	if p, _, _, err = ApplyPaymentUpdate(p.ID, PaymentUpdate{Status: PaymentSuccess}); err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	return p
+}
+
+// refund starts and completes a refund
+func refund(t *testing.T, r Refund) Refund {
+	t.Helper()
+	started, err := StartRefund(r)
+	if err != nil {
+		t.Fatalf("start refund: %v", err)
+	}
+	done, _, err := FinishRefund(started.ID, RefundOutcome{Status: PaymentSuccess})
+	if err != nil {
+		t.Fatalf("finish refund: %v", err)
+	}
+	return done
+}
+
+func TestRefundReversesLoyalty(t *testing.T) {
+	const member = "member-loyalty"
+	p := paidOrder(t, "order-loyalty", []OrderItem{{ID: "line-loyalty", ProductName: "Latte", Quantity: 3, UnitPrice: 30000}}, 90000)
+	AddPointEntry(PointEntry{MemberID: member, OrderID: p.OrderID, Points: 91, Type: PointsEarn})
+	AddPointEntry(PointEntry{MemberID: member, OrderID: p.OrderID, Points: -40, Type: PointsRedeem})
+	AddVoucherUse(VoucherUse{VoucherCode: "HEMAT10", OrderID: p.OrderID, MemberID: member, DiscountApplied: 10000})
+
+	first := refund(t, Refund{PaymentID: p.ID, Items: []RefundItem{{OrderItemID: "line-loyalty", Quantity: 1}}, Reason: "spilled"})
+	if first.PointsReversed != 30 || first.PointsReturned != 0 || len(first.VouchersReleased) != 0 {
+		t.Errorf("partial refund reversed %d, returned %d, released %v; want 30 of the 91 earned only", first.PointsReversed, first.PointsReturned, first.VouchersReleased)
+	}
+	if n := VoucherUseCount("HEMAT10"); n != 1 {
+		t.Errorf("voucher uses = %d after a partial refund, want 1", n)
+	}
+
+	rest := refund(t, Refund{PaymentID: p.ID, Reason: "closing early"})
+	if rest.PointsReversed != 61 || rest.PointsReturned != 40 {
+		t.Errorf("final refund reversed %d, returned %d; want the other 61 earned and the 40 spent", rest.PointsReversed, rest.PointsReturned)
+	}
+	if len(rest.VouchersReleased) != 1 || rest.VouchersReleased[0] != "HEMAT10" {
+		t.Errorf("vouchers released = %v, want HEMAT10", rest.VouchersReleased)
+	}
+	if n := VoucherUseCount("HEMAT10"); n != 0 {
+		t.Errorf("voucher uses = %d after a full refund, want 0", n)
+	}
+	// 91 earned - 40 spent - 91 taken back + 40 given back
+	if balance := MemberPointBalance(member); balance != 0 {
+		t.Errorf("member balance = %d, want 0", balance)
+	}
+}
+
+func TestItemRefundsAddUpToTotal(t *testing.T) {
+	// 37,000 plus tax and rounding doesn't share out evenly over the units
+	p := paidOrder(t, "order-rounding", []OrderItem{
+		{ID: "line-rounding-1", ProductName: "Croissant", Quantity: 3, UnitPrice: 10000},
+		{ID: "line-rounding-2", ProductName: "Teh", Quantity: 1, UnitPrice: 7000},
+	}, 41071)
+
+	total := 0
+	for _, line := range []string{"line-rounding-1", "line-rounding-1", "line-rounding-1", "line-rounding-2"} {
+		total += refund(t, Refund{PaymentID: p.ID, Items: []RefundItem{{OrderItemID: line, Quantity: 1}}, Reason: "stale"}).Amount
+	}
+	if total != 41071 {
+		t.Errorf("refunding every unit gave back %d, want the total 41071", total)
+	}
+	if got := GetPayment(p.ID); got.Status != PaymentRefunded {
+		t.Errorf("payment is %s, want refunded", got.Status)
+	}
+}
+
+func TestItemRefundAfterWholeRefund(t *testing.T) {
+	AddOrder(Order{ID: "order-split", StoreID: DefaultStoreID, OrderNumber: "order-split", Status: "completed", PaymentStatus: "unpaid",
+		Items: []OrderItem{{ID: "line-split", ProductName: "Nasi Goreng", Quantity: 2, UnitPrice: 30000, Subtotal: 60000}}, Subtotal: 60000, Total: 60000})
+	var payments []Payment
+	for _, method := range []string{"cash", "qris"} {
+		p, err := AddPayment(Payment{OrderID: "order-split", StoreID: DefaultStoreID, Method: method, Amount: 30000, Provider: method})
+		if err != nil {
+			t.Fatalf("add payment: %v", err)
+		}
+		if p, _, _, err = ApplyPaymentUpdate(p.ID, PaymentUpdate{Status: PaymentSuccess}); err != nil {
+			t.Fatalf("pay: %v", err)
+		}
+		payments = append(payments, p)
+	}
+
+	refund(t, Refund{PaymentID: payments[0].ID, Reason: "wrong order"})
+	_, err := StartRefund(Refund{PaymentID: payments[1].ID, Items: []RefundItem{{OrderItemID: "line-split", Quantity: 2}}, Reason: "wrong order"})
+	if err != ErrRefundedWhole {
+		t.Errorf("item refund after a whole payment was refunded: %v, want %v", err, ErrRefundedWhole)
+	}
+	if r := refund(t, Refund{PaymentID: payments[1].ID, Reason: "wrong order"}); r.Amount != 30000 {
+		t.Errorf("refunding the other payment gave back %d, want 30000", r.Amount)
+	}
+}
@@ -0,0 +1,298 @@
+package dummy
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Shift statuses
+const (
+	ShiftOpen   = "open"
+	ShiftClosed = "closed"
+)
+
+// Drawer entry types. Paid in and paid out are entered by hand with a reason;
+// cash sales and refunds are recorded as they happen.
+const (
+	DrawerPaidIn     = "paid_in"
+	DrawerPaidOut    = "paid_out"
+	DrawerCashSale   = "cash_sale"
+	DrawerCashRefund = "cash_refund"
+)
+
+// DefaultDrawerID is the drawer of stores with a single till
+const DefaultDrawerID = "main"
+
+// Denominations are the rupiah notes and coins counted at close, largest first
+var Denominations = []int{100000, 50000, 20000, 10000, 5000, 2000, 1000, 500, 200, 100}
+
+var (
+	// ErrShiftNotFound is returned for unknown shifts
+	ErrShiftNotFound = errors.New("shift not found")
+
+	// ErrShiftClosed is returned when changing a closed shift
+	ErrShiftClosed = errors.New("shift is closed")
+
+	// ErrShiftAlreadyOpen is returned when a cashier already has an open shift
+	ErrShiftAlreadyOpen = errors.New("cashier already has an open shift")
+
+	// ErrDrawerInUse is returned when another shift is open on the drawer
+	ErrDrawerInUse = errors.New("another shift is open on this drawer")
+
+	// ErrInvalidDenomination is returned for counts of notes or coins that
+	// don't exist, or negative counts
+	ErrInvalidDenomination = errors.New("invalid denomination count")
+)
+
+var (
+	shiftsMu sync.RWMutex
+
+	// Shifts are cashier shifts on the stores' cash drawers, oldest first
+	Shifts = []Shift{}
+)
+
+// Shift is a cashier's time on a cash drawer, from the opening float to the
+// count at close
+type Shift struct {
+	ID           string        `json:"id"`
+	StoreID      string        `json:"store_id"`
+	DrawerID     string        `json:"drawer_id"`
+	CashierID    string        `json:"cashier_id"`
+	CashierName  string        `json:"cashier_name"`
+	Status       string        `json:"status"` // open, closed
+	OpeningFloat int           `json:"opening_float"`
+	Entries      []DrawerEntry `json:"entries,omitempty"` // left out for cashiers until the shift is closed
+	OpenedAt     time.Time     `json:"opened_at"`
+
+	// Filled in at close. The count is blind: the cashier counts before seeing
+	// what the drawer should hold.
+	ClosedAt *time.Time  `json:"closed_at,omitempty"`
+	ClosedBy string      `json:"closed_by,omitempty"`
+	Count    map[int]int `json:"count,omitempty"` // number of notes or coins per denomination
+	Counted  int         `json:"counted"`
+	Expected int         `json:"expected"`
+	Variance int         `json:"variance"` // counted less expected: over when positive, short when negative
+	Notes    string      `json:"notes,omitempty"`
+}
+
+// DrawerEntry is cash going into or out of a drawer
+type DrawerEntry struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`   // paid_in, paid_out, cash_sale, cash_refund
+	Amount    int       `json:"amount"` // always positive; the type says which way
+	Reason    string    `json:"reason,omitempty"`
+	OrderID   string    `json:"order_id,omitempty"`
+	PaymentID string    `json:"payment_id,omitempty"`
+	RefundID  string    `json:"refund_id,omitempty"`
+	UserID    string    `json:"user_id"`
+	At        time.Time `json:"at"`
+}
+
+// DrawerTotals adds up a shift's drawer entries
+type DrawerTotals struct {
+	OpeningFloat int `json:"opening_float"`
+	CashSales    int `json:"cash_sales"`
+	CashRefunds  int `json:"cash_refunds"`
+	PaidIn       int `json:"paid_in"`
+	PaidOut      int `json:"paid_out"`
+	Expected     int `json:"expected"` // what the drawer should hold
+}
+
+// Totals adds up the drawer's cash movements
+func (s *Shift) Totals() DrawerTotals {
+	t := DrawerTotals{OpeningFloat: s.OpeningFloat}
+	for _, e := range s.Entries {
+		switch e.Type {
+		case DrawerCashSale:
+			t.CashSales += e.Amount
+		case DrawerCashRefund:
+			t.CashRefunds += e.Amount
+		case DrawerPaidIn:
+			t.PaidIn += e.Amount
+		case DrawerPaidOut:
+			t.PaidOut += e.Amount
+		}
+	}
+	t.Expected = t.OpeningFloat + t.CashSales - t.CashRefunds + t.PaidIn - t.PaidOut
+	return t
+}
+
+// CountCash adds up a count by denomination
+func CountCash(count map[int]int) (int, error) {
+	total := 0
+	for denomination, n := range count {
+		if n < 0 || !slices.Contains(Denominations, denomination) {
+			return 0, ErrInvalidDenomination
+		}
+		total += denomination * n
+	}
+	return total, nil
+}
+
+// OpenShift starts a shift. A cashier works one drawer at a time, and a drawer
+// has one cashier at a time.
+func OpenShift(s Shift) (Shift, error) {
+	shiftsMu.Lock()
+	defer shiftsMu.Unlock()
+	if s.DrawerID == "" {
+		s.DrawerID = DefaultDrawerID
+	}
+	for _, existing := range Shifts {
+		if existing.Status != ShiftOpen {
+			continue
+		}
+		if existing.CashierID == s.CashierID {
+			return existing, ErrShiftAlreadyOpen
+		}
+		if existing.StoreID == s.StoreID && existing.DrawerID == s.DrawerID {
+			return existing, ErrDrawerInUse
+		}
+	}
+	s.ID = uuid.New().String()
+	s.Status = ShiftOpen
+	s.Entries = []DrawerEntry{}
+	s.OpenedAt = time.Now()
+	Shifts = append(Shifts, s)
+	return s, nil
+}
+
+// GetShift returns a shift by ID
+func GetShift(id string) *Shift {
+	shiftsMu.RLock()
+	defer shiftsMu.RUnlock()
+	if s := findShift(id); s != nil {
+		found := copyShift(s)
+		return &found
+	}
+	return nil
+}
+
+// OpenShiftFor returns a cashier's open shift, if any
+func OpenShiftFor(cashierID string) *Shift {
+	shiftsMu.RLock()
+	defer shiftsMu.RUnlock()
+	for i := range Shifts {
+		if Shifts[i].CashierID == cashierID && Shifts[i].Status == ShiftOpen {
+			found := copyShift(&Shifts[i])
+			return &found
+		}
+	}
+	return nil
+}
+
+// ListShifts returns a store's shifts, newest first, optionally for one cashier
+func ListShifts(storeID, cashierID string) []Shift {
+	shiftsMu.RLock()
+	defer shiftsMu.RUnlock()
+	result := []Shift{}
+	for i := len(Shifts) - 1; i >= 0; i-- {
+		s := &Shifts[i]
+		if (storeID != "" && s.StoreID != storeID) || (cashierID != "" && s.CashierID != cashierID) {
+			continue
+		}
+		result = append(result, copyShift(s))
+	}
+	return result
+}
+
+// AddDrawerEntry records cash going into or out of an open shift's drawer
+func AddDrawerEntry(shiftID string, e DrawerEntry) (Shift, error) {
+	shiftsMu.Lock()
+	defer shiftsMu.Unlock()
+	s := findShift(shiftID)
+	if s == nil {
+		return Shift{}, ErrShiftNotFound
+	}
+	if s.Status != ShiftOpen {
+		return copyShift(s), ErrShiftClosed
+	}
+	e.ID = uuid.New().String()
+	e.At = time.Now()
+	s.Entries = append(s.Entries, e)
+	return copyShift(s), nil
+}
+
+// AddDrawerEntryAfter records cash going into or out of an open shift's drawer
+// once record, which records the payment or refund it is for, succeeds. The
+// shift can't close in between, so both are recorded or neither is. record
+// must not touch shifts.
+func AddDrawerEntryAfter(shiftID string, e DrawerEntry, record func() error) (Shift, error) {
+	shiftsMu.Lock()
+	defer shiftsMu.Unlock()
+	s := findShift(shiftID)
+	if s == nil {
+		return Shift{}, ErrShiftNotFound
+	}
+	if s.Status != ShiftOpen {
+		return copyShift(s), ErrShiftClosed
+	}
+	if err := record(); err != nil {
+		return copyShift(s), err
+	}
+	e.ID = uuid.New().String()
+	e.At = time.Now()
+	s.Entries = append(s.Entries, e)
+	return copyShift(s), nil
+}
+
+// CloseShift ends a shift with the cash counted in the drawer and works out
+// what it should have held
+func CloseShift(id string, count map[int]int, closedBy, notes string) (Shift, error) {
+	counted, err := CountCash(count)
+	if err != nil {
+		return Shift{}, err
+	}
+
+	shiftsMu.Lock()
+	defer shiftsMu.Unlock()
+	s := findShift(id)
+	if s == nil {
+		return Shift{}, ErrShiftNotFound
+	}
+	if s.Status != ShiftOpen {
+		return copyShift(s), ErrShiftClosed
+	}
+	now := time.Now()
+	s.Status = ShiftClosed
+	s.ClosedAt = &now
+	s.ClosedBy = closedBy
+	s.Count = make(map[int]int, len(count))
+	for denomination, n := range count {
+		if n > 0 {
+			s.Count[denomination] = n
+		}
+	}
+	s.Counted = counted
+	s.Expected = s.Totals().Expected
+	s.Variance = s.Counted - s.Expected
+	s.Notes = notes
+	return copyShift(s), nil
+}
+
+// findShift returns a shift by ID. Callers hold shiftsMu.
+func findShift(id string) *Shift {
+	for i := range Shifts {
+		if Shifts[i].ID == id {
+			return &Shifts[i]
+		}
+	}
+	return nil
+}
+
+// copyShift copies a shift so callers can't change its entries or count
+// under the lock. Callers hold shiftsMu.
+func copyShift(s *Shift) Shift {
+	c := *s
+	c.Entries = append([]DrawerEntry{}, s.Entries...)
+	if s.Count != nil {
+		c.Count = make(map[int]int, len(s.Count))
+		for k, v := range s.Count {
+			c.Count[k] = v
+		}
+	}
+	return c
+}
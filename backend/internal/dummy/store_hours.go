@@ -0,0 +1,43 @@
+package dummy
+
+import (
+	"sort"
+	"sync"
+)
+
+// OpeningHours is when a store is open ("HH:MM", store local time)
+type OpeningHours struct {
+	OpensAt  string `json:"opens_at"`
+	ClosesAt string `json:"closes_at"`
+}
+
+var (
+	hoursMu sync.RWMutex
+
+	// storeHours holds the opening hours of every store we know
+	storeHours = map[string]OpeningHours{
+		DefaultStoreID: {OpensAt: "07:00", ClosesAt: "22:00"},
+	}
+)
+
+// GetOpeningHours returns a store's opening hours, 08:00-22:00 if none are set
+func GetOpeningHours(storeID string) OpeningHours {
+	hoursMu.RLock()
+	defer hoursMu.RUnlock()
+	if h, ok := storeHours[storeID]; ok {
+		return h
+	}
+	return OpeningHours{OpensAt: "08:00", ClosesAt: "22:00"}
+}
+
+// StoreIDs lists the stores with opening hours, in order
+func StoreIDs() []string {
+	hoursMu.RLock()
+	defer hoursMu.RUnlock()
+	ids := make([]string, 0, len(storeHours))
+	for id := range storeHours {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
@@ -0,0 +1,144 @@
+package dummy
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook processing results
+const (
+	WebhookProcessed = "processed" // order created or updated
+	WebhookDuplicate = "duplicate" // platform resent an order we already have
+	WebhookRejected  = "rejected"  // payload we couldn't accept (4xx)
+	WebhookFailed    = "failed"    // our error (5xx)
+)
+
+// Kinds of webhook a platform sends
+const (
+	WebhookKindOrder   = "order"   // new orders
+	WebhookKindDriver  = "driver"  // driver assigned, arrived, picked up...
+	WebhookKindCancel  = "cancel"  // order cancelled on the platform
+	WebhookKindModify  = "modify"  // order items changed on the platform
+	WebhookKindPayment = "payment" // payment provider notification (Midtrans)
+)
+
+// The archive is bounded however fast webhooks arrive: past either limit the
+// oldest events are dropped before their retention is up
+const (
+	maxWebhookEvents       = 10000
+	maxWebhookArchiveBytes = 64 << 20
+)
+
+var (
+	webhookMu sync.RWMutex
+
+	// WebhookEvents archives raw inbound webhook payloads, oldest first
+	WebhookEvents = []WebhookEvent{}
+
+	// webhookArchiveBytes is the size of the events in WebhookEvents
+	webhookArchiveBytes int
+)
+
+// WebhookEvent is one inbound webhook exactly as the platform sent it, with what we did with it
+type WebhookEvent struct {
+	ID           string            `json:"id"`
+	Platform     string            `json:"platform"`
+	Kind         string            `json:"kind"` // order, driver, cancel, modify, payment
+	StoreID      string            `json:"store_id"`
+	Method       string            `json:"method"`
+	Path         string            `json:"path"`
+	Query        string            `json:"query,omitempty"`
+	Headers      map[string]string `json:"headers"`
+	Body         string            `json:"body"`
+	Result       string            `json:"result"` // processed, duplicate, rejected, failed
+	ResponseCode int               `json:"response_code"`
+	Error        string            `json:"error,omitempty"`
+	OrderID      string            `json:"order_id,omitempty"`
+	ReplayOf     string            `json:"replay_of,omitempty"` // original event when this is a replay
+	ReplayedBy   string            `json:"replayed_by,omitempty"`
+	ReceivedAt   time.Time         `json:"received_at"`
+	ExpiresAt    time.Time         `json:"expires_at"`
+}
+
+// WebhookEventFilter narrows ListWebhookEvents
+type WebhookEventFilter struct {
+	Platform string
+	Kind     string
+	StoreID  string
+	Result   string
+	OrderID  string
+	From     time.Time
+	To       time.Time
+}
+
+// AddWebhookEvent archives an event and drops expired ones, and the oldest
+// ones when the archive is full
+func AddWebhookEvent(e WebhookEvent) WebhookEvent {
+	webhookMu.Lock()
+	defer webhookMu.Unlock()
+
+	e.ID = uuid.New().String()
+	WebhookEvents = append(WebhookEvents, e)
+	webhookArchiveBytes += e.size()
+
+	// Events share a retention, so they expire oldest first too: whatever goes
+	// is at the front, and each event is dropped once however large the archive
+	now := time.Now()
+	drop := 0
+	for drop < len(WebhookEvents)-1 {
+		old := &WebhookEvents[drop]
+		if old.ExpiresAt.After(now) && len(WebhookEvents)-drop <= maxWebhookEvents && webhookArchiveBytes <= maxWebhookArchiveBytes {
+			break
+		}
+		webhookArchiveBytes -= old.size()
+		*old = WebhookEvent{} // let the body go before the array is reallocated
+		drop++
+	}
+	WebhookEvents = WebhookEvents[drop:]
+	return e
+}
+
+// size roughly measures the memory an event holds
+func (e *WebhookEvent) size() int {
+	n := len(e.Body) + len(e.Path) + len(e.Query) + len(e.Error)
+	for name, value := range e.Headers {
+		n += len(name) + len(value)
+	}
+	return n
+}
+
+// ListWebhookEvents returns matching events, newest first
+func ListWebhookEvents(f WebhookEventFilter) []WebhookEvent {
+	webhookMu.RLock()
+	defer webhookMu.RUnlock()
+	result := []WebhookEvent{}
+	for i := len(WebhookEvents) - 1; i >= 0; i-- {
+		e := WebhookEvents[i]
+		if (f.Platform != "" && e.Platform != f.Platform) ||
+			(f.Kind != "" && e.Kind != f.Kind) ||
+			(f.StoreID != "" && e.StoreID != f.StoreID) ||
+			(f.Result != "" && e.Result != f.Result) ||
+			(f.OrderID != "" && e.OrderID != f.OrderID) ||
+			(!f.From.IsZero() && e.ReceivedAt.Before(f.From)) ||
+			(!f.To.IsZero() && !e.ReceivedAt.Before(f.To)) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+// GetWebhookEvent returns an archived event by ID
+func GetWebhookEvent(id string) *WebhookEvent {
+	webhookMu.RLock()
+	defer webhookMu.RUnlock()
+	for i := range WebhookEvents {
+		if WebhookEvents[i].ID == id {
+			found := WebhookEvents[i]
+			return &found
+		}
+	}
+	return nil
+}
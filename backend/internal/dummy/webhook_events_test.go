@@ -0,0 +1,36 @@
+package dummy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookArchiveBounded(t *testing.T) {
+	webhookMu.Lock()
+	WebhookEvents, webhookArchiveBytes = []WebhookEvent{}, 0
+	webhookMu.Unlock()
+
+	now := time.Now()
+	AddWebhookEvent(WebhookEvent{Platform: "gofood", Body: "expired", ExpiresAt: now.Add(-time.Minute)})
+	for i := 0; i < maxWebhookEvents+5; i++ {
+		AddWebhookEvent(WebhookEvent{Platform: "grabfood", Body: "{}", ExpiresAt: now.Add(time.Hour)})
+	}
+	if n := len(ListWebhookEvents(WebhookEventFilter{})); n != maxWebhookEvents {
+		t.Errorf("archive holds %d events, want %d", n, maxWebhookEvents)
+	}
+	if n := len(ListWebhookEvents(WebhookEventFilter{Platform: "gofood"})); n != 0 {
+		t.Errorf("expired event is still archived")
+	}
+
+	big := strings.Repeat("x", maxWebhookArchiveBytes/2)
+	for i := 0; i < 3; i++ {
+		AddWebhookEvent(WebhookEvent{Platform: "shopee_food", Body: big, ExpiresAt: now.Add(time.Hour)})
+	}
+	if n := len(ListWebhookEvents(WebhookEventFilter{Platform: "shopee_food"})); n != 2 {
+		t.Errorf("archive kept %d large events, want the 2 that fit", n)
+	}
+	if webhookArchiveBytes > maxWebhookArchiveBytes {
+		t.Errorf("archive holds %d bytes, over the %d limit", webhookArchiveBytes, maxWebhookArchiveBytes)
+	}
+}
@@ -0,0 +1,105 @@
+package dummy
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	subscriptionMu sync.RWMutex
+
+	// WebhookSubscriptions are merchant systems (accounting, loyalty dashboards)
+	// that receive our real-time events as signed webhooks
+	WebhookSubscriptions = []WebhookSubscription{}
+)
+
+// WebhookSubscription sends the chosen event types for some or all stores to a URL
+type WebhookSubscription struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	StoreIDs   []string  `json:"store_ids"` // empty for every store
+	Secret     string    `json:"-"`         // HMAC key for X-Kaori-Signature
+	IsActive   bool      `json:"is_active"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Matches reports whether the subscription wants an event of eventType from storeID
+func (s *WebhookSubscription) Matches(storeID, eventType string) bool {
+	if !s.IsActive || !slices.Contains(s.EventTypes, eventType) {
+		return false
+	}
+	return len(s.StoreIDs) == 0 || slices.Contains(s.StoreIDs, storeID)
+}
+
+// ListWebhookSubscriptions returns all subscriptions
+func ListWebhookSubscriptions() []WebhookSubscription {
+	subscriptionMu.RLock()
+	defer subscriptionMu.RUnlock()
+	result := make([]WebhookSubscription, len(WebhookSubscriptions))
+	copy(result, WebhookSubscriptions)
+	return result
+}
+
+// GetWebhookSubscription returns a subscription by ID
+func GetWebhookSubscription(id string) *WebhookSubscription {
+	subscriptionMu.RLock()
+	defer subscriptionMu.RUnlock()
+	for i := range WebhookSubscriptions {
+		if WebhookSubscriptions[i].ID == id {
+			found := WebhookSubscriptions[i]
+			return &found
+		}
+	}
+	return nil
+}
+
+// MatchingWebhookSubscriptions returns the active subscriptions that want an event
+func MatchingWebhookSubscriptions(storeID, eventType string) []WebhookSubscription {
+	subscriptionMu.RLock()
+	defer subscriptionMu.RUnlock()
+	result := []WebhookSubscription{}
+	for i := range WebhookSubscriptions {
+		if WebhookSubscriptions[i].Matches(storeID, eventType) {
+			result = append(result, WebhookSubscriptions[i])
+		}
+	}
+	return result
+}
+
+// SaveWebhookSubscription creates a subscription, or replaces the one with the same ID
+func SaveWebhookSubscription(s WebhookSubscription) WebhookSubscription {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+	s.UpdatedAt = time.Now()
+	for i := range WebhookSubscriptions {
+		if WebhookSubscriptions[i].ID == s.ID {
+			s.CreatedAt = WebhookSubscriptions[i].CreatedAt
+			WebhookSubscriptions[i] = s
+			return s
+		}
+	}
+	s.ID = uuid.New().String()
+	s.CreatedAt = s.UpdatedAt
+	WebhookSubscriptions = append(WebhookSubscriptions, s)
+	return s
+}
+
+// DeleteWebhookSubscription removes a subscription by ID
+func DeleteWebhookSubscription(id string) bool {
+	subscriptionMu.Lock()
+	defer subscriptionMu.Unlock()
+	for i := range WebhookSubscriptions {
+		if WebhookSubscriptions[i].ID == id {
+			WebhookSubscriptions = append(WebhookSubscriptions[:i], WebhookSubscriptions[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
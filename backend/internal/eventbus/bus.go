@@ -0,0 +1,59 @@
+// Package eventbus carries real-time events between API instances, so each
+// instance can forward every event to the clients connected to it.
+package eventbus
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Event is a message for a store's real-time clients
+type Event struct {
+	StoreID string          `json:"store_id"`
+	Topics  []string        `json:"topics"`
+	Type    string          `json:"type"`
+	Version int             `json:"version,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Handler receives events published on any instance
+type Handler func(Event)
+
+// Bus delivers published events to every subscriber, on this instance and,
+// depending on the implementation, on others. Events from one publisher arrive
+// in the order they were published.
+type Bus interface {
+	Publish(e Event) error
+	Subscribe(h Handler)
+	Close() error
+}
+
+// Local is a bus within one process. Subscribers get events synchronously, on
+// the publisher's goroutine.
+type Local struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewLocal creates an in-process bus
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (b *Local) Publish(e Event) error {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+	return nil
+}
+
+func (b *Local) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *Local) Close() error { return nil }
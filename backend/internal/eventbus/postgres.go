@@ -0,0 +1,215 @@
+package eventbus
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// Channel is the Postgres notification channel events travel on
+	Channel = "kaori_events"
+
+	// maxNotifyPayload keeps notifications under Postgres' 8000 byte limit.
+	// Bigger events are stored in realtime_events and sent by reference.
+	maxNotifyPayload = 7000
+
+	// spilledEventTTL is how long stored events are kept for other instances to read
+	spilledEventTTL = time.Hour
+
+	outgoingBuffer = 1024
+)
+
+// envelope is what goes in a notification: the event itself, or the ID of the
+// row it was stored in
+type envelope struct {
+	Origin string `json:"o"`
+	Event  *Event `json:"e,omitempty"`
+	Ref    int64  `json:"r,omitempty"`
+}
+
+// Postgres is a bus shared by every instance connected to the same database,
+// using LISTEN/NOTIFY. Events published here reach this instance's subscribers
+// straight away and the other instances through the database; notifications
+// are sent in the background so a slow database doesn't hold up requests.
+//
+// LISTEN needs a session connection: behind PgBouncer or Supabase's pooler,
+// use the direct or session-mode connection string.
+type Postgres struct {
+	db       *sql.DB
+	listener *pq.Listener
+	origin   string
+	outgoing chan envelope
+	done     chan struct{}
+
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewPostgres connects a bus to the database at dsn
+func NewPostgres(dsn string) (*Postgres, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event bus database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to reach event bus database: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+
+	b := &Postgres{
+		db:       db,
+		origin:   newOrigin(),
+		outgoing: make(chan envelope, outgoingBuffer),
+		done:     make(chan struct{}),
+	}
+	b.listener = pq.NewListener(dsn, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("Event bus disconnected: %v", err)
+		case pq.ListenerEventReconnected:
+			// Notifications sent while we were away are lost; clients that
+			// reconnect to us will be told to resync if they missed any
+			log.Println("Event bus reconnected")
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("Event bus connection attempt failed: %v", err)
+		}
+	})
+	if err := b.listener.Listen(Channel); err != nil {
+		b.listener.Close()
+		db.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", Channel, err)
+	}
+
+	go b.receive()
+	go b.send()
+	log.Printf("✅ Event bus listening on Postgres channel %s", Channel)
+	return b, nil
+}
+
+func (b *Postgres) Publish(e Event) error {
+	b.deliver(e)
+	select {
+	case b.outgoing <- envelope{Origin: b.origin, Event: &e}:
+		return nil
+	default:
+		return fmt.Errorf("event bus queue is full, %s not sent to other instances", e.Type)
+	}
+}
+
+func (b *Postgres) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *Postgres) Close() error {
+	close(b.done)
+	b.listener.Close()
+	return b.db.Close()
+}
+
+func (b *Postgres) deliver(e Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+// send notifies the other instances, one event at a time so they arrive in order
+func (b *Postgres) send() {
+	cleanup := time.NewTicker(spilledEventTTL / 4)
+	defer cleanup.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-cleanup.C:
+			if _, err := b.db.Exec(`DELETE FROM realtime_events WHERE created_at < $1`, time.Now().Add(-spilledEventTTL)); err != nil {
+				log.Printf("Event bus cleanup failed: %v", err)
+			}
+		case env := <-b.outgoing:
+			if err := b.notify(env); err != nil {
+				log.Printf("Event bus failed to send %s: %v", env.Event.Type, err)
+			}
+		}
+	}
+}
+
+func (b *Postgres) notify(env envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	if len(data) > maxNotifyPayload {
+		event, _ := json.Marshal(env.Event)
+		var id int64
+		if err := b.db.QueryRow(`INSERT INTO realtime_events (payload) VALUES ($1) RETURNING id`, event).Scan(&id); err != nil {
+			return err
+		}
+		if data, err = json.Marshal(envelope{Origin: env.Origin, Ref: id}); err != nil {
+			return err
+		}
+	}
+	_, err = b.db.Exec(`SELECT pg_notify($1, $2)`, Channel, string(data))
+	return err
+}
+
+// receive hands other instances' events to the subscribers
+func (b *Postgres) receive() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case n := <-b.listener.Notify:
+			if n == nil {
+				continue // reconnected
+			}
+			var env envelope
+			if err := json.Unmarshal([]byte(n.Extra), &env); err != nil {
+				log.Printf("Event bus received an invalid notification: %v", err)
+				continue
+			}
+			if env.Origin == b.origin {
+				continue // already delivered when published
+			}
+			if env.Event == nil && env.Ref != 0 {
+				if err := b.load(&env); err != nil {
+					log.Printf("Event bus could not load event %d: %v", env.Ref, err)
+					continue
+				}
+			}
+			if env.Event != nil {
+				b.deliver(*env.Event)
+			}
+		case <-time.After(90 * time.Second):
+			// Check the connection is still alive; pq reconnects if not
+			go b.listener.Ping()
+		}
+	}
+}
+
+func (b *Postgres) load(env *envelope) error {
+	var payload []byte
+	if err := b.db.QueryRow(`SELECT payload FROM realtime_events WHERE id = $1`, env.Ref).Scan(&payload); err != nil {
+		return err
+	}
+	env.Event = &Event{}
+	return json.Unmarshal(payload, env.Event)
+}
+
+func newOrigin() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
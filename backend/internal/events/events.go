@@ -0,0 +1,250 @@
+// Package events is the catalog of real-time events sent to store screens,
+// kitchen displays and customer tracking pages. Every event has a Go type, a
+// name and a version; the version goes up when a payload changes in a way
+// existing clients can't read.
+package events
+
+import (
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// Event is a payload in the catalog
+type Event interface {
+	EventType() string
+}
+
+// Event types
+const (
+	TypeOrderCreated         = "order.created"
+	TypeOrderUpdated         = "order.updated"
+	TypeOrderStatusChanged   = "order.status_changed"
+	TypeOrderAcknowledged    = "order.acknowledged"
+	TypeOrderItemReady       = "order.item_ready"
+	TypeOrderCancelled       = "order.cancelled"
+	TypeOrderModified        = "order.modified"
+	TypeOrderAcceptCountdown = "order.accept_countdown"
+	TypeOrderAcceptAlert     = "order.accept_alert"
+	TypeOrderAcceptExpired   = "order.accept_expired"
+	TypeDriverUpdated        = "driver.updated"
+	TypePaymentSucceeded     = "payment.succeeded"
+	TypePaymentFailed        = "payment.failed"
+	TypePaymentRefunded      = "payment.refunded"
+	TypeKitchenOffline       = "kitchen.offline"
+	TypeKitchenOnline        = "kitchen.online"
+)
+
+// OrderCreated is a new order, from any source
+type OrderCreated struct {
+	dummy.Order
+}
+
+// OrderUpdated is the whole order after a change other than its status, such
+// as a delivery platform changing its items
+type OrderUpdated struct {
+	dummy.Order
+}
+
+// OrderStatusChanged goes to everyone following an order, including the
+// customer's tracking page
+type OrderStatusChanged struct {
+	OrderID        string `json:"order_id"`
+	OrderNumber    string `json:"order_number"`
+	Status         string `json:"status"`
+	PreviousStatus string `json:"previous_status,omitempty"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// OrderAcknowledged means the kitchen has seen a new order
+type OrderAcknowledged struct {
+	OrderID        string     `json:"order_id"`
+	OrderNumber    string     `json:"order_number"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at"`
+	AcknowledgedBy string     `json:"acknowledged_by"`
+}
+
+// OrderItemReady means one line of an order is ready; Items has every line's
+// progress
+type OrderItemReady struct {
+	OrderID     string            `json:"order_id"`
+	OrderNumber string            `json:"order_number"`
+	ItemID      string            `json:"item_id"`
+	Items       []dummy.OrderItem `json:"items"`
+}
+
+// OrderCancelled is an urgent kitchen alert for an order a delivery platform
+// cancelled
+type OrderCancelled struct {
+	OrderID      string                   `json:"order_id"`
+	OrderNumber  string                   `json:"order_number"`
+	Urgent       bool                     `json:"urgent"`
+	Reason       string                   `json:"reason"`
+	Cancellation *dummy.OrderCancellation `json:"cancellation"`
+}
+
+// OrderModified is a kitchen alert for an order whose items a delivery platform
+// changed; urgent once the kitchen has started on it
+type OrderModified struct {
+	OrderID      string                  `json:"order_id"`
+	OrderNumber  string                  `json:"order_number"`
+	Urgent       bool                    `json:"urgent"`
+	Modification dummy.OrderModification `json:"modification"`
+	Items        []dummy.OrderItem       `json:"items"`
+}
+
+// AcceptTimer is how long a delivery order has left to be accepted before the
+// platform cancels it
+type AcceptTimer struct {
+	OrderID     string    `json:"order_id"`
+	OrderNumber string    `json:"order_number"`
+	OrderSource string    `json:"order_source"`
+	Deadline    time.Time `json:"deadline"`
+	SecondsLeft int       `json:"seconds_left"`
+	AlertLevel  string    `json:"alert_level"` // normal, warning, critical
+}
+
+// OrderAcceptCountdown is sent periodically while a delivery order waits
+type OrderAcceptCountdown struct {
+	AcceptTimer
+}
+
+// OrderAcceptAlert is sent when a waiting order's alert level goes up
+type OrderAcceptAlert struct {
+	AcceptTimer
+}
+
+// OrderAcceptExpired means a delivery order wasn't accepted in time and was
+// cancelled
+type OrderAcceptExpired struct {
+	OrderID     string `json:"order_id"`
+	OrderNumber string `json:"order_number"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+// DriverUpdated is a courier's progress, for the pickup shelf screen and the
+// customer's tracking page
+type DriverUpdated struct {
+	OrderID     string        `json:"order_id"`
+	OrderNumber string        `json:"order_number"`
+	OrderSource string        `json:"order_source"`
+	OrderStatus string        `json:"order_status"`
+	Stage       string        `json:"stage"` // assigned, arriving, arrived, picked_up, delivered
+	Driver      *dummy.Driver `json:"driver"`
+	ReadyAt     *time.Time    `json:"ready_at,omitempty"`
+}
+
+// PaymentSucceeded means an order received a payment
+type PaymentSucceeded struct {
+	PaymentID     string    `json:"payment_id,omitempty"`
+	OrderID       string    `json:"order_id"`
+	OrderNumber   string    `json:"order_number"`
+	Method        string    `json:"method"` // cash, qris, card, ewallet
+	Amount        int       `json:"amount"`
+	Remaining     int       `json:"remaining"`      // left to pay on the order, for split bills
+	PaymentStatus string    `json:"payment_status"` // the order's, after this payment
+	PaidAt        time.Time `json:"paid_at"`
+}
+
+// PaymentFailed means a payment was declined, cancelled or never completed.
+// The order stays unpaid and can be paid again.
+type PaymentFailed struct {
+	PaymentID     string `json:"payment_id"`
+	OrderID       string `json:"order_id"`
+	OrderNumber   string `json:"order_number"`
+	Method        string `json:"method"`
+	Amount        int    `json:"amount"`
+	Status        string `json:"status"`           // failed or expired
+	Reason        string `json:"reason,omitempty"` // the provider's status, e.g. deny, cancel, expire
+	PaymentStatus string `json:"payment_status"`   // the order's
+}
+
+// PaymentRefunded means money was given back on a payment. Refunds are not
+// cancellations: the order keeps its status.
+type PaymentRefunded struct {
+	RefundID       string `json:"refund_id"`
+	PaymentID      string `json:"payment_id"`
+	OrderID        string `json:"order_id"`
+	OrderNumber    string `json:"order_number"`
+	Method         string `json:"method"`
+	Amount         int    `json:"amount"`
+	OrderRefunded  int    `json:"order_refunded"` // across all the order's refunds
+	Reason         string `json:"reason"`
+	PointsReversed int    `json:"points_reversed,omitempty"`
+	PaymentStatus  string `json:"payment_status"` // the order's: partially_refunded or refunded
+}
+
+// KitchenOffline warns cashiers and managers that no kitchen display has been
+// online for a while during opening hours
+type KitchenOffline struct {
+	OfflineSince time.Time `json:"offline_since"`
+	Message      string    `json:"message"`
+}
+
+// KitchenOnline follows KitchenOffline once a display is back, or the store has
+// closed
+type KitchenOnline struct {
+	StoreOpen bool `json:"store_open"`
+}
+
+func (OrderCreated) EventType() string         { return TypeOrderCreated }
+func (OrderUpdated) EventType() string         { return TypeOrderUpdated }
+func (OrderStatusChanged) EventType() string   { return TypeOrderStatusChanged }
+func (OrderAcknowledged) EventType() string    { return TypeOrderAcknowledged }
+func (OrderItemReady) EventType() string       { return TypeOrderItemReady }
+func (OrderCancelled) EventType() string       { return TypeOrderCancelled }
+func (OrderModified) EventType() string        { return TypeOrderModified }
+func (OrderAcceptCountdown) EventType() string { return TypeOrderAcceptCountdown }
+func (OrderAcceptAlert) EventType() string     { return TypeOrderAcceptAlert }
+func (OrderAcceptExpired) EventType() string   { return TypeOrderAcceptExpired }
+func (DriverUpdated) EventType() string        { return TypeDriverUpdated }
+func (PaymentSucceeded) EventType() string     { return TypePaymentSucceeded }
+func (PaymentFailed) EventType() string        { return TypePaymentFailed }
+func (PaymentRefunded) EventType() string      { return TypePaymentRefunded }
+func (KitchenOffline) EventType() string       { return TypeKitchenOffline }
+func (KitchenOnline) EventType() string        { return TypeKitchenOnline }
+
+// Definition is an entry in the catalog
+type Definition struct {
+	Type        string `json:"type"`
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	Audience    string `json:"audience"` // who receives it, for client developers
+
+	example Event
+}
+
+var catalog = []Definition{
+	{TypeOrderCreated, 1, "A new order, from any source", "store screens and the order's kitchen stations", OrderCreated{}},
+	{TypeOrderUpdated, 1, "The whole order after its items or details changed", "store screens", OrderUpdated{}},
+	{TypeOrderStatusChanged, 1, "An order moved to a new status", "store screens, the order's stations and its tracking page", OrderStatusChanged{}},
+	{TypeOrderAcknowledged, 1, "The kitchen has seen a new order", "store screens and the order's stations", OrderAcknowledged{}},
+	{TypeOrderItemReady, 1, "One line of an order is ready", "store screens and the order's stations", OrderItemReady{}},
+	{TypeOrderCancelled, 1, "A delivery platform cancelled an order", "kitchen displays", OrderCancelled{}},
+	{TypeOrderModified, 1, "A delivery platform changed an order's items", "kitchen displays", OrderModified{}},
+	{TypeOrderAcceptCountdown, 1, "Time left to accept a delivery order", "store screens", OrderAcceptCountdown{}},
+	{TypeOrderAcceptAlert, 1, "A waiting delivery order's alert level went up", "store screens", OrderAcceptAlert{}},
+	{TypeOrderAcceptExpired, 1, "A delivery order wasn't accepted in time", "store screens and the order's tracking page", OrderAcceptExpired{}},
+	{TypeDriverUpdated, 1, "A courier's progress picking up an order", "store screens and the order's tracking page", DriverUpdated{}},
+	{TypePaymentSucceeded, 1, "An order received a payment", "store screens and the order's tracking page", PaymentSucceeded{}},
+	{TypePaymentFailed, 1, "A payment was declined, cancelled or expired", "store screens and the order's tracking page", PaymentFailed{}},
+	{TypePaymentRefunded, 1, "Some or all of a payment was given back", "store screens and the order's tracking page", PaymentRefunded{}},
+	{TypeKitchenOffline, 1, "No kitchen display is online while the store is open", "cashiers and managers", KitchenOffline{}},
+	{TypeKitchenOnline, 1, "A kitchen display is back online", "cashiers and managers", KitchenOnline{}},
+}
+
+// Catalog lists every event type
+func Catalog() []Definition {
+	return append([]Definition(nil), catalog...)
+}
+
+// Lookup finds an event type in the catalog
+func Lookup(eventType string) (Definition, bool) {
+	for _, d := range catalog {
+		if d.Type == eventType {
+			return d, true
+		}
+	}
+	return Definition{}, false
+}
@@ -0,0 +1,139 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema describes every event as it arrives over /api/ws or /api/events, as a
+// JSON Schema (draft 2020-12) clients can generate types from. Each event is
+// the message envelope with its type and version fixed and its payload.
+func Schema() map[string]interface{} {
+	b := &schemaBuilder{defs: map[string]interface{}{}, types: map[string]reflect.Type{}}
+
+	oneOf := []interface{}{}
+	for _, d := range catalog {
+		b.defs[d.Type] = map[string]interface{}{
+			"type":        "object",
+			"description": d.Description + ". Sent to " + d.Audience + ".",
+			"properties": map[string]interface{}{
+				"type":     map[string]interface{}{"const": d.Type},
+				"version":  map[string]interface{}{"const": d.Version},
+				"store_id": map[string]interface{}{"type": "string"},
+				"seq":      map[string]interface{}{"type": "integer", "description": "Per-store event number, for resuming after a reconnect"},
+				"payload":  b.schemaFor(reflect.TypeOf(d.example)),
+			},
+			"required": []string{"type", "version", "store_id", "payload"},
+		}
+		oneOf = append(oneOf, map[string]interface{}{"$ref": "#/$defs/" + d.Type})
+	}
+
+	return map[string]interface{}{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "Kaori POS real-time events",
+		"description": "Events sent to store screens, kitchen displays and order tracking pages",
+		"oneOf":       oneOf,
+		"$defs":       b.defs,
+	}
+}
+
+// schemaBuilder turns Go types into JSON Schema, putting named structs in $defs
+type schemaBuilder struct {
+	defs  map[string]interface{}
+	types map[string]reflect.Type
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == rawType:
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]interface{}{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			properties := map[string]interface{}{}
+			required := []string{}
+			b.addFields(t, properties, &required)
+			return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+		}
+		return b.ref(t)
+	}
+	return map[string]interface{}{}
+}
+
+// ref adds a named struct to $defs the first time it is seen and refers to it
+func (b *schemaBuilder) ref(t reflect.Type) map[string]interface{} {
+	name := t.Name()
+	if other, ok := b.types[name]; ok && other != t {
+		name = strings.ReplaceAll(t.String(), ".", "_")
+	}
+	if _, ok := b.types[name]; !ok {
+		b.types[name] = t
+		b.defs[name] = nil // placeholder, so types that refer to themselves stop here
+		properties := map[string]interface{}{}
+		required := []string{}
+		b.addFields(t, properties, &required)
+		b.defs[name] = map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{"$ref": "#/$defs/" + name}
+}
+
+// addFields adds a struct's fields as encoding/json would write them, with the
+// fields of embedded structs inline
+func (b *schemaBuilder) addFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			b.addFields(f.Type, properties, required)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := b.schemaFor(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+			if f.Type.Kind() == reflect.Ptr || f.Type.Kind() == reflect.Slice || f.Type.Kind() == reflect.Map {
+				schema = map[string]interface{}{"anyOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+			}
+		}
+		properties[name] = schema
+	}
+}
@@ -1,32 +1,41 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/delivery"
 	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/middleware"
 	"github.com/kaori/backend/internal/websocket"
 	"github.com/kaori/backend/pkg/response"
 )
 
 // ItemInput is a common type for order items
 type ItemInput struct {
-	Name     string
-	Quantity int
-	Price    int
-	Notes    string
+	ExternalID string // platform item ID or SKU, used for menu mapping
+	Name       string
+	Variant    string
+	Modifiers  []string
+	Quantity   int
+	Price      int
+	Notes      string
 }
 
 // DeliveryHandler handles delivery platform webhooks
 type DeliveryHandler struct {
-	hub *websocket.Hub
+	hub    *websocket.Hub
+	outbox *delivery.Outbox
 }
 
 // NewDeliveryHandler creates a new delivery handler
-func NewDeliveryHandler(hub *websocket.Hub) *DeliveryHandler {
-	return &DeliveryHandler{hub: hub}
+func NewDeliveryHandler(hub *websocket.Hub, outbox *delivery.Outbox) *DeliveryHandler {
+	return &DeliveryHandler{hub: hub, outbox: outbox}
 }
 
 // GrabFood webhook - POST /api/webhooks/grabfood
@@ -36,13 +45,18 @@ type GrabFoodOrder struct {
 	CustomerPhone string `json:"customerPhone"`
 	Address       string `json:"address"`
 	Items         []struct {
-		Name     string `json:"name"`
-		Quantity int    `json:"quantity"`
-		Price    int    `json:"price"`
-		Notes    string `json:"notes,omitempty"`
+		ItemID    string   `json:"itemId,omitempty"`
+		Name      string   `json:"name"`
+		Variant   string   `json:"variant,omitempty"`
+		Modifiers []string `json:"modifiers,omitempty"`
+		Quantity  int      `json:"quantity"`
+		Price     int      `json:"price"`
+		Notes     string   `json:"notes,omitempty"`
 	} `json:"items"`
-	DriverName string `json:"driverName,omitempty"`
-	Total      int    `json:"total"`
+	DriverName          string `json:"driverName,omitempty"`
+	Total               int    `json:"total"`
+	MerchantFundedPromo int    `json:"merchantFundedPromo,omitempty"`
+	GrabFundedPromo     int    `json:"grabFundedPromo,omitempty"`
 }
 
 func (h *DeliveryHandler) HandleGrabFood(c *gin.Context) {
@@ -51,21 +65,20 @@ func (h *DeliveryHandler) HandleGrabFood(c *gin.Context) {
 		response.BadRequest(c, "Invalid GrabFood order format")
 		return
 	}
+	if existing := dummy.FindOrderByExternalID(dummy.SourceGrabFood, req.OrderID); existing != nil {
+		respondDuplicate(c, existing)
+		return
+	}
 
 	items := make([]ItemInput, len(req.Items))
 	for i, item := range req.Items {
-		items[i] = ItemInput{Name: item.Name, Quantity: item.Quantity, Price: item.Price, Notes: item.Notes}
+		items[i] = ItemInput{ExternalID: item.ItemID, Name: item.Name, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Quantity, Price: item.Price, Notes: item.Notes}
 	}
 
 	order := h.createDeliveryOrder(req.OrderID, dummy.SourceGrabFood, req.CustomerName, req.CustomerPhone, req.Address, req.DriverName, items, req.Total)
-	dummy.AddOrder(order)
-	h.hub.BroadcastOrder(order.ID, "new_order", order)
+	order = h.receiveOrder(webhookStoreID(c), order, delivery.Promo{Merchant: req.MerchantFundedPromo, Platform: req.GrabFundedPromo})
 
-	response.Success(c, http.StatusCreated, gin.H{
-		"status":       "accepted",
-		"order_id":     order.ID,
-		"order_number": order.OrderNumber,
-	})
+	respondReceived(c, http.StatusCreated, order)
 }
 
 // GoFood webhook - POST /api/webhooks/gofood
@@ -77,15 +90,20 @@ type GoFoodOrder struct {
 	} `json:"customer"`
 	DeliveryAddress string `json:"delivery_address"`
 	Items           []struct {
-		ProductName string `json:"product_name"`
-		Qty         int    `json:"qty"`
-		Price       int    `json:"price"`
-		Note        string `json:"note,omitempty"`
+		SKU         string   `json:"sku,omitempty"`
+		ProductName string   `json:"product_name"`
+		Variant     string   `json:"variant,omitempty"`
+		Modifiers   []string `json:"modifiers,omitempty"`
+		Qty         int      `json:"qty"`
+		Price       int      `json:"price"`
+		Note        string   `json:"note,omitempty"`
 	} `json:"items"`
 	Driver struct {
 		Name string `json:"name"`
 	} `json:"driver"`
-	TotalAmount int `json:"total_amount"`
+	TotalAmount      int `json:"total_amount"`
+	MerchantDiscount int `json:"merchant_discount,omitempty"`
+	GoFoodDiscount   int `json:"gofood_discount,omitempty"`
 }
 
 func (h *DeliveryHandler) HandleGoFood(c *gin.Context) {
@@ -94,21 +112,20 @@ func (h *DeliveryHandler) HandleGoFood(c *gin.Context) {
 		response.BadRequest(c, "Invalid GoFood order format")
 		return
 	}
+	if existing := dummy.FindOrderByExternalID(dummy.SourceGoFood, req.TransactionID); existing != nil {
+		respondDuplicate(c, existing)
+		return
+	}
 
 	items := make([]ItemInput, len(req.Items))
 	for i, item := range req.Items {
-		items[i] = ItemInput{Name: item.ProductName, Quantity: item.Qty, Price: item.Price, Notes: item.Note}
+		items[i] = ItemInput{ExternalID: item.SKU, Name: item.ProductName, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Qty, Price: item.Price, Notes: item.Note}
 	}
 
 	order := h.createDeliveryOrder(req.TransactionID, dummy.SourceGoFood, req.Customer.Name, req.Customer.Phone, req.DeliveryAddress, req.Driver.Name, items, req.TotalAmount)
-	dummy.AddOrder(order)
-	h.hub.BroadcastOrder(order.ID, "new_order", order)
+	order = h.receiveOrder(webhookStoreID(c), order, delivery.Promo{Merchant: req.MerchantDiscount, Platform: req.GoFoodDiscount})
 
-	response.Success(c, http.StatusCreated, gin.H{
-		"status":       "accepted",
-		"order_id":     order.ID,
-		"order_number": order.OrderNumber,
-	})
+	respondReceived(c, http.StatusCreated, order)
 }
 
 // Shopee Food webhook - POST /api/webhooks/shopee
@@ -120,13 +137,18 @@ type ShopeeFoodOrder struct {
 		Full string `json:"full"`
 	} `json:"address"`
 	OrderItems []struct {
-		ItemName string `json:"item_name"`
-		Quantity int    `json:"quantity"`
-		Price    int    `json:"price"`
-		Remark   string `json:"remark,omitempty"`
+		ItemID    string   `json:"item_id,omitempty"`
+		ItemName  string   `json:"item_name"`
+		ModelName string   `json:"model_name,omitempty"` // Shopee's name for a variant
+		AddOns    []string `json:"add_ons,omitempty"`
+		Quantity  int      `json:"quantity"`
+		Price     int      `json:"price"`
+		Remark    string   `json:"remark,omitempty"`
 	} `json:"order_items"`
-	ShipperName string `json:"shipper_name"`
-	TotalPrice  int    `json:"total_price"`
+	ShipperName     string `json:"shipper_name"`
+	TotalPrice      int    `json:"total_price"`
+	MerchantVoucher int    `json:"merchant_voucher,omitempty"`
+	ShopeeVoucher   int    `json:"shopee_voucher,omitempty"`
 }
 
 func (h *DeliveryHandler) HandleShopeeFood(c *gin.Context) {
@@ -135,21 +157,20 @@ func (h *DeliveryHandler) HandleShopeeFood(c *gin.Context) {
 		response.BadRequest(c, "Invalid Shopee Food order format")
 		return
 	}
+	if existing := dummy.FindOrderByExternalID(dummy.SourceShopeeFood, req.OrderNo); existing != nil {
+		respondDuplicate(c, existing)
+		return
+	}
 
 	items := make([]ItemInput, len(req.OrderItems))
 	for i, item := range req.OrderItems {
-		items[i] = ItemInput{Name: item.ItemName, Quantity: item.Quantity, Price: item.Price, Notes: item.Remark}
+		items[i] = ItemInput{ExternalID: item.ItemID, Name: item.ItemName, Variant: item.ModelName, Modifiers: item.AddOns, Quantity: item.Quantity, Price: item.Price, Notes: item.Remark}
 	}
 
 	order := h.createDeliveryOrder(req.OrderNo, dummy.SourceShopeeFood, req.BuyerName, req.BuyerPhone, req.Address.Full, req.ShipperName, items, req.TotalPrice)
-	dummy.AddOrder(order)
-	h.hub.BroadcastOrder(order.ID, "new_order", order)
+	order = h.receiveOrder(webhookStoreID(c), order, delivery.Promo{Merchant: req.MerchantVoucher, Platform: req.ShopeeVoucher})
 
-	response.Success(c, http.StatusCreated, gin.H{
-		"status":       "accepted",
-		"order_id":     order.ID,
-		"order_number": order.OrderNumber,
-	})
+	respondReceived(c, http.StatusCreated, order)
 }
 
 // Simulate incoming order (for testing) - POST /api/simulate/order
@@ -184,8 +205,7 @@ func (h *DeliveryHandler) SimulateOrder(c *gin.Context) {
 
 	extID := uuid.New().String()[:8]
 	order := h.createDeliveryOrder(extID, req.Source, req.CustomerName, "08123456789", "Jl. Delivery No. 123", "Driver", items, total)
-	dummy.AddOrder(order)
-	h.hub.BroadcastOrder(order.ID, "new_order", order)
+	order = h.receiveOrder(webhookStoreID(c), order, delivery.Promo{})
 
 	response.Success(c, http.StatusCreated, order)
 }
@@ -197,31 +217,172 @@ func (h *DeliveryHandler) GetOrdersBySource(c *gin.Context) {
 	response.Success(c, http.StatusOK, orders)
 }
 
-// Helper to create delivery order
-func (h *DeliveryHandler) createDeliveryOrder(externalID, source, customerName, phone, address, driver string, items []ItemInput, total int) dummy.Order {
-	orderItems := make([]dummy.OrderItem, len(items))
-	subtotal := 0
-	for i, item := range items {
-		itemTotal := item.Price * item.Quantity
-		subtotal += itemTotal
-		orderItems[i] = dummy.OrderItem{
-			ID:          uuid.New().String(),
-			ProductID:   "",
-			ProductName: item.Name,
-			Quantity:    item.Quantity,
-			UnitPrice:   item.Price,
-			Subtotal:    itemTotal,
-			Notes:       item.Notes,
+// respondReceived answers a platform webhook with the order we created for it
+func respondReceived(c *gin.Context, status int, order dummy.Order) {
+	c.Set(ctxWebhookOrderID, order.ID)
+	response.Success(c, status, gin.H{
+		"status":       "accepted",
+		"order_id":     order.ID,
+		"order_number": order.OrderNumber,
+		"order_status": order.Status,
+	})
+}
+
+// respondDuplicate answers a platform resending an order we already have, so
+// webhook retries and replays don't create a second order
+func respondDuplicate(c *gin.Context, existing *dummy.Order) {
+	c.Set(ctxWebhookDuplicate, true)
+	respondReceived(c, http.StatusOK, *existing)
+}
+
+// webhookStoreID is the store a webhook is for. Mapped integrations belong to
+// one store; for the built-in platforms each outlet's webhook URL carries its
+// store_id, and older registrations without it go to the default store.
+func webhookStoreID(c *gin.Context) string {
+	if storeID := c.GetString(ctxWebhookStoreID); storeID != "" {
+		return storeID
+	}
+	return c.DefaultQuery("store_id", dummy.DefaultStoreID)
+}
+
+// receiveOrder applies the store's acceptance rule to a new delivery order, works
+// out what the platform will pay us for it, saves it and tells cashier screens and,
+// if it was decided automatically, the platform
+func (h *DeliveryHandler) receiveOrder(storeID string, order dummy.Order, promo delivery.Promo) dummy.Order {
+	order.StoreID = storeID
+
+	decision := delivery.Decision{Action: delivery.DecisionHold}
+	if dummy.IsDeliverySource(order.OrderSource) {
+		order.Payout = delivery.CalculatePayout(order.OrderSource, order.Total, promo, order.CreatedAt)
+		rule := dummy.GetDeliveryRule(storeID, order.OrderSource)
+		decision = delivery.Decide(rule, &order, order.CreatedAt)
+		if pause := dummy.GetDeliveryPause(storeID); pause.Paused {
+			// The platform may not have processed our pause yet
+			decision = delivery.Decision{Action: delivery.DecisionReject, Reason: "Store is paused on delivery platforms"}
+		}
+		switch decision.Action {
+		case delivery.DecisionAccept:
+			order.Status = "confirmed"
+		case delivery.DecisionReject:
+			order.Status = "cancelled"
+		default:
+			deadline := order.CreatedAt.Add(time.Duration(rule.AcceptTimeoutSeconds) * time.Second)
+			order.AcceptDeadline = &deadline
 		}
+		order.StatusReason = decision.Reason
 	}
 
+	dummy.AddOrder(order)
+	h.hub.Publish(websocket.ToStore(storeID).WithStations(dummy.OrderStations(&order)...), events.OrderCreated{Order: order})
+
+	switch decision.Action {
+	case delivery.DecisionAccept:
+		h.outbox.EnqueueOrderEvent(&order, delivery.EventAccepted, decision.Reason)
+	case delivery.DecisionReject:
+		h.outbox.EnqueueOrderEvent(&order, delivery.EventRejected, decision.Reason)
+	}
+	return order
+}
+
+// DeliveryRuleRequest updates a store's acceptance rule for one platform
+type DeliveryRuleRequest struct {
+	StoreID               string `json:"store_id"`
+	AutoAcceptDuringHours bool   `json:"auto_accept_during_hours"`
+	OpensAt               string `json:"opens_at"`
+	ClosesAt              string `json:"closes_at"`
+	AutoAcceptMaxTotal    int    `json:"auto_accept_max_total" binding:"min=0"`
+	AutoRejectOutOfStock  bool   `json:"auto_reject_out_of_stock"`
+	AcceptTimeoutSeconds  int    `json:"accept_timeout_seconds" binding:"min=0,max=3600"`
+}
+
+// ListRules - GET /api/admin/delivery/rules?store_id=
+func (h *DeliveryHandler) ListRules(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListDeliveryRules(adminStoreID(c, c.Query("store_id"))))
+}
+
+// UpdateRule - PUT /api/admin/delivery/rules/:platform
+func (h *DeliveryHandler) UpdateRule(c *gin.Context) {
+	platform := c.Param("platform")
+	if !dummy.IsDeliverySource(platform) {
+		response.BadRequest(c, "Invalid platform. Use: grabfood, gofood, shopee_food")
+		return
+	}
+
+	var req DeliveryRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	storeID := adminStoreID(c, req.StoreID)
+	rule := dummy.GetDeliveryRule(storeID, platform)
+	rule.AutoAcceptDuringHours = req.AutoAcceptDuringHours
+	rule.AutoAcceptMaxTotal = req.AutoAcceptMaxTotal
+	rule.AutoRejectOutOfStock = req.AutoRejectOutOfStock
+	if req.OpensAt != "" {
+		rule.OpensAt = req.OpensAt
+	}
+	if req.ClosesAt != "" {
+		rule.ClosesAt = req.ClosesAt
+	}
+	if req.AcceptTimeoutSeconds > 0 {
+		rule.AcceptTimeoutSeconds = req.AcceptTimeoutSeconds
+	}
+	for _, clock := range []string{rule.OpensAt, rule.ClosesAt} {
+		if _, err := delivery.ParseClock(clock); err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+	}
+
+	response.Success(c, http.StatusOK, dummy.SaveDeliveryRule(rule))
+}
+
+// adminStoreID picks the store an admin request applies to. Store admins are
+// limited to their own store; super admins may name any store.
+func adminStoreID(c *gin.Context, requested string) string {
+	if middleware.GetUserRole(c) == "super_admin" && requested != "" {
+		return requested
+	}
+	if storeID := middleware.GetStoreID(c); storeID != "" {
+		return storeID
+	}
+	return dummy.DefaultStoreID
+}
+
+// ListOutbox - GET /api/admin/delivery/outbox?status=pending|delivered|dead
+func (h *DeliveryHandler) ListOutbox(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.outbox.List(c.Query("status")))
+}
+
+// RetryOutboxJob - POST /api/admin/delivery/outbox/:id/retry
+func (h *DeliveryHandler) RetryOutboxJob(c *gin.Context) {
+	job, err := h.outbox.Retry(c.Param("id"))
+	if errors.Is(err, os.ErrNotExist) {
+		response.NotFound(c, "Outbox job not found")
+		return
+	}
+	if err != nil {
+		response.Conflict(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusOK, job)
+}
+
+// Helper to create delivery order
+// Items are matched to our catalog through the menu mappings; anything that
+// cannot be matched is kept with the platform's name and queued for an admin.
+func (h *DeliveryHandler) createDeliveryOrder(externalID, source, customerName, phone, address, driver string, items []ItemInput, total int) dummy.Order {
+	orderID := uuid.New().String()
+	orderItems, subtotal := buildDeliveryItems(orderID, source, items)
+
 	if total == 0 {
 		total = subtotal
 	}
 	tax := total * 11 / 100
 
 	return dummy.Order{
-		ID:              uuid.New().String(),
+		ID:              orderID,
 		OrderNumber:     dummy.GetNextDeliveryOrderNumber(source),
 		ExternalOrderID: externalID,
 		OrderType:       "delivery",
@@ -240,3 +401,46 @@ func (h *DeliveryHandler) createDeliveryOrder(externalID, source, customerName,
 		UpdatedAt:       time.Now(),
 	}
 }
+
+// buildDeliveryItems turns platform order lines into order items matched to our catalog
+func buildDeliveryItems(orderID, source string, items []ItemInput) ([]dummy.OrderItem, int) {
+	orderItems := make([]dummy.OrderItem, len(items))
+	subtotal := 0
+	for i, item := range items {
+		itemTotal := item.Price * item.Quantity
+		subtotal += itemTotal
+		orderItems[i] = dummy.OrderItem{
+			ID:             uuid.New().String(),
+			ExternalItemID: item.ExternalID,
+			ModifierNames:  item.Modifiers,
+			Quantity:       item.Quantity,
+			UnitPrice:      item.Price,
+			Subtotal:       itemTotal,
+			Notes:          item.Notes,
+		}
+		resolved := delivery.Resolve(source, menuLineFor(orderItems[i], item.Name, item.Variant))
+		applyResolvedLine(&orderItems[i], resolved)
+		for _, miss := range resolved.Misses {
+			dummy.RecordUnmappedItem(source, miss.Kind, miss.ExternalID, miss.Name, miss.ProductID, orderID)
+		}
+	}
+	return orderItems, subtotal
+}
+
+func menuLineFor(item dummy.OrderItem, name, variant string) delivery.MenuLine {
+	return delivery.MenuLine{
+		ExternalID: item.ExternalItemID,
+		Name:       name,
+		Variant:    variant,
+		Modifiers:  item.ModifierNames,
+	}
+}
+
+// applyResolvedLine copies catalog matches onto an order item
+func applyResolvedLine(item *dummy.OrderItem, resolved delivery.ResolvedLine) {
+	item.ProductID = resolved.ProductID
+	item.ProductName = resolved.ProductName
+	item.VariantID = resolved.VariantID
+	item.VariantName = resolved.VariantName
+	item.Modifiers = resolved.ModifierIDs
+}
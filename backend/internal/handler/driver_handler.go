@@ -0,0 +1,238 @@
+package handler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/websocket"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// GrabFood driver webhook - POST /api/webhooks/grabfood/driver
+type GrabFoodDriverEvent struct {
+	OrderID string `json:"orderId" binding:"required"`
+	State   string `json:"state" binding:"required"`
+	Driver  struct {
+		Name         string `json:"name"`
+		Phone        string `json:"phone"`
+		LicensePlate string `json:"licensePlate"`
+	} `json:"driver"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (h *DeliveryHandler) HandleGrabFoodDriver(c *gin.Context) {
+	var req GrabFoodDriverEvent
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid GrabFood driver event format")
+		return
+	}
+	h.recordDriverEvent(c, dummy.SourceGrabFood, req.OrderID, req.State, dummy.DriverEvent{
+		Name: req.Driver.Name, Phone: req.Driver.Phone, Plate: req.Driver.LicensePlate, At: req.UpdatedAt,
+	})
+}
+
+// GoFood driver webhook - POST /api/webhooks/gofood/driver
+type GoFoodDriverEvent struct {
+	TransactionID string `json:"transaction_id" binding:"required"`
+	Event         string `json:"event" binding:"required"`
+	Driver        struct {
+		Name          string `json:"name"`
+		Phone         string `json:"phone"`
+		VehicleNumber string `json:"vehicle_number"`
+	} `json:"driver"`
+	EventTime time.Time `json:"event_time"`
+}
+
+func (h *DeliveryHandler) HandleGoFoodDriver(c *gin.Context) {
+	var req GoFoodDriverEvent
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid GoFood driver event format")
+		return
+	}
+	h.recordDriverEvent(c, dummy.SourceGoFood, req.TransactionID, req.Event, dummy.DriverEvent{
+		Name: req.Driver.Name, Phone: req.Driver.Phone, Plate: req.Driver.VehicleNumber, At: req.EventTime,
+	})
+}
+
+// Shopee Food driver webhook - POST /api/webhooks/shopee/driver
+type ShopeeFoodDriverEvent struct {
+	OrderNo       string `json:"order_no" binding:"required"`
+	ShipperStatus string `json:"shipper_status" binding:"required"`
+	Shipper       struct {
+		Name        string `json:"name"`
+		Phone       string `json:"phone"`
+		PlateNumber string `json:"plate_number"`
+	} `json:"shipper"`
+	UpdateTime int64 `json:"update_time"` // unix seconds
+}
+
+func (h *DeliveryHandler) HandleShopeeFoodDriver(c *gin.Context) {
+	var req ShopeeFoodDriverEvent
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid Shopee Food driver event format")
+		return
+	}
+	var at time.Time
+	if req.UpdateTime > 0 {
+		at = time.Unix(req.UpdateTime, 0)
+	}
+	h.recordDriverEvent(c, dummy.SourceShopeeFood, req.OrderNo, req.ShipperStatus, dummy.DriverEvent{
+		Name: req.Shipper.Name, Phone: req.Shipper.Phone, Plate: req.Shipper.PlateNumber, At: at,
+	})
+}
+
+// recordDriverEvent stores a platform's driver update on its order and shows it
+// on the store's pickup shelf screen
+func (h *DeliveryHandler) recordDriverEvent(c *gin.Context, platform, externalID, status string, event dummy.DriverEvent) {
+	stage, ok := delivery.DriverStage(platform, status)
+	if !ok {
+		response.BadRequest(c, "Unknown driver status: "+status)
+		return
+	}
+	existing := dummy.FindOrderByExternalID(platform, externalID)
+	if existing == nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+
+	event.Stage = stage
+	event.ReceivedAt = time.Now()
+	if event.At.IsZero() {
+		event.At = event.ReceivedAt
+	}
+	order, duplicate, err := dummy.RecordDriverEvent(existing.ID, event)
+	if err != nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	c.Set(ctxWebhookOrderID, order.ID)
+	c.Set(ctxWebhookDuplicate, duplicate)
+
+	if !duplicate {
+		h.hub.Publish(websocket.ToStore(order.StoreID).With(websocket.OrderTopic(order.ID)), events.DriverUpdated{
+			OrderID:     order.ID,
+			OrderNumber: order.OrderNumber,
+			OrderSource: order.OrderSource,
+			OrderStatus: order.Status,
+			Stage:       stage,
+			Driver:      order.Driver,
+			ReadyAt:     order.ReadyAt,
+		})
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"status":       "accepted",
+		"order_id":     order.ID,
+		"order_number": order.OrderNumber,
+		"driver":       order.Driver,
+	})
+}
+
+// DriverWaitRow is one delivery order in the driver wait report
+type DriverWaitRow struct {
+	OrderID            string     `json:"order_id"`
+	OrderNumber        string     `json:"order_number"`
+	Platform           string     `json:"platform"`
+	DriverName         string     `json:"driver_name,omitempty"`
+	ReadyAt            time.Time  `json:"ready_at"`
+	ArrivedAt          time.Time  `json:"arrived_at"`
+	PickedUpAt         *time.Time `json:"picked_up_at,omitempty"`
+	DriverWaitSeconds  int        `json:"driver_wait_seconds"` // driver at the counter before the food was ready
+	FoodWaitSeconds    int        `json:"food_wait_seconds"`   // food on the shelf before the driver arrived
+	PickupDelaySeconds int        `json:"pickup_delay_seconds,omitempty"`
+}
+
+// DriverWaitSummary averages driver and food wait for one platform
+type DriverWaitSummary struct {
+	Platform             string `json:"platform"`
+	Orders               int    `json:"orders"`
+	DriversWaited        int    `json:"drivers_waited"` // orders where the driver arrived before the food was ready
+	AvgDriverWaitSeconds int    `json:"avg_driver_wait_seconds"`
+	MaxDriverWaitSeconds int    `json:"max_driver_wait_seconds"`
+	AvgFoodWaitSeconds   int    `json:"avg_food_wait_seconds"`
+}
+
+// GetDriverWait - GET /api/reports/driver-wait?date_from=&date_to=&platform=
+// Compares each driver's arrival with when the kitchen marked the food ready.
+// Orders without both times yet are left out.
+func (h *DeliveryHandler) GetDriverWait(c *gin.Context) {
+	from, to, ok := reportPeriod(c, "date_from", "date_to")
+	if !ok {
+		return
+	}
+	platform := c.Query("platform")
+
+	rows := []DriverWaitRow{}
+	summaries := map[string]*DriverWaitSummary{}
+	driverWait, foodWait := map[string]time.Duration{}, map[string]time.Duration{}
+
+	for _, o := range dummy.GetAllOrders() {
+		if !dummy.IsDeliverySource(o.OrderSource) || (platform != "" && o.OrderSource != platform) ||
+			o.CreatedAt.Before(from) || !o.CreatedAt.Before(to) {
+			continue
+		}
+		wait, ok := delivery.WaitFor(&o)
+		if !ok {
+			continue
+		}
+
+		row := DriverWaitRow{
+			OrderID:           o.ID,
+			OrderNumber:       o.OrderNumber,
+			Platform:          o.OrderSource,
+			DriverName:        o.DriverName,
+			ReadyAt:           wait.ReadyAt,
+			ArrivedAt:         wait.ArrivedAt,
+			PickedUpAt:        wait.PickedUpAt,
+			DriverWaitSeconds: int(wait.DriverWaited.Seconds()),
+			FoodWaitSeconds:   int(wait.FoodWaited.Seconds()),
+		}
+		if wait.PickedUpAt != nil {
+			// Time from the later of food ready and driver arrival to the handover
+			start := wait.ReadyAt
+			if wait.ArrivedAt.After(start) {
+				start = wait.ArrivedAt
+			}
+			if wait.PickedUpAt.After(start) {
+				row.PickupDelaySeconds = int(wait.PickedUpAt.Sub(start).Seconds())
+			}
+		}
+		rows = append(rows, row)
+
+		s := summaries[o.OrderSource]
+		if s == nil {
+			s = &DriverWaitSummary{Platform: o.OrderSource}
+			summaries[o.OrderSource] = s
+		}
+		s.Orders++
+		if wait.DriverWaited > 0 {
+			s.DriversWaited++
+		}
+		if row.DriverWaitSeconds > s.MaxDriverWaitSeconds {
+			s.MaxDriverWaitSeconds = row.DriverWaitSeconds
+		}
+		driverWait[o.OrderSource] += wait.DriverWaited
+		foodWait[o.OrderSource] += wait.FoodWaited
+	}
+
+	platforms := make([]DriverWaitSummary, 0, len(summaries))
+	for p, s := range summaries {
+		s.AvgDriverWaitSeconds = int(driverWait[p].Seconds()) / s.Orders
+		s.AvgFoodWaitSeconds = int(foodWait[p].Seconds()) / s.Orders
+		platforms = append(platforms, *s)
+	}
+	sort.Slice(platforms, func(i, j int) bool { return platforms[i].Platform < platforms[j].Platform })
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ArrivedAt.Before(rows[j].ArrivedAt) })
+
+	response.Success(c, http.StatusOK, gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"platforms": platforms,
+		"orders":    rows,
+	})
+}
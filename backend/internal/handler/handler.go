@@ -2,6 +2,8 @@ package handler
 
 import (
 	"github.com/kaori/backend/internal/config"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/payment"
 	"github.com/kaori/backend/internal/service"
 	"github.com/kaori/backend/internal/websocket"
 )
@@ -23,10 +25,10 @@ type Handlers struct {
 
 // NewHandlers creates all handler instances
 // If services is nil, handlers will use stub implementations with dummy data
-func NewHandlers(services *service.Services, hub *websocket.Hub) *Handlers {
+func NewHandlers(services *service.Services, hub *websocket.Hub, outbox *delivery.Outbox) *Handlers {
+	cfg := config.Load()
 	if services == nil {
 		// Dummy data mode - create handlers with dummy auth service
-		cfg := config.Load()
 		authService := service.NewAuthService(cfg)
 		return &Handlers{
 			Auth:     NewAuthHandler(authService),
@@ -34,8 +36,8 @@ func NewHandlers(services *service.Services, hub *websocket.Hub) *Handlers {
 			Table:    &TableHandler{},
 			Category: &CategoryHandler{},
 			Product:  &ProductHandler{},
-			Order:    &OrderHandler{hub: hub},
-			Payment:  &PaymentHandler{},
+			Order:    &OrderHandler{hub: hub, outbox: outbox},
+			Payment:  &PaymentHandler{hub: hub, providers: payment.ProvidersFromConfig(cfg)},
 			Member:   &MemberHandler{},
 			Voucher:  &VoucherHandler{},
 			Report:   &ReportHandler{},
@@ -49,8 +51,8 @@ func NewHandlers(services *service.Services, hub *websocket.Hub) *Handlers {
 		Table:    NewTableHandler(services.Table),
 		Category: NewCategoryHandler(services.Category),
 		Product:  NewProductHandler(services.Product),
-		Order:    NewOrderHandler(services.Order, hub),
-		Payment:  NewPaymentHandler(services.Payment),
+		Order:    NewOrderHandler(services.Order, hub, outbox),
+		Payment:  NewPaymentHandler(services.Payment, hub, payment.ProvidersFromConfig(cfg)),
 		Member:   NewMemberHandler(services.Member),
 		Voucher:  NewVoucherHandler(services.Voucher),
 		Report:   NewReportHandler(services.Report),
@@ -98,19 +100,22 @@ func NewProductHandler(s *service.ProductService) *ProductHandler {
 type OrderHandler struct {
 	service *service.OrderService
 	hub     *websocket.Hub
+	outbox  *delivery.Outbox
 }
 
-func NewOrderHandler(s *service.OrderService, hub *websocket.Hub) *OrderHandler {
-	return &OrderHandler{service: s, hub: hub}
+func NewOrderHandler(s *service.OrderService, hub *websocket.Hub, outbox *delivery.Outbox) *OrderHandler {
+	return &OrderHandler{service: s, hub: hub, outbox: outbox}
 }
 
 // PaymentHandler handles payment endpoints
 type PaymentHandler struct {
-	service *service.PaymentService
+	service   *service.PaymentService
+	hub       *websocket.Hub
+	providers *payment.Registry
 }
 
-func NewPaymentHandler(s *service.PaymentService) *PaymentHandler {
-	return &PaymentHandler{service: s}
+func NewPaymentHandler(s *service.PaymentService, hub *websocket.Hub, providers *payment.Registry) *PaymentHandler {
+	return &PaymentHandler{service: s, hub: hub, providers: providers}
 }
 
 // MemberHandler handles member endpoints
@@ -0,0 +1,277 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// Slugs become webhook URLs and order sources
+var integrationSlug = regexp.MustCompile(`^[a-z][a-z0-9_]{1,29}$`)
+
+// IntegrationHandler manages aggregators onboarded through field mappings
+type IntegrationHandler struct{}
+
+// NewIntegrationHandler creates a new integration handler
+func NewIntegrationHandler() *IntegrationHandler {
+	return &IntegrationHandler{}
+}
+
+// errIntegrationSecret is returned when an integration would take orders without a token
+const errIntegrationSecret = "secret is required to activate an integration"
+
+// IntegrationRequest creates or updates an integration
+type IntegrationRequest struct {
+	Slug     string `json:"slug" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	StoreID  string `json:"store_id"` // super admins only; store admins always get their own
+	Format   string `json:"format" binding:"omitempty,oneof=yaml json"`
+	Mapping  string `json:"mapping" binding:"required"`
+	Secret   string `json:"secret"`
+	IsActive *bool  `json:"is_active"`
+}
+
+// TestMappingRequest runs a sample payload through a mapping without saving anything
+type TestMappingRequest struct {
+	Format  string          `json:"format" binding:"omitempty,oneof=yaml json"`
+	Mapping string          `json:"mapping"`
+	Payload json.RawMessage `json:"payload" binding:"required"`
+}
+
+// MappingPreviewItem is a mapped order line with its catalog match
+type MappingPreviewItem struct {
+	delivery.MappedItem
+	ProductID   string          `json:"product_id,omitempty"`
+	ProductName string          `json:"product_name,omitempty"`
+	VariantName string          `json:"variant_name,omitempty"`
+	Misses      []delivery.Miss `json:"unmapped,omitempty"`
+}
+
+// List - GET /api/admin/integrations?store_id=
+func (h *IntegrationHandler) List(c *gin.Context) {
+	storeID := c.Query("store_id")
+	if middleware.GetUserRole(c) != "super_admin" {
+		storeID = adminStoreID(c, "")
+	}
+	response.Success(c, http.StatusOK, dummy.ListIntegrations(storeID))
+}
+
+// Create - POST /api/admin/integrations
+func (h *IntegrationHandler) Create(c *gin.Context) {
+	var req IntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := validateIntegration(&req, ""); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+	in := integrationFromRequest(req, dummy.Integration{IsActive: true, StoreID: adminStoreID(c, req.StoreID)})
+	if in.IsActive && in.Secret == "" {
+		response.BadRequest(c, errIntegrationSecret)
+		return
+	}
+	response.Success(c, http.StatusCreated, dummy.SaveIntegration(in))
+}
+
+// Update - PUT /api/admin/integrations/:id
+func (h *IntegrationHandler) Update(c *gin.Context) {
+	existing := findIntegration(c)
+	if existing == nil {
+		return
+	}
+
+	var req IntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := validateIntegration(&req, existing.ID); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+	in := integrationFromRequest(req, *existing)
+	if req.StoreID != "" {
+		in.StoreID = adminStoreID(c, req.StoreID)
+	}
+	if in.IsActive && in.Secret == "" {
+		response.BadRequest(c, errIntegrationSecret)
+		return
+	}
+	response.Success(c, http.StatusOK, dummy.SaveIntegration(in))
+}
+
+// Delete - DELETE /api/admin/integrations/:id
+func (h *IntegrationHandler) Delete(c *gin.Context) {
+	if findIntegration(c) == nil {
+		return
+	}
+	if !dummy.DeleteIntegration(c.Param("id")) {
+		response.NotFound(c, "Integration not found")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Integration deleted"})
+}
+
+// TestMapping - POST /api/admin/integrations/test, or /api/admin/integrations/:id/test
+// to use a saved integration's mapping
+func (h *IntegrationHandler) TestMapping(c *gin.Context) {
+	var req TestMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	source := "integration"
+	if c.Param("id") != "" {
+		in := findIntegration(c)
+		if in == nil {
+			return
+		}
+		req.Format, req.Mapping, source = in.Format, in.Mapping, in.Slug
+	}
+	if req.Mapping == "" {
+		response.BadRequest(c, "mapping is required")
+		return
+	}
+
+	mapping, err := delivery.ParseFieldMapping(req.Format, req.Mapping)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+	mapped, err := mapping.Apply(req.Payload)
+	if err != nil {
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	items := make([]MappingPreviewItem, len(mapped.Items))
+	subtotal := 0
+	for i, item := range mapped.Items {
+		resolved := delivery.Resolve(source, delivery.MenuLine{
+			ExternalID: item.ExternalID,
+			Name:       item.Name,
+			Variant:    item.Variant,
+			Modifiers:  item.Modifiers,
+		})
+		items[i] = MappingPreviewItem{
+			MappedItem:  item,
+			ProductID:   resolved.ProductID,
+			ProductName: resolved.ProductName,
+			VariantName: resolved.VariantName,
+			Misses:      resolved.Misses,
+		}
+		subtotal += item.Price * item.Quantity
+	}
+	total := mapped.Total
+	if total == 0 {
+		total = subtotal
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"order":    mapped,
+		"items":    items,
+		"subtotal": subtotal,
+		"total":    total,
+	})
+}
+
+// HandleIntegration - POST /api/webhooks/integrations/:slug
+// Turns an aggregator's payload into an order through its field mapping
+func (h *DeliveryHandler) HandleIntegration(c *gin.Context) {
+	in := dummy.FindIntegration(c.Param("slug"))
+	if in == nil || !in.IsActive {
+		response.NotFound(c, "Integration not found")
+		return
+	}
+	if !c.GetBool(ctxWebhookReplay) && (in.Secret == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Webhook-Token")), []byte(in.Secret)) != 1) {
+		response.Unauthorized(c, "Invalid webhook token")
+		return
+	}
+
+	mapping, err := delivery.ParseFieldMapping(in.Format, in.Mapping)
+	if err != nil {
+		response.InternalError(c, "Integration mapping is invalid: "+err.Error())
+		return
+	}
+	payload, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		response.BadRequest(c, "Could not read payload")
+		return
+	}
+	mapped, err := mapping.Apply(payload)
+	if err != nil {
+		response.BadRequest(c, "Payload does not match the "+in.Name+" mapping: "+err.Error())
+		return
+	}
+	if existing := dummy.FindOrderByExternalID(in.Slug, mapped.ExternalOrderID); existing != nil {
+		respondDuplicate(c, existing)
+		return
+	}
+
+	items := make([]ItemInput, len(mapped.Items))
+	for i, item := range mapped.Items {
+		items[i] = ItemInput{ExternalID: item.ExternalID, Name: item.Name, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Quantity, Price: item.Price, Notes: item.Notes}
+	}
+
+	order := h.createDeliveryOrder(mapped.ExternalOrderID, in.Slug, mapped.CustomerName, mapped.CustomerPhone, mapped.Address, mapped.DriverName, items, mapped.Total)
+	order.Notes = mapped.Notes
+	order = h.receiveOrder(in.StoreID, order, delivery.Promo{Merchant: mapped.MerchantPromo, Platform: mapped.PlatformPromo})
+
+	respondReceived(c, http.StatusCreated, order)
+}
+
+// findIntegration looks up the integration in the URL, answering 404 for
+// another store's: super admins manage all of them, store admins their own
+func findIntegration(c *gin.Context) *dummy.Integration {
+	in := dummy.GetIntegration(c.Param("id"))
+	if in == nil || (middleware.GetUserRole(c) != "super_admin" && in.StoreID != adminStoreID(c, "")) {
+		response.NotFound(c, "Integration not found")
+		return nil
+	}
+	return in
+}
+
+func validateIntegration(req *IntegrationRequest, id string) string {
+	if req.Format == "" {
+		req.Format = "yaml"
+	}
+	if !integrationSlug.MatchString(req.Slug) {
+		return "slug must be 2-30 lowercase letters, digits or underscores, starting with a letter"
+	}
+	if req.Slug == dummy.SourceGrabFood || req.Slug == dummy.SourceGoFood || req.Slug == dummy.SourceShopeeFood ||
+		req.Slug == dummy.SourceCashier || req.Slug == dummy.SourceTableQR {
+		return "slug is reserved for a built-in order source"
+	}
+	if existing := dummy.FindIntegration(req.Slug); existing != nil && existing.ID != id {
+		return "An integration with this slug already exists"
+	}
+	if _, err := delivery.ParseFieldMapping(req.Format, req.Mapping); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func integrationFromRequest(req IntegrationRequest, in dummy.Integration) dummy.Integration {
+	in.Slug = req.Slug
+	in.Name = req.Name
+	in.Format = req.Format
+	in.Mapping = req.Mapping
+	if req.Secret != "" {
+		in.Secret = req.Secret
+	}
+	if req.IsActive != nil {
+		in.IsActive = *req.IsActive
+	}
+	return in
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/eventbus"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+const testMapping = `
+order_id: $.id
+total: $.total
+items:
+  path: $.lines[*]
+  name: "@.name"
+  quantity: "@.qty"
+  price: "@.price"
+`
+
+func TestIntegrationBelongsToItsStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := websocket.NewHub(eventbus.NewLocal(), websocket.HubOptions{})
+	go hub.Run()
+	integrations := NewIntegrationHandler()
+	deliveries := NewDeliveryHandler(hub, nil)
+
+	r := gin.New()
+	r.POST("/api/webhooks/integrations/:slug", deliveries.HandleIntegration)
+	admin := r.Group("/api/admin", func(c *gin.Context) {
+		c.Set("user_id", "admin-other")
+		c.Set("role", "store_admin")
+		c.Set("store_id", "store-other")
+	})
+	admin.GET("/integrations", integrations.List)
+	admin.PUT("/integrations/:id", integrations.Update)
+	admin.DELETE("/integrations/:id", integrations.Delete)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	in := dummy.SaveIntegration(dummy.Integration{Slug: "warung_express", Name: "Warung Express", StoreID: dummy.DefaultStoreID,
+		Format: "yaml", Mapping: testMapping, Secret: "s3cret", IsActive: true})
+
+	// The store comes from the integration, whatever the URL says
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/api/webhooks/integrations/warung_express?store_id=store-other",
+		bytes.NewReader([]byte(`{"id":"WE-1","total":15000,"lines":[{"name":"Es Teh","qty":3,"price":5000}]}`)))
+	req.Header.Set("X-Webhook-Token", "s3cret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("integration webhook: %d, want 201", resp.StatusCode)
+	}
+	if order := dummy.FindOrderByExternalID("warung_express", "WE-1"); order == nil || order.StoreID != dummy.DefaultStoreID {
+		t.Errorf("order = %+v, want it in %s", order, dummy.DefaultStoreID)
+	}
+
+	// Another store's admin can't see or change it
+	resp, err = http.Get(srv.URL + "/api/admin/integrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list struct{ Data []dummy.Integration }
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list.Data) != 0 {
+		t.Errorf("other store's admin lists %+v", list.Data)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		req, _ := http.NewRequest(method, srv.URL+"/api/admin/integrations/"+in.ID,
+			bytes.NewReader([]byte(`{"slug":"warung_express","name":"Hijacked","mapping":"order_id: $.id\nitems:\n  path: $.lines[*]\n  name: \"@.name\"\n  price: \"@.price\"\n"}`)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s another store's integration: %d, want 404", method, resp.StatusCode)
+		}
+	}
+	if got := dummy.GetIntegration(in.ID); got == nil || got.Name != "Warung Express" {
+		t.Errorf("integration = %+v, want it unchanged", got)
+	}
+}
@@ -0,0 +1,303 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// suggestionsPerItem is how many catalog suggestions are attached to each unmapped item
+const suggestionsPerItem = 3
+
+// MenuMappingHandler manages delivery platform menu mappings
+type MenuMappingHandler struct{}
+
+// NewMenuMappingHandler creates a new menu mapping handler
+func NewMenuMappingHandler() *MenuMappingHandler {
+	return &MenuMappingHandler{}
+}
+
+// MenuMappingRequest creates or updates a mapping
+type MenuMappingRequest struct {
+	Platform     string `json:"platform" binding:"required"`
+	Kind         string `json:"kind" binding:"required,oneof=item variant modifier"`
+	ExternalID   string `json:"external_id"`
+	ExternalName string `json:"external_name"`
+	ProductID    string `json:"product_id"`
+	VariantID    string `json:"variant_id"`
+	ModifierID   string `json:"modifier_id"`
+}
+
+// ResolveUnmappedRequest maps a queued item to our catalog
+type ResolveUnmappedRequest struct {
+	ProductID  string `json:"product_id" binding:"required"`
+	VariantID  string `json:"variant_id"`
+	ModifierID string `json:"modifier_id"`
+}
+
+// UnmappedItemView is an unmapped queue entry with catalog suggestions
+type UnmappedItemView struct {
+	dummy.UnmappedItem
+	Suggestions []delivery.Suggestion `json:"suggestions"`
+}
+
+// List - GET /api/admin/menu-mappings
+func (h *MenuMappingHandler) List(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListMenuMappings(c.Query("platform")))
+}
+
+// Create - POST /api/admin/menu-mappings
+func (h *MenuMappingHandler) Create(c *gin.Context) {
+	var req MenuMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := validateMenuMapping(&req); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+
+	mapping := dummy.SaveMenuMapping(mappingFromRequest(req))
+	response.Success(c, http.StatusCreated, mapping)
+}
+
+// Update - PUT /api/admin/menu-mappings/:id
+func (h *MenuMappingHandler) Update(c *gin.Context) {
+	id := c.Param("id")
+	if dummy.GetMenuMapping(id) == nil {
+		response.NotFound(c, "Menu mapping not found")
+		return
+	}
+
+	var req MenuMappingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := validateMenuMapping(&req); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+
+	mapping := mappingFromRequest(req)
+	mapping.ID = id
+	response.Success(c, http.StatusOK, dummy.SaveMenuMapping(mapping))
+}
+
+// Delete - DELETE /api/admin/menu-mappings/:id
+func (h *MenuMappingHandler) Delete(c *gin.Context) {
+	if !dummy.DeleteMenuMapping(c.Param("id")) {
+		response.NotFound(c, "Menu mapping not found")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Menu mapping deleted"})
+}
+
+// Suggest - GET /api/admin/menu-mappings/suggestions?name=&kind=&product_id=&limit=
+func (h *MenuMappingHandler) Suggest(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		response.BadRequest(c, "name is required")
+		return
+	}
+	kind := c.DefaultQuery("kind", dummy.MappingKindItem)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "5"))
+	if err != nil || limit < 1 {
+		limit = 5
+	}
+
+	response.Success(c, http.StatusOK, delivery.Suggest(kind, name, c.Query("product_id"), limit))
+}
+
+// ListUnmapped - GET /api/admin/menu-mappings/unmapped?platform=&status=
+func (h *MenuMappingHandler) ListUnmapped(c *gin.Context) {
+	items := dummy.ListUnmappedItems(c.Query("platform"), c.DefaultQuery("status", dummy.UnmappedStatusOpen))
+	views := make([]UnmappedItemView, len(items))
+	for i, item := range items {
+		views[i] = UnmappedItemView{
+			UnmappedItem: item,
+			Suggestions:  delivery.Suggest(item.Kind, item.ExternalName, item.ProductID, suggestionsPerItem),
+		}
+	}
+	response.Success(c, http.StatusOK, views)
+}
+
+// ResolveUnmapped - POST /api/admin/menu-mappings/unmapped/:id/resolve
+// Creates the mapping and re-matches the orders that were waiting on it.
+func (h *MenuMappingHandler) ResolveUnmapped(c *gin.Context) {
+	item := dummy.GetUnmappedItem(c.Param("id"))
+	if item == nil {
+		response.NotFound(c, "Unmapped item not found")
+		return
+	}
+	if item.Status != dummy.UnmappedStatusOpen {
+		response.Conflict(c, "Unmapped item is already "+item.Status)
+		return
+	}
+
+	var body ResolveUnmappedRequest
+	if err := c.ShouldBindJSON(&body); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	req := MenuMappingRequest{
+		Platform:     item.Platform,
+		Kind:         item.Kind,
+		ExternalID:   item.ExternalID,
+		ExternalName: item.ExternalName,
+		ProductID:    body.ProductID,
+		VariantID:    body.VariantID,
+		ModifierID:   body.ModifierID,
+	}
+	if msg := validateMenuMapping(&req); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+
+	mapping := dummy.SaveMenuMapping(mappingFromRequest(req))
+	dummy.CloseUnmappedItem(item.ID, dummy.UnmappedStatusResolved, mapping.ID)
+	updated := rematchOrders(item.Platform, item.OrderIDs)
+
+	response.Success(c, http.StatusOK, gin.H{
+		"mapping":        mapping,
+		"orders_updated": updated,
+	})
+}
+
+// IgnoreUnmapped - POST /api/admin/menu-mappings/unmapped/:id/ignore
+func (h *MenuMappingHandler) IgnoreUnmapped(c *gin.Context) {
+	if !dummy.CloseUnmappedItem(c.Param("id"), dummy.UnmappedStatusIgnored, "") {
+		response.NotFound(c, "Unmapped item not found")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Unmapped item ignored"})
+}
+
+func mappingFromRequest(req MenuMappingRequest) dummy.MenuMapping {
+	return dummy.MenuMapping{
+		Platform:     req.Platform,
+		Kind:         req.Kind,
+		ExternalID:   req.ExternalID,
+		ExternalName: req.ExternalName,
+		ProductID:    req.ProductID,
+		VariantID:    req.VariantID,
+		ModifierID:   req.ModifierID,
+	}
+}
+
+// validateMenuMapping checks that the mapping points at real catalog entries
+func validateMenuMapping(req *MenuMappingRequest) string {
+	if !dummy.IsDeliverySource(req.Platform) {
+		return "Invalid platform. Use: grabfood, gofood, shopee_food"
+	}
+	if req.ExternalID == "" && req.ExternalName == "" {
+		return "external_id or external_name is required"
+	}
+	if req.Kind != dummy.MappingKindItem && req.ExternalName == "" {
+		return "external_name is required for variant and modifier mappings"
+	}
+
+	product := dummy.FindProduct(req.ProductID)
+	if product == nil && (req.Kind == dummy.MappingKindItem || req.ProductID != "") {
+		return "Product not found"
+	}
+
+	switch req.Kind {
+	case dummy.MappingKindItem:
+		req.ModifierID = ""
+		if req.VariantID != "" && !productHasVariant(product, req.VariantID) {
+			return "Variant does not belong to product"
+		}
+	case dummy.MappingKindVariant:
+		req.ModifierID = ""
+		if product == nil || !productHasVariant(product, req.VariantID) {
+			return "variant_id must be a variant of product_id"
+		}
+	case dummy.MappingKindModifier:
+		req.VariantID = ""
+		if req.ModifierID == "" {
+			return "modifier_id is required"
+		}
+		if product != nil && !productHasModifier(product, req.ModifierID) {
+			return "Modifier does not belong to product"
+		}
+	}
+	return ""
+}
+
+func productHasVariant(p *dummy.Product, variantID string) bool {
+	for _, v := range p.Variants {
+		if v.ID == variantID {
+			return true
+		}
+	}
+	return false
+}
+
+func productHasModifier(p *dummy.Product, modifierID string) bool {
+	for _, m := range p.Modifiers {
+		if m.ID == modifierID {
+			return true
+		}
+	}
+	return false
+}
+
+// rematchOrders re-runs catalog matching on items that were missing a product,
+// variant or modifier, returning how many orders changed
+func rematchOrders(platform string, orderIDs []string) int {
+	updated := 0
+	seen := make(map[string]bool)
+	for _, orderID := range orderIDs {
+		if seen[orderID] {
+			continue
+		}
+		seen[orderID] = true
+
+		// Matching reads the catalog, so it runs before taking the order lock
+		items, ok := dummy.OrderItems(orderID)
+		if !ok {
+			continue
+		}
+		matches := make(map[string]delivery.ResolvedLine)
+		for i := range items {
+			if itemNeedsMatching(&items[i]) {
+				matches[items[i].ID] = delivery.Resolve(platform, menuLineFor(items[i], items[i].ProductName, items[i].VariantName))
+			}
+		}
+		if len(matches) == 0 {
+			continue
+		}
+
+		changed := false
+		dummy.UpdateOrder(orderID, func(o *dummy.Order) {
+			for i := range o.Items {
+				item := &o.Items[i]
+				resolved, ok := matches[item.ID]
+				if !ok || !itemNeedsMatching(item) {
+					continue
+				}
+				if resolved.ProductID != item.ProductID || resolved.VariantID != item.VariantID || len(resolved.ModifierIDs) != len(item.Modifiers) {
+					applyResolvedLine(item, resolved)
+					changed = true
+				}
+			}
+		})
+		if changed {
+			updated++
+		}
+	}
+	return updated
+}
+
+func itemNeedsMatching(item *dummy.OrderItem) bool {
+	return item.ProductID == "" ||
+		(item.VariantName != "" && item.VariantID == "") ||
+		len(item.Modifiers) < len(item.ModifierNames)
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// MenuSyncHandler exposes delivery platform menu sync and store pausing
+type MenuSyncHandler struct {
+	sync *delivery.MenuSync
+}
+
+// NewMenuSyncHandler creates a new menu sync handler
+func NewMenuSyncHandler(sync *delivery.MenuSync) *MenuSyncHandler {
+	return &MenuSyncHandler{sync: sync}
+}
+
+// DeliveryPauseRequest pauses or resumes a store on every platform
+type DeliveryPauseRequest struct {
+	Paused bool   `json:"paused"`
+	Reason string `json:"reason"`
+}
+
+// ListStatus - GET /api/admin/delivery/menu-sync
+func (h *MenuSyncHandler) ListStatus(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.sync.Status())
+}
+
+// GetDiff - GET /api/admin/delivery/menu-sync/:platform
+// What the platform has now versus what it will get on the next push
+func (h *MenuSyncHandler) GetDiff(c *gin.Context) {
+	platform := c.Param("platform")
+	if !dummy.IsDeliverySource(platform) {
+		response.BadRequest(c, "Invalid platform. Use: grabfood, gofood, shopee_food")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"status":  h.sync.PlatformStatus(platform),
+		"changes": h.sync.Diff(platform),
+	})
+}
+
+// Sync - POST /api/admin/delivery/menu-sync/:platform/sync?full=true
+func (h *MenuSyncHandler) Sync(c *gin.Context) {
+	platform := c.Param("platform")
+	if !dummy.IsDeliverySource(platform) {
+		response.BadRequest(c, "Invalid platform. Use: grabfood, gofood, shopee_food")
+		return
+	}
+	if err := h.sync.Resync(platform, c.Query("full") == "true"); err != nil {
+		response.Conflict(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusAccepted, h.sync.PlatformStatus(platform))
+}
+
+// GetPause - GET /api/stores/:id/delivery-pause
+func (h *MenuSyncHandler) GetPause(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.GetDeliveryPause(c.Param("id")))
+}
+
+// SetPause - PUT /api/stores/:id/delivery-pause
+// Stops new orders on every delivery platform, e.g. while the kitchen catches up
+func (h *MenuSyncHandler) SetPause(c *gin.Context) {
+	storeID := c.Param("id")
+	if claim := middleware.GetStoreID(c); middleware.GetUserRole(c) != "super_admin" && claim != "" && claim != storeID {
+		response.Forbidden(c, "You can only pause your own store")
+		return
+	}
+
+	var req DeliveryPauseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	pause := dummy.SetDeliveryPause(dummy.DeliveryPause{
+		StoreID:   storeID,
+		Paused:    req.Paused,
+		Reason:    req.Reason,
+		UpdatedBy: middleware.GetUserID(c),
+	})
+	h.sync.Notify()
+	response.Success(c, http.StatusOK, pause)
+}
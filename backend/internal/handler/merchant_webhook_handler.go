@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/webhooks"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// MerchantWebhookHandler manages webhook subscriptions for merchant systems and
+// their delivery log
+type MerchantWebhookHandler struct {
+	dispatcher *webhooks.Dispatcher
+	allowHTTP  bool // plain http receivers, for development only
+}
+
+// NewMerchantWebhookHandler creates a new merchant webhook handler. allowHTTP
+// accepts http:// URLs as well as https://.
+func NewMerchantWebhookHandler(dispatcher *webhooks.Dispatcher, allowHTTP bool) *MerchantWebhookHandler {
+	return &MerchantWebhookHandler{dispatcher: dispatcher, allowHTTP: allowHTTP}
+}
+
+// WebhookSubscriptionRequest creates or updates a subscription
+type WebhookSubscriptionRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	URL        string   `json:"url" binding:"required"`
+	EventTypes []string `json:"event_types" binding:"required,min=1"`
+	StoreIDs   []string `json:"store_ids"` // empty for every store; store admins always get their own
+	Secret     string   `json:"secret"`    // generated on create if empty, kept on update if empty
+	IsActive   *bool    `json:"is_active"`
+}
+
+// createdSubscription shows the secret, which is only ever returned on create
+type createdSubscription struct {
+	dummy.WebhookSubscription
+	Secret string `json:"secret"`
+}
+
+// ListSubscriptions - GET /api/admin/webhook-subscriptions
+func (h *MerchantWebhookHandler) ListSubscriptions(c *gin.Context) {
+	result := []dummy.WebhookSubscription{}
+	for _, sub := range dummy.ListWebhookSubscriptions() {
+		if canManageSubscription(c, &sub) {
+			result = append(result, sub)
+		}
+	}
+	response.Success(c, http.StatusOK, result)
+}
+
+// CreateSubscription - POST /api/admin/webhook-subscriptions
+func (h *MerchantWebhookHandler) CreateSubscription(c *gin.Context) {
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := h.validateSubscription(c, &req); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+	if req.Secret == "" {
+		req.Secret = newWebhookSecret()
+	}
+
+	sub := subscriptionFromRequest(req, dummy.WebhookSubscription{IsActive: true, CreatedBy: middleware.GetUserID(c)})
+	sub = dummy.SaveWebhookSubscription(sub)
+	response.Success(c, http.StatusCreated, createdSubscription{WebhookSubscription: sub, Secret: sub.Secret})
+}
+
+// UpdateSubscription - PUT /api/admin/webhook-subscriptions/:id
+func (h *MerchantWebhookHandler) UpdateSubscription(c *gin.Context) {
+	existing := findSubscription(c)
+	if existing == nil {
+		return
+	}
+	var req WebhookSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if msg := h.validateSubscription(c, &req); msg != "" {
+		response.BadRequest(c, msg)
+		return
+	}
+	response.Success(c, http.StatusOK, dummy.SaveWebhookSubscription(subscriptionFromRequest(req, *existing)))
+}
+
+// DeleteSubscription - DELETE /api/admin/webhook-subscriptions/:id
+// Deliveries still being retried are marked failed on their next attempt.
+func (h *MerchantWebhookHandler) DeleteSubscription(c *gin.Context) {
+	existing := findSubscription(c)
+	if existing == nil {
+		return
+	}
+	dummy.DeleteWebhookSubscription(existing.ID)
+	response.Success(c, http.StatusOK, gin.H{"message": "Webhook subscription deleted"})
+}
+
+// ListDeliveries - GET /api/admin/webhook-deliveries?subscription_id=&event_type=&status=pending|delivered|failed
+func (h *MerchantWebhookHandler) ListDeliveries(c *gin.Context) {
+	filter := webhooks.Filter{
+		SubscriptionID: c.Query("subscription_id"),
+		EventType:      c.Query("event_type"),
+		Status:         c.Query("status"),
+		StoreID:        c.Query("store_id"),
+	}
+	if middleware.GetUserRole(c) != "super_admin" {
+		filter.StoreID = adminStoreID(c, "")
+	}
+
+	limit := defaultWebhookListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWebhookListLimit {
+			response.BadRequest(c, "limit must be between 1 and "+strconv.Itoa(maxWebhookListLimit))
+			return
+		}
+		limit = n
+	}
+
+	deliveries := h.dispatcher.List(filter)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	response.Success(c, http.StatusOK, deliveries)
+}
+
+// GetDelivery - GET /api/admin/webhook-deliveries/:id
+func (h *MerchantWebhookHandler) GetDelivery(c *gin.Context) {
+	if delivery := h.findDelivery(c); delivery != nil {
+		response.Success(c, http.StatusOK, delivery)
+	}
+}
+
+// ReplayDelivery - POST /api/admin/webhook-deliveries/:id/replay
+// Sends the same event again (same event ID, new delivery ID), e.g. after the
+// receiver fixed a bug or was down longer than the retries lasted
+func (h *MerchantWebhookHandler) ReplayDelivery(c *gin.Context) {
+	original := h.findDelivery(c)
+	if original == nil {
+		return
+	}
+	replay, err := h.dispatcher.Replay(original.ID, middleware.GetUserID(c))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		response.NotFound(c, "Webhook delivery not found")
+	case err != nil:
+		response.Conflict(c, err.Error())
+	default:
+		response.Success(c, http.StatusAccepted, replay)
+	}
+}
+
+func (h *MerchantWebhookHandler) findDelivery(c *gin.Context) *webhooks.Delivery {
+	delivery := h.dispatcher.Get(c.Param("id"))
+	if delivery == nil || (middleware.GetUserRole(c) != "super_admin" && delivery.StoreID != adminStoreID(c, "")) {
+		response.NotFound(c, "Webhook delivery not found")
+		return nil
+	}
+	return delivery
+}
+
+func findSubscription(c *gin.Context) *dummy.WebhookSubscription {
+	sub := dummy.GetWebhookSubscription(c.Param("id"))
+	if sub == nil || !canManageSubscription(c, sub) {
+		response.NotFound(c, "Webhook subscription not found")
+		return nil
+	}
+	return sub
+}
+
+// canManageSubscription reports whether the user may see and change a
+// subscription: super admins manage all of them, store admins only those
+// limited to their own store
+func canManageSubscription(c *gin.Context, sub *dummy.WebhookSubscription) bool {
+	if middleware.GetUserRole(c) == "super_admin" {
+		return true
+	}
+	return len(sub.StoreIDs) == 1 && sub.StoreIDs[0] == adminStoreID(c, "")
+}
+
+// validateSubscription checks a request, limiting store admins to their own store
+func (h *MerchantWebhookHandler) validateSubscription(c *gin.Context, req *WebhookSubscriptionRequest) string {
+	u, err := url.Parse(req.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && !(h.allowHTTP && u.Scheme == "http")) {
+		return "url must be an absolute https URL"
+	}
+	for _, t := range req.EventTypes {
+		if _, ok := events.Lookup(t); !ok {
+			return "Unknown event type: " + t
+		}
+	}
+	if middleware.GetUserRole(c) != "super_admin" {
+		storeID := adminStoreID(c, "")
+		for _, id := range req.StoreIDs {
+			if id != storeID {
+				return "You can only subscribe to your own store's events"
+			}
+		}
+		req.StoreIDs = []string{storeID}
+	}
+	return ""
+}
+
+func subscriptionFromRequest(req WebhookSubscriptionRequest, sub dummy.WebhookSubscription) dummy.WebhookSubscription {
+	sub.Name = req.Name
+	sub.URL = req.URL
+	sub.EventTypes = req.EventTypes
+	sub.StoreIDs = req.StoreIDs
+	if sub.StoreIDs == nil {
+		sub.StoreIDs = []string{}
+	}
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if req.IsActive != nil {
+		sub.IsActive = *req.IsActive
+	}
+	return sub
+}
+
+func newWebhookSecret() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/websocket"
+	"github.com/kaori/backend/pkg/response"
+)
+
+var (
+	errOtherStore        = errors.New("order belongs to another store")
+	errConfirmNotAllowed = errors.New("only cashiers and managers can confirm orders")
+)
+
+// orderActor is who is acting on an order, over REST or the WebSocket, so both
+// go through the same checks
+type orderActor struct {
+	UserID  string
+	Role    string
+	StoreID string
+}
+
+func actorFromContext(c *gin.Context) orderActor {
+	return orderActor{UserID: middleware.GetUserID(c), Role: middleware.GetUserRole(c), StoreID: requestStoreID(c)}
+}
+
+// authorizeOrder checks an actor may work on an order and move it to status:
+// staff only act on their own store's orders, and only cashiers and managers
+// confirm new ones
+func authorizeOrder(actor orderActor, id, status string) error {
+	order := dummy.GetOrderByID(id)
+	if order == nil {
+		return dummy.ErrOrderNotFound
+	}
+	if actor.Role != "super_admin" && order.StoreID != actor.StoreID {
+		return errOtherStore
+	}
+	if order.Status == "pending" && status == "confirmed" &&
+		actor.Role != "cashier" && actor.Role != "store_admin" && actor.Role != "super_admin" {
+		return errConfirmNotAllowed
+	}
+	return nil
+}
+
+// changeStatus moves an order through the order flow and tells the screens and,
+// for delivery orders, the platform
+func (h *OrderHandler) changeStatus(actor orderActor, id, status, reason string) (dummy.Order, error) {
+	if err := authorizeOrder(actor, id, status); err != nil {
+		return dummy.Order{}, err
+	}
+	before, after, err := dummy.TransitionOrder(id, status)
+	if err != nil {
+		return after, err
+	}
+	if before.Status != after.Status {
+		publishStatus(h.hub, id, before.Status)
+		h.notifyPlatform(id, before.Status, after.Status, reason)
+	}
+	return after, nil
+}
+
+// acknowledge records that the kitchen has seen a new order
+func (h *OrderHandler) acknowledge(actor orderActor, id string) (dummy.Order, error) {
+	if err := authorizeOrder(actor, id, ""); err != nil {
+		return dummy.Order{}, err
+	}
+	order, duplicate, err := dummy.AcknowledgeOrder(id, actor.UserID)
+	if err != nil || duplicate {
+		return order, err
+	}
+	h.hub.Publish(websocket.ToStore(order.StoreID).WithStations(dummy.OrderStations(&order)...), events.OrderAcknowledged{
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		AcknowledgedAt: order.AcknowledgedAt,
+		AcknowledgedBy: order.AcknowledgedBy,
+	})
+	return order, nil
+}
+
+// markItemReady marks one line of an order ready, moving the order along when
+// that starts or finishes it
+func (h *OrderHandler) markItemReady(actor orderActor, id, itemID string) (dummy.Order, error) {
+	if err := authorizeOrder(actor, id, ""); err != nil {
+		return dummy.Order{}, err
+	}
+	before, after, err := dummy.MarkItemReady(id, itemID)
+	if err != nil {
+		return after, err
+	}
+	h.hub.Publish(websocket.ToStore(after.StoreID).WithStations(dummy.OrderStations(&after)...), events.OrderItemReady{
+		OrderID:     after.ID,
+		OrderNumber: after.OrderNumber,
+		ItemID:      itemID,
+		Items:       after.Items,
+	})
+	if before.Status != after.Status {
+		publishStatus(h.hub, id, before.Status)
+		h.notifyPlatform(id, before.Status, after.Status, "")
+	}
+	return after, nil
+}
+
+// HandleCommand carries out a kitchen display's command from the WebSocket
+func (h *OrderHandler) HandleCommand(from websocket.Sender, cmd websocket.Command) (interface{}, error) {
+	actor := orderActor{UserID: from.UserID, Role: from.Role, StoreID: from.StoreID}
+	if cmd.OrderID == "" {
+		return nil, &websocket.CommandError{Code: websocket.ErrCodeBadRequest, Message: "order_id is required"}
+	}
+
+	var order dummy.Order
+	var err error
+	switch cmd.Name {
+	case websocket.CommandBump, websocket.CommandRecall:
+		current := orderStatus(cmd.OrderID)
+		if current == "" {
+			return nil, commandError(dummy.ErrOrderNotFound)
+		}
+		next, ok := dummy.BumpStatus(current)
+		if cmd.Name == websocket.CommandRecall {
+			next, ok = dummy.RecallStatus(current)
+		}
+		if !ok {
+			return nil, &websocket.CommandError{Code: websocket.ErrCodeInvalidTransition, Message: "Can't " + cmd.Name + " a " + current + " order"}
+		}
+		order, err = h.changeStatus(actor, cmd.OrderID, next, "")
+	case websocket.CommandAcknowledge:
+		order, err = h.acknowledge(actor, cmd.OrderID)
+	case websocket.CommandItemReady:
+		if cmd.ItemID == "" {
+			return nil, &websocket.CommandError{Code: websocket.ErrCodeBadRequest, Message: "item_id is required"}
+		}
+		order, err = h.markItemReady(actor, cmd.OrderID, cmd.ItemID)
+	default:
+		return nil, &websocket.CommandError{Code: websocket.ErrCodeBadRequest, Message: "Unknown command " + cmd.Name}
+	}
+	if err != nil {
+		return nil, commandError(err)
+	}
+	return gin.H{"order_id": order.ID, "status": order.Status}, nil
+}
+
+// orderErrorCode maps an order action error to a command error code
+func orderErrorCode(err error) string {
+	switch {
+	case errors.Is(err, dummy.ErrOrderNotFound), errors.Is(err, dummy.ErrItemNotFound):
+		return websocket.ErrCodeNotFound
+	case errors.Is(err, dummy.ErrInvalidTransition):
+		return websocket.ErrCodeInvalidTransition
+	case errors.Is(err, errOtherStore), errors.Is(err, errConfirmNotAllowed):
+		return websocket.ErrCodeForbidden
+	}
+	return websocket.ErrCodeUnavailable
+}
+
+func commandError(err error) error {
+	return &websocket.CommandError{Code: orderErrorCode(err), Message: err.Error()}
+}
+
+// respondOrderError answers a failed order action over REST
+func respondOrderError(c *gin.Context, err error) {
+	switch orderErrorCode(err) {
+	case websocket.ErrCodeNotFound:
+		response.NotFound(c, err.Error())
+	case websocket.ErrCodeInvalidTransition:
+		response.Conflict(c, err.Error())
+	case websocket.ErrCodeForbidden:
+		response.Forbidden(c, err.Error())
+	default:
+		response.InternalError(c, "Could not update order")
+	}
+}
@@ -0,0 +1,588 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/payment"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// CashPaymentRequest records cash towards an order. Amount splits the bill:
+// only that part is paid in cash, and the rest with other payments.
+type CashPaymentRequest struct {
+	OrderID    string `json:"order_id" binding:"required"`
+	AmountPaid int    `json:"amount_paid" binding:"required,min=1"` // cash handed over
+	Amount     int    `json:"amount" binding:"omitempty,min=1"`     // part of the balance paid in cash; default as much as was handed over
+	ShiftID    string `json:"shift_id"`                             // drawer the cash goes in; default your open shift
+}
+
+// CreatePaymentRequest starts a non-cash payment for an order. Which fields
+// matter depends on the provider the store routes the method to.
+type CreatePaymentRequest struct {
+	OrderID      string `json:"order_id" binding:"required"`
+	Method       string `json:"method" binding:"required,oneof=qris card ewallet"`
+	Amount       int    `json:"amount" binding:"omitempty,min=1"`                  // part of the balance; default all of it
+	Channel      string `json:"channel"`                                           // Midtrans: snap (default) or core
+	Ewallet      string `json:"ewallet" binding:"omitempty,oneof=gopay shopeepay"` // for e-wallet charges, default gopay
+	CardToken    string `json:"card_token"`                                        // from the gateway's card form
+	ApprovalCode string `json:"approval_code"`                                     // from the EDC slip
+	TerminalID   string `json:"terminal_id"`                                       // which EDC terminal
+	ReturnURL    string `json:"return_url" binding:"omitempty,url"`                // where the customer lands after paying
+}
+
+// RefundPaymentRequest gives back a payment in full, or the selected order lines
+type RefundPaymentRequest struct {
+	Reason  string              `json:"reason" binding:"required"`
+	Items   []RefundItemRequest `json:"items" binding:"omitempty,dive"` // leave out to refund the rest of the payment
+	ShiftID string              `json:"shift_id"`                       // cash: drawer to pay out of; default your open shift
+}
+
+// RefundItemRequest is an order line and how many of it to refund
+type RefundItemRequest struct {
+	ItemID   string `json:"item_id" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1"`
+}
+
+// PaymentRouteRequest picks the provider for a payment method
+type PaymentRouteRequest struct {
+	Provider string `json:"provider" binding:"required"`
+	StoreID  string `json:"store_id"` // super admins only; defaults to your store
+}
+
+// startedPayment is a started payment with the one URL the customer needs
+type startedPayment struct {
+	dummy.Payment
+	PaymentURL string               `json:"payment_url,omitempty"` // payment page, e-wallet deeplink, QR image or 3-D Secure page
+	Balance    dummy.PaymentBalance `json:"balance"`
+}
+
+// orderPayments is an order's balance with the payments behind it
+type orderPayments struct {
+	dummy.PaymentBalance
+	Payments []dummy.Payment `json:"payments"`
+}
+
+// paymentProvider describes a provider for admins choosing routes
+type paymentProvider struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+}
+
+// ProcessCash - POST /api/payments/cash
+// Records cash for all or part of what is left to pay. Change is worked out on
+// the cash alone, so a bill split between cash and QRIS gives change only on
+// the cash handed over. The cash goes in the drawer of an open shift.
+func (h *PaymentHandler) ProcessCash(c *gin.Context) {
+	var req CashPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	balance, err := dummy.OrderBalance(req.OrderID)
+	if err != nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	if balance.Remaining == 0 {
+		response.Conflict(c, "Order is already paid")
+		return
+	}
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = min(req.AmountPaid, balance.Remaining)
+	}
+	if amount > balance.Remaining {
+		response.BadRequest(c, "Amount is more than the remaining balance of "+strconv.Itoa(balance.Remaining))
+		return
+	}
+	if req.AmountPaid < amount {
+		response.BadRequest(c, "Cash handed over is less than the amount")
+		return
+	}
+
+	order := dummy.GetOrderByID(req.OrderID)
+	shift, err := cashShift(c, req.ShiftID)
+	switch {
+	case err != nil:
+		response.Conflict(c, err.Error())
+		return
+	case shift == nil:
+		response.Conflict(c, "Open a shift before taking cash")
+		return
+	case shift.StoreID != order.StoreID:
+		response.Conflict(c, "Shift is on another store's drawer")
+		return
+	}
+
+	p, err := dummy.AddPayment(dummy.Payment{
+		OrderID:  order.ID,
+		StoreID:  order.StoreID,
+		Method:   "cash",
+		Amount:   amount,
+		Provider: payment.ProviderCash,
+		Tendered: req.AmountPaid,
+		Change:   req.AmountPaid - amount,
+		ShiftID:  shift.ID,
+	})
+	if err != nil {
+		response.Conflict(c, err.Error())
+		return
+	}
+	// The payment only succeeds with its cash in the drawer of a shift still open
+	_, err = dummy.AddDrawerEntryAfter(shift.ID, dummy.DrawerEntry{
+		Type:      dummy.DrawerCashSale,
+		Amount:    p.Amount,
+		OrderID:   order.ID,
+		PaymentID: p.ID,
+		UserID:    middleware.GetUserID(c),
+	}, func() (err error) {
+		p, _, err = payment.Apply(h.hub, p.ID, dummy.PaymentUpdate{Status: dummy.PaymentSuccess})
+		return err
+	})
+	if err != nil {
+		reason, message := "order already paid", "Order was paid by another payment; hand the cash back"
+		if errors.Is(err, dummy.ErrShiftClosed) {
+			reason, message = "shift closed", "Shift was closed; open a new one to take cash"
+		}
+		payment.Apply(h.hub, p.ID, dummy.PaymentUpdate{Status: dummy.PaymentFailed, ProviderStatus: reason})
+		response.Conflict(c, message)
+		return
+	}
+	balance, _ = dummy.OrderBalance(order.ID)
+
+	message := "Payment successful"
+	if balance.Remaining > 0 {
+		message = "Partial payment recorded"
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"message":     message,
+		"order_id":    order.ID,
+		"total":       order.Total,
+		"amount_paid": req.AmountPaid,
+		"change":      p.Change,
+		"shift_id":    shift.ID,
+		"payment":     p,
+		"balance":     balance,
+	})
+}
+
+// ListForOrder - GET /api/orders/:id/payments
+// What has been paid towards an order, by which payments, and what is left
+func (h *PaymentHandler) ListForOrder(c *gin.Context) {
+	balance, err := dummy.OrderBalance(c.Param("id"))
+	if err != nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	response.Success(c, http.StatusOK, orderPayments{PaymentBalance: balance, Payments: dummy.OrderPayments(balance.OrderID)})
+}
+
+// Create - POST /api/payments
+// Starts a payment for the order's balance, or part of it, with the provider
+// the order's store uses for the method
+func (h *PaymentHandler) Create(c *gin.Context) {
+	var req CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	order := dummy.GetOrderByID(req.OrderID)
+	if order == nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	provider, err := h.providers.Route(order.StoreID, req.Method)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+	h.create(c, req, order, provider)
+}
+
+// CreateMidtrans - POST /api/payments/midtrans
+// Starts a payment through Midtrans whatever the store's routes say, either as
+// a Snap page or a direct Core API charge (QRIS code, e-wallet deeplink or
+// tokenized card)
+func (h *PaymentHandler) CreateMidtrans(c *gin.Context) {
+	var req CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	order := dummy.GetOrderByID(req.OrderID)
+	if order == nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	provider, _ := h.providers.Get(payment.ProviderMidtrans)
+	h.create(c, req, order, provider)
+}
+
+func (h *PaymentHandler) create(c *gin.Context, req CreatePaymentRequest, order *dummy.Order, provider payment.Provider) {
+	if !payment.Supports(provider, req.Method) {
+		response.BadRequest(c, provider.Name()+" does not take "+req.Method+" payments")
+		return
+	}
+	balance, _ := dummy.OrderBalance(order.ID)
+	if balance.Remaining == 0 {
+		response.Conflict(c, "Order is already paid")
+		return
+	}
+	amount := req.Amount
+	if amount == 0 {
+		amount = balance.Remaining
+	}
+	if amount > balance.Remaining {
+		response.BadRequest(c, "Amount is more than the remaining balance of "+strconv.Itoa(balance.Remaining))
+		return
+	}
+
+	// The payment's ID is what the provider knows it by, so it is chosen first
+	// and the payment saved once the provider has taken it
+	id := uuid.New().String()
+	charge := payment.ChargeRequest{
+		Ref:          id,
+		Amount:       amount,
+		Method:       req.Method,
+		Items:        payment.OrderItems(order, amount),
+		Channel:      req.Channel,
+		Ewallet:      req.Ewallet,
+		CardToken:    req.CardToken,
+		ApprovalCode: req.ApprovalCode,
+		TerminalID:   req.TerminalID,
+		CallbackURL:  req.ReturnURL,
+	}
+	if order.CustomerName != "" || order.CustomerPhone != "" {
+		charge.Customer = &payment.Customer{FirstName: order.CustomerName, Phone: order.CustomerPhone}
+	}
+	started, err := provider.Create(c.Request.Context(), charge)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+
+	p := dummy.Payment{
+		ID:          id,
+		OrderID:     order.ID,
+		StoreID:     order.StoreID,
+		Method:      req.Method,
+		Amount:      charge.Amount,
+		Provider:    provider.Name(),
+		ProviderRef: id,
+	}
+	if shift := dummy.OpenShiftFor(middleware.GetUserID(c)); shift != nil {
+		p.ShiftID = shift.ID
+	}
+	started.Details(&p)
+	if p, err = dummy.AddPayment(p); err != nil {
+		// Another payment took the balance while the provider was answering
+		response.Conflict(c, err.Error())
+		return
+	}
+
+	// Approved EDC slips, declined cards and the like are known straight away
+	if started.Status != dummy.PaymentPending {
+		p, _, _ = payment.Apply(h.hub, p.ID, started.Update())
+	}
+	balance, _ = dummy.OrderBalance(order.ID)
+	response.Success(c, http.StatusCreated, startedPayment{Payment: p, PaymentURL: started.PaymentURL, Balance: balance})
+}
+
+// MidtransCallback - POST /api/payments/midtrans/callback
+// Midtrans' HTTP notification. It is signed with our server key and sent again
+// until we answer 200, so unchanged statuses are acknowledged without effect.
+func (h *PaymentHandler) MidtransCallback(c *gin.Context) {
+	h.callback(c, payment.ProviderMidtrans)
+}
+
+func (h *PaymentHandler) callback(c *gin.Context, name string) {
+	provider, ok := h.providers.Get(name)
+	if !ok {
+		response.NotFound(c, "Unknown payment provider")
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		response.BadRequest(c, "Invalid notification")
+		return
+	}
+	cb, err := provider.ParseCallback(c.Request.Header, body)
+	if err != nil {
+		paymentError(c, err)
+		return
+	}
+
+	p := dummy.FindPaymentByProviderRef(name, cb.Ref)
+	if p == nil {
+		response.NotFound(c, "Payment not found")
+		return
+	}
+	c.Set(ctxWebhookOrderID, p.OrderID)
+	c.Set(ctxWebhookStoreID, p.StoreID) // the order's store, so its admins find the callback
+	if cb.Update.Amount == 0 {
+		cb.Update.Amount = cb.Amount
+	}
+
+	updated, changed, err := payment.Apply(h.hub, p.ID, cb.Update)
+	switch {
+	case errors.Is(err, payment.ErrAmountMismatch):
+		response.BadRequest(c, "Amount does not match the payment")
+		return
+	case errors.Is(err, dummy.ErrOverpaid):
+		response.Conflict(c, "Order is already paid by other payments")
+		return
+	case err != nil:
+		response.NotFound(c, err.Error())
+		return
+	}
+	if !changed {
+		c.Set(ctxWebhookDuplicate, true)
+	}
+	response.Success(c, http.StatusOK, gin.H{"payment_id": updated.ID, "status": updated.Status, "changed": changed})
+}
+
+// GetStatus - GET /api/payments/:id/status
+// Takes a payment ID, or an order ID for the order's latest payment. Pending
+// payments are checked with their provider first, in case a callback was lost.
+func (h *PaymentHandler) GetStatus(c *gin.Context) {
+	p := dummy.GetPayment(c.Param("id"))
+	if p == nil {
+		if payments := dummy.OrderPayments(c.Param("id")); len(payments) > 0 {
+			p = &payments[len(payments)-1]
+		}
+	}
+	if p == nil {
+		response.NotFound(c, "Payment not found")
+		return
+	}
+
+	if provider, ok := h.providers.Get(p.Provider); ok && p.Status == dummy.PaymentPending {
+		u, err := provider.Status(c.Request.Context(), *p)
+		switch {
+		case err == nil:
+			if updated, _, err := payment.Apply(h.hub, p.ID, u); err == nil {
+				p = &updated
+			}
+		case errors.Is(err, payment.ErrNoStatus), errors.Is(err, payment.ErrNotConfigured):
+			// Nothing to ask yet, or no one to ask
+		default:
+			paymentError(c, err)
+			return
+		}
+	}
+	response.Success(c, http.StatusOK, p)
+}
+
+// Refund - POST /api/payments/:id/refunds
+// Managers only. The money goes back the way it came: through the payment's
+// provider, or for cash out of the drawer. The order keeps its status; a refund
+// is not a cancellation.
+func (h *PaymentHandler) Refund(c *gin.Context) {
+	var req RefundPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	p := dummy.GetPayment(c.Param("id"))
+	if p == nil {
+		response.NotFound(c, "Payment not found")
+		return
+	}
+	if middleware.GetUserRole(c) != "super_admin" && p.StoreID != requestStoreID(c) {
+		response.Forbidden(c, "Payment belongs to another store")
+		return
+	}
+
+	// Cash comes out of a drawer: the one asked for, the manager's own, or the
+	// one the payment went into if that shift is still open
+	shiftID := ""
+	if p.Provider == payment.ProviderCash {
+		shift, err := cashShift(c, req.ShiftID)
+		if err != nil {
+			response.Conflict(c, err.Error())
+			return
+		}
+		if shift == nil {
+			if taken := dummy.GetShift(p.ShiftID); taken != nil && taken.Status == dummy.ShiftOpen {
+				shift = taken
+			}
+		}
+		if shift == nil {
+			response.Conflict(c, "Open a shift to pay the refund out of a drawer")
+			return
+		}
+		if shift.StoreID != p.StoreID {
+			response.Conflict(c, "Shift is on another store's drawer")
+			return
+		}
+		shiftID = shift.ID
+	}
+
+	items := make([]dummy.RefundItem, len(req.Items))
+	for i, it := range req.Items {
+		items[i] = dummy.RefundItem{OrderItemID: it.ItemID, Quantity: it.Quantity}
+	}
+	r, err := dummy.StartRefund(dummy.Refund{
+		PaymentID:   p.ID,
+		Items:       items,
+		Reason:      req.Reason,
+		ShiftID:     shiftID,
+		RequestedBy: middleware.GetUserID(c),
+	})
+	switch {
+	case errors.Is(err, dummy.ErrNotRefundable), errors.Is(err, dummy.ErrRefundedWhole):
+		response.Conflict(c, err.Error())
+		return
+	case err != nil:
+		response.BadRequest(c, err.Error())
+		return
+	}
+
+	out, err := h.refund(c, *p, r)
+	if err != nil && !payment.Refused(err) {
+		// The provider may have refunded it: the refund stays pending, holding
+		// its amount, and reconciliation sends it again with the same refund_key
+		r, _, _ = dummy.FinishRefund(r.ID, dummy.RefundOutcome{Status: dummy.PaymentPending, Message: err.Error()})
+		response.Success(c, http.StatusAccepted, r)
+		return
+	}
+	if err != nil {
+		dummy.FinishRefund(r.ID, dummy.RefundOutcome{Status: dummy.PaymentFailed, Message: err.Error()})
+		paymentError(c, err)
+		return
+	}
+	var order dummy.Order
+	finish := func() (err error) {
+		r, order, err = dummy.FinishRefund(r.ID, out)
+		return err
+	}
+	if r.ShiftID == "" {
+		err = finish()
+	} else {
+		// Cash is only refunded out of the drawer of a shift still open
+		_, err = dummy.AddDrawerEntryAfter(r.ShiftID, dummy.DrawerEntry{
+			Type:      dummy.DrawerCashRefund,
+			Amount:    r.Amount,
+			Reason:    r.Reason,
+			OrderID:   r.OrderID,
+			PaymentID: r.PaymentID,
+			RefundID:  r.ID,
+			UserID:    r.RequestedBy,
+		}, finish)
+	}
+	switch {
+	case errors.Is(err, dummy.ErrShiftClosed):
+		dummy.FinishRefund(r.ID, dummy.RefundOutcome{Status: dummy.PaymentFailed, Message: "shift closed"})
+		response.Conflict(c, "Shift was closed; open a new one to pay the refund out of a drawer")
+		return
+	case err != nil:
+		response.InternalError(c, err.Error())
+		return
+	}
+	if r.Status == dummy.PaymentSuccess {
+		payment.PublishRefund(h.hub, r, order)
+	}
+	response.Success(c, http.StatusCreated, r)
+}
+
+// refund asks the payment's provider to give the money back
+func (h *PaymentHandler) refund(c *gin.Context, p dummy.Payment, r dummy.Refund) (dummy.RefundOutcome, error) {
+	if p.Provider == payment.ProviderCash {
+		return dummy.RefundOutcome{
+			Status:  dummy.PaymentSuccess,
+			Manual:  true,
+			Message: "Give " + strconv.Itoa(r.Amount) + " back from the cash drawer",
+		}, nil
+	}
+	provider, ok := h.providers.Get(p.Provider)
+	if !ok {
+		return dummy.RefundOutcome{}, fmt.Errorf("%w: unknown payment provider %s", payment.ErrInvalidRequest, p.Provider)
+	}
+	res, err := provider.Refund(c.Request.Context(), p, payment.RefundRequest{Ref: r.ID, Amount: r.Amount, Reason: r.Reason})
+	if err != nil {
+		return dummy.RefundOutcome{}, err
+	}
+	return dummy.RefundOutcome{Status: res.Status, TransactionID: res.TransactionID, Manual: res.Manual, Message: res.Message}, nil
+}
+
+// ListRefunds - GET /api/payments/:id/refunds
+func (h *PaymentHandler) ListRefunds(c *gin.Context) {
+	if dummy.GetPayment(c.Param("id")) == nil {
+		response.NotFound(c, "Payment not found")
+		return
+	}
+	response.Success(c, http.StatusOK, dummy.PaymentRefunds(c.Param("id")))
+}
+
+// ListProviders - GET /api/admin/payment-providers
+func (h *PaymentHandler) ListProviders(c *gin.Context) {
+	result := []paymentProvider{}
+	for _, name := range h.providers.Names() {
+		provider, _ := h.providers.Get(name)
+		result = append(result, paymentProvider{Name: name, Methods: provider.Methods()})
+	}
+	response.Success(c, http.StatusOK, result)
+}
+
+// ListRoutes - GET /api/admin/payment-routes?store_id=
+func (h *PaymentHandler) ListRoutes(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListPaymentRoutes(adminStoreID(c, c.Query("store_id"))))
+}
+
+// UpdateRoute - PUT /api/admin/payment-routes/:method
+func (h *PaymentHandler) UpdateRoute(c *gin.Context) {
+	method := c.Param("method")
+	if !slices.Contains(dummy.ProviderPaymentMethods, method) {
+		response.BadRequest(c, "Invalid method. Use: qris, card, ewallet")
+		return
+	}
+
+	var req PaymentRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	provider, ok := h.providers.Get(req.Provider)
+	if !ok {
+		response.BadRequest(c, "Unknown payment provider: "+req.Provider)
+		return
+	}
+	if !payment.Supports(provider, method) {
+		response.BadRequest(c, provider.Name()+" does not take "+method+" payments")
+		return
+	}
+
+	response.Success(c, http.StatusOK, dummy.SavePaymentRoute(dummy.PaymentRoute{
+		StoreID:   adminStoreID(c, req.StoreID),
+		Method:    method,
+		Provider:  provider.Name(),
+		UpdatedBy: middleware.GetUserID(c),
+	}))
+}
+
+// paymentError answers for a provider that refused or failed a request
+func paymentError(c *gin.Context, err error) {
+	var apiErr *payment.APIError
+	switch {
+	case errors.Is(err, payment.ErrNotConfigured):
+		response.Error(c, http.StatusServiceUnavailable, response.ErrCodePaymentFailed, err.Error())
+	case errors.Is(err, payment.ErrInvalidSignature):
+		response.Forbidden(c, "Invalid signature")
+	case errors.Is(err, payment.ErrInvalidRequest), errors.Is(err, payment.ErrNoCallbacks):
+		response.BadRequest(c, err.Error())
+	case errors.As(err, &apiErr) && apiErr.StatusCode < 500:
+		response.Error(c, http.StatusUnprocessableEntity, response.ErrCodePaymentFailed, apiErr.Error())
+	default:
+		response.Error(c, http.StatusBadGateway, response.ErrCodePaymentFailed, "Payment provider is unavailable: "+err.Error())
+	}
+}
@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/eventbus"
+	"github.com/kaori/backend/internal/payment"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+const testServerKey = "SB-Mid-server-test"
+
+// newPaymentServer serves the payment endpoints for a signed-in user of role
+func newPaymentServer(t *testing.T, providers *payment.Registry, role string) (*httptest.Server, *websocket.Hub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	hub := websocket.NewHub(eventbus.NewLocal(), websocket.HubOptions{})
+	go hub.Run()
+
+	payments := NewPaymentHandler(nil, hub, providers)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", "user-"+role)
+		c.Set("role", role)
+		c.Set("store_id", dummy.DefaultStoreID)
+	})
+	r.POST("/api/payments/cash", payments.ProcessCash)
+	r.POST("/api/payments/midtrans", payments.CreateMidtrans)
+	r.POST("/api/payments/midtrans/callback", payments.MidtransCallback)
+	r.POST("/api/payments/:id/refunds", payments.Refund)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, hub
+}
+
+// post sends body to url and decodes the JSON answer
+func post(t *testing.T, url string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		t.Fatalf("POST %s: %d %s", url, resp.StatusCode, raw)
+	}
+	return resp.StatusCode, out
+}
+
+func TestPayDeliveryOrder(t *testing.T) {
+	midtrans := payment.NewMidtransProvider(payment.NewMidtrans("", false, ""))
+	srv, _ := newPaymentServer(t, payment.NewRegistry(midtrans), "cashier")
+
+	// The platform collected for it: paid, without a payment of ours
+	order := (&DeliveryHandler{}).createDeliveryOrder("GF-PAID-1", "grabfood", "Budi", "", "", "", []ItemInput{{Name: "Kopi Susu", Quantity: 2, Price: 18000}}, 36000)
+	order.StoreID = dummy.DefaultStoreID
+	dummy.AddOrder(order)
+
+	if balance, _ := dummy.OrderBalance(order.ID); balance.Remaining != 0 {
+		t.Errorf("remaining = %d on a delivery order, want 0", balance.Remaining)
+	}
+	if code, out := post(t, srv.URL+"/api/payments/cash", map[string]interface{}{"order_id": order.ID, "amount_paid": 50000}); code != http.StatusConflict {
+		t.Errorf("cash for a delivery order: %d %v, want 409", code, out)
+	}
+	if code, out := post(t, srv.URL+"/api/payments/midtrans", map[string]interface{}{"order_id": order.ID, "method": "qris"}); code != http.StatusConflict {
+		t.Errorf("QRIS for a delivery order: %d %v, want 409", code, out)
+	}
+	if _, err := dummy.AddPayment(dummy.Payment{OrderID: order.ID, Method: "cash", Amount: 1000, Provider: payment.ProviderCash}); !errors.Is(err, dummy.ErrOrderPaid) {
+		t.Errorf("adding a payment: %v, want %v", err, dummy.ErrOrderPaid)
+	}
+	if payments := dummy.OrderPayments(order.ID); len(payments) != 0 {
+		t.Errorf("delivery order has %d payments, want none", len(payments))
+	}
+}
+
+// paidCashOrder is an order paid in full in cash
+func paidCashOrder(t *testing.T, amount int) dummy.Payment {
+	t.Helper()
+	order := dummy.Order{ID: "order-" + t.Name(), StoreID: dummy.DefaultStoreID, OrderNumber: t.Name(), Status: "completed", PaymentStatus: "unpaid", Subtotal: amount, Total: amount}
+	dummy.AddOrder(order)
+	p, err := dummy.AddPayment(dummy.Payment{OrderID: order.ID, StoreID: order.StoreID, Method: "cash", Amount: amount, Provider: payment.ProviderCash})
+	if err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	if p, _, _, err = dummy.ApplyPaymentUpdate(p.ID, dummy.PaymentUpdate{Status: dummy.PaymentSuccess}); err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+	return p
+}
+
+func TestRefundFromAnotherStoresDrawer(t *testing.T) {
+	srv, _ := newPaymentServer(t, payment.NewRegistry(), "super_admin")
+	p := paidCashOrder(t, 25000)
+
+	shift, err := dummy.OpenShift(dummy.Shift{StoreID: "store-other", CashierID: "cashier-other", OpeningFloat: 100000})
+	if err != nil {
+		t.Fatalf("open shift: %v", err)
+	}
+	code, out := post(t, srv.URL+"/api/payments/"+p.ID+"/refunds", map[string]string{"reason": "cold coffee", "shift_id": shift.ID})
+	if code != http.StatusConflict {
+		t.Errorf("refund out of another store's drawer: %d %v, want 409", code, out)
+	}
+	if refunds := dummy.PaymentRefunds(p.ID); len(refunds) != 0 {
+		t.Errorf("refund was recorded: %+v", refunds)
+	}
+	if got := dummy.GetShift(shift.ID); len(got.Entries) != 0 {
+		t.Errorf("other store's drawer has %d entries, want none", len(got.Entries))
+	}
+}
+
+// pendingQRIS adds a pending Midtrans QRIS payment for amount on an order
+func pendingQRIS(t *testing.T, order dummy.Order, amount int) dummy.Payment {
+	t.Helper()
+	id := uuid.New().String()
+	p, err := dummy.AddPayment(dummy.Payment{ID: id, OrderID: order.ID, StoreID: order.StoreID, Method: "qris", Amount: amount, Provider: payment.ProviderMidtrans, ProviderRef: id})
+	if err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	return p
+}
+
+// notify sends Kaori a Midtrans notification for p, signed with serverKey
+func notify(t *testing.T, srv *httptest.Server, p dummy.Payment, status string, amount int, serverKey string) (int, map[string]interface{}) {
+	t.Helper()
+	n := payment.Transaction{StatusCode: "200", TransactionID: "txn-" + p.ID, OrderID: p.ProviderRef, GrossAmount: payment.FormatAmount(amount), PaymentType: "qris", TransactionStatus: status}
+	n.SignatureKey = payment.MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount, serverKey)
+	return post(t, srv.URL+"/api/payments/midtrans/callback", n)
+}
+
+func TestCallbackOverpaid(t *testing.T) {
+	midtrans := payment.NewMidtransProvider(payment.NewMidtrans(testServerKey, false, ""))
+	srv, _ := newPaymentServer(t, payment.NewRegistry(midtrans), "cashier")
+
+	order := dummy.Order{ID: uuid.New().String(), StoreID: dummy.DefaultStoreID, OrderNumber: t.Name(), Status: "pending", PaymentStatus: "unpaid", Subtotal: 30000, Total: 30000}
+	dummy.AddOrder(order)
+	// Both charges are for the whole bill while neither is paid
+	first, second := pendingQRIS(t, order, 30000), pendingQRIS(t, order, 30000)
+
+	if code, out := notify(t, srv, first, "settlement", 30000, testServerKey); code != http.StatusOK {
+		t.Fatalf("first payment: %d %v", code, out)
+	}
+	if code, out := notify(t, srv, second, "settlement", 30000, testServerKey); code != http.StatusConflict {
+		t.Errorf("second payment for a paid order: %d %v, want 409", code, out)
+	}
+	if got := dummy.GetPayment(second.ID); got.Status != dummy.PaymentPending {
+		t.Errorf("second payment is %s, want it left pending", got.Status)
+	}
+	if balance, _ := dummy.OrderBalance(order.ID); balance.Paid != 30000 {
+		t.Errorf("order paid = %d, want 30000", balance.Paid)
+	}
+
+	found := false
+	for _, d := range dummy.ListPaymentDiscrepancies(order.StoreID, "", nil) {
+		found = found || (d.PaymentID == second.ID && d.Kind == dummy.DiscrepancyOverpaid)
+	}
+	if !found {
+		t.Error("overpayment was not reported as a discrepancy")
+	}
+}
+
+// lostAnswerProvider makes the first refund and loses Midtrans' answer to it,
+// as a gateway timeout would
+type lostAnswerProvider struct {
+	payment.SandboxProvider
+	mu   sync.Mutex
+	made map[string]int // refunds made, by refund key
+}
+
+func (p *lostAnswerProvider) Refund(ctx context.Context, paid dummy.Payment, req payment.RefundRequest) (*payment.Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.made[req.Ref]++
+	if len(p.made) == 1 && p.made[req.Ref] == 1 {
+		return nil, &payment.APIError{StatusCode: http.StatusBadGateway, Messages: []string{"bad gateway"}}
+	}
+	return &payment.Refund{Status: dummy.PaymentSuccess, TransactionID: "refund-" + req.Ref}, nil
+}
+
+// TestRefundLostAnswerRetried loses the provider's answer to a refund it made:
+// the refund stays pending, holding its amount, and reconciliation sends the
+// same refund key again rather than a second refund
+func TestRefundLostAnswerRetried(t *testing.T) {
+	provider := &lostAnswerProvider{made: map[string]int{}}
+	providers := payment.NewRegistry(provider)
+	srv, hub := newPaymentServer(t, providers, "super_admin")
+
+	order := dummy.Order{ID: uuid.New().String(), StoreID: dummy.DefaultStoreID, OrderNumber: t.Name(), Status: "completed", PaymentStatus: "unpaid", Subtotal: 40000, Total: 40000}
+	dummy.AddOrder(order)
+	p, err := dummy.AddPayment(dummy.Payment{OrderID: order.ID, StoreID: order.StoreID, Method: "qris", Amount: 40000, Provider: payment.ProviderSandbox})
+	if err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	if p, _, _, err = dummy.ApplyPaymentUpdate(p.ID, dummy.PaymentUpdate{Status: dummy.PaymentSuccess}); err != nil {
+		t.Fatalf("pay: %v", err)
+	}
+
+	code, out := post(t, srv.URL+"/api/payments/"+p.ID+"/refunds", map[string]string{"reason": "wrong order"})
+	data, _ := out["data"].(map[string]interface{})
+	if code != http.StatusAccepted || data["status"] != dummy.PaymentPending {
+		t.Fatalf("refund with a lost answer: %d %v, want 202 and pending", code, out)
+	}
+	if code, out = post(t, srv.URL+"/api/payments/"+p.ID+"/refunds", map[string]string{"reason": "wrong order"}); code != http.StatusBadRequest {
+		t.Errorf("second refund while the first is pending: %d %v, want 400", code, out)
+	}
+
+	res := payment.NewReconciler(hub, providers, 0, time.Hour).Reconcile(context.Background(), time.Now().Add(time.Second))
+	if res.Refunds != 1 || res.Errors != 0 {
+		t.Errorf("reconciliation: %+v, want 1 refund retried", res)
+	}
+	refunds := dummy.PaymentRefunds(p.ID)
+	if len(refunds) != 1 || refunds[0].Status != dummy.PaymentSuccess {
+		t.Fatalf("refunds = %+v, want one successful", refunds)
+	}
+	if got := dummy.GetPayment(p.ID); got.Status != dummy.PaymentRefunded || got.Refunded != p.Amount {
+		t.Errorf("payment is %s with %d refunded, want refunded in full", got.Status, got.Refunded)
+	}
+	if len(provider.made) != 1 {
+		t.Errorf("refund keys sent: %v, want the same one both times", provider.made)
+	}
+}
+
+func TestCallbackIdempotent(t *testing.T) {
+	midtrans := payment.NewMidtransProvider(payment.NewMidtrans(testServerKey, false, ""))
+	srv, _ := newPaymentServer(t, payment.NewRegistry(midtrans), "cashier")
+
+	order := dummy.Order{ID: uuid.New().String(), StoreID: dummy.DefaultStoreID, OrderNumber: t.Name(), Status: "pending", PaymentStatus: "unpaid", Subtotal: 40000, Total: 40000}
+	dummy.AddOrder(order)
+	p := pendingQRIS(t, order, 40000)
+
+	code, out := notify(t, srv, p, "settlement", p.Amount, testServerKey)
+	if code != http.StatusOK || changed(out) != true {
+		t.Fatalf("first notification: %d %v, want 200 and changed", code, out)
+	}
+	if got := dummy.GetPayment(p.ID); got.Status != dummy.PaymentSuccess {
+		t.Fatalf("payment is %s after settlement", got.Status)
+	}
+
+	code, out = notify(t, srv, p, "settlement", p.Amount, testServerKey)
+	if code != http.StatusOK || changed(out) != false {
+		t.Errorf("same notification again: %d %v, want 200 and unchanged", code, out)
+	}
+
+	// Correctly signed, but for another amount
+	if code, out = notify(t, srv, p, "settlement", p.Amount+1000, testServerKey); code != http.StatusBadRequest {
+		t.Errorf("notification for a different amount: %d %v, want 400", code, out)
+	}
+	if got := dummy.GetPayment(p.ID); got.Amount != p.Amount || got.Status != dummy.PaymentSuccess {
+		t.Errorf("payment changed to %d %s by a wrong amount", got.Amount, got.Status)
+	}
+
+	// And with a signature that doesn't match
+	if code, out = notify(t, srv, p, "settlement", p.Amount, "SB-Mid-server-other"); code != http.StatusForbidden {
+		t.Errorf("notification with a bad signature: %d %v, want 403", code, out)
+	}
+}
+
+func changed(out map[string]interface{}) interface{} {
+	data, _ := out["data"].(map[string]interface{})
+	return data["changed"]
+}
+
+func TestCallbackArchivedForOrdersStore(t *testing.T) {
+	midtrans := payment.NewMidtransProvider(payment.NewMidtrans(testServerKey, false, ""))
+	hub := websocket.NewHub(eventbus.NewLocal(), websocket.HubOptions{})
+	go hub.Run()
+	archive := NewWebhookArchiveHandler(time.Hour)
+	r := gin.New()
+	r.POST("/api/payments/midtrans/callback", archive.Archive("midtrans", dummy.WebhookKindPayment, NewPaymentHandler(nil, hub, payment.NewRegistry(midtrans)).MidtransCallback))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	order := dummy.Order{ID: uuid.New().String(), StoreID: "store-archive", OrderNumber: t.Name(), Status: "pending", PaymentStatus: "unpaid", Subtotal: 15000, Total: 15000}
+	dummy.AddOrder(order)
+	p := pendingQRIS(t, order, 15000)
+	if code, out := notify(t, srv, p, "settlement", 15000, testServerKey); code != http.StatusOK {
+		t.Fatalf("notification: %d %v", code, out)
+	}
+
+	events := dummy.ListWebhookEvents(dummy.WebhookEventFilter{OrderID: order.ID})
+	if len(events) != 1 || events[0].StoreID != "store-archive" {
+		t.Errorf("archived events = %+v, want one for store-archive", events)
+	}
+}
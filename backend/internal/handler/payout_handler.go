@@ -0,0 +1,251 @@
+package handler
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// maxSettlementSize caps uploaded settlement files
+const maxSettlementSize = 10 << 20
+
+// PayoutHandler manages delivery commissions and platform settlement reconciliation
+type PayoutHandler struct{}
+
+// NewPayoutHandler creates a new payout handler
+func NewPayoutHandler() *PayoutHandler {
+	return &PayoutHandler{}
+}
+
+// CommissionSettingRequest starts new commission terms for a platform
+type CommissionSettingRequest struct {
+	Platform      string  `json:"platform" binding:"required"`
+	RatePercent   float64 `json:"rate_percent" binding:"min=0,max=100"`
+	FixedFee      int     `json:"fixed_fee" binding:"min=0"`
+	EffectiveFrom string  `json:"effective_from" binding:"required"` // YYYY-MM-DD
+}
+
+// PlatformPayout totals delivery orders for one platform
+type PlatformPayout struct {
+	Platform      string `json:"platform"`
+	Orders        int    `json:"orders"`
+	Gross         int    `json:"gross"`
+	MerchantPromo int    `json:"merchant_promo"`
+	Commission    int    `json:"commission"`
+	Net           int    `json:"net"`
+}
+
+// ListCommissions - GET /api/admin/delivery/commissions
+func (h *PayoutHandler) ListCommissions(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListCommissionSettings(c.Query("platform")))
+}
+
+// CreateCommission - POST /api/admin/delivery/commissions
+func (h *PayoutHandler) CreateCommission(c *gin.Context) {
+	var req CommissionSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if !dummy.IsDeliverySource(req.Platform) {
+		response.BadRequest(c, "Invalid platform. Use: grabfood, gofood, shopee_food")
+		return
+	}
+	from, err := time.ParseInLocation("2006-01-02", req.EffectiveFrom, time.Local)
+	if err != nil {
+		response.BadRequest(c, "effective_from must be YYYY-MM-DD")
+		return
+	}
+
+	setting := dummy.AddCommissionSetting(dummy.CommissionSetting{
+		Platform:      req.Platform,
+		RatePercent:   req.RatePercent,
+		FixedFee:      req.FixedFee,
+		EffectiveFrom: from,
+	})
+	response.Success(c, http.StatusCreated, setting)
+}
+
+// DeleteCommission - DELETE /api/admin/delivery/commissions/:id
+func (h *PayoutHandler) DeleteCommission(c *gin.Context) {
+	if !dummy.DeleteCommissionSetting(c.Param("id")) {
+		response.NotFound(c, "Commission setting not found")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Commission setting deleted"})
+}
+
+// ImportSettlement - POST /api/admin/delivery/settlements/import?platform=&period_from=&period_to=
+// Accepts the platform's CSV export as a multipart "file" field or as the raw request body.
+func (h *PayoutHandler) ImportSettlement(c *gin.Context) {
+	platform := c.Query("platform")
+	if !dummy.IsDeliverySource(platform) {
+		response.BadRequest(c, "Invalid platform. Use: grabfood, gofood, shopee_food")
+		return
+	}
+	from, to, ok := reportPeriod(c, "period_from", "period_to")
+	if !ok {
+		return
+	}
+
+	fileName := "upload.csv"
+	var body io.Reader
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxSettlementSize {
+			response.BadRequest(c, "Settlement file is too large")
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			response.BadRequest(c, "Could not read settlement file")
+			return
+		}
+		defer f.Close()
+		fileName = file.Filename
+		body = f
+	} else {
+		data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSettlementSize))
+		if err != nil || len(data) == 0 {
+			response.BadRequest(c, "Upload the settlement CSV as the request body or a \"file\" form field")
+			return
+		}
+		body = bytes.NewReader(data)
+	}
+
+	rows, err := delivery.ParseSettlementCSV(body)
+	if err != nil {
+		response.BadRequest(c, "Invalid settlement file: "+err.Error())
+		return
+	}
+
+	reconciled, summary := delivery.Reconcile(platform, rows, from, to)
+	imp := dummy.AddSettlementImport(dummy.SettlementImport{
+		Platform:   platform,
+		FileName:   fileName,
+		PeriodFrom: from,
+		PeriodTo:   to,
+		Summary:    summary,
+		Rows:       reconciled,
+		ImportedBy: middleware.GetUserID(c),
+	})
+	response.Success(c, http.StatusCreated, imp)
+}
+
+// ListSettlements - GET /api/admin/delivery/settlements
+func (h *PayoutHandler) ListSettlements(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListSettlementImports(c.Query("platform")))
+}
+
+// GetSettlement - GET /api/admin/delivery/settlements/:id?status=
+func (h *PayoutHandler) GetSettlement(c *gin.Context) {
+	imp := dummy.GetSettlementImport(c.Param("id"))
+	if imp == nil {
+		response.NotFound(c, "Settlement import not found")
+		return
+	}
+	if status := c.Query("status"); status != "" {
+		rows := []dummy.SettlementRow{}
+		for _, row := range imp.Rows {
+			if row.Status == status {
+				rows = append(rows, row)
+			}
+		}
+		imp.Rows = rows
+	}
+	response.Success(c, http.StatusOK, imp)
+}
+
+// GetDeliveryPayouts - GET /api/reports/delivery-payouts?date_from=&date_to=
+// Gross, commission, merchant-funded promo and net per platform
+func (h *PayoutHandler) GetDeliveryPayouts(c *gin.Context) {
+	from, to, ok := reportPeriod(c, "date_from", "date_to")
+	if !ok {
+		return
+	}
+
+	platforms := []string{dummy.SourceGrabFood, dummy.SourceGoFood, dummy.SourceShopeeFood}
+	rows := make([]PlatformPayout, len(platforms))
+	var total PlatformPayout
+	total.Platform = "total"
+
+	for i, platform := range platforms {
+		rows[i].Platform = platform
+		for _, o := range dummy.GetOrdersBySource(platform) {
+			if o.Status == "cancelled" || o.CreatedAt.Before(from) || !o.CreatedAt.Before(to) {
+				continue
+			}
+			payout := orderPayout(o)
+			rows[i].Orders++
+			rows[i].Gross += payout.Gross
+			rows[i].MerchantPromo += payout.MerchantPromo
+			rows[i].Commission += payout.Commission
+			rows[i].Net += payout.Net
+		}
+		total.Orders += rows[i].Orders
+		total.Gross += rows[i].Gross
+		total.MerchantPromo += rows[i].MerchantPromo
+		total.Commission += rows[i].Commission
+		total.Net += rows[i].Net
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"date_from": from.Format("2006-01-02"),
+		"date_to":   to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"platforms": rows,
+		"total":     total,
+	})
+}
+
+// orderPayout returns the stored payout, or works one out for orders received
+// before commissions were tracked
+func orderPayout(o dummy.Order) *dummy.DeliveryPayout {
+	if o.Payout != nil {
+		return o.Payout
+	}
+	return delivery.CalculatePayout(o.OrderSource, o.Total, delivery.Promo{}, o.CreatedAt)
+}
+
+// orderNet is what an order brings in after delivery commission and merchant promos
+func orderNet(o dummy.Order) int {
+	if dummy.IsDeliverySource(o.OrderSource) {
+		return orderPayout(o).Net
+	}
+	return o.Total
+}
+
+// reportPeriod reads an inclusive YYYY-MM-DD date range from the query, defaulting
+// to the last 30 days, and returns it as [from, to) in local time
+func reportPeriod(c *gin.Context, fromKey, toKey string) (time.Time, time.Time, bool) {
+	today := time.Now()
+	today = time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today.AddDate(0, 0, -29), today
+
+	if v := c.Query(fromKey); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			response.BadRequest(c, fromKey+" must be YYYY-MM-DD")
+			return from, to, false
+		}
+		from = t
+	}
+	if v := c.Query(toKey); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			response.BadRequest(c, toKey+" must be YYYY-MM-DD")
+			return from, to, false
+		}
+		to = t
+	}
+	if to.Before(from) {
+		response.BadRequest(c, toKey+" must not be before "+fromKey)
+		return from, to, false
+	}
+	return from, to.AddDate(0, 0, 1), true
+}
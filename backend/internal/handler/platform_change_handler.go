@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/delivery"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/websocket"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// HandleCancellation - POST /api/webhooks/{grabfood,gofood,shopee}/cancel
+// Cancels an order the customer, driver or platform cancelled on the platform's
+// side, records who pays for food already made and stops the kitchen.
+func (h *DeliveryHandler) HandleCancellation(platform string) gin.HandlerFunc {
+	adapter := delivery.InboundAdapter(platform)
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			response.BadRequest(c, "Could not read payload")
+			return
+		}
+		cancel, err := adapter.ParseCancellation(body)
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		existing := dummy.FindOrderByExternalID(platform, cancel.ExternalOrderID)
+		if existing == nil {
+			response.NotFound(c, "Order not found")
+			return
+		}
+		if cancel.OccurredAt.IsZero() {
+			cancel.OccurredAt = time.Now()
+		}
+
+		// The status is checked under the lock so a concurrent change can't slip through
+		var order dummy.Order
+		var previous string
+		dummy.UpdateOrder(existing.ID, func(o *dummy.Order) {
+			previous = o.Status
+			if o.Status == "cancelled" {
+				order = *o
+				return
+			}
+			foodMade, bearer := delivery.CostBearer(o, cancel.CancelledBy)
+			record := &dummy.OrderCancellation{
+				CancelledBy:    cancel.CancelledBy,
+				Reason:         cancel.Reason,
+				StatusAtCancel: o.Status,
+				FoodMade:       foodMade,
+				CostBearer:     bearer,
+				Compensation:   cancel.Compensation,
+				CancelledAt:    cancel.OccurredAt,
+			}
+			if foodMade {
+				record.FoodValue = o.Subtotal
+			}
+			o.Cancellation = record
+			o.Status = "cancelled"
+			o.StatusReason = "Cancelled on " + platform + " by " + cancel.CancelledBy
+			if cancel.Reason != "" {
+				o.StatusReason += ": " + cancel.Reason
+			}
+			order = *o
+		})
+		if previous == "cancelled" {
+			respondDuplicate(c, &order)
+			return
+		}
+
+		// The platform already knows, so nothing is pushed back through the outbox
+		h.hub.Publish(websocket.ToKitchen(order.StoreID, dummy.OrderStations(&order)...), events.OrderCancelled{
+			OrderID:      order.ID,
+			OrderNumber:  order.OrderNumber,
+			Urgent:       true,
+			Reason:       order.StatusReason,
+			Cancellation: order.Cancellation,
+		})
+		publishStatus(h.hub, order.ID, previous)
+
+		respondReceived(c, http.StatusOK, order)
+	}
+}
+
+// HandleModification - POST /api/webhooks/{grabfood,gofood,shopee}/modify
+// Replaces an order's items after the customer changed the order on the platform
+func (h *DeliveryHandler) HandleModification(platform string) gin.HandlerFunc {
+	adapter := delivery.InboundAdapter(platform)
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+		if err != nil {
+			response.BadRequest(c, "Could not read payload")
+			return
+		}
+		mod, err := adapter.ParseModification(body)
+		if err != nil {
+			response.BadRequest(c, err.Error())
+			return
+		}
+		if len(mod.Items) == 0 {
+			response.BadRequest(c, "A modified order needs at least one item; cancel it instead")
+			return
+		}
+		existing := dummy.FindOrderByExternalID(platform, mod.ExternalOrderID)
+		if existing == nil {
+			response.NotFound(c, "Order not found")
+			return
+		}
+		inputs := make([]ItemInput, len(mod.Items))
+		for i, item := range mod.Items {
+			inputs[i] = ItemInput{ExternalID: item.ExternalID, Name: item.Name, Variant: item.Variant, Modifiers: item.Modifiers, Quantity: item.Quantity, Price: item.Price, Notes: item.Notes}
+		}
+		items, subtotal := buildDeliveryItems(existing.ID, platform, inputs)
+		total := mod.Total
+		if total == 0 {
+			total = subtotal
+		}
+		if mod.OccurredAt.IsZero() {
+			mod.OccurredAt = time.Now()
+		}
+
+		var order, before dummy.Order
+		var record dummy.OrderModification
+		dummy.UpdateOrder(existing.ID, func(o *dummy.Order) {
+			before = *o // its items are replaced below, not changed in place
+			if o.Status == "cancelled" || o.Status == "completed" {
+				return
+			}
+			record = dummy.OrderModification{
+				Reason:        mod.Reason,
+				Changes:       itemChanges(o.Items, items),
+				PreviousTotal: o.Total,
+				Total:         total,
+				ModifiedAt:    mod.OccurredAt,
+			}
+			promo := delivery.Promo{}
+			if o.Payout != nil {
+				promo = delivery.Promo{Merchant: o.Payout.MerchantPromo, Platform: o.Payout.PlatformPromo}
+			}
+			o.Items = items
+			o.Subtotal = subtotal
+			o.Total = total
+			o.Tax = total * 11 / 100
+			o.Payout = delivery.CalculatePayout(platform, total, promo, o.CreatedAt)
+			o.Modifications = append(o.Modifications, record)
+			order = *o
+		})
+		if before.Status == "cancelled" || before.Status == "completed" {
+			response.Conflict(c, "Order is already "+before.Status)
+			return
+		}
+
+		// Stations that lost every item still need to hear about it
+		stations := append(dummy.OrderStations(&before), dummy.OrderStations(&order)...)
+		h.hub.Publish(websocket.ToKitchen(order.StoreID, stations...), events.OrderModified{
+			OrderID:      order.ID,
+			OrderNumber:  order.OrderNumber,
+			Urgent:       order.Status != "pending",
+			Modification: record,
+			Items:        order.Items,
+		})
+		h.hub.Publish(websocket.ToStore(order.StoreID), events.OrderUpdated{Order: order})
+
+		respondReceived(c, http.StatusOK, order)
+	}
+}
+
+// itemChanges lists the lines whose quantity differs between two versions of an order
+func itemChanges(before, after []dummy.OrderItem) []dummy.ItemChange {
+	key := func(item dummy.OrderItem) string {
+		return item.ProductID + "|" + item.VariantID + "|" + item.ProductName + "|" + item.Notes
+	}
+
+	var changes []dummy.ItemChange
+	index := make(map[string]int)
+	for _, item := range before {
+		k := key(item)
+		if i, ok := index[k]; ok {
+			changes[i].Before += item.Quantity
+			continue
+		}
+		index[k] = len(changes)
+		changes = append(changes, dummy.ItemChange{Name: item.ProductName, Before: item.Quantity})
+	}
+	for _, item := range after {
+		k := key(item)
+		if i, ok := index[k]; ok {
+			changes[i].After += item.Quantity
+			continue
+		}
+		index[k] = len(changes)
+		changes = append(changes, dummy.ItemChange{Name: item.ProductName, After: item.Quantity})
+	}
+
+	result := []dummy.ItemChange{}
+	for _, ch := range changes {
+		if ch.Before != ch.After {
+			result = append(result, ch)
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/websocket"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// RealtimeHandler handles live update connections
+type RealtimeHandler struct {
+	hub  *websocket.Hub
+	auth *websocket.Authenticator
+}
+
+// NewRealtimeHandler creates a new realtime handler
+func NewRealtimeHandler(hub *websocket.Hub, auth *websocket.Authenticator) *RealtimeHandler {
+	return &RealtimeHandler{hub: hub, auth: auth}
+}
+
+// IssueTicket - POST /api/ws/ticket
+// Exchanges the caller's access token for a single-use ticket to open /api/ws?ticket=
+func (h *RealtimeHandler) IssueTicket(c *gin.Context) {
+	ticket, expiresAt, err := h.auth.IssueTicket(websocket.Identity{
+		UserID:    middleware.GetUserID(c),
+		Role:      middleware.GetUserRole(c),
+		StoreID:   middleware.GetStoreID(c),
+		ExpiresAt: middleware.GetTokenExpiry(c),
+	})
+	if err != nil {
+		response.InternalError(c, "Could not issue ticket")
+		return
+	}
+	response.Success(c, http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
+
+// orderTrackingTTL is how long a customer's tracking page stays connected
+const orderTrackingTTL = 4 * time.Hour
+
+// IssueOrderTicket - POST /api/public/orders/:id/ws-ticket
+// Gives a customer's order tracking page a ticket for a socket that only ever
+// receives updates about that one order
+func (h *RealtimeHandler) IssueOrderTicket(c *gin.Context) {
+	order := dummy.GetOrderByID(c.Param("id"))
+	if order == nil {
+		response.NotFound(c, "Order not found")
+		return
+	}
+	ticket, expiresAt, err := h.auth.IssueTicket(websocket.Identity{
+		Role:      "customer",
+		StoreID:   order.StoreID,
+		OrderID:   order.ID,
+		ExpiresAt: time.Now().Add(orderTrackingTTL),
+	})
+	if err != nil {
+		response.InternalError(c, "Could not issue ticket")
+		return
+	}
+	response.Success(c, http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+		"topics":     []string{websocket.OrderTopic(order.ID)},
+	})
+}
+
+// OnlineDevices - GET /api/stores/:id/devices/online
+// Lists the store's connected screens and tablets, and whether the kitchen can
+// see new orders right now
+func (h *RealtimeHandler) OnlineDevices(c *gin.Context) {
+	storeID := c.Param("id")
+	if claim := middleware.GetStoreID(c); middleware.GetUserRole(c) != "super_admin" && claim != "" && claim != storeID {
+		response.Forbidden(c, "You can only see your own store's devices")
+		return
+	}
+
+	devices := h.hub.Online(storeID)
+	kitchen := 0
+	for _, d := range devices {
+		if d.KitchenDisplay {
+			kitchen++
+		}
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"store_id":         storeID,
+		"opening_hours":    dummy.GetOpeningHours(storeID),
+		"kitchen_displays": kitchen,
+		"devices":          devices,
+	})
+}
+
+// Stats - GET /api/admin/realtime/stats
+// Connected clients on this instance, their queues and dropped messages
+func (h *RealtimeHandler) Stats(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.hub.Stats())
+}
+
+// Schema - GET /api/realtime/schema
+// The event catalog as a JSON Schema document, served as is so code generators
+// can read it
+func (h *RealtimeHandler) Schema(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, events.Schema())
+}
+
+// ServeWS - GET /api/ws?ticket=
+// Without a ticket, the first message must be {"type":"auth","token":"<access token>"}
+func (h *RealtimeHandler) ServeWS(c *gin.Context) {
+	websocket.ServeWS(h.hub, h.auth, c.Writer, c.Request)
+}
+
+// ServeSSE - GET /api/events?topics=&ticket=
+// The same events as /api/ws as Server-Sent Events, for browsers and proxies
+// that can't use WebSockets. Authenticated with a ticket or a Bearer token.
+func (h *RealtimeHandler) ServeSSE(c *gin.Context) {
+	websocket.ServeSSE(h.hub, h.auth, c.Writer, c.Request)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/payment"
+	"github.com/kaori/backend/pkg/response"
+)
+
+// ReconciliationHandler exposes payment reconciliation and the discrepancies
+// it found for admins to review
+type ReconciliationHandler struct {
+	reconciler *payment.Reconciler
+}
+
+// NewReconciliationHandler creates a new reconciliation handler
+func NewReconciliationHandler(reconciler *payment.Reconciler) *ReconciliationHandler {
+	return &ReconciliationHandler{reconciler: reconciler}
+}
+
+// ReviewDiscrepancyRequest closes a discrepancy with what was done about it
+type ReviewDiscrepancyRequest struct {
+	Resolution string `json:"resolution" binding:"required"` // e.g. "refunded", "confirmed with Midtrans"
+}
+
+// GetStatus - GET /api/admin/payments/reconcile
+// The latest reconciliation pass
+func (h *ReconciliationHandler) GetStatus(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.reconciler.Last())
+}
+
+// Reconcile - POST /api/admin/payments/reconcile
+// Runs a pass now instead of waiting for the next one
+func (h *ReconciliationHandler) Reconcile(c *gin.Context) {
+	response.Success(c, http.StatusOK, h.reconciler.Reconcile(c.Request.Context(), time.Now()))
+}
+
+// ListDiscrepancies - GET /api/admin/payment-discrepancies?date=2006-01-02&status=open|reviewed&store_id=
+// The daily review list: what reconciliation and callbacks found on a day,
+// or everything still open without a date
+func (h *ReconciliationHandler) ListDiscrepancies(c *gin.Context) {
+	date := c.Query("date")
+	if date != "" {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			response.BadRequest(c, "Invalid date. Use YYYY-MM-DD")
+			return
+		}
+	}
+	var reviewed *bool
+	switch c.Query("status") {
+	case "":
+		if date == "" {
+			open := false
+			reviewed = &open
+		}
+	case "open", "reviewed":
+		r := c.Query("status") == "reviewed"
+		reviewed = &r
+	default:
+		response.BadRequest(c, "Invalid status. Use: open, reviewed")
+		return
+	}
+	response.Success(c, http.StatusOK, dummy.ListPaymentDiscrepancies(adminStoreID(c, c.Query("store_id")), date, reviewed))
+}
+
+// ReviewDiscrepancy - POST /api/admin/payment-discrepancies/:id/review
+func (h *ReconciliationHandler) ReviewDiscrepancy(c *gin.Context) {
+	var req ReviewDiscrepancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	d := dummy.GetPaymentDiscrepancy(c.Param("id"))
+	if d == nil {
+		response.NotFound(c, "Payment discrepancy not found")
+		return
+	}
+	if middleware.GetUserRole(c) != "super_admin" && d.StoreID != requestStoreID(c) {
+		response.Forbidden(c, "Payment discrepancy belongs to another store")
+		return
+	}
+	if d.ReviewedAt != nil {
+		response.Conflict(c, "Payment discrepancy was already reviewed")
+		return
+	}
+	reviewed, err := dummy.ReviewPaymentDiscrepancy(d.ID, middleware.GetUserID(c), req.Resolution)
+	if err != nil {
+		response.NotFound(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusOK, reviewed)
+}
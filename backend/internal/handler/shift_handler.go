@@ -0,0 +1,387 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/pkg/response"
+)
+
+var (
+	errShiftOtherStore = errors.New("shift belongs to another store")
+	errOtherShift      = errors.New("shift belongs to another cashier")
+)
+
+// ShiftHandler manages cashier shifts and their cash drawers
+type ShiftHandler struct{}
+
+// NewShiftHandler creates a new shift handler
+func NewShiftHandler() *ShiftHandler {
+	return &ShiftHandler{}
+}
+
+// OpenShiftRequest starts a shift with the cash already in the drawer
+type OpenShiftRequest struct {
+	OpeningFloat int    `json:"opening_float" binding:"min=0"`
+	DrawerID     string `json:"drawer_id"` // default "main"
+}
+
+// CashMovementRequest records cash put into or taken out of the drawer by hand
+type CashMovementRequest struct {
+	Type   string `json:"type" binding:"required,oneof=paid_in paid_out"`
+	Amount int    `json:"amount" binding:"required,min=1"`
+	Reason string `json:"reason" binding:"required"` // e.g. "change from the bank", "ice supplier"
+}
+
+// CloseShiftRequest ends a shift with a blind count of the drawer
+type CloseShiftRequest struct {
+	Count map[int]int `json:"count" binding:"required"` // notes and coins per denomination, e.g. {"100000":3,"500":4}
+	Notes string      `json:"notes"`
+}
+
+// ShiftReport is a shift's sales and cash drawer, for printing at close
+type ShiftReport struct {
+	Shift      dummy.Shift        `json:"shift"`
+	Sales      []MethodSales      `json:"sales"`
+	TotalSales int                `json:"total_sales"`
+	Drawer     dummy.DrawerTotals `json:"drawer"`
+}
+
+// MethodSales sums a shift's payments of one method
+type MethodSales struct {
+	Method string `json:"method"`
+	Count  int    `json:"count"`
+	Amount int    `json:"amount"`
+}
+
+// Open - POST /api/shifts
+// Opens a shift for the signed-in user on a drawer of their store
+func (h *ShiftHandler) Open(c *gin.Context) {
+	var req OpenShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	userID := middleware.GetUserID(c)
+	shift, err := dummy.OpenShift(dummy.Shift{
+		StoreID:      requestStoreID(c),
+		DrawerID:     req.DrawerID,
+		CashierID:    userID,
+		CashierName:  userName(userID),
+		OpeningFloat: req.OpeningFloat,
+	})
+	if err != nil {
+		response.Conflict(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusCreated, shift)
+}
+
+// Current - GET /api/shifts/current
+func (h *ShiftHandler) Current(c *gin.Context) {
+	shift := dummy.OpenShiftFor(middleware.GetUserID(c))
+	if shift == nil {
+		response.NotFound(c, "No open shift")
+		return
+	}
+	response.Success(c, http.StatusOK, shiftView(c, *shift))
+}
+
+// List - GET /api/shifts?cashier_id=&store_id=
+func (h *ShiftHandler) List(c *gin.Context) {
+	response.Success(c, http.StatusOK, dummy.ListShifts(adminStoreID(c, c.Query("store_id")), c.Query("cashier_id")))
+}
+
+// Get - GET /api/shifts/:id
+func (h *ShiftHandler) Get(c *gin.Context) {
+	shift, ok := shiftForRequest(c)
+	if !ok {
+		return
+	}
+	response.Success(c, http.StatusOK, shiftView(c, shift))
+}
+
+// AddCashMovement - POST /api/shifts/:id/cash-movements
+// Paid in and paid out: cash put in or taken out of the drawer for anything
+// but a sale, always with a reason
+func (h *ShiftHandler) AddCashMovement(c *gin.Context) {
+	var req CashMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	shift, ok := shiftForRequest(c)
+	if !ok {
+		return
+	}
+	updated, err := dummy.AddDrawerEntry(shift.ID, dummy.DrawerEntry{
+		Type:   req.Type,
+		Amount: req.Amount,
+		Reason: req.Reason,
+		UserID: middleware.GetUserID(c),
+	})
+	if err != nil {
+		response.Conflict(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusCreated, updated.Entries[len(updated.Entries)-1])
+}
+
+// Close - POST /api/shifts/:id/close
+// The cashier counts the drawer by denomination without seeing what it should
+// hold; expected cash and the variance are only shown once the count is in
+func (h *ShiftHandler) Close(c *gin.Context) {
+	var req CloseShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	shift, ok := shiftForRequest(c)
+	if !ok {
+		return
+	}
+	closed, err := dummy.CloseShift(shift.ID, req.Count, middleware.GetUserID(c), req.Notes)
+	switch {
+	case errors.Is(err, dummy.ErrInvalidDenomination):
+		response.BadRequest(c, "Invalid count. Denominations are "+denominationList())
+		return
+	case err != nil:
+		response.Conflict(c, err.Error())
+		return
+	}
+	response.Success(c, http.StatusOK, buildShiftReport(closed))
+}
+
+// Report - GET /api/shifts/:id/report?format=text
+// The shift report as JSON, or laid out for a receipt printer with format=text.
+// Open shifts' reports show the expected cash, so only managers see them before
+// the blind count.
+func (h *ShiftHandler) Report(c *gin.Context) {
+	shift, ok := shiftForRequest(c)
+	if !ok {
+		return
+	}
+	if shift.Status == dummy.ShiftOpen && !isManager(c) {
+		response.Forbidden(c, "Close the shift with a count before seeing its report")
+		return
+	}
+	report := buildShiftReport(shift)
+	if c.Query("format") == "text" {
+		c.String(http.StatusOK, report.Text())
+		return
+	}
+	response.Success(c, http.StatusOK, report)
+}
+
+// shiftView leaves out an open shift's drawer entries for cashiers, so that
+// they can't add up what the drawer should hold before the blind count
+func shiftView(c *gin.Context, shift dummy.Shift) dummy.Shift {
+	if shift.Status == dummy.ShiftOpen && !isManager(c) {
+		shift.Entries = nil
+	}
+	return shift
+}
+
+// shiftForRequest loads the shift in the path, answering for shifts that don't
+// exist or that the user may not work on: cashiers only their own, managers
+// their store's
+func shiftForRequest(c *gin.Context) (dummy.Shift, bool) {
+	shift := dummy.GetShift(c.Param("id"))
+	if shift == nil {
+		response.NotFound(c, "Shift not found")
+		return dummy.Shift{}, false
+	}
+	if err := authorizeShift(c, shift); err != nil {
+		response.Forbidden(c, err.Error())
+		return dummy.Shift{}, false
+	}
+	return *shift, true
+}
+
+func authorizeShift(c *gin.Context, shift *dummy.Shift) error {
+	switch {
+	case middleware.GetUserRole(c) == "super_admin":
+		return nil
+	case shift.StoreID != requestStoreID(c):
+		return errShiftOtherStore
+	case shift.CashierID != middleware.GetUserID(c) && !isManager(c):
+		return errOtherShift
+	}
+	return nil
+}
+
+// cashShift finds the open shift whose drawer cash goes into: the one asked
+// for, or the signed-in user's own
+func cashShift(c *gin.Context, shiftID string) (*dummy.Shift, error) {
+	if shiftID == "" {
+		return dummy.OpenShiftFor(middleware.GetUserID(c)), nil
+	}
+	shift := dummy.GetShift(shiftID)
+	if shift == nil {
+		return nil, dummy.ErrShiftNotFound
+	}
+	if err := authorizeShift(c, shift); err != nil {
+		return nil, err
+	}
+	if shift.Status != dummy.ShiftOpen {
+		return nil, dummy.ErrShiftClosed
+	}
+	return shift, nil
+}
+
+func isManager(c *gin.Context) bool {
+	role := middleware.GetUserRole(c)
+	return role == "store_admin" || role == "super_admin"
+}
+
+func userName(id string) string {
+	for _, u := range dummy.Users {
+		if u.ID == id {
+			return u.Name
+		}
+	}
+	return ""
+}
+
+func buildShiftReport(shift dummy.Shift) ShiftReport {
+	report := ShiftReport{Shift: shift, Sales: []MethodSales{}, Drawer: shift.Totals()}
+	index := make(map[string]int)
+	for _, p := range dummy.ShiftPayments(shift.ID) {
+		if p.Status != dummy.PaymentSuccess && p.Status != dummy.PaymentRefunded {
+			continue
+		}
+		i, ok := index[p.Method]
+		if !ok {
+			i = len(report.Sales)
+			index[p.Method] = i
+			report.Sales = append(report.Sales, MethodSales{Method: p.Method})
+		}
+		report.Sales[i].Count++
+		report.Sales[i].Amount += p.Amount
+		report.TotalSales += p.Amount
+	}
+	return report
+}
+
+const reportWidth = 40
+
+// Text lays the report out for a 40-column receipt printer
+func (r ShiftReport) Text() string {
+	var b strings.Builder
+	rule := strings.Repeat("-", reportWidth) + "\n"
+	line := func(label string, amount int) {
+		value := formatRupiah(amount)
+		pad := reportWidth - len(label) - len(value)
+		if pad < 1 {
+			pad = 1
+		}
+		b.WriteString(label + strings.Repeat(" ", pad) + value + "\n")
+	}
+	field := func(label, value string) {
+		fmt.Fprintf(&b, "%-14s%s\n", label, value)
+	}
+	const stamp = "2006-01-02 15:04"
+
+	title := "SHIFT REPORT"
+	b.WriteString(strings.Repeat(" ", (reportWidth-len(title))/2) + title + "\n")
+	b.WriteString(rule)
+	field("Cashier", r.Shift.CashierName)
+	field("Store", r.Shift.StoreID)
+	field("Drawer", r.Shift.DrawerID)
+	field("Opened", r.Shift.OpenedAt.Local().Format(stamp))
+	if r.Shift.ClosedAt != nil {
+		field("Closed", r.Shift.ClosedAt.Local().Format(stamp))
+	} else {
+		field("Status", "open, printed "+time.Now().Format(stamp))
+	}
+
+	b.WriteString(rule + "SALES\n")
+	for _, s := range r.Sales {
+		line(s.Method+" ("+strconv.Itoa(s.Count)+")", s.Amount)
+	}
+	line("Total", r.TotalSales)
+
+	b.WriteString(rule + "CASH DRAWER\n")
+	line("Opening float", r.Drawer.OpeningFloat)
+	line("Cash sales", r.Drawer.CashSales)
+	line("Cash refunds", -r.Drawer.CashRefunds)
+	line("Paid in", r.Drawer.PaidIn)
+	line("Paid out", -r.Drawer.PaidOut)
+	line("Expected", r.Drawer.Expected)
+
+	if r.Shift.Status == dummy.ShiftClosed {
+		b.WriteString(rule + "COUNT\n")
+		denominations := make([]int, 0, len(r.Shift.Count))
+		for d := range r.Shift.Count {
+			denominations = append(denominations, d)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(denominations)))
+		for _, d := range denominations {
+			line(formatRupiah(d)+" x "+strconv.Itoa(r.Shift.Count[d]), d*r.Shift.Count[d])
+		}
+		line("Counted", r.Shift.Counted)
+		variance := "Variance"
+		switch {
+		case r.Shift.Variance > 0:
+			variance += " (over)"
+		case r.Shift.Variance < 0:
+			variance += " (short)"
+		}
+		line(variance, r.Shift.Variance)
+	}
+
+	var movements []dummy.DrawerEntry
+	for _, e := range r.Shift.Entries {
+		if e.Type == dummy.DrawerPaidIn || e.Type == dummy.DrawerPaidOut {
+			movements = append(movements, e)
+		}
+	}
+	if len(movements) > 0 {
+		b.WriteString(rule + "PAID IN / OUT\n")
+		for _, e := range movements {
+			amount := e.Amount
+			if e.Type == dummy.DrawerPaidOut {
+				amount = -amount
+			}
+			reason := []rune(e.Reason)
+			if len(reason) > 20 {
+				reason = reason[:20]
+			}
+			line(e.At.Local().Format("15:04")+" "+string(reason), amount)
+		}
+	}
+	if r.Shift.Notes != "" {
+		b.WriteString(rule + r.Shift.Notes + "\n")
+	}
+	b.WriteString(rule)
+	return b.String()
+}
+
+// formatRupiah writes an amount with dots between thousands, e.g. 1.250.000
+func formatRupiah(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	s := strconv.Itoa(amount)
+	for i := len(s) - 3; i > 0; i -= 3 {
+		s = s[:i] + "." + s[i:]
+	}
+	return sign + s
+}
+
+func denominationList() string {
+	names := make([]string, len(dummy.Denominations))
+	for i, d := range dummy.Denominations {
+		names[i] = strconv.Itoa(d)
+	}
+	return strings.Join(names, ", ")
+}
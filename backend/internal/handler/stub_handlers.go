@@ -6,7 +6,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/delivery"
 	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/internal/websocket"
 	"github.com/kaori/backend/pkg/response"
 )
 
@@ -37,7 +41,7 @@ func (h *StoreHandler) Update(c *gin.Context) {
 
 func (h *StoreHandler) GetStats(c *gin.Context) {
 	response.Success(c, http.StatusOK, gin.H{
-		"total_orders_today":  len(dummy.Orders),
+		"total_orders_today":  len(dummy.GetAllOrders()),
 		"total_revenue_today": calculateTotalRevenue(),
 		"active_orders":       len(dummy.GetOrdersByStatus("confirmed", "cooking", "ready")),
 	})
@@ -45,9 +49,9 @@ func (h *StoreHandler) GetStats(c *gin.Context) {
 
 func calculateTotalRevenue() int {
 	total := 0
-	for _, o := range dummy.Orders {
-		if o.PaymentStatus == "paid" {
-			total += o.Total
+	for _, o := range dummy.GetAllOrders() {
+		if o.PaymentStatus != "unpaid" {
+			total += o.Total - o.Refunded
 		}
 	}
 	return total
@@ -155,18 +159,65 @@ func (h *ProductHandler) Create(c *gin.Context) {
 	response.Success(c, http.StatusCreated, gin.H{"message": "Product created"})
 }
 
+// UpdateProductRequest changes catalog fields; omitted fields are left as they are
+type UpdateProductRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	BasePrice   *int    `json:"base_price" binding:"omitempty,min=0"`
+	IsAvailable *bool   `json:"is_available"`
+}
+
 func (h *ProductHandler) Update(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{"message": "Product updated"})
+	var req UpdateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	var updated dummy.Product
+	found := dummy.UpdateProduct(c.Param("id"), func(p *dummy.Product) {
+		if req.Name != nil {
+			p.Name = *req.Name
+		}
+		if req.Description != nil {
+			p.Description = *req.Description
+		}
+		if req.BasePrice != nil {
+			p.BasePrice = *req.BasePrice
+		}
+		if req.IsAvailable != nil {
+			p.IsAvailable = *req.IsAvailable
+		}
+		updated = *p
+	})
+	if !found {
+		response.NotFound(c, "Product not found")
+		return
+	}
+	response.Success(c, http.StatusOK, updated)
 }
 
 func (h *ProductHandler) ToggleAvailability(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{"message": "Availability updated"})
+	id := c.Param("id")
+	var req struct {
+		IsAvailable bool `json:"is_available"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.BadRequest(c, "Invalid request")
+		return
+	}
+
+	if !dummy.SetProductAvailability(id, req.IsAvailable) {
+		response.NotFound(c, "Product not found")
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Availability updated", "is_available": req.IsAvailable})
 }
 
 // --- Order Handler ---
 
 func (h *OrderHandler) List(c *gin.Context) {
-	response.Success(c, http.StatusOK, dummy.Orders)
+	response.Success(c, http.StatusOK, dummy.GetAllOrders())
 }
 
 func (h *OrderHandler) GetActive(c *gin.Context) {
@@ -181,7 +232,7 @@ func (h *OrderHandler) GetIncoming(c *gin.Context) {
 
 func (h *OrderHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
-	for _, o := range dummy.Orders {
+	for _, o := range dummy.GetAllOrders() {
 		if o.ID == id {
 			response.Success(c, http.StatusOK, o)
 			return
@@ -283,6 +334,7 @@ func (h *OrderHandler) Create(c *gin.Context) {
 	order := dummy.Order{
 		ID:            uuid.New().String(),
 		OrderNumber:   dummy.GetNextOrderNumber(),
+		StoreID:       requestStoreID(c),
 		TableID:       req.TableID,
 		TableNumber:   tableNumber,
 		OrderType:     req.OrderType,
@@ -302,95 +354,114 @@ func (h *OrderHandler) Create(c *gin.Context) {
 
 	dummy.AddOrder(order)
 
-	// Broadcast to kitchen via WebSocket
-	h.hub.BroadcastOrder(order.ID, "new_order", order)
+	// Broadcast to the store's screens and the stations preparing it
+	h.hub.Publish(websocket.ToStore(order.StoreID).WithStations(dummy.OrderStations(&order)...), events.OrderCreated{Order: order})
 
 	response.Success(c, http.StatusCreated, order)
 }
 
+// requestStoreID is the signed-in user's store, or the default store for users without one
+func requestStoreID(c *gin.Context) string {
+	if storeID := middleware.GetStoreID(c); storeID != "" {
+		return storeID
+	}
+	return dummy.DefaultStoreID
+}
+
 func (h *OrderHandler) Confirm(c *gin.Context) {
-	id := c.Param("id")
-	if dummy.UpdateOrderStatus(id, "confirmed") {
-		response.Success(c, http.StatusOK, gin.H{"message": "Order confirmed"})
+	if _, err := h.changeStatus(actorFromContext(c), c.Param("id"), "confirmed", ""); err != nil {
+		respondOrderError(c, err)
 		return
 	}
-	response.NotFound(c, "Order not found")
+	response.Success(c, http.StatusOK, gin.H{"message": "Order confirmed"})
 }
 
 func (h *OrderHandler) UpdateStatus(c *gin.Context) {
 	id := c.Param("id")
 	var req struct {
 		Status string `json:"status"`
+		Reason string `json:"reason,omitempty"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.BadRequest(c, "Invalid request")
 		return
 	}
 
-	if dummy.UpdateOrderStatus(id, req.Status) {
-		h.hub.BroadcastOrder(id, "order_status", gin.H{"id": id, "status": req.Status})
-		response.Success(c, http.StatusOK, gin.H{"message": "Status updated", "status": req.Status})
+	if _, err := h.changeStatus(actorFromContext(c), id, req.Status, req.Reason); err != nil {
+		respondOrderError(c, err)
 		return
 	}
-	response.NotFound(c, "Order not found")
+	response.Success(c, http.StatusOK, gin.H{"message": "Status updated", "status": req.Status})
 }
 
 func (h *OrderHandler) Cancel(c *gin.Context) {
 	id := c.Param("id")
-	if dummy.UpdateOrderStatus(id, "cancelled") {
-		response.Success(c, http.StatusOK, gin.H{"message": "Order cancelled"})
-		return
+	var req struct {
+		Reason string `json:"reason"`
 	}
-	response.NotFound(c, "Order not found")
-}
+	_ = c.ShouldBindJSON(&req) // reason is optional
 
-func (h *OrderHandler) SyncOffline(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{"synced": 0})
+	if _, err := h.changeStatus(actorFromContext(c), id, "cancelled", req.Reason); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Order cancelled"})
 }
 
-// --- Payment Handler ---
-
-func (h *PaymentHandler) ProcessCash(c *gin.Context) {
-	var req struct {
-		OrderID    string `json:"order_id"`
-		AmountPaid int    `json:"amount_paid"`
-	}
-	if err := c.ShouldBindJSON(&req); err != nil {
-		response.BadRequest(c, "Invalid request")
+// Acknowledge - PATCH /api/orders/:id/acknowledge
+// Records that the kitchen has seen a new order
+func (h *OrderHandler) Acknowledge(c *gin.Context) {
+	order, err := h.acknowledge(actorFromContext(c), c.Param("id"))
+	if err != nil {
+		respondOrderError(c, err)
 		return
 	}
+	response.Success(c, http.StatusOK, gin.H{"message": "Order acknowledged", "acknowledged_at": order.AcknowledgedAt})
+}
 
-	// Find and update order
-	for i := range dummy.Orders {
-		if dummy.Orders[i].ID == req.OrderID {
-			dummy.Orders[i].PaymentStatus = "paid"
-			change := req.AmountPaid - dummy.Orders[i].Total
-			response.Success(c, http.StatusOK, gin.H{
-				"message":     "Payment successful",
-				"order_id":    req.OrderID,
-				"total":       dummy.Orders[i].Total,
-				"amount_paid": req.AmountPaid,
-				"change":      change,
-			})
-			return
-		}
+// MarkItemReady - PATCH /api/orders/:id/items/:itemId/ready
+func (h *OrderHandler) MarkItemReady(c *gin.Context) {
+	order, err := h.markItemReady(actorFromContext(c), c.Param("id"), c.Param("itemId"))
+	if err != nil {
+		respondOrderError(c, err)
+		return
 	}
-	response.NotFound(c, "Order not found")
+	response.Success(c, http.StatusOK, gin.H{"message": "Item ready", "status": order.Status, "items": order.Items})
 }
 
-func (h *PaymentHandler) CreateMidtrans(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{
-		"payment_url":    "https://midtrans.com/pay/sample",
-		"transaction_id": uuid.New().String(),
-	})
+func orderStatus(id string) string {
+	if o := dummy.GetOrderByID(id); o != nil {
+		return o.Status
+	}
+	return ""
+}
+
+// publishStatus tells everyone following an order, including the customer's
+// tracking page, about its new status
+func publishStatus(hub *websocket.Hub, id, previous string) {
+	if o := dummy.GetOrderByID(id); o != nil {
+		hub.Publish(websocket.ToOrder(o.StoreID, o.ID, dummy.OrderStations(o)...), events.OrderStatusChanged{
+			OrderID:        o.ID,
+			OrderNumber:    o.OrderNumber,
+			Status:         o.Status,
+			PreviousStatus: previous,
+			Reason:         o.StatusReason,
+		})
+	}
 }
 
-func (h *PaymentHandler) MidtransCallback(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{"message": "Callback received"})
+// notifyPlatform queues a status push when a delivery platform order changes state
+func (h *OrderHandler) notifyPlatform(id, previous, status, reason string) {
+	if previous == status {
+		return
+	}
+	if order := dummy.GetOrderByID(id); order != nil {
+		h.outbox.EnqueueOrderEvent(order, delivery.EventForTransition(previous, status), reason)
+	}
 }
 
-func (h *PaymentHandler) GetStatus(c *gin.Context) {
-	response.Success(c, http.StatusOK, gin.H{"status": "pending"})
+func (h *OrderHandler) SyncOffline(c *gin.Context) {
+	response.Success(c, http.StatusOK, gin.H{"synced": 0})
 }
 
 // --- Member Handler ---
@@ -404,7 +475,7 @@ func (h *MemberHandler) Create(c *gin.Context) {
 }
 
 func (h *MemberHandler) GetPoints(c *gin.Context) {
-	response.Success(c, http.StatusOK, []interface{}{})
+	response.Success(c, http.StatusOK, dummy.MemberPointHistory(c.Param("id")))
 }
 
 func (h *MemberHandler) Redeem(c *gin.Context) {
@@ -423,18 +494,41 @@ func (h *VoucherHandler) Apply(c *gin.Context) {
 
 // --- Report Handler ---
 
+// ReportTotal counts orders or refunds and their value
+type ReportTotal struct {
+	Count  int `json:"count"`
+	Amount int `json:"amount"`
+}
+
 func (h *ReportHandler) GetDaily(c *gin.Context) {
-	totalOrders := len(dummy.Orders)
+	orders := dummy.GetAllOrders()
 	totalRevenue := 0
-	for _, o := range dummy.Orders {
-		if o.PaymentStatus == "paid" {
+	netRevenue := 0
+	var cancellations, refunds ReportTotal
+	for _, o := range orders {
+		if o.Status == "cancelled" {
+			// Paid orders called off show up in refunds too, once the money is given back
+			cancellations.Count++
+			cancellations.Amount += o.Total
+		}
+		if o.PaymentStatus != "unpaid" {
 			totalRevenue += o.Total
+			netRevenue += orderNet(o) - o.Refunded
+		}
+	}
+	for _, r := range dummy.ListRefunds() {
+		if r.Status == dummy.PaymentSuccess {
+			refunds.Count++
+			refunds.Amount += r.Amount
 		}
 	}
 	response.Success(c, http.StatusOK, gin.H{
 		"date":          time.Now().Format("2006-01-02"),
-		"total_orders":  totalOrders,
+		"total_orders":  len(orders),
 		"total_revenue": totalRevenue,
+		"refunds":       refunds,       // money given back on paid orders
+		"cancellations": cancellations, // orders that were called off
+		"net_revenue":   netRevenue,    // after refunds, delivery commissions and merchant-funded promos
 	})
 }
 
@@ -442,12 +536,113 @@ func (h *ReportHandler) GetDailyByDate(c *gin.Context) {
 	response.Success(c, http.StatusOK, gin.H{})
 }
 
-func (h *ReportHandler) GetProductSales(c *gin.Context) {
-	response.Success(c, http.StatusOK, []interface{}{})
+// ProductSales is one row of the product sales report
+type ProductSales struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Revenue     int    `json:"revenue"`
+	Unmapped    bool   `json:"unmapped,omitempty"` // delivery items not yet mapped to our catalog
 }
 
+func (h *ReportHandler) GetProductSales(c *gin.Context) {
+	source := c.Query("source")
+	rows := []ProductSales{}
+	index := make(map[string]int)
+
+	for _, o := range dummy.GetAllOrders() {
+		if o.Status == "cancelled" || (source != "" && o.OrderSource != source) {
+			continue
+		}
+		for _, item := range o.Items {
+			key := item.ProductID
+			if key == "" {
+				key = "unmapped:" + o.OrderSource + ":" + item.ProductName
+			}
+			i, ok := index[key]
+			if !ok {
+				i = len(rows)
+				index[key] = i
+				rows = append(rows, ProductSales{ProductID: item.ProductID, ProductName: item.ProductName, Unmapped: item.ProductID == ""})
+			}
+			// Refunded units weren't sold
+			rows[i].Quantity += item.Quantity - item.RefundedQuantity
+			rows[i].Revenue += item.Subtotal - item.UnitPrice*item.RefundedQuantity
+		}
+	}
+	response.Success(c, http.StatusOK, rows)
+}
+
+// CashierSales sums up a cashier's shifts, with the report of each
+type CashierSales struct {
+	CashierID   string         `json:"cashier_id"`
+	CashierName string         `json:"cashier_name"`
+	Shifts      int            `json:"shifts"`
+	Sales       int            `json:"sales"`
+	CashSales   int            `json:"cash_sales"`
+	CashRefunds int            `json:"cash_refunds"`
+	PaidIn      int            `json:"paid_in"`
+	PaidOut     int            `json:"paid_out"`
+	Variance    int            `json:"variance"` // across closed shifts; negative when short
+	Reports     []ShiftSummary `json:"reports"`
+}
+
+// ShiftSummary is one line of a cashier's shift list, linking to its printable report
+type ShiftSummary struct {
+	ShiftID   string     `json:"shift_id"`
+	DrawerID  string     `json:"drawer_id"`
+	Status    string     `json:"status"`
+	OpenedAt  time.Time  `json:"opened_at"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	Sales     int        `json:"sales"`
+	Expected  int        `json:"expected"`
+	Counted   int        `json:"counted"`
+	Variance  int        `json:"variance"`
+	ReportURL string     `json:"report_url"`
+}
+
+// GetCashierSales - GET /api/reports/cashiers?date=2006-01-02&cashier_id=&store_id=
+// Sales, drawer movements and cash variance per cashier, from their shifts
 func (h *ReportHandler) GetCashierSales(c *gin.Context) {
-	response.Success(c, http.StatusOK, []interface{}{})
+	date := c.Query("date")
+	rows := []CashierSales{}
+	index := make(map[string]int)
+
+	shifts := dummy.ListShifts(adminStoreID(c, c.Query("store_id")), c.Query("cashier_id"))
+	for i := len(shifts) - 1; i >= 0; i-- { // oldest first
+		shift := shifts[i]
+		if date != "" && shift.OpenedAt.Local().Format("2006-01-02") != date {
+			continue
+		}
+		j, ok := index[shift.CashierID]
+		if !ok {
+			j = len(rows)
+			index[shift.CashierID] = j
+			rows = append(rows, CashierSales{CashierID: shift.CashierID, CashierName: shift.CashierName, Reports: []ShiftSummary{}})
+		}
+		report := buildShiftReport(shift)
+		row := &rows[j]
+		row.Shifts++
+		row.Sales += report.TotalSales
+		row.CashSales += report.Drawer.CashSales
+		row.CashRefunds += report.Drawer.CashRefunds
+		row.PaidIn += report.Drawer.PaidIn
+		row.PaidOut += report.Drawer.PaidOut
+		row.Variance += shift.Variance
+		row.Reports = append(row.Reports, ShiftSummary{
+			ShiftID:   shift.ID,
+			DrawerID:  shift.DrawerID,
+			Status:    shift.Status,
+			OpenedAt:  shift.OpenedAt,
+			ClosedAt:  shift.ClosedAt,
+			Sales:     report.TotalSales,
+			Expected:  report.Drawer.Expected,
+			Counted:   shift.Counted,
+			Variance:  shift.Variance,
+			ReportURL: "/api/shifts/" + shift.ID + "/report?format=text",
+		})
+	}
+	response.Success(c, http.StatusOK, rows)
 }
 
 func (h *ReportHandler) GetHourly(c *gin.Context) {
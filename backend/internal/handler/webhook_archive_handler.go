@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/middleware"
+	"github.com/kaori/backend/pkg/response"
+)
+
+const (
+	// maxWebhookBody caps how much of a webhook payload is read and archived
+	maxWebhookBody = 1 << 20
+
+	defaultWebhookListLimit = 100
+	maxWebhookListLimit     = 500
+)
+
+// Context keys webhook handlers set so the archive can record what they did
+const (
+	ctxWebhookOrderID   = "webhook_order_id"
+	ctxWebhookDuplicate = "webhook_duplicate"
+	ctxWebhookReplay    = "webhook_replay"   // set on admin replays, which carry no platform credentials
+	ctxWebhookStoreID   = "webhook_store_id" // set when the store is known from the sender or the order, not the URL
+)
+
+// Credentials are never archived
+var redactedWebhookHeaders = map[string]bool{
+	"Authorization":   true,
+	"Cookie":          true,
+	"X-Webhook-Token": true,
+}
+
+// WebhookArchiveHandler stores every inbound webhook payload and can replay one
+type WebhookArchiveHandler struct {
+	retention   time.Duration
+	router      http.Handler // replays go through it like the platform's request did
+	handlers    map[string]bool
+	integration bool
+}
+
+// webhookReplay travels in a replayed request's context, so the archive links
+// the new event to the original and hands it back to Replay
+type webhookReplay struct {
+	of, by string
+	event  *dummy.WebhookEvent
+}
+
+type webhookReplayKey struct{}
+
+// NewWebhookArchiveHandler creates a webhook archive keeping payloads for retention
+func NewWebhookArchiveHandler(retention time.Duration) *WebhookArchiveHandler {
+	return &WebhookArchiveHandler{retention: retention, handlers: make(map[string]bool)}
+}
+
+// SetRouter sets the router replays are sent through, once the webhook routes are on it
+func (h *WebhookArchiveHandler) SetRouter(router http.Handler) {
+	h.router = router
+}
+
+// Archive wraps one of a platform's webhook handlers (kind is order, driver, cancel, modify or payment)
+// so the raw request and its outcome are stored, and registers it for replays
+func (h *WebhookArchiveHandler) Archive(platform, kind string, next gin.HandlerFunc) gin.HandlerFunc {
+	h.handlers[platform+"/"+kind] = true
+	return func(c *gin.Context) {
+		h.serve(c, platform, kind, next)
+	}
+}
+
+// ArchiveIntegration is Archive for the mapped-integration webhook, where the
+// platform is the integration slug in the URL. Requests for slugs that aren't
+// an active integration are turned away without being archived.
+func (h *WebhookArchiveHandler) ArchiveIntegration(next gin.HandlerFunc) gin.HandlerFunc {
+	h.integration = true
+	return func(c *gin.Context) {
+		in := dummy.FindIntegration(c.Param("slug"))
+		if in == nil || !in.IsActive {
+			next(c)
+			return
+		}
+		c.Set(ctxWebhookStoreID, in.StoreID)
+		h.serve(c, c.Param("slug"), dummy.WebhookKindOrder, next)
+	}
+}
+
+// bodyRecorder keeps a copy of the response so errors can be archived
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// replayWriter collects the response to a replayed webhook
+type replayWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *replayWriter) Header() http.Header { return w.header }
+
+func (w *replayWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *replayWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (h *WebhookArchiveHandler) serve(c *gin.Context, platform, kind string, next gin.HandlerFunc) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody+1))
+	if err != nil {
+		body = nil
+	}
+	if len(body) > maxWebhookBody {
+		response.Error(c, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", "Webhook body is larger than 1 MB")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	replay, _ := c.Request.Context().Value(webhookReplayKey{}).(*webhookReplay)
+	if replay != nil {
+		c.Set(ctxWebhookReplay, true)
+	}
+
+	recorder := &bodyRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	next(c)
+
+	headers := make(map[string]string, len(c.Request.Header))
+	for name, values := range c.Request.Header {
+		if redactedWebhookHeaders[name] {
+			headers[name] = "[redacted]"
+			continue
+		}
+		if len(values) > 0 {
+			headers[name] = values[0]
+		}
+	}
+
+	now := time.Now()
+	event := dummy.WebhookEvent{
+		Platform:     platform,
+		Kind:         kind,
+		StoreID:      webhookStoreID(c),
+		Method:       c.Request.Method,
+		Path:         c.Request.URL.Path,
+		Query:        c.Request.URL.RawQuery,
+		Headers:      headers,
+		Body:         string(body),
+		ResponseCode: c.Writer.Status(),
+		OrderID:      c.GetString(ctxWebhookOrderID),
+		ReceivedAt:   now,
+		ExpiresAt:    now.Add(h.retention),
+	}
+
+	switch code := event.ResponseCode; {
+	case code >= 500:
+		event.Result = dummy.WebhookFailed
+	case code >= 400:
+		event.Result = dummy.WebhookRejected
+	case c.GetBool(ctxWebhookDuplicate):
+		event.Result = dummy.WebhookDuplicate
+	default:
+		event.Result = dummy.WebhookProcessed
+	}
+	if event.ResponseCode >= 400 {
+		var resp response.APIResponse
+		if json.Unmarshal(recorder.body.Bytes(), &resp) == nil && resp.Error != nil {
+			event.Error = resp.Error.Message
+		} else {
+			event.Error = recorder.body.String()
+		}
+	}
+
+	if replay != nil {
+		event.ReplayOf, event.ReplayedBy = replay.of, replay.by
+	}
+	event = dummy.AddWebhookEvent(event)
+	if replay != nil {
+		replay.event = &event
+	}
+}
+
+// List - GET /api/admin/webhooks?platform=&kind=&result=&order_id=&date_from=&date_to=&limit=
+func (h *WebhookArchiveHandler) List(c *gin.Context) {
+	filter := dummy.WebhookEventFilter{
+		Platform: c.Query("platform"),
+		Kind:     c.Query("kind"),
+		Result:   c.Query("result"),
+		OrderID:  c.Query("order_id"),
+		StoreID:  c.Query("store_id"),
+	}
+	if middleware.GetUserRole(c) != "super_admin" {
+		filter.StoreID = adminStoreID(c, "")
+	}
+	if c.Query("date_from") != "" || c.Query("date_to") != "" {
+		from, to, ok := reportPeriod(c, "date_from", "date_to")
+		if !ok {
+			return
+		}
+		filter.From, filter.To = from, to
+	}
+
+	limit := defaultWebhookListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxWebhookListLimit {
+			response.BadRequest(c, "limit must be between 1 and "+strconv.Itoa(maxWebhookListLimit))
+			return
+		}
+		limit = n
+	}
+
+	events := dummy.ListWebhookEvents(filter)
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	response.Success(c, http.StatusOK, events)
+}
+
+// Get - GET /api/admin/webhooks/:id
+func (h *WebhookArchiveHandler) Get(c *gin.Context) {
+	event := h.findEvent(c)
+	if event == nil {
+		return
+	}
+	response.Success(c, http.StatusOK, event)
+}
+
+// Replay - POST /api/admin/webhooks/:id/replay
+// Runs an archived payload through the current webhook handler again. Orders the
+// platform already sent are recognised by their platform ID and not duplicated.
+func (h *WebhookArchiveHandler) Replay(c *gin.Context) {
+	original := h.findEvent(c)
+	if original == nil {
+		return
+	}
+	kind := original.Kind
+	if kind == "" {
+		kind = dummy.WebhookKindOrder // archived before driver webhooks existed
+	}
+	ok := h.handlers[original.Platform+"/"+kind] ||
+		(kind == dummy.WebhookKindOrder && h.integration && dummy.FindIntegration(original.Platform) != nil)
+	if !ok || h.router == nil {
+		response.Conflict(c, "No webhook handler for "+original.Platform)
+		return
+	}
+
+	target := original.Path
+	if original.Query != "" {
+		target += "?" + original.Query
+	}
+	replay := &webhookReplay{of: original.ID, by: middleware.GetUserID(c)}
+	ctx := context.WithValue(c.Request.Context(), webhookReplayKey{}, replay)
+	req, err := http.NewRequestWithContext(ctx, original.Method, target, bytes.NewReader([]byte(original.Body)))
+	if err != nil {
+		response.InternalError(c, "Could not rebuild webhook request")
+		return
+	}
+	for name, value := range original.Headers {
+		if !redactedWebhookHeaders[name] {
+			req.Header.Set(name, value)
+		}
+	}
+
+	w := &replayWriter{header: make(http.Header)}
+	h.router.ServeHTTP(w, req)
+
+	var body interface{}
+	if err := json.Unmarshal(w.body.Bytes(), &body); err != nil {
+		body = w.body.String()
+	}
+	if replay.event == nil {
+		// The request never reached the webhook handler, e.g. its route is gone
+		response.Error(c, http.StatusConflict, "CONFLICT", "Webhook could not be replayed: "+http.StatusText(w.status))
+		return
+	}
+	response.Success(c, http.StatusOK, gin.H{
+		"event":    replay.event,
+		"response": body,
+	})
+}
+
+// findEvent loads the event named in the URL, limited to the admin's store
+func (h *WebhookArchiveHandler) findEvent(c *gin.Context) *dummy.WebhookEvent {
+	event := dummy.GetWebhookEvent(c.Param("id"))
+	if event == nil || (middleware.GetUserRole(c) != "super_admin" && event.StoreID != adminStoreID(c, "")) {
+		response.NotFound(c, "Webhook event not found")
+		return nil
+	}
+	return event
+}
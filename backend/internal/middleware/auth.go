@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -60,6 +61,9 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
 		c.Set("store_id", claims.StoreID)
+		if claims.ExpiresAt != nil {
+			c.Set("token_expires_at", claims.ExpiresAt.Time)
+		}
 
 		c.Next()
 	}
@@ -119,3 +123,11 @@ func GetStoreID(c *gin.Context) string {
 	}
 	return ""
 }
+
+// GetTokenExpiry gets when the request's access token expires
+func GetTokenExpiry(c *gin.Context) time.Time {
+	if t, exists := c.Get("token_expires_at"); exists {
+		return t.(time.Time)
+	}
+	return time.Time{}
+}
@@ -143,6 +143,7 @@ type ProcessCashPaymentRequest struct {
 type CreateMidtransPaymentRequest struct {
 	OrderID string `json:"order_id" binding:"required,uuid"`
 	Method  string `json:"method" binding:"required,oneof=qris card ewallet"`
+	Amount  int    `json:"amount" binding:"omitempty,min=1"` // part of the balance, for split bills
 }
 
 // CreateMemberRequest for registering a new member
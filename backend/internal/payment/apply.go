@@ -0,0 +1,128 @@
+package payment
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/events"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+// Apply records a provider's report on a payment and, if its status changed,
+// tells the store and the order's tracking page. Provider callbacks, status
+// checks and reconciliation all go through here, so a report that arrives
+// twice, or after we already asked for the status, changes nothing the second
+// time. Reports for a different amount, and successes for an order other
+// payments have already covered, are refused and reported for review; money
+// arriving for a payment we gave up on or a cancelled order is kept but
+// reported too.
+func Apply(hub *websocket.Hub, paymentID string, u dummy.PaymentUpdate) (dummy.Payment, bool, error) {
+	before := dummy.GetPayment(paymentID)
+	if before == nil {
+		return dummy.Payment{}, false, dummy.ErrPaymentNotFound
+	}
+	if u.Amount != 0 && u.Amount != before.Amount {
+		reportDiscrepancy(*before, dummy.DiscrepancyAmountMismatch, "Provider reports "+FormatAmount(u.Amount)+" for a payment of "+FormatAmount(before.Amount), u.Amount)
+		return *before, false, ErrAmountMismatch
+	}
+
+	p, order, changed, err := dummy.ApplyPaymentUpdate(paymentID, u)
+	if errors.Is(err, dummy.ErrOverpaid) && p.Provider != ProviderCash {
+		// Cash is handed back at the till; anything else has to be refunded
+		reportDiscrepancy(p, dummy.DiscrepancyOverpaid, "Paid, but order "+order.OrderNumber+" was already paid by other payments; refund it at "+p.Provider, 0)
+	}
+	if err != nil || !changed {
+		return p, changed, err
+	}
+	if p.Status == dummy.PaymentSuccess {
+		if before.Status == dummy.PaymentFailed || before.Status == dummy.PaymentExpired {
+			reportDiscrepancy(p, dummy.DiscrepancyPaidAfterExpiry, "Paid after it was marked "+before.Status, 0)
+		}
+		if order.Status == "cancelled" {
+			reportDiscrepancy(p, dummy.DiscrepancyPaidCancelled, "Order "+order.OrderNumber+" was cancelled but paid; refund it or reopen it", 0)
+		}
+	}
+
+	balance, _ := dummy.OrderBalance(order.ID)
+	aud := websocket.ToStore(order.StoreID).With(websocket.OrderTopic(order.ID))
+	switch p.Status {
+	case dummy.PaymentSuccess:
+		paidAt := time.Now()
+		if p.PaidAt != nil {
+			paidAt = *p.PaidAt
+		}
+		hub.Publish(aud, events.PaymentSucceeded{
+			PaymentID:     p.ID,
+			OrderID:       order.ID,
+			OrderNumber:   order.OrderNumber,
+			Method:        p.Method,
+			Amount:        p.Amount,
+			Remaining:     balance.Remaining,
+			PaymentStatus: order.PaymentStatus,
+			PaidAt:        paidAt,
+		})
+	case dummy.PaymentFailed, dummy.PaymentExpired:
+		hub.Publish(aud, events.PaymentFailed{
+			PaymentID:     p.ID,
+			OrderID:       order.ID,
+			OrderNumber:   order.OrderNumber,
+			Method:        p.Method,
+			Amount:        p.Amount,
+			Status:        p.Status,
+			Reason:        p.ProviderStatus,
+			PaymentStatus: order.PaymentStatus,
+		})
+	}
+	return p, true, nil
+}
+
+// PublishRefund tells the store and the order's tracking page about a
+// successful refund
+func PublishRefund(hub *websocket.Hub, r dummy.Refund, order dummy.Order) {
+	hub.Publish(websocket.ToStore(order.StoreID).With(websocket.OrderTopic(order.ID)), events.PaymentRefunded{
+		RefundID:       r.ID,
+		PaymentID:      r.PaymentID,
+		OrderID:        order.ID,
+		OrderNumber:    order.OrderNumber,
+		Method:         r.Method,
+		Amount:         r.Amount,
+		OrderRefunded:  order.Refunded,
+		Reason:         r.Reason,
+		PointsReversed: r.PointsReversed,
+		PaymentStatus:  order.PaymentStatus,
+	})
+}
+
+// OrderItems lists an order's lines for a charge. Tax, discounts and rounding
+// go on a line of their own so the items add up to amount, as Midtrans requires.
+func OrderItems(order *dummy.Order, amount int) []Item {
+	items := make([]Item, 0, len(order.Items)+1)
+	sum := 0
+	for _, it := range order.Items {
+		items = append(items, Item{ID: it.ProductID, Name: truncate(it.ProductName, 50), Price: it.UnitPrice, Quantity: it.Quantity})
+		sum += it.UnitPrice * it.Quantity
+	}
+	if sum == amount {
+		return items
+	}
+	if amount != order.Total {
+		// Part of the bill: one line for the part, rather than items that don't add up
+		return []Item{{ID: "part", Name: "Order " + order.OrderNumber + " (part)", Price: amount, Quantity: 1}}
+	}
+	return append(items, Item{ID: "adjustment", Name: "Tax and adjustments", Price: amount - sum, Quantity: 1})
+}
+
+// FormatAmount formats a rupiah amount the way Midtrans sends gross_amount
+func FormatAmount(amount int) string {
+	return strconv.Itoa(amount) + ".00"
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// ProviderEDC names payments taken on a bank's standalone EDC terminal
+const ProviderEDC = "edc"
+
+// Approval codes are printed on the slip, usually 6 characters
+var approvalCodePattern = regexp.MustCompile(`^[A-Z0-9]{4,12}$`)
+
+// EDCProvider records card and QRIS payments taken on a standalone bank
+// terminal we can't talk to. The terminal has already approved the payment
+// when the cashier types in the approval code from the slip, so it is a
+// success straight away.
+type EDCProvider struct{}
+
+// NewEDCProvider creates the EDC provider
+func NewEDCProvider() *EDCProvider {
+	return &EDCProvider{}
+}
+
+func (p *EDCProvider) Name() string { return ProviderEDC }
+
+func (p *EDCProvider) Methods() []string { return []string{"card", "qris"} }
+
+func (p *EDCProvider) Create(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	code := strings.ToUpper(strings.TrimSpace(req.ApprovalCode))
+	if !approvalCodePattern.MatchString(code) {
+		return nil, fmt.Errorf("%w: approval_code from the EDC slip is required (4-12 letters or digits)", ErrInvalidRequest)
+	}
+	channel := ProviderEDC
+	if req.TerminalID != "" {
+		channel = ProviderEDC + ":" + req.TerminalID
+	}
+	return &Charge{
+		Status:         dummy.PaymentSuccess,
+		ProviderStatus: "approved",
+		TransactionID:  code,
+		Channel:        channel,
+		At:             time.Now(),
+	}, nil
+}
+
+// Status is whatever the cashier recorded; the terminal can't be asked
+func (p *EDCProvider) Status(ctx context.Context, payment dummy.Payment) (dummy.PaymentUpdate, error) {
+	return dummy.PaymentUpdate{Status: payment.Status, ProviderStatus: payment.ProviderStatus}, nil
+}
+
+// Refund is done by voiding or refunding on the terminal itself
+func (p *EDCProvider) Refund(ctx context.Context, payment dummy.Payment, req RefundRequest) (*Refund, error) {
+	return &Refund{
+		Status:  dummy.PaymentSuccess,
+		Manual:  true,
+		Message: "Void or refund approval code " + payment.TransactionID + " on the EDC terminal",
+	}, nil
+}
+
+func (p *EDCProvider) ParseCallback(header http.Header, body []byte) (*Callback, error) {
+	return nil, ErrNoCallbacks
+}
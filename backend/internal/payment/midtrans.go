@@ -0,0 +1,499 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/config"
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// ProviderMidtrans names Midtrans on payments
+const ProviderMidtrans = "midtrans"
+
+// Midtrans hosts. The Core API (charges, status) and Snap (hosted payment page)
+// live on different hosts.
+const (
+	midtransSandboxAPI     = "https://api.sandbox.midtrans.com"
+	midtransSandboxSnap    = "https://app.sandbox.midtrans.com"
+	midtransProductionAPI  = "https://api.midtrans.com"
+	midtransProductionSnap = "https://app.midtrans.com"
+)
+
+// Ways to charge through Midtrans
+const (
+	ChannelSnap = "snap" // redirect to Midtrans' hosted page, which offers the method
+	ChannelCore = "core" // charge directly and show the QR code or deeplink ourselves
+)
+
+// E-wallets the Core API can charge
+const (
+	EwalletGoPay     = "gopay"
+	EwalletShopeePay = "shopeepay"
+)
+
+// ErrNotConfigured is returned when no Midtrans server key is set
+var ErrNotConfigured = errors.New("midtrans is not configured")
+
+// Midtrans talks to the Midtrans Snap and Core APIs with a merchant's server key
+type Midtrans struct {
+	http      *http.Client
+	serverKey string
+	apiURL    string
+	snapURL   string
+}
+
+// NewMidtrans creates a client for the sandbox or production environment.
+// baseURL, if set, replaces both hosts, e.g. to use cmd/mockmidtrans locally.
+func NewMidtrans(serverKey string, production bool, baseURL string) *Midtrans {
+	m := &Midtrans{
+		http:      &http.Client{Timeout: 15 * time.Second},
+		serverKey: serverKey,
+		apiURL:    midtransSandboxAPI,
+		snapURL:   midtransSandboxSnap,
+	}
+	if production {
+		m.apiURL, m.snapURL = midtransProductionAPI, midtransProductionSnap
+	}
+	if baseURL != "" {
+		m.apiURL = strings.TrimRight(baseURL, "/")
+		m.snapURL = m.apiURL
+	}
+	return m
+}
+
+// MidtransFromConfig creates the client for the configured merchant account
+func MidtransFromConfig(cfg *config.Config) *Midtrans {
+	return NewMidtrans(cfg.MidtransServerKey, cfg.MidtransIsProduction, cfg.MidtransBaseURL)
+}
+
+// Configured reports whether a server key is set
+func (m *Midtrans) Configured() bool {
+	return m != nil && m.serverKey != ""
+}
+
+// SnapTransaction is a Snap payment page
+type SnapTransaction struct {
+	Token       string `json:"token"`
+	RedirectURL string `json:"redirect_url"`
+}
+
+// Transaction is a charge, status or notification as Midtrans reports it. The
+// three share their fields.
+type Transaction struct {
+	StatusCode        string   `json:"status_code"`
+	StatusMessage     string   `json:"status_message"`
+	TransactionID     string   `json:"transaction_id"`
+	OrderID           string   `json:"order_id"`
+	GrossAmount       string   `json:"gross_amount"` // "10000.00"
+	PaymentType       string   `json:"payment_type"`
+	TransactionTime   string   `json:"transaction_time"`
+	TransactionStatus string   `json:"transaction_status"`
+	FraudStatus       string   `json:"fraud_status,omitempty"`
+	SettlementTime    string   `json:"settlement_time,omitempty"`
+	ExpiryTime        string   `json:"expiry_time,omitempty"`
+	SignatureKey      string   `json:"signature_key,omitempty"`
+	Actions           []Action `json:"actions,omitempty"`
+	QRString          string   `json:"qr_string,omitempty"`
+	RedirectURL       string   `json:"redirect_url,omitempty"` // 3-D Secure page for cards
+}
+
+// Action is something the customer does to pay a Core API charge
+type Action struct {
+	Name   string `json:"name"` // generate-qr-code, deeplink-redirect, get-status, cancel
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// ActionURL returns the URL of the named action, if the charge has one
+func (t *Transaction) ActionURL(name string) string {
+	for _, a := range t.Actions {
+		if a.Name == name {
+			return a.URL
+		}
+	}
+	return ""
+}
+
+// Status maps Midtrans' transaction status to ours. Captured card payments
+// that fraud detection wants reviewed ("challenge") stay pending.
+func (t *Transaction) Status() string {
+	switch t.TransactionStatus {
+	case "settlement":
+		return dummy.PaymentSuccess
+	case "capture":
+		if t.FraudStatus == "" || t.FraudStatus == "accept" {
+			return dummy.PaymentSuccess
+		}
+		if t.FraudStatus == "deny" {
+			return dummy.PaymentFailed
+		}
+		return dummy.PaymentPending
+	case "deny", "cancel", "failure":
+		return dummy.PaymentFailed
+	case "expire":
+		return dummy.PaymentExpired
+	}
+	return dummy.PaymentPending
+}
+
+// Amount parses the gross amount. Rupiah have no minor unit, so it is whole.
+func (t *Transaction) Amount() (int, error) {
+	f, err := strconv.ParseFloat(t.GrossAmount, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid gross_amount %q", t.GrossAmount)
+	}
+	return int(f), nil
+}
+
+// Expiry is when an unpaid charge expires, if Midtrans said
+func (t *Transaction) Expiry() *time.Time {
+	at, err := parseMidtransTime(t.ExpiryTime)
+	if err != nil {
+		return nil
+	}
+	return &at
+}
+
+// Update converts the transaction for dummy.ApplyPaymentUpdate
+func (t *Transaction) Update() dummy.PaymentUpdate {
+	u := dummy.PaymentUpdate{
+		Status:         t.Status(),
+		ProviderStatus: t.TransactionStatus,
+		TransactionID:  t.TransactionID,
+	}
+	if amount, err := t.Amount(); err == nil {
+		u.Amount = amount
+	}
+	for _, ts := range []string{t.SettlementTime, t.TransactionTime} {
+		if at, err := parseMidtransTime(ts); err == nil {
+			u.At = at
+			break
+		}
+	}
+	return u
+}
+
+// APIError is returned when Midtrans rejects or fails a request
+type APIError struct {
+	StatusCode int
+	Messages   []string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("midtrans responded %d: %s", e.StatusCode, strings.Join(e.Messages, "; "))
+}
+
+// CreateSnap creates a Snap payment page offering the request's method
+func (m *Midtrans) CreateSnap(ctx context.Context, req ChargeRequest) (*SnapTransaction, error) {
+	body := map[string]interface{}{
+		"transaction_details": map[string]interface{}{"order_id": req.Ref, "gross_amount": req.Amount},
+		"enabled_payments":    snapPayments(req.Method),
+	}
+	if len(req.Items) > 0 {
+		body["item_details"] = req.Items
+	}
+	if req.Customer != nil {
+		body["customer_details"] = req.Customer
+	}
+	if req.CallbackURL != "" {
+		body["callbacks"] = map[string]string{"finish": req.CallbackURL}
+	}
+
+	var snap SnapTransaction
+	if err := m.send(ctx, http.MethodPost, m.snapURL+"/snap/v1/transactions", body, &snap); err != nil {
+		return nil, err
+	}
+	return &snap, nil
+}
+
+// Charge charges through the Core API: a QRIS code, an e-wallet deeplink, or a
+// card token from Midtrans.js (which may need 3-D Secure, see RedirectURL)
+func (m *Midtrans) Charge(ctx context.Context, req ChargeRequest) (*Transaction, error) {
+	body := map[string]interface{}{
+		"transaction_details": map[string]interface{}{"order_id": req.Ref, "gross_amount": req.Amount},
+	}
+	if len(req.Items) > 0 {
+		body["item_details"] = req.Items
+	}
+	if req.Customer != nil {
+		body["customer_details"] = req.Customer
+	}
+
+	switch req.Method {
+	case "qris":
+		body["payment_type"] = "qris"
+		body["qris"] = map[string]string{"acquirer": "gopay"}
+	case "card":
+		if req.CardToken == "" {
+			return nil, fmt.Errorf("%w: card charges need a card_token", ErrInvalidRequest)
+		}
+		body["payment_type"] = "credit_card"
+		body["credit_card"] = map[string]interface{}{"token_id": req.CardToken, "authentication": true}
+	case "ewallet":
+		switch req.Ewallet {
+		case EwalletGoPay:
+			body["payment_type"] = EwalletGoPay
+			body["gopay"] = map[string]interface{}{"enable_callback": req.CallbackURL != "", "callback_url": req.CallbackURL}
+		case EwalletShopeePay:
+			body["payment_type"] = EwalletShopeePay
+			body["shopeepay"] = map[string]string{"callback_url": req.CallbackURL}
+		default:
+			return nil, fmt.Errorf("%w: unsupported e-wallet %q", ErrInvalidRequest, req.Ewallet)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported payment method %q", ErrInvalidRequest, req.Method)
+	}
+
+	var txn Transaction
+	if err := m.send(ctx, http.MethodPost, m.apiURL+"/v2/charge", body, &txn); err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// GetStatus asks Midtrans for a transaction's current status
+func (m *Midtrans) GetStatus(ctx context.Context, orderID string) (*Transaction, error) {
+	var txn Transaction
+	if err := m.send(ctx, http.MethodGet, m.apiURL+"/v2/"+url.PathEscape(orderID)+"/status", nil, &txn); err != nil {
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// MidtransRefund is Midtrans' answer to a refund
+type MidtransRefund struct {
+	StatusCode         string `json:"status_code"`
+	StatusMessage      string `json:"status_message"`
+	TransactionStatus  string `json:"transaction_status"` // refund or partial_refund
+	RefundChargebackID int64  `json:"refund_chargeback_id"`
+	RefundAmount       string `json:"refund_amount"`
+	RefundKey          string `json:"refund_key"`
+}
+
+// Refund refunds a settled or captured transaction in full or in part. The
+// refund key makes retries safe: Midtrans refunds each key once.
+func (m *Midtrans) Refund(ctx context.Context, orderID string, req RefundRequest) (*MidtransRefund, error) {
+	body := map[string]interface{}{"refund_key": req.Ref, "amount": req.Amount, "reason": req.Reason}
+	var refund MidtransRefund
+	if err := m.send(ctx, http.MethodPost, m.apiURL+"/v2/"+url.PathEscape(orderID)+"/refund", body, &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// VerifySignature checks a notification's signature_key, the SHA512 of
+// order_id + status_code + gross_amount + server key
+func (m *Midtrans) VerifySignature(n *Transaction) bool {
+	if !m.Configured() || n.SignatureKey == "" {
+		return false
+	}
+	expected := MidtransSignature(n.OrderID, n.StatusCode, n.GrossAmount, m.serverKey)
+	return subtle.ConstantTimeCompare([]byte(strings.ToLower(n.SignatureKey)), []byte(expected)) == 1
+}
+
+// MidtransSignature computes a notification signature_key. cmd/mockmidtrans uses
+// it to sign the notifications it sends.
+func MidtransSignature(orderID, statusCode, grossAmount, serverKey string) string {
+	sum := sha512.Sum512([]byte(orderID + statusCode + grossAmount + serverKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// send makes an authenticated request. Midtrans reports some errors with HTTP
+// 200 and the real code in status_code, so both are checked.
+func (m *Midtrans) send(ctx context.Context, method, endpoint string, body, out interface{}) error {
+	if !m.Configured() {
+		return ErrNotConfigured
+	}
+
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(m.serverKey, "")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var status struct {
+		StatusCode    string   `json:"status_code"`
+		StatusMessage string   `json:"status_message"`
+		ErrorMessages []string `json:"error_messages"`
+	}
+	json.Unmarshal(respBody, &status)
+	code := resp.StatusCode
+	if n, err := strconv.Atoi(status.StatusCode); err == nil && n >= 400 {
+		code = n
+	}
+	if code >= 300 {
+		messages := status.ErrorMessages
+		if len(messages) == 0 && status.StatusMessage != "" {
+			messages = []string{status.StatusMessage}
+		}
+		if len(messages) == 0 {
+			messages = []string{strings.TrimSpace(string(respBody))}
+		}
+		return &APIError{StatusCode: code, Messages: messages}
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// snapPayments lists the Snap payment channels for one of our methods
+func snapPayments(method string) []string {
+	switch method {
+	case "qris":
+		return []string{"other_qris"}
+	case "card":
+		return []string{"credit_card"}
+	case "ewallet":
+		return []string{EwalletGoPay, EwalletShopeePay}
+	}
+	return nil
+}
+
+// Midtrans reports times in Jakarta time without a zone
+var jakarta = time.FixedZone("WIB", 7*60*60)
+
+func parseMidtransTime(s string) (time.Time, error) {
+	return time.ParseInLocation("2006-01-02 15:04:05", s, jakarta)
+}
+
+// MidtransProvider takes QRIS, card and e-wallet payments through Midtrans
+type MidtransProvider struct {
+	client *Midtrans
+}
+
+// NewMidtransProvider creates the Midtrans provider
+func NewMidtransProvider(client *Midtrans) *MidtransProvider {
+	return &MidtransProvider{client: client}
+}
+
+func (p *MidtransProvider) Name() string { return ProviderMidtrans }
+
+func (p *MidtransProvider) Methods() []string { return []string{"qris", "card", "ewallet"} }
+
+// Create makes a Snap page by default, or charges through the Core API for the
+// "core" channel
+func (p *MidtransProvider) Create(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	if !p.client.Configured() {
+		return nil, ErrNotConfigured
+	}
+	if req.Channel == "" || req.Channel == ChannelSnap {
+		snap, err := p.client.CreateSnap(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		return &Charge{
+			Status:      dummy.PaymentPending,
+			Channel:     ChannelSnap,
+			PaymentURL:  snap.RedirectURL,
+			SnapToken:   snap.Token,
+			RedirectURL: snap.RedirectURL,
+		}, nil
+	}
+	if req.Channel != ChannelCore {
+		return nil, fmt.Errorf("%w: channel must be snap or core", ErrInvalidRequest)
+	}
+
+	if req.Method == "ewallet" && req.Ewallet == "" {
+		req.Ewallet = EwalletGoPay
+	}
+	txn, err := p.client.Charge(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	u := txn.Update()
+	charge := &Charge{
+		Status:         u.Status,
+		ProviderStatus: u.ProviderStatus,
+		TransactionID:  u.TransactionID,
+		Channel:        txn.PaymentType,
+		RedirectURL:    txn.RedirectURL,
+		QRString:       txn.QRString,
+		QRCodeURL:      txn.ActionURL("generate-qr-code"),
+		DeeplinkURL:    txn.ActionURL("deeplink-redirect"),
+		ExpiresAt:      txn.Expiry(),
+		At:             u.At,
+	}
+	for _, url := range []string{charge.DeeplinkURL, charge.RedirectURL, charge.QRCodeURL} {
+		if url != "" {
+			charge.PaymentURL = url
+			break
+		}
+	}
+	return charge, nil
+}
+
+func (p *MidtransProvider) Status(ctx context.Context, payment dummy.Payment) (dummy.PaymentUpdate, error) {
+	txn, err := p.client.GetStatus(ctx, payment.ProviderRef)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return dummy.PaymentUpdate{}, ErrNoStatus
+	}
+	if err != nil {
+		return dummy.PaymentUpdate{}, err
+	}
+	return txn.Update(), nil
+}
+
+func (p *MidtransProvider) Refund(ctx context.Context, payment dummy.Payment, req RefundRequest) (*Refund, error) {
+	refund, err := p.client.Refund(ctx, payment.ProviderRef, req)
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{
+		Status:        dummy.PaymentSuccess,
+		TransactionID: strconv.FormatInt(refund.RefundChargebackID, 10),
+		Message:       refund.StatusMessage,
+	}, nil
+}
+
+// ParseCallback reads an HTTP notification, which is only trusted with a valid signature_key
+func (p *MidtransProvider) ParseCallback(header http.Header, body []byte) (*Callback, error) {
+	if !p.client.Configured() {
+		return nil, ErrNotConfigured
+	}
+	var n Transaction
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	if !p.client.VerifySignature(&n) {
+		return nil, ErrInvalidSignature
+	}
+	amount, err := n.Amount()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return &Callback{Ref: n.OrderID, Amount: amount, Update: n.Update()}, nil
+}
@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/kaori/backend/internal/config"
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// ProviderCash names payments the cashier takes in cash
+const ProviderCash = "cash"
+
+var (
+	// ErrAmountMismatch is returned for a provider's report about a different
+	// amount than the payment's
+	ErrAmountMismatch = errors.New("amount does not match the payment")
+
+	// ErrInvalidRequest wraps charges a provider can't take as asked, e.g. a card
+	// charge without a token. Sending it again won't help.
+	ErrInvalidRequest = errors.New("invalid payment request")
+
+	// ErrNoStatus means the provider doesn't know the payment yet, e.g. a Snap
+	// page where the customer hasn't picked how to pay
+	ErrNoStatus = errors.New("provider has no status for this payment yet")
+
+	// ErrNoCallbacks is returned by providers that never call us back
+	ErrNoCallbacks = errors.New("provider does not send callbacks")
+
+	// ErrInvalidSignature is returned for callbacks that fail verification
+	ErrInvalidSignature = errors.New("invalid callback signature")
+)
+
+// Refused reports whether a provider turned a request down, so nothing
+// happened and sending it again won't help. A timeout or a 5xx is not a
+// refusal: the provider may well have done it.
+func Refused(err error) bool {
+	var apiErr *APIError
+	return errors.Is(err, ErrInvalidRequest) || errors.Is(err, ErrNotConfigured) ||
+		(errors.As(err, &apiErr) && apiErr.StatusCode < 500)
+}
+
+// Provider takes payments other than cash: a payment gateway like Midtrans or
+// Xendit, a bank's standalone EDC terminal, or the sandbox for training.
+// Payments are known to the provider by their Ref, which is unique per attempt.
+type Provider interface {
+	Name() string
+
+	// Methods lists the payment methods (qris, card, ewallet) it takes
+	Methods() []string
+
+	// Create starts a payment. Some are decided at once (an approved EDC slip,
+	// a declined card), others are pending until the customer pays.
+	Create(ctx context.Context, req ChargeRequest) (*Charge, error)
+
+	// Status asks the provider where a payment stands
+	Status(ctx context.Context, p dummy.Payment) (dummy.PaymentUpdate, error)
+
+	// Refund returns some or all of a successful payment to the customer
+	Refund(ctx context.Context, p dummy.Payment, req RefundRequest) (*Refund, error)
+
+	// ParseCallback verifies and reads a notification the provider sent us
+	ParseCallback(header http.Header, body []byte) (*Callback, error)
+}
+
+// ChargeRequest is a payment to start
+type ChargeRequest struct {
+	Ref     string // the payment's ID, which the provider will know it by
+	Amount  int
+	Method  string // qris, card, ewallet
+	Items   []Item
+	Channel string // provider specific, e.g. Midtrans snap or core
+
+	Ewallet      string // gopay or shopeepay, for e-wallet charges
+	CardToken    string // from the gateway's card form, for card charges
+	ApprovalCode string // from the EDC slip, for terminals we don't talk to
+	TerminalID   string // which EDC terminal took it
+	CallbackURL  string // where the e-wallet app or 3-D Secure page sends the customer back
+	Customer     *Customer
+}
+
+// Item is a line shown to the customer. Midtrans rejects charges whose items
+// don't add up to the amount.
+type Item struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Price    int    `json:"price"`
+	Quantity int    `json:"quantity"`
+}
+
+// Customer is who pays, if known
+type Customer struct {
+	FirstName string `json:"first_name,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+}
+
+// Charge is a started payment: what the provider decided, if anything yet, and
+// what the customer needs to pay
+type Charge struct {
+	Status         string // pending until the provider decides
+	ProviderStatus string
+	TransactionID  string
+	Channel        string
+	PaymentURL     string // the one URL to show or open: payment page, deeplink, QR image or 3-D Secure
+
+	SnapToken   string
+	RedirectURL string
+	QRString    string
+	QRCodeURL   string
+	DeeplinkURL string
+	ExpiresAt   *time.Time
+	At          time.Time // when it was decided, if it was
+}
+
+// Details copies what the customer needs to pay onto a payment. The status is
+// left to Apply.
+func (ch *Charge) Details(p *dummy.Payment) {
+	if ch.Channel != "" {
+		p.Channel = ch.Channel
+	}
+	p.TransactionID = ch.TransactionID
+	p.ProviderStatus = ch.ProviderStatus
+	p.SnapToken = ch.SnapToken
+	p.RedirectURL = ch.RedirectURL
+	p.QRString = ch.QRString
+	p.QRCodeURL = ch.QRCodeURL
+	p.DeeplinkURL = ch.DeeplinkURL
+	p.ExpiresAt = ch.ExpiresAt
+}
+
+// Update is the charge's decision, for Apply
+func (ch *Charge) Update() dummy.PaymentUpdate {
+	return dummy.PaymentUpdate{Status: ch.Status, ProviderStatus: ch.ProviderStatus, TransactionID: ch.TransactionID, At: ch.At}
+}
+
+// RefundRequest returns money from a payment. Ref is unique per refund so a
+// retried request isn't refunded twice.
+type RefundRequest struct {
+	Ref    string
+	Amount int
+	Reason string
+}
+
+// Refund is a provider's answer to a refund
+type Refund struct {
+	Status        string // success, pending or failed
+	TransactionID string // the provider's reference for the refund
+	Manual        bool   // the money is returned outside the system, e.g. a void on the EDC terminal
+	Message       string
+}
+
+// Callback is a verified notification about one payment
+type Callback struct {
+	Ref    string
+	Amount int
+	Update dummy.PaymentUpdate
+}
+
+// Registry holds the configured providers and picks one for a payment
+type Registry struct {
+	providers map[string]Provider
+}
+
+// NewRegistry creates a registry of providers, by name
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider, len(providers))}
+	for _, p := range providers {
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// ProvidersFromConfig registers every provider we support. Midtrans refuses
+// charges until its server key is configured.
+func ProvidersFromConfig(cfg *config.Config) *Registry {
+	return NewRegistry(
+		NewMidtransProvider(MidtransFromConfig(cfg)),
+		NewEDCProvider(),
+		NewSandboxProvider(),
+	)
+}
+
+// Get returns a provider by name
+func (r *Registry) Get(name string) (Provider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Names lists the registered providers, sorted
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Route returns the provider a store uses for a payment method
+func (r *Registry) Route(storeID, method string) (Provider, error) {
+	route := dummy.GetPaymentRoute(storeID, method)
+	p, ok := r.providers[route.Provider]
+	if !ok {
+		return nil, fmt.Errorf("store %s routes %s payments to unknown provider %q", storeID, method, route.Provider)
+	}
+	if !Supports(p, method) {
+		return nil, fmt.Errorf("%w: %s does not take %s payments", ErrInvalidRequest, p.Name(), method)
+	}
+	return p, nil
+}
+
+// Supports reports whether a provider takes a payment method
+func Supports(p Provider, method string) bool {
+	return slices.Contains(p.Methods(), method)
+}
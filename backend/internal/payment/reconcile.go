@@ -0,0 +1,188 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+const reconcileInterval = time.Minute
+
+// ReconcileResult sums up one reconciliation pass
+type ReconcileResult struct {
+	RanAt         time.Time `json:"ran_at"`
+	Checked       int       `json:"checked"`       // pending payments asked about
+	Updated       int       `json:"updated"`       // settled or failed by what the provider said
+	Expired       int       `json:"expired"`       // given up on
+	Discrepancies int       `json:"discrepancies"` // new ones, for review
+	Errors        int       `json:"errors"`        // providers that couldn't be asked
+	Refunds       int       `json:"refunds"`       // pending refunds sent again
+}
+
+// Reconciler settles pending payments whose callback never came. It asks the
+// provider about payments pending for longer than after, applies the answer
+// like a callback, and expires payments still open after expireAfter or past
+// their provider expiry. Refunds left pending by a provider error are sent
+// again until the provider answers.
+type Reconciler struct {
+	hub         *websocket.Hub
+	providers   *Registry
+	after       time.Duration
+	expireAfter time.Duration
+
+	mu   sync.Mutex // one pass at a time
+	last ReconcileResult
+}
+
+// NewReconciler creates a new reconciler
+func NewReconciler(hub *websocket.Hub, providers *Registry, after, expireAfter time.Duration) *Reconciler {
+	return &Reconciler{hub: hub, providers: providers, after: after, expireAfter: expireAfter}
+}
+
+// Run reconciles every minute until ctx is cancelled
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(reconcileInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			r.Reconcile(ctx, now)
+		}
+	}
+}
+
+// Last returns the latest pass
+func (r *Reconciler) Last() ReconcileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Reconcile checks every payment that has been pending for too long
+func (r *Reconciler) Reconcile(ctx context.Context, now time.Time) ReconcileResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := ReconcileResult{RanAt: now}
+	found := len(dummy.ListPaymentDiscrepancies("", "", nil))
+	for _, p := range dummy.PendingPayments(now.Add(-r.after)) {
+		res.Checked++
+		r.check(ctx, p, now, &res)
+	}
+	res.Discrepancies = len(dummy.ListPaymentDiscrepancies("", "", nil)) - found
+	for _, refund := range dummy.PendingRefunds(now.Add(-r.after)) {
+		res.Refunds++
+		r.retryRefund(ctx, refund, &res)
+	}
+
+	if res.Checked > 0 || res.Refunds > 0 {
+		log.Printf("Payment reconciliation: %d checked, %d updated, %d expired, %d discrepancies, %d refunds retried, %d errors",
+			res.Checked, res.Updated, res.Expired, res.Discrepancies, res.Refunds, res.Errors)
+	}
+	r.last = res
+	return res
+}
+
+func (r *Reconciler) check(ctx context.Context, p dummy.Payment, now time.Time, res *ReconcileResult) {
+	stale := now.Sub(p.CreatedAt) >= r.expireAfter || (p.ExpiresAt != nil && now.After(*p.ExpiresAt))
+
+	provider, ok := r.providers.Get(p.Provider)
+	if !ok {
+		reportDiscrepancy(p, dummy.DiscrepancyUnknownProvider, "No provider named "+p.Provider+" to ask about this payment", 0)
+		if stale {
+			r.expire(p, res)
+		}
+		return
+	}
+
+	u, err := provider.Status(ctx, p)
+	switch {
+	case err == nil:
+		updated, changed, err := Apply(r.hub, p.ID, u)
+		switch {
+		case err != nil:
+			// Amount mismatches and overpayments are reported by Apply. The
+			// money is sorted out by whoever reviews that; the payment is
+			// given up on like any other once it is stale.
+			if stale {
+				r.expire(p, res)
+			}
+		case changed:
+			res.Updated++
+		case updated.Status == dummy.PaymentPending && stale:
+			r.expire(updated, res)
+		}
+	case errors.Is(err, ErrNoStatus):
+		// The customer never got as far as paying
+		if stale {
+			r.expire(p, res)
+		}
+	default:
+		// The provider may well have the money, so nothing is expired on a guess
+		res.Errors++
+		log.Printf("Payment reconciliation: %s status for payment %s: %v", p.Provider, p.ID, err)
+		if stale {
+			reportDiscrepancy(p, dummy.DiscrepancyStatusUnavailable, "Still pending and "+p.Provider+" could not be asked: "+err.Error(), 0)
+		}
+	}
+}
+
+// expire gives up on a payment. If the customer pays after all, the provider's
+// report still settles it, and it is reported as paid after expiry.
+func (r *Reconciler) expire(p dummy.Payment, res *ReconcileResult) {
+	if _, changed, _ := Apply(r.hub, p.ID, dummy.PaymentUpdate{Status: dummy.PaymentExpired}); changed {
+		res.Expired++
+	}
+}
+
+// retryRefund sends a pending refund to its provider again. The refund's ID is
+// its refund key, so the provider gives the money back at most once however
+// often it is sent.
+func (r *Reconciler) retryRefund(ctx context.Context, refund dummy.Refund, res *ReconcileResult) {
+	p := dummy.GetPayment(refund.PaymentID)
+	provider, ok := r.providers.Get(refund.Provider)
+	if p == nil || !ok {
+		res.Errors++
+		log.Printf("Payment reconciliation: no payment or provider to retry refund %s", refund.ID)
+		return
+	}
+
+	out, err := provider.Refund(ctx, *p, RefundRequest{Ref: refund.ID, Amount: refund.Amount, Reason: refund.Reason})
+	switch {
+	case err == nil:
+		finished, order, err := dummy.FinishRefund(refund.ID, dummy.RefundOutcome{Status: out.Status, TransactionID: out.TransactionID, Manual: out.Manual, Message: out.Message})
+		if err == nil && finished.Status == dummy.PaymentSuccess {
+			PublishRefund(r.hub, finished, order)
+		}
+	case Refused(err):
+		dummy.FinishRefund(refund.ID, dummy.RefundOutcome{Status: dummy.PaymentFailed, Message: err.Error()})
+	default:
+		res.Errors++
+		log.Printf("Payment reconciliation: %s refund %s: %v", refund.Provider, refund.ID, err)
+	}
+}
+
+// reportDiscrepancy records something about a payment that needs a person
+func reportDiscrepancy(p dummy.Payment, kind, detail string, theirs int) {
+	d := dummy.PaymentDiscrepancy{
+		PaymentID: p.ID,
+		OrderID:   p.OrderID,
+		StoreID:   p.StoreID,
+		Provider:  p.Provider,
+		Kind:      kind,
+		Detail:    detail,
+	}
+	if theirs != 0 {
+		d.Ours, d.Theirs = p.Amount, theirs
+	}
+	if _, added := dummy.AddPaymentDiscrepancy(d); added {
+		log.Printf("Payment discrepancy (%s) on payment %s: %s", kind, p.ID, detail)
+	}
+}
@@ -0,0 +1,69 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/eventbus"
+	"github.com/kaori/backend/internal/websocket"
+)
+
+func newTestHub() *websocket.Hub {
+	hub := websocket.NewHub(eventbus.NewLocal(), websocket.HubOptions{})
+	go hub.Run()
+	return hub
+}
+
+// overchargingProvider reports every payment settled for 1,000 more
+type overchargingProvider struct{ SandboxProvider }
+
+func (p *overchargingProvider) Status(ctx context.Context, payment dummy.Payment) (dummy.PaymentUpdate, error) {
+	return dummy.PaymentUpdate{Status: dummy.PaymentSuccess, ProviderStatus: "settlement", Amount: payment.Amount + 1000}, nil
+}
+
+// pendingPayment adds an order and a pending payment for all of it
+func pendingPayment(t *testing.T, orderID, provider string, amount int) dummy.Payment {
+	t.Helper()
+	dummy.AddOrder(dummy.Order{ID: orderID, StoreID: dummy.DefaultStoreID, OrderNumber: orderID, Status: "pending", PaymentStatus: "unpaid", Subtotal: amount, Total: amount})
+	p, err := dummy.AddPayment(dummy.Payment{OrderID: orderID, StoreID: dummy.DefaultStoreID, Method: "qris", Amount: amount, Provider: provider})
+	if err != nil {
+		t.Fatalf("add payment: %v", err)
+	}
+	return p
+}
+
+func TestReconcileMismatchReportedOnce(t *testing.T) {
+	r := NewReconciler(newTestHub(), NewRegistry(&overchargingProvider{}), 0, time.Hour)
+	p := pendingPayment(t, "order-mismatch", ProviderSandbox, 20000)
+	now := time.Now().Add(time.Second)
+
+	if res := r.Reconcile(context.Background(), now); res.Discrepancies != 1 {
+		t.Fatalf("first pass found %d discrepancies, want 1", res.Discrepancies)
+	}
+	if got := dummy.GetPayment(p.ID); got.Status != dummy.PaymentPending {
+		t.Fatalf("payment is %s after a mismatch, want pending", got.Status)
+	}
+	open := dummy.ListPaymentDiscrepancies(dummy.DefaultStoreID, "", nil)
+	if _, err := dummy.ReviewPaymentDiscrepancy(open[len(open)-1].ID, "manager", "asked Midtrans"); err != nil {
+		t.Fatalf("review: %v", err)
+	}
+
+	if res := r.Reconcile(context.Background(), now); res.Discrepancies != 0 {
+		t.Errorf("pass after review found %d discrepancies, want the reviewed one left alone", res.Discrepancies)
+	}
+
+	res := r.Reconcile(context.Background(), now.Add(2*time.Hour))
+	if res.Discrepancies != 0 {
+		t.Errorf("stale pass: %+v, want nothing new reported", res)
+	}
+	if got := dummy.GetPayment(p.ID); got.Status != dummy.PaymentExpired {
+		t.Errorf("payment is %s once stale, want expired", got.Status)
+	}
+	for _, pending := range dummy.PendingPayments(now.Add(3 * time.Hour)) {
+		if pending.ID == p.ID {
+			t.Error("expired payment is still up for reconciliation")
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package payment
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/dummy"
+)
+
+// ProviderSandbox names the provider for training and demo stores
+const ProviderSandbox = "sandbox"
+
+// Test values for card_token or approval_code that make sandbox payments
+// decline or wait, instead of being approved
+const (
+	SandboxDecline = "decline"
+	SandboxPending = "pending"
+)
+
+// SandboxProvider approves every method at once without moving money, so new
+// staff can practise and demo stores can take orders end to end
+type SandboxProvider struct{}
+
+// NewSandboxProvider creates the sandbox provider
+func NewSandboxProvider() *SandboxProvider {
+	return &SandboxProvider{}
+}
+
+func (p *SandboxProvider) Name() string { return ProviderSandbox }
+
+func (p *SandboxProvider) Methods() []string { return []string{"qris", "card", "ewallet"} }
+
+func (p *SandboxProvider) Create(ctx context.Context, req ChargeRequest) (*Charge, error) {
+	charge := &Charge{
+		Status:         dummy.PaymentSuccess,
+		ProviderStatus: "approved",
+		TransactionID:  "sandbox-" + uuid.New().String()[:8],
+		Channel:        ProviderSandbox,
+		At:             time.Now(),
+	}
+	switch {
+	case req.CardToken == SandboxDecline || req.ApprovalCode == SandboxDecline:
+		charge.Status, charge.ProviderStatus = dummy.PaymentFailed, "declined"
+	case req.CardToken == SandboxPending || req.ApprovalCode == SandboxPending:
+		charge.Status, charge.ProviderStatus = dummy.PaymentPending, "pending"
+	}
+	return charge, nil
+}
+
+// Status never changes on its own: pending sandbox payments stay pending
+func (p *SandboxProvider) Status(ctx context.Context, payment dummy.Payment) (dummy.PaymentUpdate, error) {
+	return dummy.PaymentUpdate{Status: payment.Status, ProviderStatus: payment.ProviderStatus}, nil
+}
+
+func (p *SandboxProvider) Refund(ctx context.Context, payment dummy.Payment, req RefundRequest) (*Refund, error) {
+	return &Refund{Status: dummy.PaymentSuccess, TransactionID: "sandbox-refund-" + uuid.New().String()[:8]}, nil
+}
+
+func (p *SandboxProvider) ParseCallback(header http.Header, body []byte) (*Callback, error) {
+	return nil, ErrNoCallbacks
+}
@@ -0,0 +1,492 @@
+// Package webhooks sends real-time events to merchant systems that subscribed
+// to them, signed, retried with backoff and logged per delivery.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kaori/backend/internal/dummy"
+	"github.com/kaori/backend/internal/eventbus"
+)
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed" // out of attempts, or the subscription is gone
+)
+
+const (
+	defaultMaxAttempts = 10
+	defaultBaseDelay   = 5 * time.Second
+	defaultMaxDelay    = time.Hour
+	pollInterval       = time.Second
+	requestTimeout     = 10 * time.Second
+	maxConcurrent      = 8
+
+	// maxResponseBody caps how much of a receiver's answer is read before the
+	// connection is given up; none of it is kept
+	maxResponseBody = 1024
+
+	// How long finished webhooks stay in the log: delivered ones for a look,
+	// failed ones long enough to be replayed after the receiver is fixed
+	deliveredRetention = 72 * time.Hour
+	failedRetention    = 14 * 24 * time.Hour
+)
+
+// ErrNotFinished is returned when replaying a delivery that is still being retried
+var ErrNotFinished = errors.New("delivery is still being retried")
+
+// errBlockedAddress is returned for receivers on our own network
+var errBlockedAddress = errors.New("receiver is on a private, loopback or link-local address")
+
+// Payload is the body of every webhook
+type Payload struct {
+	ID         string          `json:"id"` // the event's ID: the same for every subscription and on replays
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	StoreID    string          `json:"store_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Attempt is one try at sending a delivery
+type Attempt struct {
+	At           time.Time `json:"at"`
+	ResponseCode int       `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+// Delivery is one event sent to one subscription
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	StoreID        string          `json:"store_id"`
+	URL            string          `json:"url"`
+	Body           json.RawMessage `json:"body"`
+	Status         string          `json:"status"`
+	Attempts       []Attempt       `json:"attempts"`
+	ResponseCode   int             `json:"response_code,omitempty"` // from the last attempt
+	LastError      string          `json:"last_error,omitempty"`
+	ReplayOf       string          `json:"replay_of,omitempty"` // original delivery when this is a replay
+	ReplayedBy     string          `json:"replayed_by,omitempty"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// Filter narrows List
+type Filter struct {
+	SubscriptionID string
+	StoreID        string
+	EventType      string
+	Status         string
+}
+
+// Dispatcher is a file-backed queue of webhook deliveries. Failed deliveries are
+// retried with exponential backoff and marked failed after MaxAttempts.
+type Dispatcher struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	// AllowPrivate lets webhooks go to loopback and private addresses, for
+	// receivers running next to a development server
+	AllowPrivate bool
+
+	client *http.Client
+
+	mu         sync.Mutex
+	path       string
+	deliveries []*Delivery
+	sending    map[string]bool
+	dirty      bool // changed since the log was last written
+	wake       chan struct{}
+
+	saveMu sync.Mutex // one write to the file at a time
+}
+
+// NewDispatcher loads any deliveries left in path
+func NewDispatcher(path string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		MaxAttempts: defaultMaxAttempts,
+		BaseDelay:   defaultBaseDelay,
+		MaxDelay:    defaultMaxDelay,
+		path:        path,
+		sending:     make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+	}
+	// The address is checked once DNS has answered, on every connection, so a
+	// name can't be pointed at our own network after the subscription is saved
+	dialer := &net.Dialer{Timeout: requestTimeout, Control: d.checkAddress}
+	d.client = &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			MaxIdleConnsPerHost: maxConcurrent,
+		},
+	}
+	if path == "" {
+		return d, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &d.deliveries); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Publish queues an event for every subscription that wants it
+func (d *Dispatcher) Publish(e eventbus.Event) {
+	subs := dummy.MatchingWebhookSubscriptions(e.StoreID, e.Type)
+	if len(subs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	eventID := uuid.New().String()
+	body, err := json.Marshal(Payload{
+		ID:         eventID,
+		Type:       e.Type,
+		Version:    e.Version,
+		StoreID:    e.StoreID,
+		OccurredAt: now,
+		Data:       e.Payload,
+	})
+	if err != nil {
+		log.Printf("Error encoding %s webhook: %v", e.Type, err)
+		return
+	}
+	d.mu.Lock()
+	for _, sub := range subs {
+		d.deliveries = append(d.deliveries, &Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			EventType:      e.Type,
+			StoreID:        e.StoreID,
+			URL:            sub.URL,
+			Body:           body,
+			Status:         StatusPending,
+			Attempts:       []Attempt{},
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		})
+	}
+	d.saveLocked()
+	d.mu.Unlock()
+	d.notify()
+}
+
+// List returns deliveries matching f, newest first
+func (d *Dispatcher) List(f Filter) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := []Delivery{}
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		del := d.deliveries[i]
+		if (f.SubscriptionID != "" && del.SubscriptionID != f.SubscriptionID) ||
+			(f.StoreID != "" && del.StoreID != f.StoreID) ||
+			(f.EventType != "" && del.EventType != f.EventType) ||
+			(f.Status != "" && del.Status != f.Status) {
+			continue
+		}
+		result = append(result, *del)
+	}
+	return result
+}
+
+// Get returns a delivery by ID
+func (d *Dispatcher) Get(id string) *Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, del := range d.deliveries {
+		if del.ID == id {
+			found := *del
+			return &found
+		}
+	}
+	return nil
+}
+
+// Replay sends a finished delivery's event again, as a new delivery with the
+// same event ID, to the subscription's current URL
+func (d *Dispatcher) Replay(id, userID string) (*Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, del := range d.deliveries {
+		if del.ID != id {
+			continue
+		}
+		if del.Status == StatusPending {
+			return nil, ErrNotFinished
+		}
+		sub := dummy.GetWebhookSubscription(del.SubscriptionID)
+		if sub == nil {
+			return nil, fmt.Errorf("subscription %s no longer exists", del.SubscriptionID)
+		}
+
+		now := time.Now()
+		replay := &Delivery{
+			ID:             uuid.New().String(),
+			SubscriptionID: del.SubscriptionID,
+			EventID:        del.EventID,
+			EventType:      del.EventType,
+			StoreID:        del.StoreID,
+			URL:            sub.URL,
+			Body:           del.Body,
+			Status:         StatusPending,
+			Attempts:       []Attempt{},
+			ReplayOf:       del.ID,
+			ReplayedBy:     userID,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		d.deliveries = append(d.deliveries, replay)
+		d.saveLocked()
+		d.notify()
+		result := *replay
+		return &result, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Run sends due deliveries until ctx is cancelled. The log is written to
+// disk from here, at most once a round, rather than on every change.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(ctx)
+		d.save()
+		select {
+		case <-ctx.Done():
+			d.save()
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// sendDue starts sending what is due, up to maxConcurrent requests at once. It
+// doesn't wait for them: one slow receiver holds a slot, not the next round.
+func (d *Dispatcher) sendDue(ctx context.Context) {
+	now := time.Now()
+	d.mu.Lock()
+	due := []*Delivery{}
+	for _, del := range d.deliveries {
+		if len(d.sending) >= maxConcurrent {
+			break
+		}
+		if del.Status == StatusPending && !del.NextAttemptAt.After(now) && !d.sending[del.ID] {
+			d.sending[del.ID] = true
+			due = append(due, del)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, del := range due {
+		go func(del *Delivery) {
+			d.attempt(ctx, del)
+			d.notify() // a slot is free
+		}(del)
+	}
+}
+
+// attempt sends a delivery once and records the outcome
+func (d *Dispatcher) attempt(ctx context.Context, del *Delivery) {
+	d.mu.Lock()
+	id, subscriptionID, url, eventType, body := del.ID, del.SubscriptionID, del.URL, del.EventType, del.Body
+	d.mu.Unlock()
+
+	start := time.Now()
+	code, err := d.send(ctx, subscriptionID, id, url, eventType, body)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sending, id)
+
+	a := Attempt{At: start, ResponseCode: code, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		a.Error = err.Error()
+	}
+	del.Attempts = append(del.Attempts, a)
+	del.ResponseCode, del.LastError = code, a.Error
+	del.UpdatedAt = time.Now()
+
+	var gone *subscriptionGone
+	switch {
+	case err == nil:
+		del.Status = StatusDelivered
+		del.DeliveredAt = &del.UpdatedAt
+		log.Printf("Sent %s webhook %s to %s", eventType, id, url)
+	case errors.As(err, &gone) || len(del.Attempts) >= d.MaxAttempts:
+		del.Status = StatusFailed
+		log.Printf("Gave up on %s webhook %s to %s: %v", eventType, id, url, err)
+	default:
+		del.NextAttemptAt = time.Now().Add(d.backoff(len(del.Attempts)))
+	}
+	d.saveLocked()
+}
+
+// subscriptionGone means a delivery can't be sent anymore
+type subscriptionGone struct{ reason string }
+
+func (e *subscriptionGone) Error() string { return e.reason }
+
+// send posts a webhook signed with the subscription's current secret. Any
+// answer other than 2xx is an error and is retried.
+func (d *Dispatcher) send(ctx context.Context, subscriptionID, id, url, eventType string, body []byte) (int, error) {
+	sub := dummy.GetWebhookSubscription(subscriptionID)
+	if sub == nil {
+		return 0, &subscriptionGone{"subscription was deleted"}
+	}
+	if !sub.IsActive {
+		return 0, &subscriptionGone{"subscription is paused"}
+	}
+
+	reqCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, &subscriptionGone{err.Error()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Kaori-Webhooks/1")
+	req.Header.Set(HeaderEvent, eventType)
+	req.Header.Set(HeaderDelivery, id)
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// checkAddress refuses connections to loopback, private, link-local and
+// unspecified addresses unless AllowPrivate is set
+func (d *Dispatcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	if d.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() {
+		return errBlockedAddress
+	}
+	return nil
+}
+
+// backoff doubles the delay per attempt, capped at MaxDelay, with up to 20% jitter
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay << uint(attempts-1)
+	if delay <= 0 || delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay + time.Duration(rand.Int63n(int64(delay)/5+1))
+}
+
+// saveLocked prunes old finished webhooks and marks the log for the next
+// write. Callers hold d.mu.
+func (d *Dispatcher) saveLocked() {
+	now := time.Now()
+	kept := d.deliveries[:0]
+	for _, del := range d.deliveries {
+		if (del.Status == StatusDelivered && del.UpdatedAt.Before(now.Add(-deliveredRetention))) ||
+			(del.Status == StatusFailed && del.UpdatedAt.Before(now.Add(-failedRetention))) {
+			continue
+		}
+		kept = append(kept, del)
+	}
+	d.deliveries = kept
+	d.dirty = true
+}
+
+// save writes the log to disk if it changed. The deliveries are copied under
+// d.mu and encoded and written without it, so sends and publishes don't wait
+// on the disk.
+func (d *Dispatcher) save() {
+	if d.path == "" {
+		return
+	}
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+
+	d.mu.Lock()
+	if !d.dirty {
+		d.mu.Unlock()
+		return
+	}
+	d.dirty = false
+	snapshot := make([]Delivery, len(d.deliveries))
+	for i, del := range d.deliveries {
+		snapshot[i] = *del
+		snapshot[i].Attempts = append([]Attempt(nil), del.Attempts...)
+	}
+	d.mu.Unlock()
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding webhook deliveries: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+		log.Printf("Error creating webhook delivery directory: %v", err)
+		return
+	}
+	tmp := d.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		log.Printf("Error writing webhook deliveries: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		log.Printf("Error saving webhook deliveries: %v", err)
+	}
+}
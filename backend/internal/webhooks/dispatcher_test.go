@@ -0,0 +1,31 @@
+package webhooks
+
+import "testing"
+
+func TestCheckAddress(t *testing.T) {
+	d, err := NewDispatcher("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for addr, blocked := range map[string]bool{
+		"127.0.0.1:443":       true,
+		"10.1.2.3:443":        true,
+		"192.168.1.10:80":     true,
+		"169.254.169.254:80":  true,
+		"[::1]:443":           true,
+		"[fe80::1]:443":       true,
+		"[::ffff:10.0.0.1]:0": true,
+		"0.0.0.0:80":          true,
+		"203.0.113.7:443":     false,
+		"[2001:db8::1]:443":   false,
+	} {
+		if err := d.checkAddress("tcp", addr, nil); (err != nil) != blocked {
+			t.Errorf("checkAddress(%s) = %v, want blocked %v", addr, err, blocked)
+		}
+	}
+
+	d.AllowPrivate = true
+	if err := d.checkAddress("tcp", "127.0.0.1:8080", nil); err != nil {
+		t.Errorf("loopback with AllowPrivate: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package websocket
+
+// Topics a client can subscribe to within its store. Clients start out subscribed
+// to TopicStore and their own role; a kitchen display for one station would
+// unsubscribe from those and subscribe to its station instead.
+const (
+	TopicStore = "store" // everything for the store's staff screens
+)
+
+// RoleTopic is every client signed in with role
+func RoleTopic(role string) string { return "role:" + role }
+
+// StationTopic is a kitchen station's display, e.g. station:bar
+func StationTopic(station string) string { return "station:" + station }
+
+// OrderTopic is a single order, e.g. the customer's tracking page
+func OrderTopic(orderID string) string { return "order:" + orderID }
+
+// Audience is who a message is for: clients of one store subscribed to any of
+// the topics. Messages never cross stores.
+type Audience struct {
+	StoreID string
+	Topics  []string
+}
+
+// ToStore addresses all of a store's staff screens
+func ToStore(storeID string) Audience {
+	return Audience{StoreID: storeID, Topics: []string{TopicStore}}
+}
+
+// ToRoles addresses clients of a store signed in with one of the roles
+func ToRoles(storeID string, roles ...string) Audience {
+	a := Audience{StoreID: storeID}
+	for _, r := range roles {
+		a.Topics = append(a.Topics, RoleTopic(r))
+	}
+	return a
+}
+
+// ToKitchen addresses a store's kitchen screens and managers, plus the displays
+// of the stations involved
+func ToKitchen(storeID string, stations ...string) Audience {
+	return ToRoles(storeID, "kitchen", "store_admin", "super_admin").WithStations(stations...)
+}
+
+// ToOrder addresses everyone following one order: staff screens, the stations
+// preparing it and the customer's tracking page
+func ToOrder(storeID, orderID string, stations ...string) Audience {
+	return ToStore(storeID).WithStations(stations...).With(OrderTopic(orderID))
+}
+
+// With adds topics to the audience
+func (a Audience) With(topics ...string) Audience {
+	a.Topics = append(append([]string{}, a.Topics...), topics...)
+	return a
+}
+
+// WithStations adds kitchen station displays to the audience
+func (a Audience) WithStations(stations ...string) Audience {
+	for _, s := range stations {
+		a = a.With(StationTopic(s))
+	}
+	return a
+}
@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwtutil "github.com/kaori/backend/pkg/jwt"
+)
+
+const (
+	// TicketTTL is how long a connection ticket can be redeemed
+	TicketTTL = 30 * time.Second
+
+	// authTimeout is how long a socket without a ticket has to send its token
+	authTimeout = 10 * time.Second
+
+	// Close codes in the application range, so clients can tell them apart
+	CloseTokenExpired = 4001
+	CloseTooSlow      = 4002 // the client fell too far behind; reconnect with last_seq
+	CloseUnauthorized = 4003
+)
+
+// ErrInvalidTicket is returned for unknown, used or expired tickets
+var ErrInvalidTicket = errors.New("invalid or expired ticket")
+
+// Identity is who a socket belongs to, taken from their access token
+type Identity struct {
+	UserID    string
+	Role      string
+	StoreID   string
+	OrderID   string    // customer tracking pages follow only this order
+	ExpiresAt time.Time // when the access token expires; the socket closes then
+}
+
+type ticket struct {
+	identity  Identity
+	expiresAt time.Time
+}
+
+// Authenticator checks the origin and access token of WebSocket connections.
+// Browsers can't set an Authorization header on a WebSocket, so clients either
+// exchange their token for a single-use ticket and pass it as ?ticket=, or send
+// {"type":"auth","token":"..."} as their first message.
+type Authenticator struct {
+	secret       string
+	origins      map[string]bool
+	anyOrig      bool
+	defaultStore string
+
+	mu      sync.Mutex
+	tickets map[string]ticket
+}
+
+// NewAuthenticator creates an authenticator for tokens signed with secret,
+// accepting connections from the given CORS origins. Users whose token names
+// no store are connected to defaultStore.
+func NewAuthenticator(secret string, allowedOrigins []string, defaultStore string) *Authenticator {
+	a := &Authenticator{secret: secret, origins: make(map[string]bool), defaultStore: defaultStore, tickets: make(map[string]ticket)}
+	for _, o := range allowedOrigins {
+		o = strings.TrimRight(strings.TrimSpace(o), "/")
+		if o == "*" {
+			a.anyOrig = true
+		}
+		a.origins[o] = true
+	}
+	return a
+}
+
+// CheckOrigin allows browsers on an allowed origin, and clients that send no
+// Origin header at all (native apps, kitchen display devices)
+func (a *Authenticator) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || a.anyOrig || a.origins[strings.TrimRight(origin, "/")]
+}
+
+// IssueTicket creates a single-use ticket for an authenticated user
+func (a *Authenticator) IssueTicket(id Identity) (string, time.Time, error) {
+	if id.StoreID == "" {
+		id.StoreID = a.defaultStore
+	}
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	value := hex.EncodeToString(buf)
+	now := time.Now()
+	expiresAt := now.Add(TicketTTL)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, t := range a.tickets {
+		if now.After(t.expiresAt) {
+			delete(a.tickets, k)
+		}
+	}
+	a.tickets[value] = ticket{identity: id, expiresAt: expiresAt}
+	return value, expiresAt, nil
+}
+
+// redeemTicket returns a ticket's identity and removes it
+func (a *Authenticator) redeemTicket(value string) (Identity, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok := a.tickets[value]
+	if !ok {
+		return Identity{}, ErrInvalidTicket
+	}
+	delete(a.tickets, value)
+	if time.Now().After(t.expiresAt) || time.Now().After(t.identity.ExpiresAt) {
+		return Identity{}, ErrInvalidTicket
+	}
+	return t.identity, nil
+}
+
+// parseToken validates an access token
+func (a *Authenticator) parseToken(token string) (Identity, error) {
+	claims, err := jwtutil.ParseToken(token, a.secret)
+	if err != nil {
+		return Identity{}, err
+	}
+	if claims.ExpiresAt == nil {
+		return Identity{}, errors.New("token has no expiry")
+	}
+	id := Identity{
+		UserID:    claims.UserID,
+		Role:      claims.Role,
+		StoreID:   claims.StoreID,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if id.StoreID == "" {
+		id.StoreID = a.defaultStore
+	}
+	return id, nil
+}
+
+// requestIdentity authenticates a plain HTTP request, such as an event stream,
+// by its ?ticket= or its Authorization: Bearer header
+func (a *Authenticator) requestIdentity(r *http.Request) (Identity, error) {
+	if value := r.URL.Query().Get("ticket"); value != "" {
+		return a.redeemTicket(value)
+	}
+	header := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(header, "Bearer "); ok && token != "" {
+		return a.parseToken(token)
+	}
+	return Identity{}, errors.New("authorization required")
+}
@@ -0,0 +1,107 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+)
+
+// Commands kitchen displays send over the socket instead of calling the REST API
+const (
+	CommandBump        = "bump"        // move an order to its next kitchen status
+	CommandRecall      = "recall"      // undo the last bump
+	CommandAcknowledge = "acknowledge" // the kitchen has seen a new order
+	CommandItemReady   = "item_ready"  // one line of an order is ready
+)
+
+// MessageTypeAck answers a command that succeeded. Failed commands get a
+// MessageTypeError; both carry the command's request_id.
+const MessageTypeAck = "ack"
+
+// Error codes in command replies
+const (
+	ErrCodeBadRequest        = "bad_request"
+	ErrCodeForbidden         = "forbidden"
+	ErrCodeNotFound          = "not_found"
+	ErrCodeInvalidTransition = "invalid_transition"
+	ErrCodeUnavailable       = "unavailable"
+)
+
+// Command is an action a client asks for over the socket
+type Command struct {
+	Name      string
+	RequestID string
+	OrderID   string
+	ItemID    string
+}
+
+// Sender is who sent a command, as authenticated when the socket connected
+type Sender struct {
+	UserID  string
+	Role    string
+	StoreID string
+}
+
+// CommandError is a failed command, with a code clients can act on
+type CommandError struct {
+	Code    string
+	Message string
+}
+
+func (e *CommandError) Error() string { return e.Message }
+
+// CommandHandler carries out a command and returns the result sent in the ack
+type CommandHandler func(from Sender, cmd Command) (interface{}, error)
+
+// HandleCommands sets what carries out commands from clients
+func (h *Hub) HandleCommands(handler CommandHandler) {
+	h.commandsMu.Lock()
+	defer h.commandsMu.Unlock()
+	h.commands = handler
+}
+
+func isCommand(messageType string) bool {
+	switch messageType {
+	case CommandBump, CommandRecall, CommandAcknowledge, CommandItemReady:
+		return true
+	}
+	return false
+}
+
+// runCommand carries out a client's command and answers it
+func (c *Client) runCommand(msg clientMessage) {
+	c.Hub.commandsMu.RLock()
+	handler := c.Hub.commands
+	c.Hub.commandsMu.RUnlock()
+
+	fail := func(code, message string) {
+		c.reply(MessageTypeError, map[string]string{"request_id": msg.RequestID, "code": code, "message": message})
+	}
+	switch {
+	case msg.RequestID == "":
+		fail(ErrCodeBadRequest, "request_id is required")
+		return
+	case c.orderID != "":
+		fail(ErrCodeForbidden, "order tracking connections can't send commands")
+		return
+	case handler == nil:
+		fail(ErrCodeUnavailable, "commands are not available")
+		return
+	}
+
+	result, err := handler(Sender{UserID: c.UserID, Role: c.Role, StoreID: c.StoreID}, Command{
+		Name:      msg.Type,
+		RequestID: msg.RequestID,
+		OrderID:   msg.OrderID,
+		ItemID:    msg.ItemID,
+	})
+	if err != nil {
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			log.Printf("Command %s from user=%s failed: %v", msg.Type, c.UserID, err)
+			cmdErr = &CommandError{Code: ErrCodeUnavailable, Message: "command failed"}
+		}
+		fail(cmdErr.Code, cmdErr.Message)
+		return
+	}
+	c.reply(MessageTypeAck, map[string]interface{}{"request_id": msg.RequestID, "command": msg.Type, "result": result})
+}
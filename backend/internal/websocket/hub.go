@@ -2,224 +2,539 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/kaori/backend/internal/eventbus"
+	"github.com/kaori/backend/internal/events"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins (configure properly in production)
-	},
-}
+const (
+	// writeWait is how long a write to a client may take
+	writeWait = 10 * time.Second
+
+	// pongWait is how long a client may stay silent; pings keep it talking
+	pongWait   = 60 * time.Second
+	pingPeriod = (pongWait * 9) / 10
+
+	// maxMessageSize caps messages from clients
+	maxMessageSize = 4096
+)
 
 // Message types
 const (
-	MessageTypeNewOrder    = "new_order"
-	MessageTypeOrderUpdate = "order_update"
-	MessageTypePayment     = "payment"
+	// Connection authentication: the client's first message, and our answer
+	MessageTypeAuth   = "auth"
+	MessageTypeAuthOK = "auth_ok"
+
+	// Topic subscriptions: client requests, and the topics it has afterwards
+	MessageTypeSubscribe   = "subscribe"
+	MessageTypeUnsubscribe = "unsubscribe"
+	MessageTypeSubscribed  = "subscribed"
+	MessageTypeError       = "error"
 )
 
-// Message represents a WebSocket message
+// Message represents a WebSocket message. Events are typed in the events
+// catalog, which has their payloads; the other messages belong to the
+// connection itself.
 type Message struct {
 	Type    string      `json:"type"`
+	Version int         `json:"version,omitempty"` // the event's schema version
 	Payload interface{} `json:"payload"`
 	StoreID string      `json:"store_id"`
+	Seq     uint64      `json:"seq,omitempty"` // per-store event number; replies to the client have none
 }
 
 // Client represents a WebSocket client
 type Client struct {
 	Hub     *Hub
 	Conn    *websocket.Conn
-	Send    chan []byte
+	UserID  string
 	StoreID string
 	Role    string
+	Device  string // name the device gave itself, e.g. "Bar display"
+
+	queue *sendQueue // messages waiting to be written
+
+	connectedAt time.Time
+	lastSeen    atomic.Int64 // unix nanoseconds of the last message or pong
+
+	auth      *Authenticator
+	expiresAt time.Time
+	renew     chan time.Time // new token expiry after the client re-authenticates
+
+	orderID string // set for customer tracking pages, which only ever see this order
+	subMu   sync.RWMutex
+	topics  map[string]bool
+}
+
+// clientMessage is a message from a client: its access token, first to
+// authenticate and later to keep the socket open past the old token's expiry,
+// a change to its topic subscriptions, or a command
+type clientMessage struct {
+	Type   string   `json:"type"`
+	Token  string   `json:"token,omitempty"`
+	Topics []string `json:"topics,omitempty"`
+
+	// Commands: the client's ID for matching the reply, and what it acts on
+	RequestID string `json:"request_id,omitempty"`
+	OrderID   string `json:"order_id,omitempty"`
+	ItemID    string `json:"item_id,omitempty"`
+
+	// Connecting clients may name their device for the presence list
+	Device string `json:"device,omitempty"`
+
+	// Where a reconnecting client left off, if not given in the URL
+	Stream  string  `json:"stream,omitempty"`
+	LastSeq *uint64 `json:"last_seq,omitempty"`
 }
 
-// Hub manages WebSocket connections
+// Hub manages WebSocket connections. Events go through the bus, which brings
+// back everything published on any instance for the clients connected here.
+//
+// The clients and event streams belong to the goroutine running Run: everything
+// that reads or changes them is sent there, so nothing else needs to lock them.
 type Hub struct {
+	bus eventbus.Bus
+
 	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
+	events     chan eventbus.Event
+	ops        chan op
 	unregister chan *Client
-	mutex      sync.RWMutex
+
+	// Numbered recent events per store, for clients that reconnect. The stream
+	// ID changes on restart, when numbering starts over.
+	streamID string
+	streams  map[string]*storeStream
+
+	// Slow clients: how many messages may wait for each, and what happens then
+	queueSize int
+	policy    string
+
+	published       uint64
+	dropped         uint64 // from clients that have since disconnected
+	slowDisconnects uint64
+
+	commandsMu sync.RWMutex
+	commands   CommandHandler
+
+	observersMu sync.RWMutex
+	observers   []func(eventbus.Event)
+}
+
+// HubOptions tune how the hub treats clients that can't keep up
+type HubOptions struct {
+	QueueSize        int    // messages waiting per client, DefaultQueueSize if 0
+	SlowClientPolicy string // PolicyDropOldest (default) or PolicyDisconnect
+}
+
+// op is work for the hub's goroutine; done is closed when it has run
+type op struct {
+	fn   func()
+	done chan struct{}
 }
 
-// NewHub creates a new Hub
-func NewHub() *Hub {
-	return &Hub{
+// NewHub creates a new Hub on an event bus
+func NewHub(bus eventbus.Bus, opts HubOptions) *Hub {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.SlowClientPolicy != PolicyDisconnect {
+		opts.SlowClientPolicy = PolicyDropOldest
+	}
+	h := &Hub{
+		bus:        bus,
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
+		events:     make(chan eventbus.Event, 1024),
+		ops:        make(chan op),
 		unregister: make(chan *Client),
+		streamID:   newStreamID(),
+		streams:    make(map[string]*storeStream),
+		queueSize:  opts.QueueSize,
+		policy:     opts.SlowClientPolicy,
 	}
+	bus.Subscribe(func(e eventbus.Event) { h.events <- e })
+	return h
 }
 
 // Run starts the hub
 func (h *Hub) Run() {
 	for {
 		select {
-		case client := <-h.register:
-			h.mutex.Lock()
-			h.clients[client] = true
-			h.mutex.Unlock()
-			log.Printf("Client connected: store=%s, role=%s", client.StoreID, client.Role)
+		case o := <-h.ops:
+			o.fn()
+			close(o.done)
 
 		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
-			h.mutex.Unlock()
-			log.Printf("Client disconnected: store=%s", client.StoreID)
+			h.remove(client, "")
 
-		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
-				}
-			}
-			h.mutex.RUnlock()
+		case e := <-h.events:
+			h.deliver(e)
 		}
 	}
 }
 
-// BroadcastOrder broadcasts an order-related message to all connected clients
-func (h *Hub) BroadcastOrder(orderID string, messageType string, payload interface{}) {
-	message := Message{
-		Type:    messageType,
-		Payload: payload,
-		StoreID: "store-1", // Default store for dummy data
+// do runs fn on the hub's goroutine and waits for it
+func (h *Hub) do(fn func()) {
+	done := make(chan struct{})
+	h.ops <- op{fn: fn, done: done}
+	<-done
+}
+
+// register adds a client before its pumps start, so replies to its first
+// messages aren't dropped. The client is greeted with auth_ok, which has the
+// store's current sequence number, followed by anything it missed since from.
+func (h *Hub) register(client *Client, from *Resume) error {
+	client.queue = newSendQueue(h.queueSize, h.policy)
+	var err error
+	h.do(func() {
+		welcome := map[string]interface{}{"user_id": client.UserID, "role": client.Role, "expires_at": client.expiresAt, "topics": client.Topics()}
+		welcome["stream"] = h.streamID
+		welcome["seq"] = h.stream(client.StoreID).seq
+		var data []byte
+		if data, err = json.Marshal(Message{Type: MessageTypeAuthOK, StoreID: client.StoreID, Payload: welcome}); err != nil {
+			return
+		}
+		client.queue.push(data)
+		h.replay(client, from)
+		h.clients[client] = true
+	})
+	if err == nil {
+		log.Printf("Client connected: user=%s, store=%s, role=%s, device=%q", client.UserID, client.StoreID, client.Role, client.Device)
 	}
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling order message: %v", err)
+	return err
+}
+
+// remove disconnects a client, telling it why if the hub is the one closing it.
+// Runs on the hub's goroutine.
+func (h *Hub) remove(client *Client, reason string) {
+	if !h.clients[client] {
 		return
 	}
+	delete(h.clients, client)
+	_, dropped := client.queue.depth()
+	h.dropped += dropped
+	client.queue.close(reason)
+	log.Printf("Client disconnected: user=%s, store=%s", client.UserID, client.StoreID)
+}
 
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+// Publish sends an event to the clients of aud.StoreID subscribed to any of
+// aud.Topics, on every instance. Only events in the catalog are sent.
+func (h *Hub) Publish(aud Audience, e events.Event) {
+	def, ok := events.Lookup(e.EventType())
+	if !ok {
+		log.Printf("Not publishing %s: not in the event catalog", e.EventType())
+		return
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("Error marshaling %s message: %v", def.Type, err)
+		return
+	}
+	event := eventbus.Event{StoreID: aud.StoreID, Topics: aud.Topics, Type: def.Type, Version: def.Version, Payload: data}
+	if err := h.bus.Publish(event); err != nil {
+		log.Printf("Error publishing %s message: %v", def.Type, err)
+	}
 
-	for client := range h.clients {
-		select {
-		case client.Send <- data:
-		default:
-			close(client.Send)
-			delete(h.clients, client)
-		}
+	h.observersMu.RLock()
+	defer h.observersMu.RUnlock()
+	for _, fn := range h.observers {
+		fn(event)
 	}
-	log.Printf("Broadcasted %s for order %s", messageType, orderID)
 }
 
-// BroadcastToStore sends a message to all clients of a specific store
-func (h *Hub) BroadcastToStore(storeID string, message Message) {
-	data, err := json.Marshal(message)
+// OnPublish calls fn with every event published on this instance. Events from
+// other instances don't reach it, so each event is seen once however many
+// instances there are.
+func (h *Hub) OnPublish(fn func(eventbus.Event)) {
+	h.observersMu.Lock()
+	defer h.observersMu.Unlock()
+	h.observers = append(h.observers, fn)
+}
+
+// deliver sends an event from the bus to this instance's clients, numbering it
+// in the store's event stream. Runs on the hub's goroutine.
+func (h *Hub) deliver(e eventbus.Event) {
+	data, err := h.stream(e.StoreID).append(e.Topics, Message{Type: e.Type, Version: e.Version, Payload: e.Payload, StoreID: e.StoreID})
 	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
+		log.Printf("Error marshaling %s message: %v", e.Type, err)
 		return
 	}
+	h.published++
 
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
-
+	sent := 0
 	for client := range h.clients {
-		if client.StoreID == storeID {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
+		if client.StoreID != e.StoreID || !client.subscribedToAny(e.Topics) {
+			continue
 		}
+		h.push(client, data)
+		sent++
 	}
+	log.Printf("Published %s to %d client(s) of store %s", e.Type, sent, e.StoreID)
 }
 
-// BroadcastToKitchen sends a message to kitchen clients of a specific store
-func (h *Hub) BroadcastToKitchen(storeID string, message Message) {
-	data, err := json.Marshal(message)
-	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
-		return
+// push queues a message for a client, disconnecting it if it has fallen too far
+// behind under PolicyDisconnect. Runs on the hub's goroutine.
+func (h *Hub) push(client *Client, data []byte) {
+	if !client.queue.push(data) {
+		h.slowDisconnects++
+		h.remove(client, "too slow")
 	}
+}
 
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+// sendTo queues a message for one client, if it is still connected
+func (h *Hub) sendTo(client *Client, data []byte) {
+	h.do(func() {
+		if h.clients[client] {
+			h.push(client, data)
+		}
+	})
+}
 
-	for client := range h.clients {
-		if client.StoreID == storeID && (client.Role == "kitchen" || client.Role == "store_admin" || client.Role == "super_admin") {
-			select {
-			case client.Send <- data:
-			default:
-				close(client.Send)
-				delete(h.clients, client)
-			}
+// ServeWS handles WebSocket connections. The connection is authenticated with
+// a ticket (?ticket=) or an auth message, and its store and role come from the
+// user's access token. Super admins may pick a store with ?store_id=.
+// Clients may connect straight onto their topics with ?topics=, and
+// reconnecting clients pass ?stream=&last_seq= from the last message they saw
+// to have what they missed replayed.
+func ServeWS(hub *Hub, auth *Authenticator, w http.ResponseWriter, r *http.Request) {
+	var identity Identity
+	from := parseResume(r.URL.Query().Get("stream"), r.URL.Query().Get("last_seq"))
+	var topics []string
+	device := r.URL.Query().Get("device")
+	if t := r.URL.Query().Get("topics"); t != "" {
+		topics = strings.Split(t, ",")
+	}
+	ticketed := false
+	if value := r.URL.Query().Get("ticket"); value != "" {
+		id, err := auth.redeemTicket(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
 		}
+		identity, ticketed = id, true
 	}
-}
 
-// ServeWS handles WebSocket connections
-func ServeWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     auth.CheckOrigin,
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
 
-	// Get store_id and role from query params
-	storeID := r.URL.Query().Get("store_id")
-	role := r.URL.Query().Get("role")
+	if !ticketed {
+		var msg clientMessage
+		identity, msg, err = readAuthMessage(conn, auth)
+		if err != nil {
+			closeConn(conn, CloseUnauthorized, "authentication required")
+			return
+		}
+		if msg.LastSeq != nil {
+			from = &Resume{Stream: msg.Stream, LastSeq: *msg.LastSeq}
+		}
+		if len(msg.Topics) > 0 {
+			topics = msg.Topics
+		}
+		if msg.Device != "" {
+			device = msg.Device
+		}
+	}
 
-	client := &Client{
-		Hub:     hub,
-		Conn:    conn,
-		Send:    make(chan []byte, 256),
-		StoreID: storeID,
-		Role:    role,
+	client, err := newClient(hub, auth, conn, identity, r.URL.Query().Get("store_id"), device, topics)
+	if err != nil {
+		closeConn(conn, websocket.ClosePolicyViolation, err.Error())
+		return
 	}
 
-	hub.register <- client
+	if err := hub.register(client, from); err != nil {
+		log.Printf("WebSocket register error: %v", err)
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
 }
 
+// newClient creates the hub client for an authenticated connection, on the
+// topics it asked for. conn is nil for Server-Sent Events subscribers. Super
+// admins may pick the store with requestedStore.
+func newClient(hub *Hub, auth *Authenticator, conn *websocket.Conn, identity Identity, requestedStore, device string, topics []string) (*Client, error) {
+	storeID := identity.StoreID
+	if requestedStore != "" && identity.Role == "super_admin" {
+		storeID = requestedStore
+	}
+
+	client := &Client{
+		Hub:       hub,
+		Conn:      conn,
+		UserID:    identity.UserID,
+		StoreID:   storeID,
+		Role:      identity.Role,
+		Device:    truncate(device, 64),
+		auth:      auth,
+		expiresAt: identity.ExpiresAt,
+		renew:     make(chan time.Time, 1),
+		orderID:   identity.OrderID,
+
+		connectedAt: time.Now(),
+	}
+	client.seen()
+	client.topics = client.defaultTopics()
+	if err := client.setTopics(topics); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// readAuthMessage waits for a socket's first message to be a valid auth message
+func readAuthMessage(conn *websocket.Conn, auth *Authenticator) (Identity, clientMessage, error) {
+	var msg clientMessage
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		return Identity{}, msg, err
+	}
+	if err := json.Unmarshal(data, &msg); err != nil || msg.Type != MessageTypeAuth {
+		return Identity{}, msg, errors.New("first message must be an auth message")
+	}
+	identity, err := auth.parseToken(msg.Token)
+	if err != nil {
+		return Identity{}, msg, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return identity, msg, nil
+}
+
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+	conn.Close()
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.Hub.unregister <- c
 		c.Conn.Close()
 	}()
 
+	// A client that neither answers pings nor sends anything for pongWait is gone,
+	// even if its TCP connection was never closed
+	c.Conn.SetReadLimit(maxMessageSize)
+	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.Conn.SetPongHandler(func(string) error {
+		c.seen()
+		return c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		_, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+		c.seen()
+		c.Conn.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg clientMessage
+		if json.Unmarshal(data, &msg) != nil {
+			continue
+		}
+		switch msg.Type {
+		case MessageTypeAuth:
+			// A refreshed token for the same user keeps the socket open longer
+			if identity, err := c.auth.parseToken(msg.Token); err == nil && identity.UserID == c.UserID {
+				select {
+				case c.renew <- identity.ExpiresAt:
+				default:
+				}
+			}
+		case MessageTypeSubscribe, MessageTypeUnsubscribe:
+			if err := c.changeTopics(msg.Type == MessageTypeSubscribe, msg.Topics); err != nil {
+				c.reply(MessageTypeError, map[string]string{"message": err.Error()})
+				continue
+			}
+			c.reply(MessageTypeSubscribed, map[string][]string{"topics": c.Topics()})
+		default:
+			if isCommand(msg.Type) {
+				c.runCommand(msg)
+			}
+		}
 	}
 }
 
 func (c *Client) writePump() {
-	defer c.Conn.Close()
+	expiry := time.NewTimer(time.Until(c.expiresAt))
+	ping := time.NewTicker(pingPeriod)
+	defer func() {
+		expiry.Stop()
+		ping.Stop()
+		c.Conn.Close()
+	}()
 
 	for {
-		message, ok := <-c.Send
-		if !ok {
-			c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-			return
-		}
+		select {
+		case <-c.queue.ready:
+			messages, behind, closed := c.queue.take()
+			for _, message := range messages {
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					return
+				}
+			}
+			if behind {
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.Conn.WriteMessage(websocket.TextMessage, c.resyncMessage("fell behind")); err != nil {
+					return
+				}
+			}
+			if closed {
+				if reason := c.queue.closeReason(); reason != "" {
+					closeConn(c.Conn, CloseTooSlow, reason)
+				} else {
+					c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+					c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
+				}
+				return
+			}
+
+		case <-ping.C:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+
+		case expiresAt := <-c.renew:
+			if !expiry.Stop() {
+				select {
+				case <-expiry.C:
+				default:
+				}
+			}
+			c.expiresAt = expiresAt
+			expiry.Reset(time.Until(expiresAt))
 
-		if err := c.Conn.WriteMessage(websocket.TextMessage, message); err != nil {
+		case <-expiry.C:
+			log.Printf("Closing socket for user=%s: token expired", c.UserID)
+			closeConn(c.Conn, CloseTokenExpired, "token expired")
 			return
 		}
 	}
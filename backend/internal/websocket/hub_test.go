@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kaori/backend/internal/eventbus"
+	"github.com/kaori/backend/internal/events"
+)
+
+const testStore = "store-1"
+
+func startHub(t *testing.T, opts HubOptions) *Hub {
+	t.Helper()
+	hub := NewHub(eventbus.NewLocal(), opts)
+	go hub.Run()
+	return hub
+}
+
+// register adds a client without a socket; its queue is read directly
+func register(hub *Hub, userID string) (*Client, error) {
+	identity := Identity{UserID: userID, Role: "cashier", StoreID: testStore, ExpiresAt: time.Now().Add(time.Hour)}
+	client, err := newClient(hub, nil, nil, identity, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return client, hub.register(client, nil)
+}
+
+func connect(t *testing.T, hub *Hub, userID string) *Client {
+	t.Helper()
+	client, err := register(hub, userID)
+	if err != nil {
+		t.Fatalf("register %s: %v", userID, err)
+	}
+	return client
+}
+
+func publish(hub *Hub, n int) {
+	for i := 0; i < n; i++ {
+		hub.Publish(ToStore(testStore), events.OrderCancelled{OrderID: fmt.Sprintf("order-%d", i)})
+	}
+}
+
+// waitFor polls the hub's stats until ok accepts them
+func waitFor(t *testing.T, hub *Hub, ok func(Stats) bool) Stats {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s := hub.Stats()
+		if ok(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hub never got there: %+v", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHubConcurrentRegisterPublishUnregister(t *testing.T) {
+	hub := startHub(t, HubOptions{QueueSize: 64})
+
+	const clients, perClient = 20, 10
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := register(hub, fmt.Sprintf("user-%d", i))
+			if err != nil {
+				t.Errorf("register: %v", err)
+				return
+			}
+			publish(hub, perClient)
+			hub.Stats()
+			client.queue.take()
+			hub.unregister <- client
+		}(i)
+	}
+	wg.Wait()
+
+	s := waitFor(t, hub, func(s Stats) bool { return s.Published == clients*perClient })
+	if s.Clients != 0 {
+		t.Errorf("clients = %d after all unregistered, want 0", s.Clients)
+	}
+	if s.Queued != 0 {
+		t.Errorf("queued = %d with no clients, want 0", s.Queued)
+	}
+}
+
+func TestSlowClientDropOldest(t *testing.T) {
+	hub := startHub(t, HubOptions{QueueSize: 4, SlowClientPolicy: PolicyDropOldest})
+	client := connect(t, hub, "slow")
+
+	// auth_ok plus 10 events through a queue of 4
+	publish(hub, 10)
+	s := waitFor(t, hub, func(s Stats) bool { return s.Published == 10 })
+
+	if s.Clients != 1 {
+		t.Fatalf("clients = %d, want the slow client kept", s.Clients)
+	}
+	if s.Queued != 4 || s.MaxQueued != 4 {
+		t.Errorf("queued = %d, max %d, want 4 and 4", s.Queued, s.MaxQueued)
+	}
+	if s.Dropped != 7 {
+		t.Errorf("dropped = %d, want 7", s.Dropped)
+	}
+	if s.SlowDisconnects != 0 {
+		t.Errorf("slow disconnects = %d, want 0", s.SlowDisconnects)
+	}
+
+	items, behind, closed := client.queue.take()
+	if len(items) != 4 || !behind || closed {
+		t.Errorf("take = %d items, behind %v, closed %v; want the 4 newest, behind, open", len(items), behind, closed)
+	}
+
+	// Dropped messages are still counted once the client has gone
+	hub.unregister <- client
+	s = waitFor(t, hub, func(s Stats) bool { return s.Clients == 0 })
+	if s.Dropped != 7 || s.Queued != 0 {
+		t.Errorf("after disconnect dropped = %d, queued = %d; want 7 and 0", s.Dropped, s.Queued)
+	}
+}
+
+func TestSlowClientDisconnect(t *testing.T) {
+	hub := startHub(t, HubOptions{QueueSize: 4, SlowClientPolicy: PolicyDisconnect})
+	client := connect(t, hub, "slow")
+	fast := connect(t, hub, "fast")
+
+	// auth_ok plus 3 events fill the queue; the 4th event is one too many
+	publish(hub, 3)
+	waitFor(t, hub, func(s Stats) bool { return s.Published == 3 })
+	fast.queue.take()
+	publish(hub, 1)
+	s := waitFor(t, hub, func(s Stats) bool { return s.Published == 4 })
+
+	if s.SlowDisconnects != 1 || s.Clients != 1 {
+		t.Errorf("clients = %d, slow disconnects = %d; want only the slow client gone", s.Clients, s.SlowDisconnects)
+	}
+	if s.Dropped != 0 {
+		t.Errorf("dropped = %d, want 0: disconnecting drops nothing", s.Dropped)
+	}
+
+	items, _, closed := client.queue.take()
+	if len(items) != 4 || !closed {
+		t.Errorf("take = %d items, closed %v; want what was queued, then closed", len(items), closed)
+	}
+	if reason := client.queue.closeReason(); reason != "too slow" {
+		t.Errorf("close reason = %q, want %q", reason, "too slow")
+	}
+
+	// Publishing after the disconnect doesn't touch the closed queue
+	publish(hub, 1)
+	waitFor(t, hub, func(s Stats) bool { return s.Published == 5 })
+	if items, _, _ := client.queue.take(); len(items) != 0 {
+		t.Errorf("closed queue got %d more messages", len(items))
+	}
+}
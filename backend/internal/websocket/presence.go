@@ -0,0 +1,155 @@
+package websocket
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kaori/backend/internal/events"
+)
+
+const (
+	// presenceInterval is how often stores are checked for a kitchen display
+	presenceInterval = 30 * time.Second
+
+	// kitchenOfflineGrace lets a display reconnect before anyone is alerted
+	kitchenOfflineGrace = 2 * time.Minute
+)
+
+// Device is a connected client as shown in the store's presence list
+type Device struct {
+	UserID         string    `json:"user_id,omitempty"`
+	Role           string    `json:"role"`
+	Name           string    `json:"name,omitempty"`
+	Topics         []string  `json:"topics"`
+	KitchenDisplay bool      `json:"kitchen_display"`
+	ConnectedAt    time.Time `json:"connected_at"`
+	LastSeen       time.Time `json:"last_seen"`
+	Queued         int       `json:"queued"`  // messages waiting to be sent to it
+	Dropped        uint64    `json:"dropped"` // messages dropped because it fell behind
+}
+
+// isKitchenDisplay reports whether a client shows the kitchen queue: signed in
+// as kitchen staff, or following a kitchen station
+func (c *Client) isKitchenDisplay() bool {
+	if c.Role == "kitchen" {
+		return true
+	}
+	for _, t := range c.Topics() {
+		if strings.HasPrefix(t, "station:") {
+			return true
+		}
+	}
+	return false
+}
+
+// seen records that the client is still there
+func (c *Client) seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// Online lists the devices connected to a store, longest connected first.
+// Customer tracking pages aren't devices and are left out.
+func (h *Hub) Online(storeID string) []Device {
+	devices := []Device{}
+	h.do(func() {
+		for client := range h.clients {
+			if client.StoreID != storeID || client.orderID != "" {
+				continue
+			}
+			queued, dropped := client.queue.depth()
+			devices = append(devices, Device{
+				UserID:         client.UserID,
+				Role:           client.Role,
+				Name:           client.Device,
+				Topics:         client.Topics(),
+				KitchenDisplay: client.isKitchenDisplay(),
+				ConnectedAt:    client.connectedAt,
+				LastSeen:       time.Unix(0, client.lastSeen.Load()),
+				Queued:         queued,
+				Dropped:        dropped,
+			})
+		}
+	})
+	sort.Slice(devices, func(i, j int) bool { return devices[i].ConnectedAt.Before(devices[j].ConnectedAt) })
+	return devices
+}
+
+// KitchenDisplaysOnline counts a store's connected kitchen displays
+func (h *Hub) KitchenDisplaysOnline(storeID string) int {
+	n := 0
+	for _, d := range h.Online(storeID) {
+		if d.KitchenDisplay {
+			n++
+		}
+	}
+	return n
+}
+
+// PresenceWatcher alerts a store's cashiers and managers when no kitchen display
+// has been online for a while during opening hours, and again when one is back
+type PresenceWatcher struct {
+	hub    *Hub
+	stores func() []string
+	isOpen func(storeID string, now time.Time) bool
+
+	offlineSince map[string]time.Time
+	alerted      map[string]bool
+}
+
+// NewPresenceWatcher creates a watcher for the stores listed by stores, which
+// are expected to have a kitchen display online whenever isOpen says so
+func NewPresenceWatcher(hub *Hub, stores func() []string, isOpen func(storeID string, now time.Time) bool) *PresenceWatcher {
+	return &PresenceWatcher{
+		hub:          hub,
+		stores:       stores,
+		isOpen:       isOpen,
+		offlineSince: make(map[string]time.Time),
+		alerted:      make(map[string]bool),
+	}
+}
+
+// Run checks every store until ctx is cancelled
+func (w *PresenceWatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, storeID := range w.stores() {
+				w.check(storeID, now)
+			}
+		}
+	}
+}
+
+func (w *PresenceWatcher) check(storeID string, now time.Time) {
+	open := w.isOpen(storeID, now)
+	if !open || w.hub.KitchenDisplaysOnline(storeID) > 0 {
+		delete(w.offlineSince, storeID)
+		if w.alerted[storeID] {
+			delete(w.alerted, storeID)
+			w.hub.Publish(ToRoles(storeID, "cashier", "store_admin", "super_admin"), events.KitchenOnline{StoreOpen: open})
+		}
+		return
+	}
+
+	since, ok := w.offlineSince[storeID]
+	if !ok {
+		w.offlineSince[storeID] = now
+		return
+	}
+	if w.alerted[storeID] || now.Sub(since) < kitchenOfflineGrace {
+		return
+	}
+	w.alerted[storeID] = true
+	log.Printf("Store %s is open with no kitchen display online since %s", storeID, since.Format(time.RFC3339))
+	w.hub.Publish(ToRoles(storeID, "cashier", "store_admin", "super_admin"), events.KitchenOffline{
+		OfflineSince: since,
+		Message:      "No kitchen display is online. New orders won't be seen in the kitchen.",
+	})
+}
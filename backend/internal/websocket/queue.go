@@ -0,0 +1,150 @@
+package websocket
+
+import (
+	"sync"
+)
+
+// What happens when a client's queue is full
+const (
+	// PolicyDropOldest drops the oldest queued message and tells the client to
+	// resync once it catches up
+	PolicyDropOldest = "drop_oldest"
+
+	// PolicyDisconnect closes the connection; the client reconnects with its
+	// last_seq and has what it missed replayed
+	PolicyDisconnect = "disconnect"
+)
+
+// DefaultQueueSize is how many messages may wait for a client by default
+const DefaultQueueSize = 256
+
+// sendQueue holds the messages waiting to be written to one client. The hub
+// pushes and closes it; the client's writer takes from it.
+type sendQueue struct {
+	mu      sync.Mutex
+	items   [][]byte
+	size    int
+	policy  string
+	closed  bool
+	reason  string // why the hub closed the queue, if it was the hub
+	dropped uint64
+	behind  bool // messages were dropped since the writer last took any
+
+	ready chan struct{} // signalled when there is something to take
+}
+
+func newSendQueue(size int, policy string) *sendQueue {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+	return &sendQueue{size: size, policy: policy, ready: make(chan struct{}, 1)}
+}
+
+// push queues a message. It reports false if the queue is full and the client
+// should be disconnected.
+func (q *sendQueue) push(data []byte) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return true
+	}
+	if len(q.items) >= q.size {
+		if q.policy == PolicyDisconnect {
+			return false
+		}
+		q.items = q.items[1:]
+		q.dropped++
+		q.behind = true
+	}
+	q.items = append(q.items, data)
+	q.signal()
+	return true
+}
+
+// take returns everything queued, whether messages were dropped since the last
+// take, and whether the queue is closed: the writer sends what it got and stops.
+func (q *sendQueue) take() (items [][]byte, behind bool, closed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	items, behind = q.items, q.behind
+	q.items, q.behind = nil, false
+	return items, behind, q.closed
+}
+
+// close stops the queue; the writer finishes what is queued and then sees it
+// closed. Closing twice is harmless.
+func (q *sendQueue) close(reason string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed, q.reason = true, reason
+	q.signal()
+}
+
+// closeReason is why the hub closed the queue, empty if it is still open or
+// the client went away by itself
+func (q *sendQueue) closeReason() string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.reason
+}
+
+func (q *sendQueue) depth() (queued int, dropped uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items), q.dropped
+}
+
+func (q *sendQueue) free() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size - len(q.items)
+}
+
+// signal wakes the writer. Callers hold q.mu.
+func (q *sendQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Stats describes the hub's clients and how well they keep up
+type Stats struct {
+	Clients          int    `json:"clients"`
+	QueueSize        int    `json:"queue_size"`
+	SlowClientPolicy string `json:"slow_client_policy"`
+	Queued           int    `json:"queued"`           // messages waiting, across all clients
+	MaxQueued        int    `json:"max_queued"`       // the longest queue
+	Pending          int    `json:"pending"`          // events from the bus not yet handed to clients
+	Published        uint64 `json:"published"`        // events delivered since the server started
+	Dropped          uint64 `json:"dropped"`          // messages dropped from full queues
+	SlowDisconnects  uint64 `json:"slow_disconnects"` // clients closed for falling behind
+}
+
+// Stats reports queue depths and dropped messages for this instance
+func (h *Hub) Stats() Stats {
+	var s Stats
+	h.do(func() {
+		s = Stats{
+			Clients:          len(h.clients),
+			QueueSize:        h.queueSize,
+			SlowClientPolicy: h.policy,
+			Pending:          len(h.events),
+			Published:        h.published,
+			Dropped:          h.dropped,
+			SlowDisconnects:  h.slowDisconnects,
+		}
+		for client := range h.clients {
+			queued, dropped := client.queue.depth()
+			s.Queued += queued
+			s.Dropped += dropped
+			if queued > s.MaxQueued {
+				s.MaxQueued = queued
+			}
+		}
+	})
+	return s
+}
@@ -0,0 +1,153 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"strconv"
+)
+
+// replayBufferSize is how many recent events are kept per store for clients
+// that reconnect. Anyone further behind has to reload from the REST API.
+const replayBufferSize = 500
+
+// MessageTypeResync tells a reconnecting client it missed more than can be
+// replayed and must reload its state from the REST API
+const MessageTypeResync = "resync_required"
+
+// event is a published message kept for replay
+type event struct {
+	seq    uint64
+	topics []string
+	data   []byte
+}
+
+// storeStream numbers a store's events and remembers the most recent ones
+type storeStream struct {
+	seq    uint64
+	events []event // oldest first
+}
+
+// append numbers a message and keeps it for replay
+func (s *storeStream) append(topics []string, msg Message) ([]byte, error) {
+	msg.Seq = s.seq + 1
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	s.seq = msg.Seq
+	if len(s.events) == replayBufferSize {
+		copy(s.events, s.events[1:])
+		s.events = s.events[:len(s.events)-1]
+	}
+	s.events = append(s.events, event{seq: s.seq, topics: topics, data: data})
+	return data, nil
+}
+
+// since returns the events after lastSeq, or false if some were already dropped
+func (s *storeStream) since(lastSeq uint64) ([]event, bool) {
+	if lastSeq >= s.seq {
+		return nil, true
+	}
+	if len(s.events) == 0 || s.events[0].seq > lastSeq+1 {
+		return nil, false
+	}
+	return s.events[lastSeq+1-s.events[0].seq:], true
+}
+
+// Resume is where a reconnecting client left off: the stream it was reading
+// and the last sequence number it saw
+type Resume struct {
+	Stream  string
+	LastSeq uint64
+}
+
+// parseResume reads ?stream=&last_seq= from a reconnecting client
+func parseResume(stream, lastSeq string) *Resume {
+	if lastSeq == "" {
+		return nil
+	}
+	seq, err := strconv.ParseUint(lastSeq, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &Resume{Stream: stream, LastSeq: seq}
+}
+
+func newStreamID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Printf("Could not generate stream ID: %v", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// stream returns a store's event stream. Runs on the hub's goroutine.
+func (h *Hub) stream(storeID string) *storeStream {
+	s := h.streams[storeID]
+	if s == nil {
+		s = &storeStream{}
+		h.streams[storeID] = s
+	}
+	return s
+}
+
+// replay queues the events a reconnecting client missed on its topics, or a
+// resync signal if they can't all be replayed. Runs on the hub's goroutine
+// before the client is added, so nothing is published in between.
+func (h *Hub) replay(client *Client, from *Resume) {
+	s := h.stream(client.StoreID)
+	if from == nil {
+		return
+	}
+
+	reason := ""
+	var missed []event
+	if from.Stream == "" && from.LastSeq > 0 {
+		// Sequence numbers mean nothing without the stream that gave them out
+		reason = "stream missing"
+	} else if (from.Stream != "" && from.Stream != h.streamID) || from.LastSeq > s.seq {
+		reason = "server restarted"
+	} else if events, ok := s.since(from.LastSeq); !ok {
+		reason = "too far behind"
+	} else {
+		for _, e := range events {
+			if client.subscribedToAny(e.topics) {
+				missed = append(missed, e)
+			}
+		}
+		// Leave room in the send queue for live messages
+		if len(missed) > client.queue.free()/2 {
+			reason = "too far behind"
+		}
+	}
+
+	if reason != "" {
+		data, _ := json.Marshal(Message{
+			Type:    MessageTypeResync,
+			StoreID: client.StoreID,
+			Payload: map[string]interface{}{"seq": s.seq, "stream": h.streamID, "reason": reason},
+		})
+		client.queue.push(data)
+		log.Printf("Client user=%s must resync from seq %d: %s", client.UserID, from.LastSeq, reason)
+		return
+	}
+	for _, e := range missed {
+		client.queue.push(e.data)
+	}
+	if len(missed) > 0 {
+		log.Printf("Replayed %d event(s) to user=%s from seq %d", len(missed), client.UserID, from.LastSeq)
+	}
+}
+
+// resyncMessage tells a client whose queue overflowed that messages were
+// dropped and it should reload its state
+func (c *Client) resyncMessage(reason string) []byte {
+	data, _ := json.Marshal(Message{
+		Type:    MessageTypeResync,
+		StoreID: c.StoreID,
+		Payload: map[string]interface{}{"reason": reason},
+	})
+	return data
+}
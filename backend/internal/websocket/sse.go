@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServeSSE streams hub events as Server-Sent Events, for browsers and proxies
+// where WebSockets don't work. Subscribers are authenticated like sockets (a
+// ticket, or a Bearer token), are ordinary hub clients on the topics in
+// ?topics=, and resume from the Last-Event-ID header (or ?last_event_id=) after
+// reconnecting. The stream ends when the access token expires.
+func ServeSSE(hub *Hub, auth *Authenticator, w http.ResponseWriter, r *http.Request) {
+	identity, err := auth.requestIdentity(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var topics []string
+	if t := r.URL.Query().Get("topics"); t != "" {
+		topics = strings.Split(t, ",")
+	}
+	client, err := newClient(hub, auth, nil, identity, r.URL.Query().Get("store_id"), r.URL.Query().Get("device"), topics)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+
+	rc := http.NewResponseController(w)
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // stop nginx from holding events back
+	w.WriteHeader(http.StatusOK)
+
+	if err := hub.register(client, parseEventID(lastEventID)); err != nil {
+		log.Printf("SSE register error: %v", err)
+		return
+	}
+	defer func() { hub.unregister <- client }()
+
+	// Ask the browser to wait a little before reconnecting
+	fmt.Fprint(w, "retry: 3000\n\n")
+	rc.Flush()
+
+	ping := time.NewTicker(pingPeriod)
+	expiry := time.NewTimer(time.Until(client.expiresAt))
+	defer func() {
+		ping.Stop()
+		expiry.Stop()
+	}()
+
+	for {
+		var event []byte
+		closed := false
+		select {
+		case <-r.Context().Done():
+			return
+		case <-client.queue.ready:
+			var messages [][]byte
+			var behind bool
+			messages, behind, closed = client.queue.take()
+			for _, message := range messages {
+				event = append(event, formatEvent(hub.streamID, message)...)
+			}
+			if behind {
+				event = append(event, formatEvent("", client.resyncMessage("fell behind"))...)
+			}
+		case <-ping.C:
+			event = []byte(": ping\n\n")
+		case <-expiry.C:
+			data, _ := json.Marshal(Message{Type: "token_expired", StoreID: client.StoreID})
+			rc.SetWriteDeadline(time.Now().Add(writeWait))
+			w.Write(formatEvent("", data))
+			rc.Flush()
+			return
+		}
+
+		rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := w.Write(event); err != nil {
+			return
+		}
+		if err := rc.Flush(); err != nil || closed {
+			return // closed by the hub for falling behind; the browser reconnects
+		}
+		client.seen()
+	}
+}
+
+// formatEvent turns a message into an SSE event. Numbered messages get an id of
+// stream-seq, which the browser sends back as Last-Event-ID when it reconnects.
+func formatEvent(stream string, message []byte) []byte {
+	var numbered struct {
+		Seq uint64 `json:"seq"`
+	}
+	var b strings.Builder
+	if json.Unmarshal(message, &numbered) == nil && numbered.Seq > 0 && stream != "" {
+		fmt.Fprintf(&b, "id: %s-%d\n", stream, numbered.Seq)
+	}
+	fmt.Fprintf(&b, "data: %s\n\n", message)
+	return []byte(b.String())
+}
+
+// parseEventID reads a Last-Event-ID of stream-seq
+func parseEventID(id string) *Resume {
+	stream, seq, ok := strings.Cut(id, "-")
+	if !ok {
+		return nil
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return nil
+	}
+	return &Resume{Stream: stream, LastSeq: n}
+}
@@ -0,0 +1,122 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxTopics caps how many topics one client may follow
+const maxTopics = 50
+
+var topicName = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// defaultTopics are what a client follows on connecting: its store and role, or
+// for a customer tracking page, just its order
+func (c *Client) defaultTopics() map[string]bool {
+	if c.orderID != "" {
+		return map[string]bool{OrderTopic(c.orderID): true}
+	}
+	return map[string]bool{TopicStore: true, RoleTopic(c.Role): true}
+}
+
+// Topics lists the client's subscriptions
+func (c *Client) Topics() []string {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	topics := make([]string, 0, len(c.topics))
+	for t := range c.topics {
+		topics = append(topics, t)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+func (c *Client) subscribedToAny(topics []string) bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	for _, t := range topics {
+		if c.topics[t] {
+			return true
+		}
+	}
+	return false
+}
+
+// changeTopics subscribes to or unsubscribes from topics, all or nothing. Staff
+// may follow their store, their own role (managers any role), any kitchen
+// station and any order; everything they receive is still limited to their store.
+func (c *Client) changeTopics(subscribe bool, topics []string) error {
+	if c.orderID != "" {
+		return fmt.Errorf("order tracking connections follow a single order")
+	}
+	for _, t := range topics {
+		if err := c.checkTopic(t); err != nil {
+			return err
+		}
+	}
+
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	next := make(map[string]bool, len(c.topics))
+	for t := range c.topics {
+		next[t] = true
+	}
+	for _, t := range topics {
+		if subscribe {
+			next[t] = true
+		} else {
+			delete(next, t)
+		}
+	}
+	if len(next) > maxTopics {
+		return fmt.Errorf("at most %d topics per connection", maxTopics)
+	}
+	c.topics = next
+	return nil
+}
+
+// setTopics replaces the default topics with the ones a client asked for when
+// connecting, so a reconnecting station display gets its station's missed events
+func (c *Client) setTopics(topics []string) error {
+	if len(topics) == 0 {
+		return nil
+	}
+	if err := c.changeTopics(false, c.Topics()); err != nil {
+		return err
+	}
+	return c.changeTopics(true, topics)
+}
+
+func (c *Client) checkTopic(topic string) error {
+	if topic == TopicStore {
+		return nil
+	}
+	kind, name, ok := strings.Cut(topic, ":")
+	if !ok || !topicName.MatchString(name) {
+		return fmt.Errorf("invalid topic %q", topic)
+	}
+	switch kind {
+	case "role":
+		if name != c.Role && c.Role != "store_admin" && c.Role != "super_admin" {
+			return fmt.Errorf("cannot subscribe to another role's topic %q", topic)
+		}
+	case "station", "order":
+	default:
+		return fmt.Errorf("unknown topic %q: use store, role:<role>, station:<station> or order:<id>", topic)
+	}
+	return nil
+}
+
+// reply sends a message to this client only
+func (c *Client) reply(messageType string, payload interface{}) {
+	data, err := json.Marshal(Message{Type: messageType, Payload: payload, StoreID: c.StoreID})
+	if err != nil {
+		log.Printf("Error marshaling %s reply: %v", messageType, err)
+		return
+	}
+	c.Hub.sendTo(c, data)
+}
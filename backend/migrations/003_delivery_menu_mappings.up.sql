@@ -0,0 +1,60 @@
+-- 003_delivery_menu_mappings.up.sql
+-- Map delivery platform menu entries to our catalog
+
+-- ============================================
+-- DELIVERY MENU MAPPINGS
+-- ============================================
+CREATE TYPE menu_mapping_kind AS ENUM ('item', 'variant', 'modifier');
+
+CREATE TABLE IF NOT EXISTS delivery_menu_mappings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    store_id UUID REFERENCES stores(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    kind menu_mapping_kind NOT NULL DEFAULT 'item',
+    external_id VARCHAR(255),
+    external_name VARCHAR(255),
+    product_id UUID REFERENCES products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES product_variants(id) ON DELETE CASCADE,
+    modifier_id UUID REFERENCES product_modifiers(id) ON DELETE CASCADE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (external_id IS NOT NULL OR external_name IS NOT NULL)
+);
+
+-- ============================================
+-- UNMAPPED DELIVERY ITEMS (admin queue)
+-- ============================================
+CREATE TYPE unmapped_item_status AS ENUM ('open', 'resolved', 'ignored');
+
+CREATE TABLE IF NOT EXISTS delivery_unmapped_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    store_id UUID REFERENCES stores(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    kind menu_mapping_kind NOT NULL DEFAULT 'item',
+    external_id VARCHAR(255),
+    external_name VARCHAR(255) NOT NULL,
+    product_id UUID REFERENCES products(id) ON DELETE CASCADE,
+    occurrences INTEGER NOT NULL DEFAULT 1,
+    order_ids UUID[] NOT NULL DEFAULT '{}',
+    status unmapped_item_status NOT NULL DEFAULT 'open',
+    mapping_id UUID REFERENCES delivery_menu_mappings(id) ON DELETE SET NULL,
+    first_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Delivery items keep the platform's identifiers alongside our catalog IDs,
+-- and may have no product until an admin maps them
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS external_item_id VARCHAR(255);
+ALTER TABLE order_items ALTER COLUMN product_id DROP NOT NULL;
+
+-- ============================================
+-- INDEXES
+-- ============================================
+CREATE INDEX IF NOT EXISTS idx_delivery_menu_mappings_lookup ON delivery_menu_mappings(platform, kind, external_id);
+CREATE INDEX IF NOT EXISTS idx_delivery_menu_mappings_name ON delivery_menu_mappings(platform, kind, lower(external_name));
+CREATE INDEX IF NOT EXISTS idx_delivery_unmapped_items_status ON delivery_unmapped_items(status, platform);
+
+CREATE TRIGGER update_delivery_menu_mappings_updated_at
+    BEFORE UPDATE ON delivery_menu_mappings
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
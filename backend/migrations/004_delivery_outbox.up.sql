@@ -0,0 +1,31 @@
+-- 004_delivery_outbox.up.sql
+-- Queue of order status updates pushed to delivery platforms
+
+-- ============================================
+-- DELIVERY OUTBOX
+-- ============================================
+CREATE TYPE delivery_push_event AS ENUM ('accepted', 'rejected', 'ready', 'cancelled');
+CREATE TYPE outbox_job_status AS ENUM ('pending', 'delivered', 'dead');
+
+CREATE TABLE IF NOT EXISTS delivery_outbox (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    platform VARCHAR(50) NOT NULL,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    external_order_id VARCHAR(255) NOT NULL,
+    event delivery_push_event NOT NULL,
+    reason TEXT,
+    status outbox_job_status NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_delivery_outbox_due ON delivery_outbox(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_delivery_outbox_order_id ON delivery_outbox(order_id);
+
+CREATE TRIGGER update_delivery_outbox_updated_at
+    BEFORE UPDATE ON delivery_outbox
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,31 @@
+-- 005_delivery_acceptance_rules.up.sql
+-- Per-store, per-platform rules for accepting delivery orders
+
+-- ============================================
+-- DELIVERY RULES
+-- ============================================
+CREATE TABLE IF NOT EXISTS delivery_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    auto_accept_during_hours BOOLEAN NOT NULL DEFAULT false,
+    opens_at TIME NOT NULL DEFAULT '08:00',
+    closes_at TIME NOT NULL DEFAULT '22:00',
+    auto_accept_max_total DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    auto_reject_out_of_stock BOOLEAN NOT NULL DEFAULT false,
+    accept_timeout_seconds INTEGER NOT NULL DEFAULT 300,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(store_id, platform)
+);
+
+-- Pending delivery orders are cancelled by the platform after this deadline
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS accept_deadline TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS status_reason VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_orders_accept_deadline ON orders(accept_deadline) WHERE status = 'pending';
+
+CREATE TRIGGER update_delivery_rules_updated_at
+    BEFORE UPDATE ON delivery_rules
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,65 @@
+-- 006_delivery_commissions.up.sql
+-- Delivery platform commissions, per-order net payout and settlement reconciliation
+
+-- ============================================
+-- COMMISSION SETTINGS
+-- ============================================
+CREATE TABLE IF NOT EXISTS delivery_commission_settings (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    platform VARCHAR(50) NOT NULL,
+    rate_percent DECIMAL(5, 2) NOT NULL DEFAULT 0,
+    fixed_fee DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    effective_from DATE NOT NULL,
+    effective_to DATE, -- NULL = still in effect
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_commission_settings_platform ON delivery_commission_settings(platform, effective_from);
+
+-- ============================================
+-- ORDER PAYOUT
+-- ============================================
+-- Gross is the platform-reported total; net = gross - merchant_promo - commission
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_gross DECIMAL(15, 2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS merchant_promo DECIMAL(15, 2) DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS platform_promo DECIMAL(15, 2) DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS commission DECIMAL(15, 2) DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS payout_net DECIMAL(15, 2);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS commission_setting_id UUID REFERENCES delivery_commission_settings(id);
+
+-- ============================================
+-- SETTLEMENT IMPORTS
+-- ============================================
+CREATE TABLE IF NOT EXISTS settlement_imports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    platform VARCHAR(50) NOT NULL,
+    file_name VARCHAR(255),
+    period_from DATE NOT NULL,
+    period_to DATE NOT NULL,
+    rows_total INTEGER NOT NULL DEFAULT 0,
+    matched INTEGER NOT NULL DEFAULT 0,
+    mismatched INTEGER NOT NULL DEFAULT 0,
+    missing_orders INTEGER NOT NULL DEFAULT 0,
+    missing_in_settlement INTEGER NOT NULL DEFAULT 0,
+    settled_net DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    expected_net DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    imported_by UUID REFERENCES users(id),
+    imported_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS settlement_rows (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    import_id UUID NOT NULL REFERENCES settlement_imports(id) ON DELETE CASCADE,
+    external_order_id VARCHAR(100) NOT NULL,
+    order_id UUID REFERENCES orders(id),
+    gross DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    commission DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    promo DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    net DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    expected_net DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    status VARCHAR(30) NOT NULL, -- matched, mismatch, missing_order, missing_in_settlement
+    note TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_settlement_rows_import ON settlement_rows(import_id, status);
+CREATE INDEX IF NOT EXISTS idx_settlement_rows_order ON settlement_rows(order_id);
@@ -0,0 +1,45 @@
+-- 007_delivery_menu_sync.up.sql
+-- Menu state pushed to each delivery platform, and store pauses
+
+-- ============================================
+-- PLATFORM MENU STATE
+-- ============================================
+-- What each platform last accepted; the pending diff is the catalog minus this
+CREATE TABLE IF NOT EXISTS delivery_menu_state (
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    external_id VARCHAR(100) NOT NULL,
+    product_id UUID REFERENCES products(id) ON DELETE SET NULL,
+    name VARCHAR(255) NOT NULL,
+    price DECIMAL(15, 2) NOT NULL,
+    is_available BOOLEAN NOT NULL,
+    pushed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (store_id, platform, external_id)
+);
+
+CREATE TABLE IF NOT EXISTS delivery_menu_sync (
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    platform VARCHAR(50) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    failed BOOLEAN NOT NULL DEFAULT false, -- rejected by the platform, waiting for a forced sync
+    last_synced_at TIMESTAMP,
+    next_attempt_at TIMESTAMP,
+    PRIMARY KEY (store_id, platform)
+);
+
+-- ============================================
+-- DELIVERY PAUSE
+-- ============================================
+CREATE TABLE IF NOT EXISTS delivery_pauses (
+    store_id UUID PRIMARY KEY REFERENCES stores(id) ON DELETE CASCADE,
+    paused BOOLEAN NOT NULL DEFAULT false,
+    reason VARCHAR(255),
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_delivery_pauses_updated_at
+    BEFORE UPDATE ON delivery_pauses
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,31 @@
+-- 008_webhook_events.up.sql
+-- Raw inbound webhook payloads, kept for debugging and platform disputes
+
+-- ============================================
+-- WEBHOOK EVENTS
+-- ============================================
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    platform VARCHAR(50) NOT NULL,
+    store_id UUID REFERENCES stores(id) ON DELETE SET NULL,
+    method VARCHAR(10) NOT NULL,
+    path VARCHAR(255) NOT NULL,
+    query TEXT,
+    headers JSONB NOT NULL DEFAULT '{}', -- Authorization and Cookie are redacted
+    body TEXT NOT NULL,
+    result VARCHAR(20) NOT NULL, -- processed, duplicate, rejected, failed
+    response_code INTEGER NOT NULL,
+    error TEXT,
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    replay_of UUID REFERENCES webhook_events(id) ON DELETE SET NULL,
+    replayed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_events_platform ON webhook_events(platform, received_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_events_order ON webhook_events(order_id);
+CREATE INDEX IF NOT EXISTS idx_webhook_events_expires ON webhook_events(expires_at);
+
+-- Platforms retry webhooks; one order per platform order ID
+CREATE UNIQUE INDEX IF NOT EXISTS idx_orders_external ON orders(order_source, external_order_id) WHERE external_order_id IS NOT NULL;
@@ -0,0 +1,28 @@
+-- 009_delivery_integrations.up.sql
+-- Delivery aggregators onboarded through a declarative field mapping
+
+-- ============================================
+-- INTEGRATIONS
+-- ============================================
+CREATE TABLE IF NOT EXISTS delivery_integrations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    slug VARCHAR(30) NOT NULL UNIQUE, -- webhook URL segment and order source
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE, -- the store its orders go to
+    name VARCHAR(100) NOT NULL,
+    format VARCHAR(10) NOT NULL DEFAULT 'yaml', -- yaml, json
+    mapping TEXT NOT NULL,
+    secret VARCHAR(255), -- expected X-Webhook-Token
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_delivery_integrations_updated_at
+    BEFORE UPDATE ON delivery_integrations
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- Integration slugs are order sources, so the source can no longer be a fixed enum
+ALTER TABLE orders ALTER COLUMN order_source DROP DEFAULT;
+ALTER TABLE orders ALTER COLUMN order_source TYPE VARCHAR(30) USING order_source::text;
+ALTER TABLE orders ALTER COLUMN order_source SET DEFAULT 'cashier';
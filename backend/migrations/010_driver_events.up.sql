@@ -0,0 +1,35 @@
+-- 010_driver_events.up.sql
+-- Driver progress on delivery orders and food-ready time for driver wait reporting
+
+-- ============================================
+-- ORDERS
+-- ============================================
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_name VARCHAR(100);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_phone VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_plate VARCHAR(20);
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_stage VARCHAR(20); -- assigned, arriving, arrived, picked_up, delivered
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_arrived_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS driver_picked_up_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS ready_at TIMESTAMP;
+
+-- ============================================
+-- DRIVER EVENTS
+-- ============================================
+CREATE TABLE IF NOT EXISTS order_driver_events (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    stage VARCHAR(20) NOT NULL,
+    driver_name VARCHAR(100),
+    driver_phone VARCHAR(20),
+    driver_plate VARCHAR(20),
+    occurred_at TIMESTAMP NOT NULL, -- per the platform
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (order_id, stage, occurred_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_driver_events_order ON order_driver_events(order_id);
+
+-- ============================================
+-- WEBHOOK EVENTS
+-- ============================================
+ALTER TABLE webhook_events ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'order'; -- order, driver
@@ -0,0 +1,36 @@
+-- 011_platform_cancellations.up.sql
+-- Orders cancelled or changed on the delivery platform's side
+
+-- ============================================
+-- CANCELLATIONS
+-- ============================================
+CREATE TABLE IF NOT EXISTS order_cancellations (
+    order_id UUID PRIMARY KEY REFERENCES orders(id) ON DELETE CASCADE,
+    cancelled_by VARCHAR(20) NOT NULL, -- customer, platform, driver, merchant
+    reason TEXT,
+    status_at_cancel VARCHAR(20) NOT NULL,
+    food_made BOOLEAN NOT NULL DEFAULT false,
+    cost_bearer VARCHAR(20) NOT NULL, -- none, platform, merchant
+    food_value INTEGER NOT NULL DEFAULT 0,
+    compensation INTEGER NOT NULL DEFAULT 0, -- what the platform said it will pay
+    cancelled_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_cancellations_bearer ON order_cancellations(cost_bearer);
+
+-- ============================================
+-- MODIFICATIONS
+-- ============================================
+CREATE TABLE IF NOT EXISTS order_modifications (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    reason TEXT,
+    changes JSONB NOT NULL, -- [{name, before, after}]
+    previous_total INTEGER NOT NULL,
+    total INTEGER NOT NULL,
+    modified_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_modifications_order ON order_modifications(order_id);
@@ -0,0 +1,7 @@
+-- 012_kitchen_stations.up.sql
+-- Kitchen station that prepares each category, for routing orders to station displays
+
+-- ============================================
+-- KITCHEN STATIONS
+-- ============================================
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS station VARCHAR(30); -- e.g. bar, kitchen, pastry
@@ -0,0 +1,8 @@
+-- 013_store_opening_hours.up.sql
+-- Store opening hours, used to alert when no kitchen display is online while open
+
+-- ============================================
+-- OPENING HOURS
+-- ============================================
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS opens_at TIME NOT NULL DEFAULT '08:00';
+ALTER TABLE stores ADD COLUMN IF NOT EXISTS closes_at TIME NOT NULL DEFAULT '22:00';
@@ -0,0 +1,9 @@
+-- 014_kitchen_progress.up.sql
+-- Kitchen acknowledgement of new orders and per-item ready times
+
+-- ============================================
+-- KITCHEN PROGRESS
+-- ============================================
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS acknowledged_at TIMESTAMP;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS acknowledged_by UUID REFERENCES users(id);
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS ready_at TIMESTAMP;
@@ -0,0 +1,13 @@
+-- 015_realtime_events.up.sql
+-- Real-time events too big for a NOTIFY payload, read by the other API instances
+
+-- ============================================
+-- REALTIME EVENTS
+-- ============================================
+CREATE TABLE IF NOT EXISTS realtime_events (
+    id BIGSERIAL PRIMARY KEY,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_realtime_events_created_at ON realtime_events(created_at);
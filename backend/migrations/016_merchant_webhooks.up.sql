@@ -0,0 +1,57 @@
+-- 016_merchant_webhooks.up.sql
+-- Webhook subscriptions for merchant systems and the log of what was sent to them
+
+-- ============================================
+-- WEBHOOK SUBSCRIPTIONS
+-- ============================================
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    url TEXT NOT NULL,
+    event_types TEXT[] NOT NULL, -- from the real-time event catalog, e.g. order.created
+    store_ids UUID[] NOT NULL DEFAULT '{}', -- empty for every store
+    secret VARCHAR(255) NOT NULL, -- HMAC-SHA256 key for X-Kaori-Signature
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at
+    BEFORE UPDATE ON webhook_subscriptions
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+-- ============================================
+-- WEBHOOK DELIVERIES
+-- ============================================
+CREATE TYPE webhook_delivery_status AS ENUM ('pending', 'delivered', 'failed');
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL, -- shared by every subscription's copy of an event, and by replays
+    event_type VARCHAR(50) NOT NULL,
+    store_id UUID REFERENCES stores(id) ON DELETE SET NULL,
+    url TEXT NOT NULL,
+    body JSONB NOT NULL,
+    status webhook_delivery_status NOT NULL DEFAULT 'pending',
+    attempts JSONB NOT NULL DEFAULT '[]', -- time, response code, error and duration of each try
+    response_code INTEGER,
+    last_error TEXT,
+    replay_of UUID REFERENCES webhook_deliveries(id) ON DELETE SET NULL,
+    replayed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_subscription ON webhook_deliveries(subscription_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_event ON webhook_deliveries(event_id);
+
+CREATE TRIGGER update_webhook_deliveries_updated_at
+    BEFORE UPDATE ON webhook_deliveries
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,32 @@
+-- 017_midtrans_payments.up.sql
+-- Payment provider details on payments, for Midtrans charges and their notifications
+
+-- ============================================
+-- PAYMENT STATUS
+-- ============================================
+ALTER TYPE payment_txn_status ADD VALUE IF NOT EXISTS 'expired';
+
+-- ============================================
+-- PAYMENTS
+-- ============================================
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS store_id UUID REFERENCES stores(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS provider VARCHAR(30) NOT NULL DEFAULT 'cash', -- cash, midtrans
+    ADD COLUMN IF NOT EXISTS provider_ref VARCHAR(50), -- the order_id Midtrans knows the charge by (midtrans_id is its transaction_id)
+    ADD COLUMN IF NOT EXISTS provider_status VARCHAR(30), -- transaction_status as Midtrans last reported it
+    ADD COLUMN IF NOT EXISTS channel VARCHAR(30), -- snap, or the Core API payment_type (qris, gopay, credit_card...)
+    ADD COLUMN IF NOT EXISTS snap_token VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS redirect_url TEXT,
+    ADD COLUMN IF NOT EXISTS qr_string TEXT,
+    ADD COLUMN IF NOT EXISTS deeplink_url TEXT,
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_provider_ref ON payments(provider, provider_ref) WHERE provider_ref IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_payments_pending ON payments(status, created_at) WHERE status = 'pending';
+
+CREATE TRIGGER update_payments_updated_at
+    BEFORE UPDATE ON payments
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
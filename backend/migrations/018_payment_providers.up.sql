@@ -0,0 +1,19 @@
+-- 018_payment_providers.up.sql
+-- Which payment provider each store uses per payment method
+
+-- ============================================
+-- PAYMENT ROUTES
+-- ============================================
+CREATE TABLE IF NOT EXISTS payment_routes (
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    method payment_method NOT NULL, -- qris, card, ewallet (cash never goes through a provider)
+    provider VARCHAR(30) NOT NULL, -- midtrans, edc, sandbox
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (store_id, method)
+);
+
+CREATE TRIGGER update_payment_routes_updated_at
+    BEFORE UPDATE ON payment_routes
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
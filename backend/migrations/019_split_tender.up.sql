@@ -0,0 +1,14 @@
+-- 019_split_tender.up.sql
+-- Several payments per order, with cash tendered and change kept per payment
+
+-- ============================================
+-- CASH TENDERED AND CHANGE
+-- ============================================
+-- amount is the part of the order's total a payment covers; for cash, the
+-- amount handed over and the change given back are kept alongside it
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS tendered DECIMAL(15, 2);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS change_given DECIMAL(15, 2);
+
+ALTER TABLE payments ADD CONSTRAINT payments_amount_positive CHECK (amount > 0);
+ALTER TABLE payments ADD CONSTRAINT payments_change_from_tendered
+    CHECK (change_given IS NULL OR tendered - amount = change_given);
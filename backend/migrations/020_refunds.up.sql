@@ -0,0 +1,54 @@
+-- 020_refunds.up.sql
+-- Full and partial refunds on payments, kept apart from order cancellations
+
+-- ============================================
+-- STATUSES
+-- ============================================
+ALTER TYPE payment_txn_status ADD VALUE IF NOT EXISTS 'refunded';
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'partially_refunded';
+ALTER TYPE payment_status ADD VALUE IF NOT EXISTS 'refunded';
+ALTER TYPE point_type ADD VALUE IF NOT EXISTS 'refund';
+
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS refunded DECIMAL(15, 2) NOT NULL DEFAULT 0;
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS refunded DECIMAL(15, 2) NOT NULL DEFAULT 0;
+ALTER TABLE order_items ADD COLUMN IF NOT EXISTS refunded_quantity INTEGER NOT NULL DEFAULT 0;
+
+-- ============================================
+-- REFUNDS
+-- ============================================
+CREATE TABLE IF NOT EXISTS refunds (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    store_id UUID REFERENCES stores(id) ON DELETE SET NULL,
+    provider VARCHAR(30) NOT NULL, -- as on the payment: cash, midtrans, edc, sandbox
+    amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL,
+    status payment_txn_status NOT NULL DEFAULT 'pending', -- pending, success, failed
+    transaction_id VARCHAR(255), -- the provider's reference, e.g. Midtrans refund_chargeback_id
+    manual BOOLEAN NOT NULL DEFAULT false, -- cash from the drawer, or a void on the EDC terminal
+    message TEXT,
+    points_reversed INTEGER NOT NULL DEFAULT 0, -- earned on the order and taken back
+    points_returned INTEGER NOT NULL DEFAULT 0, -- spent on the order and given back
+    requested_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    refund_id UUID NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    order_item_id UUID NOT NULL REFERENCES order_items(id) ON DELETE CASCADE,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    amount DECIMAL(15, 2) NOT NULL, -- with its share of tax and adjustments
+    PRIMARY KEY (refund_id, order_item_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_refunds_payment_id ON refunds(payment_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_store_created ON refunds(store_id, created_at);
+
+-- ============================================
+-- LOYALTY REVERSALS
+-- ============================================
+-- Points are taken back, and points spent given back, with 'refund' rows in
+-- member_points; a voucher used on a fully refunded order no longer counts
+ALTER TABLE voucher_usage ADD COLUMN IF NOT EXISTS reversed_at TIMESTAMP;
@@ -0,0 +1,26 @@
+-- 021_payment_reconciliation.up.sql
+-- Discrepancies found while reconciling payments with their providers, for daily review
+
+-- ============================================
+-- PAYMENT DISCREPANCIES
+-- ============================================
+CREATE TABLE IF NOT EXISTS payment_discrepancies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    payment_id UUID NOT NULL REFERENCES payments(id) ON DELETE CASCADE,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    store_id UUID REFERENCES stores(id) ON DELETE SET NULL,
+    provider VARCHAR(30) NOT NULL,
+    kind VARCHAR(30) NOT NULL, -- amount_mismatch, paid_after_expiry, paid_cancelled, status_unavailable, unknown_provider
+    detail TEXT NOT NULL,
+    ours DECIMAL(15, 2), -- amounts, for mismatches
+    theirs DECIMAL(15, 2),
+    found_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    reviewed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP,
+    resolution TEXT
+);
+
+-- One open discrepancy of a kind per payment
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_discrepancies_open
+    ON payment_discrepancies(payment_id, kind) WHERE reviewed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_payment_discrepancies_store_found ON payment_discrepancies(store_id, found_at);
@@ -0,0 +1,67 @@
+-- 022_cashier_shifts.up.sql
+-- Cashier shifts on cash drawers: opening float, paid in/out, blind count at close
+
+-- ============================================
+-- SHIFTS
+-- ============================================
+CREATE TYPE shift_status AS ENUM ('open', 'closed');
+
+CREATE TABLE IF NOT EXISTS shifts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    store_id UUID NOT NULL REFERENCES stores(id) ON DELETE CASCADE,
+    drawer_id VARCHAR(50) NOT NULL DEFAULT 'main',
+    cashier_id UUID NOT NULL REFERENCES users(id),
+    status shift_status DEFAULT 'open',
+    opening_float DECIMAL(15, 2) NOT NULL DEFAULT 0,
+    opened_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP,
+    closed_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    counted DECIMAL(15, 2),
+    expected DECIMAL(15, 2),
+    variance DECIMAL(15, 2), -- counted less expected: over when positive, short when negative
+    notes TEXT
+);
+
+-- One open shift per cashier and per drawer
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open_cashier ON shifts(cashier_id) WHERE status = 'open';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open_drawer ON shifts(store_id, drawer_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_shifts_store_opened ON shifts(store_id, opened_at);
+
+-- ============================================
+-- DRAWER ENTRIES
+-- ============================================
+CREATE TYPE drawer_entry_type AS ENUM ('paid_in', 'paid_out', 'cash_sale', 'cash_refund');
+
+CREATE TABLE IF NOT EXISTS drawer_entries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    shift_id UUID NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    type drawer_entry_type NOT NULL,
+    amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+    reason TEXT, -- required for paid in and paid out
+    order_id UUID REFERENCES orders(id) ON DELETE SET NULL,
+    payment_id UUID REFERENCES payments(id) ON DELETE SET NULL,
+    refund_id UUID REFERENCES refunds(id) ON DELETE SET NULL,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_drawer_entries_shift ON drawer_entries(shift_id);
+
+-- ============================================
+-- CLOSING COUNTS
+-- ============================================
+CREATE TABLE IF NOT EXISTS shift_counts (
+    shift_id UUID NOT NULL REFERENCES shifts(id) ON DELETE CASCADE,
+    denomination INTEGER NOT NULL, -- rupiah note or coin
+    quantity INTEGER NOT NULL CHECK (quantity >= 0),
+    PRIMARY KEY (shift_id, denomination)
+);
+
+-- ============================================
+-- PAYMENTS AND REFUNDS
+-- ============================================
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS shift_id UUID REFERENCES shifts(id) ON DELETE SET NULL;
+ALTER TABLE refunds ADD COLUMN IF NOT EXISTS shift_id UUID REFERENCES shifts(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_payments_shift ON payments(shift_id);
+CREATE INDEX IF NOT EXISTS idx_refunds_shift ON refunds(shift_id);